@@ -0,0 +1,86 @@
+package replaylog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var annotationPrefix = []byte(`{"note":`)
+
+// annotation is the frame written by Annotate.
+type annotation struct {
+	Note string `json:"note"`
+	Time int64  `json:"t,omitempty"`
+}
+
+// isAnnotation returns true if frame is an annotation written by Annotate.
+func isAnnotation(frame []byte) bool {
+	return bytes.HasPrefix(frame, annotationPrefix)
+}
+
+// Annotation is a note written to the log by Annotate.
+type Annotation struct {
+	// Index of the entry following the annotation, which is also the number
+	// of entries preceding it.
+	Index int
+	Note  string
+	// Time the annotation was written if WithTimestamps is used, otherwise
+	// zero.
+	Time time.Time
+}
+
+// Annotate appends a human-readable note to the log, such as a record of when
+// a migration started.
+//
+// Annotations are not ops: they are ignored by Replay and are not counted as
+// entries, so they never affect the replayed State. Use Annotations to read
+// them back. Versions of this package that predate annotations can't replay a
+// log containing them.
+func (l *Log[State]) Annotate(note string) error {
+	if l.binaryFraming() {
+		return errors.New("can't annotate a log of binary records")
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	a := annotation{Note: note}
+	if l.timestamps {
+		a.Time = l.clock().UnixNano()
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return l.writeAndSync(l.terminate(data), 0)
+}
+
+// Annotations returns every annotation in the log, in order. The position of
+// the log is preserved.
+func (l *Log[State]) Annotations() ([]Annotation, error) {
+	var annotations []Annotation
+	var decodeErr error
+	err := l.fromStart(func(r *reader) error {
+		r.onAnnotation = func(line []byte) {
+			a := annotation{}
+			if err := json.Unmarshal(line, &a); err != nil && decodeErr == nil {
+				decodeErr = fmt.Errorf("invalid annotation before entry %d: %w", r.index, err)
+			}
+			found := Annotation{Index: r.index, Note: a.Note}
+			if a.Time != 0 {
+				found.Time = time.Unix(0, a.Time)
+			}
+			annotations = append(annotations, found)
+		}
+		for {
+			if _, err := r.next(); errors.Is(err, io.EOF) {
+				return decodeErr
+			} else if err != nil {
+				return err
+			}
+		}
+	})
+	return annotations, err
+}
@@ -0,0 +1,29 @@
+package replaylog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestAnnotate(t *testing.T) {
+	log := newTestLog(t, WithTimestamps(), WithSequenceNumbers())
+	log.now = func() time.Time { return time.Unix(1000, 0) }
+	assert.NoError(t, log.Annotate("start"))
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"})
+	assert.NoError(t, log.Annotate("started migration X"))
+	appendAll(t, log, &Set{Key: "bar", Value: "waz"})
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, replay(t, log))
+
+	annotations, err := log.Annotations()
+	assert.NoError(t, err)
+	assert.Equal(t, []Annotation{
+		{Index: 0, Note: "start", Time: time.Unix(1000, 0)},
+		{Index: 1, Note: "started migration X", Time: time.Unix(1000, 0)},
+	}, annotations)
+
+	n := 0
+	assert.NoError(t, log.Each(func(EntryInfo, Op[KV]) error { n++; return nil }))
+	assert.Equal(t, 2, n)
+}
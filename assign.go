@@ -0,0 +1,51 @@
+package replaylog
+
+// IDAssigner is an optional interface that an Op can implement to be assigned
+// a unique ID when it is appended WithAssignedIDs.
+//
+// The ID is the sequence number of the op's entry, starting at 1. AssignID is
+// called before the op is encoded when it is appended, and before it is
+// applied on replay.
+type IDAssigner interface {
+	AssignID(id uint64)
+}
+
+// assignID assigns the sequence number of the next entry to be written to
+// event, if it is an IDAssigner and WithAssignedIDs is used. Must be called
+// with the lock held, before the entry is stamped.
+func (l *Log[State]) assignID(event Op[State]) error {
+	if !l.assignIDs {
+		return nil
+	}
+	assigner, ok := event.(IDAssigner)
+	if !ok {
+		return nil
+	}
+	count, err := l.count()
+	if err != nil {
+		return err
+	}
+	assigner.AssignID(uint64(count + l.encoded + 1))
+	return nil
+}
+
+// reassignID assigns the ID of a replayed entry to its op, if it is an
+// IDAssigner and WithAssignedIDs is used. Entries written before
+// WithAssignedIDs was used have no sequence number, so their ID is only known
+// when replaying from the start of the log.
+func (l *Log[State]) reassignID(r *reader, logEntry Frame, event Op[State]) {
+	if !l.assignIDs {
+		return
+	}
+	assigner, ok := event.(IDAssigner)
+	if !ok {
+		return
+	}
+	id := logEntry.Seq
+	if id == 0 && r.version != 0 {
+		id = r.index
+	}
+	if id != 0 {
+		assigner.AssignID(uint64(id))
+	}
+}
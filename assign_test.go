@@ -0,0 +1,55 @@
+package replaylog
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+type IDs map[uint64]string
+
+type createUser struct {
+	id   uint64
+	Name string `json:"name"`
+}
+
+func (c *createUser) AssignID(id uint64) { c.id = id }
+
+func (c *createUser) Apply(users IDs) error {
+	users[c.id] = c.Name
+	return nil
+}
+
+func TestWithAssignedIDs(t *testing.T) {
+	f := &MemoryFile{}
+	log, err := New[IDs](f, []Op[IDs]{&createUser{}}, WithAssignedIDs())
+	assert.NoError(t, err)
+	alice := &createUser{Name: "alice"}
+	assert.NoError(t, log.Append(alice))
+	assert.Equal(t, uint64(1), alice.id)
+	bob, carol := &createUser{Name: "bob"}, &createUser{Name: "carol"}
+	assert.NoError(t, log.AppendAtomic(bob, carol))
+	batch := log.Batch()
+	dave := &createUser{Name: "dave"}
+	assert.NoError(t, batch.Add(dave))
+	_, err = batch.Commit()
+	assert.NoError(t, err)
+	assert.NoError(t, log.AppendRaw(0, []byte(`{"name":"eve"}`)))
+	appended := IDs{alice.id: "alice", bob.id: "bob", carol.id: "carol", dave.id: "dave", 5: "eve"}
+	assert.Equal(t, 5, len(appended))
+
+	f.pos = 0
+	log, err = New[IDs](f, []Op[IDs]{&createUser{}}, WithAssignedIDs())
+	assert.NoError(t, err)
+	replayed := IDs{}
+	assert.NoError(t, log.Replay(replayed))
+	assert.Equal(t, appended, replayed)
+
+	// IDs are recovered from sequence numbers part way through the log.
+	replayed = IDs{}
+	token, err := log.ReplayChunk(replayed, ResumeToken{}, 3)
+	assert.NoError(t, err)
+	_, err = log.ReplayChunk(replayed, token, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, appended, replayed)
+}
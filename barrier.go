@@ -0,0 +1,49 @@
+package replaylog
+
+// AppendNoSync appends an Op to the log without syncing it to stable storage,
+// for grouping several appends under a single Barrier.
+//
+// The op is visible to subsequent replays and subscribers immediately, but
+// may be lost or torn by a crash until Barrier returns. Close calls Barrier
+// implicitly, even WithSkipCloseSync. With WithStagedWrites, every append is
+// synced regardless.
+func (l *Log[State]) AppendNoSync(event Op[State]) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	event, err := l.appendHook(event)
+	if err != nil {
+		return err
+	}
+	l.encoded = 0
+	data, err := l.encode(event)
+	if err != nil {
+		return err
+	}
+	if err := l.writeFrames(data, 1, false); err != nil {
+		return err
+	}
+	l.publish(event)
+	return nil
+}
+
+// Barrier syncs every op appended with AppendNoSync to stable storage,
+// returning once they are durable.
+//
+// It returns immediately if nothing is pending. If the sync fails the ops
+// remain pending, as reported by PendingBytes, and a later Barrier retries.
+func (l *Log[State]) Barrier() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.pending == 0 {
+		return nil
+	}
+	if l.degraded {
+		return errDegraded
+	}
+	if err := l.withWriteTimeout(l.sync); err != nil {
+		return err
+	}
+	l.pending = 0
+	l.notifySynced()
+	return nil
+}
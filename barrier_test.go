@@ -0,0 +1,37 @@
+package replaylog
+
+import (
+	"bufio"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestAppendNoSync(t *testing.T) {
+	f := &MemoryFile{}
+	var buf *replicatingBuffer
+	log, err := New[KV](f, ops, WithSkipCloseSync(), WithWriteBuffer(func(f File) WriteBuffer {
+		buf = &replicatingBuffer{Writer: bufio.NewWriter(f), f: f}
+		return buf
+	}))
+	assert.NoError(t, err)
+	assert.NoError(t, log.AppendNoSync(&Set{Key: "foo", Value: "bar"}))
+	assert.NoError(t, log.AppendNoSync(&Set{Key: "bar", Value: "waz"}))
+	assert.Equal(t, 0, buf.syncs)
+	assert.Equal(t, len(buf.replica.String()), log.PendingBytes())
+
+	assert.NoError(t, log.Barrier())
+	assert.Equal(t, 1, buf.syncs)
+	assert.Equal(t, 0, log.PendingBytes())
+	assert.NoError(t, log.Barrier())
+	assert.Equal(t, 1, buf.syncs)
+
+	// Close syncs pending ops, even WithSkipCloseSync.
+	assert.NoError(t, log.AppendNoSync(&Delete{Key: "foo"}))
+	assert.NoError(t, log.Close())
+	assert.Equal(t, 2, buf.syncs)
+	assert.Equal(t, `{"k":0,"e":{"k":"foo","v":"bar"}}
+{"k":0,"e":{"k":"bar","v":"waz"}}
+{"k":1,"e":{"k":"foo"}}
+`, string(f.data))
+}
@@ -0,0 +1,98 @@
+package replaylog
+
+// Batch accumulates Ops to be appended to a Log together by Commit.
+//
+// A Batch is not safe for concurrent use.
+type Batch[State any] struct {
+	log     *Log[State]
+	ops     []Op[State]
+	entries []Frame
+}
+
+// Batch creates a new empty Batch of Ops for the log.
+func (l *Log[State]) Batch() *Batch[State] {
+	return &Batch[State]{log: l}
+}
+
+// Add an Op to the batch.
+//
+// The Op is passed through any WithAppendHook and encoded immediately, so
+// errors from either are returned by Add rather than Commit.
+func (b *Batch[State]) Add(op Op[State]) error {
+	op, err := b.log.appendHook(op)
+	if err != nil {
+		return err
+	}
+	e, err := b.log.marshalEntry(op)
+	if err != nil {
+		return err
+	}
+	b.ops = append(b.ops, op)
+	b.entries = append(b.entries, e)
+	return nil
+}
+
+// Len returns the number of Ops in the batch.
+func (b *Batch[State]) Len() int {
+	return len(b.ops)
+}
+
+// Commit appends every Op in the batch to the log with a single write and
+// sync, returning the index of the first appended entry.
+//
+// The batch is empty afterwards, whether or not Commit succeeds.
+func (b *Batch[State]) Commit() (start int, err error) {
+	defer b.Discard()
+	err = b.log.grouped(func() error {
+		start, err = b.commit()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return start, nil
+}
+
+// commit is Commit. Must be called with the lock held.
+func (b *Batch[State]) commit() (int, error) {
+	l := b.log
+	l.encoded = 0
+	start, err := l.count()
+	if err != nil {
+		return 0, err
+	}
+	if len(b.entries) == 0 {
+		return start, nil
+	}
+	var frames []byte
+	for i, e := range b.entries {
+		var err error
+		if l.assignIDs {
+			// IDs depend on the position of the op, so it's encoded again.
+			e, err = l.newEntry(b.ops[i])
+		} else {
+			e, err = l.stampEntry(e, b.ops[i])
+		}
+		if err != nil {
+			return 0, err
+		}
+		frame, err := l.encodeFrame(e)
+		if err != nil {
+			return 0, err
+		}
+		frames = append(frames, frame...)
+	}
+	if err := l.writeAndSync(frames, len(b.entries)); err != nil {
+		return 0, err
+	}
+	for _, op := range b.ops {
+		l.publish(op)
+	}
+	return start, nil
+}
+
+// Discard every Op in the batch without writing them.
+func (b *Batch[State]) Discard() {
+	b.ops = nil
+	b.entries = nil
+}
@@ -0,0 +1,43 @@
+package replaylog
+
+import (
+	"os"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestBatch(t *testing.T) {
+	log := newTestLog(t, WithSequenceNumbers())
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"})
+
+	batch := log.Batch()
+	assert.NoError(t, batch.Add(&Set{Key: "bar", Value: "waz"}))
+	assert.Error(t, batch.Add(&copyOp{}))
+	appendAll(t, log, &Set{Key: "waz", Value: "foo"})
+	assert.NoError(t, batch.Add(&Delete{Key: "foo"}))
+	assert.Equal(t, 2, batch.Len())
+	start, err := batch.Commit()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, start)
+	assert.Equal(t, 0, batch.Len())
+	assert.Equal(t, KV{"bar": "waz", "waz": "foo"}, replay(t, log))
+}
+
+func TestBatchDiscard(t *testing.T) {
+	log := newTestLog(t)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"})
+	before, err := os.ReadFile(log.f.(*os.File).Name())
+	assert.NoError(t, err)
+
+	batch := log.Batch()
+	assert.NoError(t, batch.Add(&Delete{Key: "foo"}))
+	batch.Discard()
+	start, err := batch.Commit()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, start)
+
+	after, err := os.ReadFile(log.f.(*os.File).Name())
+	assert.NoError(t, err)
+	assert.Equal(t, string(before), string(after))
+}
@@ -0,0 +1,141 @@
+// Package bench provides reusable workloads and benchmarks for replaylog.
+package bench
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/replaylog"
+)
+
+// KV is a simple key-value State.
+type KV map[string]string
+
+// Set a key in a KV.
+type Set struct {
+	Key   string `json:"k"`
+	Value string `json:"v"`
+}
+
+func (s *Set) Apply(kv KV) error {
+	kv[s.Key] = s.Value
+	return nil
+}
+
+// Delete a key from a KV.
+type Delete struct {
+	Key string `json:"k"`
+}
+
+func (d *Delete) Apply(kv KV) error {
+	delete(kv, d.Key)
+	return nil
+}
+
+// KVOps is the set of ops for a KV log.
+var KVOps = []replaylog.Op[KV]{&Set{}, &Delete{}}
+
+// Workload generates n ops using "gen", seeded deterministically from "seed".
+func Workload[State any](n int, seed int64, gen func(rnd *rand.Rand) replaylog.Op[State]) []replaylog.Op[State] {
+	rnd := rand.New(rand.NewSource(seed)) // nolint: gosec
+	workload := make([]replaylog.Op[State], n)
+	for i := range workload {
+		workload[i] = gen(rnd)
+	}
+	return workload
+}
+
+// KVGenerator returns a generator for Workload producing a random mix of Set
+// and Delete ops across "keys" keys, with values of "valueSize" bytes.
+//
+// Roughly one in five ops is a Delete.
+func KVGenerator(keys, valueSize int) func(rnd *rand.Rand) replaylog.Op[KV] {
+	value := strings.Repeat("x", valueSize)
+	return func(rnd *rand.Rand) replaylog.Op[KV] {
+		key := fmt.Sprintf("key-%d", rnd.Intn(keys))
+		if rnd.Intn(5) == 0 {
+			return &Delete{Key: key}
+		}
+		return &Set{Key: key, Value: value}
+	}
+}
+
+// Config for Run.
+type Config[State any] struct {
+	// Ops registered with the Log.
+	Ops []replaylog.Op[State]
+	// Workload of ops to append and replay.
+	Workload []replaylog.Op[State]
+	// NewFile creates an empty File for each benchmark.
+	NewFile func(b *testing.B) replaylog.File
+	// NewState creates an empty State to replay into.
+	NewState func() State
+	// Options passed to replaylog.New.
+	Options []replaylog.Option
+	// BatchSize is the number of ops appended per AppendAtomic call. Defaults to 100.
+	BatchSize int
+}
+
+// Run benchmarks Append, AppendAtomic and Replay for a workload.
+func Run[State any](b *testing.B, config Config[State]) {
+	b.Helper()
+	if config.BatchSize == 0 {
+		config.BatchSize = 100
+	}
+	newLog := func(b *testing.B) *replaylog.Log[State] {
+		b.Helper()
+		log, err := replaylog.New(config.NewFile(b), config.Ops, config.Options...)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { _ = log.Close() })
+		return log
+	}
+
+	b.Run("Append", func(b *testing.B) {
+		log := newLog(b)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := log.Append(config.Workload[i%len(config.Workload)]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("AppendAtomic", func(b *testing.B) {
+		log := newLog(b)
+		batch := make([]replaylog.Op[State], 0, config.BatchSize)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			batch = append(batch, config.Workload[i%len(config.Workload)])
+			if len(batch) == config.BatchSize || i == b.N-1 {
+				if err := log.AppendAtomic(batch...); err != nil {
+					b.Fatal(err)
+				}
+				batch = batch[:0]
+			}
+		}
+	})
+
+	b.Run("Replay", func(b *testing.B) {
+		log := newLog(b)
+		if err := log.AppendAtomic(config.Workload...); err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := log.Rewind(); err != nil {
+				b.Fatal(err)
+			}
+			if err := log.Replay(config.NewState()); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(len(config.Workload)), "ops/replay")
+	})
+}
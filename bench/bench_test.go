@@ -0,0 +1,47 @@
+package bench
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/alecthomas/replaylog"
+)
+
+func TestWorkload(t *testing.T) {
+	a := Workload(100, 1, KVGenerator(10, 8))
+	b := Workload(100, 1, KVGenerator(10, 8))
+	assert.Equal(t, a, b)
+	deletes := 0
+	for _, op := range a {
+		if _, ok := op.(*Delete); ok {
+			deletes++
+		}
+	}
+	assert.True(t, deletes > 0 && deletes < len(a)/2)
+}
+
+func BenchmarkKV(b *testing.B) {
+	workload := Workload(10000, 1, KVGenerator(1000, 64))
+	b.Run("MemFile", func(b *testing.B) {
+		Run(b, Config[KV]{
+			Ops:      KVOps,
+			Workload: workload,
+			NewFile:  func(b *testing.B) replaylog.File { return &replaylog.MemoryFile{} },
+			NewState: func() KV { return KV{} },
+		})
+	})
+	b.Run("TempFile", func(b *testing.B) {
+		Run(b, Config[KV]{
+			Ops:      KVOps,
+			Workload: workload,
+			NewFile: func(b *testing.B) replaylog.File {
+				f, err := ioutil.TempFile(b.TempDir(), "")
+				assert.NoError(b, err)
+				return f
+			},
+			NewState: func() KV { return KV{} },
+		})
+	})
+}
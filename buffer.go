@@ -0,0 +1,38 @@
+package replaylog
+
+import "io"
+
+// A WriteBuffer is the write path of a Log, set by WithWriteBuffer.
+//
+// The Log writes every appended entry to the WriteBuffer, then calls Flush
+// followed by Sync before the append returns. Implementations can use this to
+// tap the write path, eg. for replication or metrics, but must write entries to
+// the File at its current position in the order they are written.
+type WriteBuffer interface {
+	io.Writer
+	// Flush writes any buffered data to the File.
+	Flush() error
+	// Sync commits the File to stable storage, if it implements Syncer.
+	Sync() error
+}
+
+// fileBuffer is the default WriteBuffer, which writes directly to the File.
+type fileBuffer struct {
+	File
+}
+
+func (fileBuffer) Flush() error { return nil }
+
+func (b fileBuffer) Sync() error { return syncFile(b.File) }
+
+// buffer returns the WriteBuffer of the log, creating it if necessary.
+func (l *Log[State]) buffer() WriteBuffer {
+	if l.buf == nil {
+		if l.writeBuffer != nil {
+			l.buf = l.writeBuffer(l.f)
+		} else {
+			l.buf = fileBuffer{l.f}
+		}
+	}
+	return l.buf
+}
@@ -0,0 +1,69 @@
+package replaylog
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// replicatingBuffer buffers writes to a File, copying them to a replica.
+type replicatingBuffer struct {
+	*bufio.Writer
+	f       File
+	replica bytes.Buffer
+	syncs   int
+}
+
+func (r *replicatingBuffer) Write(p []byte) (int, error) {
+	r.replica.Write(p)
+	return r.Writer.Write(p)
+}
+
+func (r *replicatingBuffer) Sync() error {
+	r.syncs++
+	return r.f.(Syncer).Sync()
+}
+
+func TestWithWriteBuffer(t *testing.T) {
+	var buf *replicatingBuffer
+	log := newTestLog(t, WithWriteBuffer(func(f File) WriteBuffer {
+		buf = &replicatingBuffer{Writer: bufio.NewWriter(f), f: f}
+		return buf
+	}))
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Delete{Key: "foo"})
+	assert.NoError(t, log.AppendAtomic(&Set{Key: "bar", Value: "waz"}))
+	assert.Equal(t, KV{"bar": "waz"}, replay(t, log))
+	assert.Equal(t, 3, buf.syncs)
+	assert.Equal(t, `{"k":0,"e":{"k":"foo","v":"bar"}}
+{"k":1,"e":{"k":"foo"}}
+{"k":0,"e":{"k":"bar","v":"waz"}}
+`, buf.replica.String())
+}
+
+func TestCloseFlushesAndSyncs(t *testing.T) {
+	for _, skip := range []bool{false, true} {
+		f := &MemoryFile{}
+		var buf *replicatingBuffer
+		options := []Option{WithWriteBuffer(func(f File) WriteBuffer {
+			buf = &replicatingBuffer{Writer: bufio.NewWriter(f), f: f}
+			return buf
+		})}
+		if skip {
+			options = append(options, WithSkipCloseSync())
+		}
+		log, err := New[KV](f, ops, options...)
+		assert.NoError(t, err)
+		appendAll(t, log, &Set{Key: "foo", Value: "bar"})
+		_, err = buf.WriteString("\n")
+		assert.NoError(t, err)
+		assert.NoError(t, log.Close())
+		assert.Equal(t, `{"k":0,"e":{"k":"foo","v":"bar"}}`+"\n\n", string(f.data))
+		if skip {
+			assert.Equal(t, 1, buf.syncs)
+		} else {
+			assert.Equal(t, 2, buf.syncs)
+		}
+	}
+}
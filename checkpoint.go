@@ -0,0 +1,77 @@
+package replaylog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+)
+
+// Checkpoint replaces the contents of the log with a single SnapshotOp holding
+// "state", bounding the growth of the log. "state" must be the result of
+// replaying the whole log, and SnapshotOp must be registered with the log.
+//
+// The State is serialised by its Snapshotter if it implements one, otherwise
+// with json.Marshal, and in either case must be JSON, as for SnapshotOp.
+// Replay restores dest from the checkpoint as SnapshotOp does, then applies
+// the ops appended after it. The log must be an *os.File: the checkpoint is
+// written to a temporary file in the same directory and verified by replaying
+// it into a new State, as for Compact, before it is atomically renamed over
+// the log. If any step fails the log is left untouched. Appends are blocked
+// for the duration.
+func (l *Log[State]) Checkpoint(state State) error {
+	op, err := l.checkpointOp(state)
+	if err != nil {
+		return err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.readOnly {
+		return ErrReadOnly
+	}
+	path, ok := l.f.(*os.File)
+	if !ok {
+		return fmt.Errorf("can't checkpoint log of type %T, it must be an *os.File", l.f)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path.Name()), filepath.Base(path.Name())+".*.checkpoint")
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint: %w", err)
+	}
+	compacted, err := l.writeCompacted(tmp, state, newState[State], []Op[State]{op}, false)
+	if err == nil {
+		// The log may keep its own State up to date, which mustn't be the
+		// caller's.
+		shadow := newState[State]()
+		if err = op.Apply(shadow); err == nil {
+			err = l.switchToCompacted(tmp, compacted, shadow)
+		}
+	}
+	if err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// checkpointOp returns a SnapshotOp holding "state", as written by Checkpoint.
+func (l *Log[State]) checkpointOp(state State) (*SnapshotOp[State], error) {
+	op := &SnapshotOp[State]{}
+	if _, ok := l.events[reflect.TypeOf(op)]; !ok {
+		return nil, fmt.Errorf("can't checkpoint log: %T must be registered", op)
+	}
+	var err error
+	if snapshotter, ok := any(state).(Snapshotter); ok {
+		op.Snapshot, err = snapshotter.Snapshot()
+	} else {
+		op.Snapshot, err = json.Marshal(state)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot state: %w", err)
+	}
+	if !json.Valid(op.Snapshot) {
+		return nil, fmt.Errorf("can't checkpoint state of type %T, its snapshot must be JSON", state)
+	}
+	return op, nil
+}
@@ -0,0 +1,126 @@
+package replaylog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// checkpointOps are ops for a log that can be checkpointed.
+var checkpointOps = []Op[snapshotKVState]{&setSnapshotKV{}, &SnapshotOp[snapshotKVState]{}}
+
+func TestCheckpoint(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "")
+	assert.NoError(t, err)
+	log, err := New(f, checkpointOps)
+	assert.NoError(t, err)
+	defer log.Close()
+	for _, value := range []string{"1", "2", "3"} {
+		assert.NoError(t, log.Append(&setSnapshotKV{Key: "a", Value: value}))
+	}
+	assert.NoError(t, log.Append(&setSnapshotKV{Key: "b", Value: "4"}))
+	state := snapshotKVState{}
+	assert.NoError(t, log.Rewind())
+	assert.NoError(t, log.Replay(state))
+	assert.NoError(t, log.Checkpoint(state))
+	assert.NoError(t, log.Append(&setSnapshotKV{Key: "c", Value: "5"}))
+
+	data, err := os.ReadFile(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, `{"k":1,"e":{"s":{"a":"3","b":"4"}}}`+"\n"+`{"k":0,"e":{"k":"c","v":"5"}}`+"\n", string(data))
+
+	rf, err := os.OpenFile(f.Name(), os.O_RDWR, 0)
+	assert.NoError(t, err)
+	reopened, err := New(rf, checkpointOps)
+	assert.NoError(t, err)
+	defer reopened.Close()
+	assert.NoError(t, reopened.Rewind())
+	state = snapshotKVState{"stale": "x"}
+	assert.NoError(t, reopened.Replay(state))
+	assert.Equal(t, snapshotKVState{"a": "3", "b": "4", "c": "5"}, state)
+
+	// The log can be checkpointed again after switching to the checkpoint.
+	assert.NoError(t, log.Checkpoint(state))
+	entries := 0
+	assert.NoError(t, log.Each(func(info EntryInfo, op Op[snapshotKVState]) error {
+		_, ok := op.(*SnapshotOp[snapshotKVState])
+		assert.True(t, ok)
+		entries++
+		return nil
+	}))
+	assert.Equal(t, 1, entries)
+	matches, err := filepath.Glob(f.Name() + ".*")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(matches))
+
+	// States without a Snapshotter are serialised as JSON.
+	kv, err := New[KV](writeTestFile(t, ""), []Op[KV]{&Set{}, &SnapshotOp[KV]{}})
+	assert.NoError(t, err)
+	defer kv.Close()
+	appendAll(t, kv, &Set{Key: "a", Value: "1"})
+	assert.NoError(t, kv.Checkpoint(KV{"a": "1"}))
+	assert.Equal(t, KV{"a": "1"}, replay(t, kv))
+
+	err = newTestLog(t).Checkpoint(KV{})
+	assert.True(t, strings.Contains(err.Error(), "*replaylog.SnapshotOp[github.com/alecthomas/replaylog.KV] must be registered"), "%v", err)
+	mem, err := New(&MemoryFile{}, checkpointOps)
+	assert.NoError(t, err)
+	assert.EqualError(t, mem.Checkpoint(state), "can't checkpoint log of type *replaylog.MemoryFile, it must be an *os.File")
+}
+
+// rawSnapshotKV records the kinds of entries passed to a WithFallbackOp.
+type rawSnapshotKV struct{}
+
+func (rawSnapshotKV) ApplyRaw(kind int, raw json.RawMessage, state snapshotKVState) error {
+	state["raw"] = string(raw)
+	return nil
+}
+
+// Checkpoints are ordinary entries, so are handled like any other registered
+// op by the paths that deal with unregistered kinds.
+func TestCheckpointIsRegisteredOp(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "")
+	assert.NoError(t, err)
+	log, err := New(f, checkpointOps)
+	assert.NoError(t, err)
+	defer log.Close()
+	assert.NoError(t, log.Append(&setSnapshotKV{Key: "a", Value: "1"}))
+	assert.NoError(t, log.Checkpoint(snapshotKVState{"a": "1"}))
+	assert.NoError(t, log.Append(&setSnapshotKV{Key: "b", Value: "2"}))
+	expected := snapshotKVState{"a": "1", "b": "2"}
+
+	for name, option := range map[string]Option{
+		"SkipUnknown":       WithUnknownKindPolicy(SkipUnknown),
+		"WithOnUnknownKind": WithOnUnknownKind(func(kind int, raw []byte) error { return nil }),
+		"WithFallbackOp":    WithFallbackOp[snapshotKVState](rawSnapshotKV{}),
+	} {
+		rf, err := os.Open(f.Name())
+		assert.NoError(t, err)
+		reader, err := New(rf, checkpointOps, option, WithReadOnly())
+		assert.NoError(t, err, name)
+		state := snapshotKVState{}
+		assert.NoError(t, reader.Replay(state), name)
+		assert.Equal(t, expected, state, name)
+		assert.NoError(t, reader.CheckLogCompatible(), name)
+		assert.NoError(t, reader.Close())
+	}
+
+	reports, err := log.Scan()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(reports))
+	assert.Equal(t, 1, reports[0].Kind)
+	assert.NoError(t, reports[0].Err)
+
+	dst, err := NewNamed(writeTestFile(t, ""), map[string]Op[snapshotKVState]{"set": &setSnapshotKV{}, "checkpoint": &SnapshotOp[snapshotKVState]{}})
+	assert.NoError(t, err)
+	defer dst.Close()
+	assert.NoError(t, MigrateToNamed(log, dst, []string{"set", "checkpoint"}))
+	assert.NoError(t, dst.Rewind())
+	state := snapshotKVState{}
+	assert.NoError(t, dst.Replay(state))
+	assert.Equal(t, expected, state)
+}
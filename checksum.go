@@ -0,0 +1,46 @@
+package replaylog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// ErrChecksumMismatch is returned when an entry written WithEntryChecksums
+// doesn't match its checksum.
+var ErrChecksumMismatch = errors.New("entry checksum mismatch")
+
+var crc32Table = crc32.MakeTable(crc32.Castagnoli)
+
+// checksumKey starts the checksum of an entry, which is always its last field.
+var checksumKey = []byte(`,"q":"`)
+
+// checksumSuffixLen is the length of checksumKey, the hex encoded checksum and
+// the closing quote and brace.
+var checksumSuffixLen = len(checksumKey) + 8 + 2
+
+// appendChecksum adds the checksum of a JSON encoded frame, which must end
+// with its closing brace, as its last field.
+func appendChecksum(frame []byte) []byte {
+	sum := crc32.Checksum(frame, crc32Table)
+	out := make([]byte, 0, len(frame)+checksumSuffixLen-1)
+	out = append(out, frame[:len(frame)-1]...)
+	out = append(out, checksumKey...)
+	return fmt.Appendf(out, "%08x\"}", sum)
+}
+
+// verifyChecksum checks the checksum "sum" of an encoded frame, which must be
+// its last field.
+func verifyChecksum(frame []byte, sum string) error {
+	frame = bytes.TrimSpace(frame)
+	n := len(frame) - checksumSuffixLen
+	if n < 1 || !bytes.Equal(frame[n:n+len(checksumKey)], checksumKey) {
+		return fmt.Errorf("%w: checksum is not the last field", ErrChecksumMismatch)
+	}
+	unsummed := append(frame[:n:n], '}')
+	if actual := fmt.Sprintf("%08x", crc32.Checksum(unsummed, crc32Table)); actual != sum {
+		return fmt.Errorf("%w: expected %s but got %s", ErrChecksumMismatch, sum, actual)
+	}
+	return nil
+}
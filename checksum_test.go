@@ -0,0 +1,54 @@
+package replaylog
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestWithEntryChecksums(t *testing.T) {
+	f := &MemoryFile{}
+	log, err := New[KV](f, ops, WithEntryChecksums())
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "a", Value: "bar"}, &Set{Key: "b", Value: "bar"}, &Delete{Key: "a"})
+	lines := strings.Split(string(f.data), "\n")
+	assert.Equal(t, `{"k":0,"e":{"k":"a","v":"bar"},"q":"091c1b94"}`, lines[0])
+	assert.Equal(t, KV{"b": "bar"}, replay(t, log))
+
+	// Entries without checksums are still read.
+	f.data = append(f.data, `{"k":0,"e":{"k":"c","v":"d"}}`+"\n"...)
+	assert.Equal(t, KV{"b": "bar", "c": "d"}, replay(t, log))
+
+	// Corruption that is still valid JSON is detected.
+	f.data = bytes.Replace(f.data, []byte(`"b","v":"bar"`), []byte(`"b","v":"baz"`), 1)
+	assert.NoError(t, log.Rewind())
+	err = log.Replay(KV{})
+	assert.True(t, errors.Is(err, ErrChecksumMismatch), "%v", err)
+}
+
+func TestReplayTruncating(t *testing.T) {
+	f := &MemoryFile{}
+	log, err := New[KV](f, ops, WithEntryChecksums())
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "a", Value: "1"}, &Set{Key: "b", Value: "2"}, &Set{Key: "c", Value: "3"})
+	good := bytes.Index(f.data, []byte(`{"k":0,"e":{"k":"b"`))
+	f.data = bytes.Replace(f.data, []byte(`"v":"2"`), []byte(`"v":"9"`), 1)
+	assert.NoError(t, log.Rewind())
+	state := KV{}
+	dropped, err := log.ReplayTruncating(state)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, dropped)
+	assert.Equal(t, KV{"a": "1"}, state)
+	assert.Equal(t, good, len(f.data))
+
+	// The log can be appended to and replayed after truncation.
+	appendAll(t, log, &Set{Key: "d", Value: "4"})
+	assert.Equal(t, KV{"a": "1", "d": "4"}, replay(t, log))
+	assert.NoError(t, log.Rewind())
+	dropped, err = log.ReplayTruncating(KV{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, dropped)
+}
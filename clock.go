@@ -0,0 +1,77 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ClockedOp is an optional interface that an Op can implement to receive the
+// logical clock its entry was written with, as set by WithLogicalClock.
+//
+// Entries written without a logical clock have clock 0.
+type ClockedOp[State any] interface {
+	Op[State]
+	ApplyWithClock(clock uint64, state State) error
+}
+
+// ReceivedClock is an optional interface that an Op can implement to carry the
+// logical clock of a remote process it was received from, so that entries
+// appended WithLogicalClock are ordered after it.
+type ReceivedClock interface {
+	ReceivedClock() uint64
+}
+
+// LogicalClock returns the logical clock of the last entry appended
+// WithLogicalClock, for sending to other processes.
+func (l *Log[State]) LogicalClock() (uint64, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if err := l.loadLamport(); err != nil {
+		return 0, err
+	}
+	return l.lamport, nil
+}
+
+// tick advances the logical clock for an appended op, returning its clock.
+// Must be called with the lock held.
+func (l *Log[State]) tick(op Op[State]) (uint64, error) {
+	if err := l.loadLamport(); err != nil {
+		return 0, err
+	}
+	if received, ok := op.(ReceivedClock); ok && received.ReceivedClock() > l.lamport {
+		l.lamport = received.ReceivedClock()
+	}
+	l.lamport++
+	return l.lamport, nil
+}
+
+// loadLamport recovers the logical clock from the entries in the log, if it
+// has not been already. Must be called with the lock held.
+func (l *Log[State]) loadLamport() error {
+	if l.lamportLoaded {
+		return nil
+	}
+	var clock uint64
+	err := l.rewound(func(r *reader) error {
+		for {
+			data, err := r.next()
+			if errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			frame, err := l.decodeFrame(data)
+			if err != nil {
+				return fmt.Errorf("entry %d: %w", r.index-1, err)
+			}
+			clock = max(clock, frame.Clock)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to recover logical clock: %w", err)
+	}
+	l.lamport = clock
+	l.lamportLoaded = true
+	return nil
+}
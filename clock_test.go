@@ -0,0 +1,46 @@
+package replaylog
+
+import (
+	"os"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+type clockedSet struct {
+	Key      string `json:"k"`
+	Received uint64 `json:"r,omitempty"`
+}
+
+func (c *clockedSet) Apply(state KV) error { panic("not called") }
+
+func (c *clockedSet) ApplyWithClock(clock uint64, state KV) error {
+	state[c.Key] = string(rune('0' + clock))
+	return nil
+}
+
+func (c *clockedSet) ReceivedClock() uint64 { return c.Received }
+
+func TestWithLogicalClock(t *testing.T) {
+	ops := []Op[KV]{&clockedSet{}}
+	f, err := os.CreateTemp(t.TempDir(), "")
+	assert.NoError(t, err)
+	log, err := New(f, ops, WithLogicalClock())
+	assert.NoError(t, err)
+	appendAll(t, log, &clockedSet{Key: "a"}, &clockedSet{Key: "b"})
+	assert.NoError(t, log.Close())
+
+	f, err = os.OpenFile(f.Name(), os.O_RDWR, 0)
+	assert.NoError(t, err)
+	log, err = New(f, ops, WithLogicalClock())
+	assert.NoError(t, err)
+	defer log.Close()
+	clock, err := log.LogicalClock()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), clock)
+	state := replay(t, log)
+	assert.Equal(t, KV{"a": "1", "b": "2"}, state)
+	appendAll(t, log, &clockedSet{Key: "c"}, &clockedSet{Key: "d", Received: 6}, &clockedSet{Key: "e", Received: 4})
+	assert.NoError(t, log.Rewind())
+	assert.Equal(t, KV{"a": "1", "b": "2", "c": "3", "d": "7", "e": "8"}, replay(t, log))
+}
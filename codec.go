@@ -0,0 +1,46 @@
+package replaylog
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// A Codec encodes and decodes the events of ops, see WithCodec.
+//
+// Codecs for formats such as CBOR or protobuf can be plugged in by wrapping
+// their Marshal and Unmarshal functions.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec is a Codec using encoding/json, the default encoding of events.
+type JSONCodec struct{}
+
+var _ Codec = JSONCodec{}
+
+func (JSONCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (JSONCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// GobCodec is a Codec using encoding/gob.
+//
+// Each event is encoded as a self-contained gob stream, including a
+// description of its type, so that entries can be decoded independently. As
+// for any codec other than JSONCodec, the log is written WithBinaryRecords,
+// so events are stored as length-prefixed records.
+type GobCodec struct{}
+
+var _ Codec = GobCodec{}
+
+func (GobCodec) Marshal(v any) ([]byte, error) {
+	w := &bytes.Buffer{}
+	if err := gob.NewEncoder(w).Encode(v); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
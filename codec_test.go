@@ -0,0 +1,57 @@
+package replaylog
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+type setBlob struct {
+	Key   string
+	Value []byte
+	Seq   uint64
+}
+
+func (s *setBlob) Apply(kv KV) error {
+	kv[s.Key] = fmt.Sprintf("%s@%d", s.Value, s.Seq)
+	return nil
+}
+
+func TestWithCodec(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "")
+	assert.NoError(t, err)
+	defer f.Close()
+	codecOps := []Op[KV]{&Set{}, &setBlob{}}
+	log, err := New[KV](f, codecOps, WithCodec(GobCodec{}))
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "a", Value: "b"}, &setBlob{Key: "c", Value: []byte{0, 1, 'x'}, Seq: 1<<63 + 1})
+	assert.Equal(t, KV{"a": "b", "c": "\x00\x01x@9223372036854775809"}, replay(t, log))
+
+	data, err := os.ReadFile(f.Name())
+	assert.NoError(t, err)
+	assert.False(t, strings.Contains(string(data), `"k":"a"`))
+
+	// Replaying with a different codec fails rather than misdecoding.
+	log, err = New[KV](f, codecOps)
+	assert.NoError(t, err)
+	assert.NoError(t, log.Rewind())
+	assert.Error(t, log.Replay(KV{}))
+
+	_, err = New[KV](f, codecOps, WithCodec(GobCodec{}), WithValidateOps())
+	assert.EqualError(t, err, "WithValidateOps can't be used with codec replaylog.GobCodec")
+}
+
+func TestJSONCodecPreservesFormat(t *testing.T) {
+	plain := &MemoryFile{}
+	log, err := New[KV](plain, ops)
+	assert.NoError(t, err)
+	assert.NoError(t, log.Append(&Set{Key: "a", Value: "b"}))
+	withCodec := &MemoryFile{}
+	log, err = New[KV](withCodec, ops, WithCodec(JSONCodec{}))
+	assert.NoError(t, err)
+	assert.NoError(t, log.Append(&Set{Key: "a", Value: "b"}))
+	assert.Equal(t, string(plain.data), string(withCodec.data))
+}
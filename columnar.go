@@ -0,0 +1,69 @@
+package replaylog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// columnarKind is a line of the format written by ExportColumnar.
+type columnarKind struct {
+	Kind    int               `json:"kind"`
+	Type    string            `json:"type,omitempty"`
+	Indices []int             `json:"indices"`
+	Events  []json.RawMessage `json:"events"`
+}
+
+// ExportColumnar writes the events in the log to w grouped by kind, for
+// analytical tools that scan all events of a kind at once.
+//
+// One JSON object is written per kind present in the log, in kind order, of
+// the form {"kind":0,"type":"Set","indices":[0,2],"events":[{...},{...}]},
+// where "indices" holds the position in the log of each event. The export
+// can't be replayed directly, as ops of different kinds are no longer
+// interleaved, though the original order can be reconstructed from the
+// indices. Every event is held in memory until the log has been read. The
+// position of the log is preserved.
+func (l *Log[State]) ExportColumnar(w io.Writer) error {
+	kinds := map[int]*columnarKind{}
+	err := l.fromStart(func(r *reader) error {
+		for {
+			logEntry, err := l.nextEntry(r)
+			if errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("entry %d: %w", r.index-1, err)
+			}
+			column, ok := kinds[logEntry.Kind]
+			if !ok {
+				column = &columnarKind{Kind: logEntry.Kind}
+				if l.knownKind(logEntry.Kind) {
+					column.Type = shortTypeName(reflect.TypeOf(l.ops[logEntry.Kind]))
+				}
+				kinds[logEntry.Kind] = column
+			}
+			column.Indices = append(column.Indices, r.index-1)
+			column.Events = append(column.Events, append(json.RawMessage(nil), logEntry.Event...))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	order := make([]int, 0, len(kinds))
+	for kind := range kinds {
+		order = append(order, kind)
+	}
+	sort.Ints(order)
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, kind := range order {
+		if err := enc.Encode(kinds[kind]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,18 @@
+package replaylog
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestExportColumnar(t *testing.T) {
+	log := newTestLog(t)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Delete{Key: "foo"}, &Set{Key: "bar", Value: "waz"})
+	w := &bytes.Buffer{}
+	assert.NoError(t, log.ExportColumnar(w))
+	assert.Equal(t, `{"kind":0,"type":"Set","indices":[0,2],"events":[{"k":"foo","v":"bar"},{"k":"bar","v":"waz"}]}
+{"kind":1,"type":"Delete","indices":[1],"events":[{"k":"foo"}]}
+`, w.String())
+}
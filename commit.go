@@ -0,0 +1,114 @@
+package replaylog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// commitMarker is the frame written by WithCommitMarker, without its
+// delimiter.
+var commitMarker = []byte(`{"commit":true}`)
+
+// isCommitMarker returns true if frame is a commit marker.
+func isCommitMarker(frame []byte) bool {
+	return bytes.Equal(bytes.TrimSpace(frame), commitMarker)
+}
+
+// commitMarkerFrame returns a commit marker terminated by the delimiter of the
+// log.
+func (l *Log[State]) commitMarkerFrame() []byte {
+	return l.terminate(append([]byte(nil), commitMarker...))
+}
+
+// ReplayClean is like Replay, but also reports whether the log ended cleanly.
+//
+// A log is clean if it is empty or ends with a commit marker written by
+// WithCommitMarker. A log that is not clean may have been truncated by a
+// crash, so the final ops appended before the crash may be missing.
+func (l *Log[State]) ReplayClean(dest State) (clean bool, err error) {
+	defer l.startReplaying()()
+	if err := l.Replay(dest); err != nil {
+		return false, err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.endsClean()
+}
+
+// endsClean returns true if the log is empty or ends with a commit marker,
+// ignoring any trailer, preserving its position. Must be called with the lock
+// held.
+func (l *Log[State]) endsClean() (bool, error) {
+	tail, size, err := l.tail(256)
+	if err != nil {
+		return false, err
+	}
+	if n := trailerLength(tail, l.delimiter); n > 0 {
+		tail, size = tail[:len(tail)-n], size-int64(n)
+	}
+	switch {
+	case size == 0, bytes.HasSuffix(tail, l.commitMarkerFrame()):
+		return true, nil
+	case size == int64(len(tail)):
+		// The whole log is in tail, and may consist only of a header.
+		return isHeader(tail) && bytes.IndexByte(tail, l.delimiter) == len(tail)-1, nil
+	default:
+		return false, nil
+	}
+}
+
+// tail returns up to the last "n" bytes of the log and its size, preserving its
+// position. Must be called with the lock held.
+func (l *Log[State]) tail(n int64) ([]byte, int64, error) {
+	var tail []byte
+	var size int64
+	err := l.rewound(func(*reader) error {
+		var err error
+		if size, err = l.f.Seek(0, io.SeekEnd); err != nil {
+			return fmt.Errorf("failed to determine log size: %w", err)
+		}
+		if n > size {
+			n = size
+		}
+		if _, err := l.f.Seek(size-n, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek to end of log: %w", err)
+		}
+		tail = make([]byte, n)
+		if _, err := io.ReadFull(l.f, tail); err != nil {
+			return fmt.Errorf("failed to read end of log: %w", err)
+		}
+		return nil
+	})
+	return tail, size, err
+}
+
+// withCommitMarker appends a commit marker to frames if one is due after
+// appending "entries" entries.
+func (l *Log[State]) withCommitMarker(frames []byte, entries int) []byte {
+	if !l.commitMarker || l.commitMarkerEvery == 0 || entries == 0 {
+		return frames
+	}
+	l.sinceMarker += entries
+	if l.sinceMarker < l.commitMarkerEvery {
+		return frames
+	}
+	l.sinceMarker = 0
+	return l.terminate(append(frames, commitMarker...))
+}
+
+// closeWithMarker writes a commit marker if the log doesn't already end with
+// one. Must be called with the lock held.
+func (l *Log[State]) closeWithMarker() error {
+	clean, err := l.endsClean()
+	if err != nil || clean {
+		return err
+	}
+	if _, err := l.f.Seek(0, io.SeekEnd); err != nil {
+		return fmt.Errorf("failed to seek to end of log: %w", err)
+	}
+	if err := l.write(l.commitMarkerFrame()); err != nil {
+		return err
+	}
+	return l.sync()
+}
@@ -0,0 +1,70 @@
+package replaylog
+
+import (
+	"os"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestCommitMarker(t *testing.T) {
+	dir := t.TempDir()
+	open := func() *Log[KV] {
+		t.Helper()
+		f, err := os.OpenFile(dir+"/log", os.O_RDWR|os.O_CREATE, 0o600)
+		assert.NoError(t, err)
+		log, err := New[KV](f, ops, WithCommitMarker(0))
+		assert.NoError(t, err)
+		return log
+	}
+
+	log := open()
+	clean, err := log.ReplayClean(KV{})
+	assert.NoError(t, err)
+	assert.True(t, clean, "empty log is clean")
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"})
+	assert.NoError(t, log.Close())
+
+	log = open()
+	state := KV{}
+	clean, err = log.ReplayClean(state)
+	assert.NoError(t, err)
+	assert.True(t, clean)
+	assert.Equal(t, KV{"foo": "bar"}, state)
+	appendAll(t, log, &Set{Key: "bar", Value: "waz"})
+	// Simulate a crash by not closing the log.
+	clean, err = log.ReplayClean(KV{})
+	assert.NoError(t, err)
+	assert.False(t, clean)
+	assert.NoError(t, log.f.Close())
+
+	log = open()
+	state = KV{}
+	clean, err = log.ReplayClean(state)
+	assert.NoError(t, err)
+	assert.False(t, clean)
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, state)
+	assert.NoError(t, log.Close())
+	assert.NoError(t, open().Close())
+
+	data, err := os.ReadFile(dir + "/log")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"k":0,"e":{"k":"foo","v":"bar"}}
+{"commit":true}
+{"k":0,"e":{"k":"bar","v":"waz"}}
+{"commit":true}
+`, string(data))
+}
+
+func TestCommitMarkerPeriodic(t *testing.T) {
+	log := newTestLog(t, WithCommitMarker(2))
+	appendAll(t, log, &Set{Key: "a", Value: "1"})
+	clean, err := log.ReplayClean(KV{})
+	assert.NoError(t, err)
+	assert.False(t, clean)
+	assert.NoError(t, log.AppendAtomic(&Set{Key: "b", Value: "2"}, &Delete{Key: "a"}))
+	clean, err = log.ReplayClean(KV{})
+	assert.NoError(t, err)
+	assert.True(t, clean)
+	assert.Equal(t, KV{"b": "2"}, replay(t, log))
+}
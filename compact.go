@@ -0,0 +1,440 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// ErrCompactionMismatch is returned by Compact when the compacted log does not
+// replay to the same State as the original log.
+var ErrCompactionMismatch = errors.New("compacted log does not replay to the original state")
+
+// Compact replaces the contents of the log with a smaller equivalent log.
+//
+// The log is replayed from the start into a fresh State from "factory", then
+// the ops returned by "snapshot" for that State are written to "dst" in the
+// order returned. Before switching over, dst is replayed into another fresh
+// State and compared to the original with reflect.DeepEqual. If they differ,
+// ErrCompactionMismatch is returned and the original log is left untouched.
+//
+// On success the log switches to dst, positioned at its end, and the original
+// File is closed. If both Files are *os.File, dst is also atomically renamed
+// over the original.
+//
+// Appends are blocked for the duration of the compaction.
+func (l *Log[State]) Compact(dst File, factory func() State, snapshot func(State) []Op[State]) error {
+	return l.compact(dst, factory, snapshot, nil)
+}
+
+// OpSnapshotter is an optional interface that a State can implement to be
+// compacted by CompactState.
+type OpSnapshotter[State any] interface {
+	// SnapshotOp returns a single op that reproduces the State when applied
+	// to an empty State.
+	SnapshotOp() (Op[State], error)
+}
+
+// CompactState replaces the contents of the log with a single snapshot entry
+// holding the op returned by SnapshotOp for "state", which must implement
+// OpSnapshotter and be the result of replaying the whole log.
+//
+// Replay resets dest, as for WithResetBeforeReplay, before applying a snapshot
+// entry, so State must be a non-nil map or implement Resettable. Ops appended
+// afterwards follow the snapshot. As for Compact, the snapshot is written to
+// dst, synced and verified by replaying it into a new State before the log
+// switches to it, atomically renaming it over the original if both are
+// *os.File. Appends are blocked for the duration.
+func (l *Log[State]) CompactState(dst File, state State) error {
+	snapshotter, ok := any(state).(OpSnapshotter[State])
+	if !ok {
+		return fmt.Errorf("can't compact state of type %T, it must implement OpSnapshotter", state)
+	}
+	op, err := snapshotter.SnapshotOp()
+	if err != nil {
+		return fmt.Errorf("failed to snapshot state: %w", err)
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.readOnly {
+		return ErrReadOnly
+	}
+	compacted, err := l.writeCompacted(dst, state, newState[State], []Op[State]{op}, true)
+	if err != nil {
+		return err
+	}
+	// The log may keep its own State up to date, which mustn't be the
+	// caller's.
+	shadow := newState[State]()
+	if err := op.Apply(shadow); err != nil {
+		return err
+	}
+	return l.switchToCompacted(dst, compacted, shadow)
+}
+
+// compact is Compact, replaying the original log with only the ops accepted by
+// "keep", if non-nil.
+func (l *Log[State]) compact(dst File, factory func() State, snapshot func(State) []Op[State], keep func(Op[State]) bool) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.readOnly {
+		return ErrReadOnly
+	}
+	pos, err := l.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to determine log position: %w", err)
+	}
+	if _, err := l.f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind log: %w", err)
+	}
+	original := factory()
+	_, err = l.replayUntil(l.newReader(l.f, 0), original, replayControl[State]{shadow: true, keep: keep})
+	if _, serr := l.f.Seek(pos, io.SeekStart); serr != nil && err == nil {
+		err = fmt.Errorf("failed to restore log position: %w", serr)
+	}
+	if err != nil {
+		return err
+	}
+
+	compacted, err := l.writeCompacted(dst, original, factory, snapshot(original), false)
+	if err != nil {
+		return err
+	}
+	return l.switchToCompacted(dst, compacted, original)
+}
+
+// switchToCompacted replaces the log with "compacted", written to dst, whose
+// State is "original". Must be called with the lock held.
+func (l *Log[State]) switchToCompacted(dst File, compacted *Log[State], original State) error {
+	f, buf := compacted.f, compacted.buf
+	if src, ok := l.f.(*os.File); ok {
+		if dstf, ok := dst.(*os.File); ok {
+			if err := os.Rename(dstf.Name(), src.Name()); err != nil {
+				return fmt.Errorf("failed to replace log with compacted log: %w", err)
+			}
+			f, buf = reopenRenamed(dstf, src.Name()), nil
+		}
+	}
+	_ = l.f.Close()
+	l.f = f
+	l.buf = buf
+	l.size = compacted.size
+	l.entries = compacted.entries
+	l.pending = 0
+	l.forgetEntries()
+	if l.snapshotEvery > 0 {
+		// Offsets in the previous snapshot refer to the original log.
+		l.snapshots = periodicSnapshots[State]{state: original, valid: true, offset: l.size}
+		l.snapshotNow()
+	}
+	return nil
+}
+
+// writeCompacted writes "ops", the snapshot of "original", to dst, then
+// verifies that they replay to a State equal to "original". If "resets" is
+// true the first entry is marked to reset the State before it is applied. It
+// returns a Log over dst positioned at its end.
+func (l *Log[State]) writeCompacted(dst File, original State, factory func() State, ops []Op[State], resets bool) (*Log[State], error) {
+	compacted := l.withFile(dst)
+	if l.header {
+		if err := compacted.initHeader(); err != nil {
+			return nil, err
+		}
+	}
+	var frames []byte
+	for i, op := range ops {
+		e, err := compacted.newEntry(op)
+		if err != nil {
+			return nil, err
+		}
+		e.Reset = resets && i == 0
+		frame, err := compacted.encodeFrame(e)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, frame...)
+	}
+	if err := compacted.write(frames); err != nil {
+		return nil, err
+	}
+	if err := compacted.sync(); err != nil {
+		return nil, err
+	}
+
+	if _, err := compacted.f.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind compacted log: %w", err)
+	}
+	verify := factory()
+	r := l.newReader(compacted.f, 0)
+	if err := compacted.replay(r, verify); err != nil {
+		return nil, fmt.Errorf("failed to replay compacted log: %w", err)
+	}
+	compacted.size = r.offset
+	compacted.entries = r.index
+	if !reflect.DeepEqual(original, verify) {
+		return nil, ErrCompactionMismatch
+	}
+	return compacted, nil
+}
+
+// withFile returns a Log over f with the same ops and options as l.
+func (l *Log[State]) withFile(f File) *Log[State] {
+	return &Log[State]{
+		f:       seekable(f),
+		ops:     l.ops,
+		events:  l.events,
+		options: l.options,
+		hooks:   l.hooks,
+		entries: -1,
+	}
+}
+
+// CompactLatest compacts the log by keeping only the last op for each key, as
+// returned by "keyOf", in their original order. Ops for which keyOf returns
+// false are always kept.
+//
+// The log must be an *os.File. The compacted log is written to a temporary
+// file in the same directory and verified as for Compact, using a new empty
+// State for each replay, before atomically replacing the original.
+func (l *Log[State]) CompactLatest(keyOf func(op Op[State]) (string, bool)) error {
+	return l.compactInPlace(nil, func(ops []Op[State]) ([]Op[State], error) {
+		latest := map[string]int{}
+		for i, op := range ops {
+			if key, ok := keyOf(op); ok {
+				if prev, ok := latest[key]; ok {
+					ops[prev] = nil
+				}
+				latest[key] = i
+			}
+		}
+		return ops, nil
+	})
+}
+
+// Expirer is an optional interface that an Op can implement to be dropped by
+// CompactExpired once it has expired.
+type Expirer interface {
+	// ExpiresAt returns the time the op expires, or false if it never does.
+	ExpiresAt() (time.Time, bool)
+}
+
+// CompactExpired compacts the log by dropping every op implementing Expirer
+// that expired before "now", keeping all other ops in their original order.
+//
+// The log must be an *os.File. As for CompactLatest, the compacted log is
+// written to a temporary file in the same directory before atomically
+// replacing the original, after verifying that it replays to the same State
+// as the original log would if the expired ops had never been appended.
+func (l *Log[State]) CompactExpired(now time.Time) error {
+	live := func(op Op[State]) bool {
+		expirer, ok := op.(Expirer)
+		if !ok {
+			return true
+		}
+		expiresAt, ok := expirer.ExpiresAt()
+		return !ok || !expiresAt.Before(now)
+	}
+	return l.compactInPlace(live, func(ops []Op[State]) ([]Op[State], error) {
+		for i, op := range ops {
+			if !live(op) {
+				ops[i] = nil
+			}
+		}
+		return ops, nil
+	})
+}
+
+// FindRedundant returns the indices of entries in the log whose ops can be
+// dropped because a later op supersedes or cancels them, for CompactDrop.
+//
+// "redundant" is called with an op and the next op that has not itself been
+// found redundant, and must return true only if applying "prev" then "next"
+// to any State has the same effect as applying "next" alone, such as a Set
+// followed by a Delete of the same key. Dropping an op makes the op before it
+// adjacent to "next", so chains of redundant ops are found. The position of
+// the log is preserved.
+func (l *Log[State]) FindRedundant(redundant func(prev, next Op[State]) bool) ([]int, error) {
+	type survivor struct {
+		index int
+		op    Op[State]
+	}
+	var survivors []survivor
+	var indices []int
+	err := l.eachOp(func(index int, _ Frame, op Op[State]) error {
+		for len(survivors) > 0 && redundant(survivors[len(survivors)-1].op, op) {
+			indices = append(indices, survivors[len(survivors)-1].index)
+			survivors = survivors[:len(survivors)-1]
+		}
+		survivors = append(survivors, survivor{index, op})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Ints(indices)
+	return indices, nil
+}
+
+// CompactDrop compacts the log by dropping the entries at "indices", such as
+// those returned by FindRedundant, keeping all other ops in their original
+// order.
+//
+// As for CompactLatest, the log must be an *os.File, and the compacted log is
+// verified to replay to the same State as the original before it atomically
+// replaces it, so dropping an entry that isn't redundant fails with
+// ErrCompactionMismatch.
+func (l *Log[State]) CompactDrop(indices []int) error {
+	return l.compactInPlace(nil, func(ops []Op[State]) ([]Op[State], error) {
+		for _, index := range indices {
+			if index < 0 || index >= len(ops) {
+				return nil, fmt.Errorf("can't drop entry %d from log of %d entries", index, len(ops))
+			}
+			ops[index] = nil
+		}
+		return ops, nil
+	})
+}
+
+// compactInPlace compacts the log into a temporary file that replaces it, as
+// for CompactLatest. "drop" is called with every op in the log, and may set
+// ops to nil to remove them. The original log is replayed with only the ops
+// accepted by "keep", if non-nil, to verify the compacted log.
+func (l *Log[State]) compactInPlace(keep func(Op[State]) bool, drop func(ops []Op[State]) ([]Op[State], error)) error {
+	src, ok := l.f.(*os.File)
+	if !ok {
+		return fmt.Errorf("can't compact log of type %T in place, it must be an *os.File", l.f)
+	}
+	var ops []Op[State]
+	err := l.fromStart(func(r *reader) error {
+		for {
+			logEntry, err := l.nextEntry(r)
+			if errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			op, err := l.decodeOp(logEntry)
+			if err != nil {
+				return err
+			}
+			ops = append(ops, op)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if ops, err = drop(ops); err != nil {
+		return err
+	}
+	survivors := ops[:0]
+	for _, op := range ops {
+		if op != nil {
+			survivors = append(survivors, op)
+		}
+	}
+	dst, err := os.CreateTemp(filepath.Dir(src.Name()), filepath.Base(src.Name())+".*.compact")
+	if err != nil {
+		return fmt.Errorf("failed to create compacted log: %w", err)
+	}
+	// Any entries appended since the scan are missing from survivors, so
+	// verification fails rather than losing them.
+	err = l.compact(dst, newState[State], func(State) []Op[State] { return survivors }, keep)
+	if err != nil {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+		return err
+	}
+	return nil
+}
+
+// InitFromState initialises an empty log with the ops returned by "snapshot"
+// for "state", so that replaying the log reproduces it. This is the inverse of
+// Compact, for bootstrapping a log from a State that was not previously
+// logged.
+//
+// An error is returned if the log already contains entries.
+func (l *Log[State]) InitFromState(state State, snapshot func(State) []Op[State]) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.encoded = 0
+	n, err := l.count()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("can't initialise a log that already contains %d entries", n)
+	}
+	events := snapshot(state)
+	var frames []byte
+	for _, event := range events {
+		data, err := l.encode(event)
+		if err != nil {
+			return err
+		}
+		frames = append(frames, data...)
+	}
+	if len(frames) == 0 {
+		return nil
+	}
+	if err := l.writeAndSync(frames, len(events)); err != nil {
+		return err
+	}
+	for _, event := range events {
+		l.publish(event)
+	}
+	return nil
+}
+
+// appendBatchSize is the number of ops ReplayCompacting and ImportTyped append
+// in each write.
+const appendBatchSize = 1024
+
+// ReplayCompacting is like Replay, but also appends to "out" each replayed op
+// for which keep returns true, producing a compacted log in a single pass.
+//
+// keep is called with each op and the state of dest before the op is applied,
+// so it can drop ops that have no effect, such as deleting a key that does not
+// exist. Kept ops are appended in batches once applied. It is up to keep to
+// only drop ops that don't affect the result: no verification is performed,
+// so the caller should check that "out" replays to the same State before
+// switching over to it.
+func (l *Log[State]) ReplayCompacting(dest State, out *Log[State], keep func(op Op[State], state State) bool) error {
+	defer l.startReplaying()()
+	r, err := l.startReplay(dest)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	batch := out.Batch()
+	defer batch.Discard()
+	_, err = l.replayUntil(r, dest, replayControl[State]{
+		dispatch: func(logEntry Frame, op, parent Op[State]) error {
+			kept := keep(op, dest)
+			err := l.apply(logEntry, op, parent, dest)
+			if err != nil && !errors.Is(err, ErrStopReplay) {
+				return err
+			}
+			if kept {
+				if berr := batch.Add(op); berr != nil {
+					return berr
+				}
+			}
+			if batch.Len() >= appendBatchSize {
+				if _, berr := batch.Commit(); berr != nil {
+					return berr
+				}
+			}
+			return err
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = batch.Commit()
+	return err
+}
@@ -0,0 +1,303 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func snapshotKV(state KV) []Op[KV] {
+	keys := make([]string, 0, len(state))
+	for key := range state {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	ops := make([]Op[KV], 0, len(keys))
+	for _, key := range keys {
+		ops = append(ops, &Set{Key: key, Value: state[key]})
+	}
+	return ops
+}
+
+func TestCompact(t *testing.T) {
+	log := newTestLog(t)
+	path := log.f.(*os.File).Name()
+	appendAll(t, log,
+		&Set{Key: "foo", Value: "bar"},
+		&Set{Key: "bar", Value: "waz"},
+		&Set{Key: "foo", Value: "waz"},
+		&Delete{Key: "bar"},
+	)
+
+	t.Run("Mismatch", func(t *testing.T) {
+		dst, err := ioutil.TempFile(t.TempDir(), "")
+		assert.NoError(t, err)
+		err = log.Compact(dst, func() KV { return KV{} }, func(KV) []Op[KV] { return nil })
+		assert.True(t, errors.Is(err, ErrCompactionMismatch))
+		appendAll(t, log, &Set{Key: "a", Value: "b"})
+		assert.Equal(t, KV{"foo": "waz", "a": "b"}, replay(t, log))
+	})
+
+	dst, err := ioutil.TempFile(t.TempDir(), "")
+	assert.NoError(t, err)
+	err = log.Compact(dst, func() KV { return KV{} }, snapshotKV)
+	assert.NoError(t, err)
+	appendAll(t, log, &Delete{Key: "a"})
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"k":0,"e":{"k":"a","v":"b"}}
+{"k":0,"e":{"k":"foo","v":"waz"}}
+{"k":1,"e":{"k":"a"}}
+`, string(data))
+	assert.Equal(t, KV{"foo": "waz"}, replay(t, log))
+}
+
+func TestCompactTwice(t *testing.T) {
+	log := newTestLog(t)
+	path := log.f.(*os.File).Name()
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Set{Key: "foo", Value: "waz"})
+	for i := 0; i < 2; i++ {
+		dst, err := os.CreateTemp(filepath.Dir(path), "")
+		assert.NoError(t, err)
+		assert.NoError(t, log.Compact(dst, func() KV { return KV{} }, snapshotKV))
+		appendAll(t, log, &Set{Key: fmt.Sprint(i), Value: "v"})
+	}
+	assert.Equal(t, path, log.f.(*os.File).Name())
+	assert.NoError(t, log.Close())
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	assert.NoError(t, err)
+	log, err = New[KV](f, ops)
+	assert.NoError(t, err)
+	defer log.Close()
+	assert.Equal(t, KV{"foo": "waz", "0": "v", "1": "v"}, replay(t, log))
+}
+
+func TestCompactLatest(t *testing.T) {
+	log := newTestLog(t)
+	path := log.f.(*os.File).Name()
+	appendAll(t, log,
+		&Set{Key: "foo", Value: "bar"},
+		&Set{Key: "bar", Value: "waz"},
+		&Set{Key: "foo", Value: "waz"},
+		&Delete{Key: "bar"},
+		&Set{Key: "waz", Value: "foo"},
+	)
+	keyOf := func(op Op[KV]) (string, bool) {
+		switch op := op.(type) {
+		case *Set:
+			return op.Key, true
+		case *Delete:
+			return op.Key, true
+		}
+		return "", false
+	}
+	err := log.CompactLatest(keyOf)
+	assert.NoError(t, err)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"k":0,"e":{"k":"foo","v":"waz"}}
+{"k":1,"e":{"k":"bar"}}
+{"k":0,"e":{"k":"waz","v":"foo"}}
+`, string(data))
+	appendAll(t, log, &Set{Key: "bar", Value: "foo"})
+	assert.Equal(t, KV{"foo": "waz", "waz": "foo", "bar": "foo"}, replay(t, log))
+
+	// An incorrect keyOf is detected.
+	err = log.CompactLatest(func(Op[KV]) (string, bool) { return "", true })
+	assert.True(t, errors.Is(err, ErrCompactionMismatch))
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+
+	// A second compaction replaces the log rather than the first compacted
+	// file.
+	assert.NoError(t, log.CompactLatest(keyOf))
+	appendAll(t, log, &Delete{Key: "waz"})
+	assert.NoError(t, log.Close())
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	assert.NoError(t, err)
+	log, err = New[KV](f, ops)
+	assert.NoError(t, err)
+	defer log.Close()
+	assert.Equal(t, KV{"foo": "waz", "bar": "foo"}, replay(t, log))
+	entries, err = os.ReadDir(filepath.Dir(path))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+}
+
+// lease is a Set that expires.
+type lease struct {
+	Set
+	Expires time.Time `json:"x"`
+}
+
+func (l *lease) ExpiresAt() (time.Time, bool) { return l.Expires, true }
+
+func TestCompactExpired(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "")
+	assert.NoError(t, err)
+	log, err := New[KV](f, []Op[KV]{&Set{}, &Delete{}, &lease{}})
+	assert.NoError(t, err)
+	defer log.Close()
+	now := time.Unix(1000, 0).UTC()
+	appendAll(t, log,
+		&Set{Key: "foo", Value: "bar"},
+		&lease{Set: Set{Key: "bar", Value: "waz"}, Expires: now.Add(-time.Second)},
+		&lease{Set: Set{Key: "foo", Value: "waz"}, Expires: now.Add(-time.Second)},
+		&lease{Set: Set{Key: "waz", Value: "foo"}, Expires: now},
+		&Delete{Key: "bar"},
+	)
+	assert.Equal(t, KV{"foo": "waz", "waz": "foo"}, replay(t, log))
+	err = log.CompactExpired(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, log.entries)
+	assert.Equal(t, KV{"foo": "bar", "waz": "foo"}, replay(t, log))
+}
+
+func TestFindRedundantAndCompactDrop(t *testing.T) {
+	log := newTestLog(t)
+	appendAll(t, log,
+		&Set{Key: "foo", Value: "bar"},
+		&Set{Key: "bar", Value: "waz"},
+		&Set{Key: "bar", Value: "foo"},
+		&Delete{Key: "bar"},
+		&Set{Key: "waz", Value: "foo"},
+	)
+	redundant := func(prev, next Op[KV]) bool {
+		set, ok := prev.(*Set)
+		if !ok {
+			return false
+		}
+		switch next := next.(type) {
+		case *Set:
+			return next.Key == set.Key
+		case *Delete:
+			return next.Key == set.Key
+		}
+		return false
+	}
+	indices, err := log.FindRedundant(redundant)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, indices)
+	expected := replay(t, log)
+	assert.NoError(t, log.CompactDrop(indices))
+	assert.Equal(t, 3, log.entries)
+	assert.Equal(t, expected, replay(t, log))
+
+	err = log.CompactDrop([]int{0})
+	assert.True(t, errors.Is(err, ErrCompactionMismatch))
+	err = log.CompactDrop([]int{3})
+	assert.EqualError(t, err, "can't drop entry 3 from log of 3 entries")
+}
+
+func TestInitFromState(t *testing.T) {
+	log := newTestLog(t)
+	state := KV{"foo": "bar", "bar": "waz"}
+	assert.NoError(t, log.InitFromState(state, snapshotKV))
+	assert.Equal(t, state, replay(t, log))
+
+	err := log.InitFromState(state, snapshotKV)
+	assert.EqualError(t, err, "can't initialise a log that already contains 2 entries")
+}
+
+func TestReplayCompacting(t *testing.T) {
+	log := newTestLog(t)
+	appendAll(t, log,
+		&Set{Key: "foo", Value: "bar"},
+		&Delete{Key: "missing"},
+		&Set{Key: "foo", Value: "bar"},
+		&Set{Key: "bar", Value: "waz"},
+		&Delete{Key: "foo"},
+	)
+	out := newTestLog(t)
+	assert.NoError(t, log.Rewind())
+	state := KV{}
+	err := log.ReplayCompacting(state, out, func(op Op[KV], state KV) bool {
+		switch op := op.(type) {
+		case *Set:
+			value, ok := state[op.Key]
+			return !ok || value != op.Value
+		case *Delete:
+			_, ok := state[op.Key]
+			return ok
+		}
+		return true
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"bar": "waz"}, state)
+	assert.Equal(t, state, replay(t, out))
+	n := 0
+	assert.NoError(t, out.Each(func(EntryInfo, Op[KV]) error { n++; return nil }))
+	assert.Equal(t, 3, n)
+}
+
+type indexState map[string]string
+
+func (s indexState) SnapshotOp() (Op[indexState], error) {
+	return &loadIndex{Entries: map[string]string(s)}, nil
+}
+
+type putIndex struct {
+	Key   string `json:"k"`
+	Value string `json:"v"`
+}
+
+func (p *putIndex) Apply(s indexState) error {
+	s[p.Key] = p.Value
+	return nil
+}
+
+type loadIndex struct {
+	Entries map[string]string `json:"entries"`
+}
+
+func (l *loadIndex) Apply(s indexState) error {
+	for k, v := range l.Entries {
+		s[k] = v
+	}
+	return nil
+}
+
+func TestCompactState(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "")
+	assert.NoError(t, err)
+	log, err := New[indexState](f, []Op[indexState]{&putIndex{}, &loadIndex{}})
+	assert.NoError(t, err)
+	defer log.Close()
+	for _, value := range []string{"1", "2", "3"} {
+		assert.NoError(t, log.Append(&putIndex{Key: "a", Value: value}))
+	}
+	assert.NoError(t, log.Append(&putIndex{Key: "b", Value: "4"}))
+	state := indexState{}
+	assert.NoError(t, log.Rewind())
+	assert.NoError(t, log.Replay(state))
+
+	dst, err := os.CreateTemp(t.TempDir(), "")
+	assert.NoError(t, err)
+	assert.NoError(t, log.CompactState(dst, state))
+	assert.NoError(t, log.Append(&putIndex{Key: "c", Value: "5"}))
+	data, err := os.ReadFile(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, `{"k":1,"e":{"entries":{"a":"3","b":"4"}},"r":true}
+{"k":0,"e":{"k":"c","v":"5"}}
+`, string(data))
+
+	// The snapshot entry resets the State before it is applied.
+	state = indexState{"stale": "x"}
+	assert.NoError(t, log.Rewind())
+	assert.NoError(t, log.Replay(state))
+	assert.Equal(t, indexState{"a": "3", "b": "4", "c": "5"}, state)
+
+	kv := newTestLog(t)
+	err = kv.CompactState(&MemoryFile{}, KV{})
+	assert.EqualError(t, err, "can't compact state of type replaylog.KV, it must implement OpSnapshotter")
+}
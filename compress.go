@@ -0,0 +1,123 @@
+package replaylog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression algorithm used for log entries.
+type Compression int
+
+// Supported compression algorithms.
+const (
+	CompressNone Compression = iota
+	CompressGzip
+	CompressZstd
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressNone:
+		return "none"
+	case CompressGzip:
+		return "gzip"
+	case CompressZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("Compression(%d)", int(c))
+	}
+}
+
+// compressor compresses and decompresses individual entries, lazily creating
+// the zstd encoder and decoder.
+type compressor struct {
+	dict    []byte // zstd dictionary, set by WithZstdDictionary.
+	encOnce sync.Once
+	enc     *zstd.Encoder
+	encErr  error
+	decOnce sync.Once
+	dec     *zstd.Decoder
+	decErr  error
+}
+
+func (c *compressor) compress(compression Compression, level int, data []byte) ([]byte, error) {
+	var compressed []byte
+	switch compression {
+	case CompressGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		buf := &bytes.Buffer{}
+		w, err := gzip.NewWriterLevel(buf, level)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = w.Write(data); err != nil {
+			return nil, err
+		}
+		if err = w.Close(); err != nil {
+			return nil, err
+		}
+		compressed = buf.Bytes()
+
+	case CompressZstd:
+		c.encOnce.Do(func() {
+			zlevel := zstd.SpeedDefault
+			if level != 0 {
+				zlevel = zstd.EncoderLevelFromZstd(level)
+			}
+			options := []zstd.EOption{zstd.WithEncoderLevel(zlevel)}
+			if c.dict != nil {
+				options = append(options, zstd.WithEncoderDict(c.dict))
+			}
+			c.enc, c.encErr = zstd.NewWriter(nil, options...)
+		})
+		if c.encErr != nil {
+			return nil, c.encErr
+		}
+		compressed = c.enc.EncodeAll(data, nil)
+
+	default:
+		return nil, fmt.Errorf("unsupported compression %s", compression)
+	}
+	return compressed, nil
+}
+
+func (c *compressor) decompress(name string, data []byte) ([]byte, error) {
+	switch name {
+	case CompressGzip.String():
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.Close(); err != nil {
+			return nil, err
+		}
+		return data, nil
+
+	case CompressZstd.String():
+		c.decOnce.Do(func() {
+			var options []zstd.DOption
+			if c.dict != nil {
+				options = append(options, zstd.WithDecoderDicts(c.dict))
+			}
+			c.dec, c.decErr = zstd.NewReader(nil, options...)
+		})
+		if c.decErr != nil {
+			return nil, c.decErr
+		}
+		return c.dec.DecodeAll(data, nil)
+
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", name)
+	}
+}
@@ -0,0 +1,148 @@
+package replaylog
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// nopSyncFile is a File that doesn't sync, for benchmarks.
+type nopSyncFile struct{ *os.File }
+
+func (nopSyncFile) Sync() error { return nil }
+
+func TestCompression(t *testing.T) {
+	for _, compression := range []Compression{CompressGzip, CompressZstd} {
+		t.Run(compression.String(), func(t *testing.T) {
+			log := newTestLog(t, WithCompression(compression), WithCompressionLevel(1))
+			value := strings.Repeat("compressible ", 100)
+			appendAll(t, log, &Set{Key: "foo", Value: value}, &Set{Key: "bar", Value: "waz"}, &Delete{Key: "bar"})
+			size, err := log.f.Seek(0, io.SeekCurrent)
+			assert.NoError(t, err)
+			assert.True(t, size < int64(len(value)), "%d >= %d", size, len(value))
+			assert.Equal(t, KV{"foo": value}, replay(t, log))
+		})
+	}
+
+	t.Run("Mixed", func(t *testing.T) {
+		f, err := ioutil.TempFile(t.TempDir(), "")
+		assert.NoError(t, err)
+		log, err := New[KV](f, ops)
+		assert.NoError(t, err)
+		appendAll(t, log, &Set{Key: "foo", Value: "bar"})
+		log, err = New[KV](f, ops, WithCompression(CompressZstd))
+		assert.NoError(t, err)
+		defer log.Close()
+		appendAll(t, log, &Set{Key: "bar", Value: "waz"})
+		assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, replay(t, log))
+	})
+}
+
+func BenchmarkCompression(b *testing.B) {
+	workload := make([]Op[KV], 1000)
+	for i := range workload {
+		workload[i] = &Set{Key: fmt.Sprintf("key-%d", i%100), Value: fmt.Sprintf(`{"user":%d,"name":"user %d","active":true}`, i, i)}
+	}
+	for _, compression := range []Compression{CompressNone, CompressGzip, CompressZstd} {
+		b.Run(compression.String(), func(b *testing.B) {
+			b.Run("Append", func(b *testing.B) {
+				f, err := ioutil.TempFile(b.TempDir(), "")
+				assert.NoError(b, err)
+				log, err := New[KV](nopSyncFile{f}, ops, WithCompression(compression))
+				assert.NoError(b, err)
+				defer log.Close()
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					err = log.Append(workload[i%len(workload)])
+					assert.NoError(b, err)
+				}
+				b.StopTimer()
+				size, err := f.Seek(0, io.SeekCurrent)
+				assert.NoError(b, err)
+				b.ReportMetric(float64(size)/float64(b.N), "bytes/op")
+			})
+			b.Run("Replay", func(b *testing.B) {
+				f, err := ioutil.TempFile(b.TempDir(), "")
+				assert.NoError(b, err)
+				log, err := New[KV](nopSyncFile{f}, ops, WithCompression(compression))
+				assert.NoError(b, err)
+				defer log.Close()
+				for _, op := range workload {
+					err = log.Append(op)
+					assert.NoError(b, err)
+				}
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					err = log.Rewind()
+					assert.NoError(b, err)
+					err = log.Replay(KV{})
+					assert.NoError(b, err)
+				}
+			})
+		})
+	}
+}
+
+func TestWithEntryCompression(t *testing.T) {
+	log := newTestLog(t, WithEntryCompression(100))
+	large := strings.Repeat("large ", 100)
+	appendAll(t, log, &Set{Key: "small", Value: "value"}, &Set{Key: "large", Value: large})
+	data, err := os.ReadFile(log.f.(*os.File).Name())
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Equal(t, `{"k":0,"e":{"k":"small","v":"value"}}`, lines[0])
+	assert.Contains(t, lines[1], `"z":"zstd"`)
+	assert.Equal(t, KV{"small": "value", "large": large}, replay(t, log))
+}
+
+func TestWithZstdDictionary(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 100; i++ {
+		samples = append(samples, []byte(fmt.Sprintf(`{"k":"user/%d/settings","v":"theme=dark;language=en;timezone=UTC;notifications=%d"}`, i, i%3)))
+	}
+	dict, err := zstd.BuildDict(zstd.BuildDictOptions{ID: 1, Offsets: [3]int{1, 4, 8}, Contents: samples, History: []byte(`{"k":"user/settings","v":"theme=dark;language=en;timezone=UTC;notifications="}`)})
+	assert.NoError(t, err)
+
+	sizeOf := func(options ...Option) (int64, *Log[KV]) {
+		log := newTestLog(t, options...)
+		appendAll(t, log, &Set{Key: "user/7/settings", Value: "theme=dark;language=en;timezone=UTC;notifications=1"})
+		size, err := log.f.Seek(0, io.SeekCurrent)
+		assert.NoError(t, err)
+		return size, log
+	}
+	plain, _ := sizeOf(WithCompression(CompressZstd))
+	withDict, log := sizeOf(WithZstdDictionary(dict))
+	assert.True(t, withDict < plain, "%d >= %d", withDict, plain)
+	assert.Equal(t, KV{"user/7/settings": "theme=dark;language=en;timezone=UTC;notifications=1"}, replay(t, log))
+
+	// The same dictionary is needed to replay.
+	f, err := os.Open(log.f.(*os.File).Name())
+	assert.NoError(t, err)
+	reader, err := New[KV](f, ops, WithReadOnly())
+	assert.NoError(t, err)
+	defer reader.Close()
+	assert.Error(t, reader.Replay(KV{}))
+
+	_, err = New[KV](&MemoryFile{}, ops, WithZstdDictionary(dict), WithCompression(CompressGzip))
+	assert.EqualError(t, err, "WithZstdDictionary requires zstd compression but got gzip")
+}
+
+func TestGzipChecksumVerified(t *testing.T) {
+	c := &compressor{}
+	compressed, err := c.compress(CompressGzip, 0, []byte(`{"k":"a","v":"b"}`))
+	assert.NoError(t, err)
+	// Corrupt the CRC-32 in the gzip trailer.
+	compressed[len(compressed)-8] ^= 0xff
+	_, err = c.decompress(CompressGzip.String(), compressed)
+	assert.True(t, errors.Is(err, gzip.ErrChecksum), "%v", err)
+}
@@ -0,0 +1,85 @@
+package replaylog
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// ConcurrentKV is a State that is safe to read while it is being replayed into.
+type ConcurrentKV = *sync.Map
+
+type ConcurrentSet struct {
+	Key   string `json:"k"`
+	Value string `json:"v"`
+}
+
+func (s *ConcurrentSet) Apply(kv ConcurrentKV) error {
+	kv.Store(s.Key, s.Value)
+	return nil
+}
+
+type ConcurrentDelete struct {
+	Key string `json:"k"`
+}
+
+func (d *ConcurrentDelete) Apply(kv ConcurrentKV) error {
+	kv.Delete(d.Key)
+	return nil
+}
+
+func Example_concurrentState() {
+	log, err := New[ConcurrentKV](&MemoryFile{}, []Op[ConcurrentKV]{&ConcurrentSet{}, &ConcurrentDelete{}})
+	if err != nil {
+		panic(err)
+	}
+	_ = log.Append(&ConcurrentSet{Key: "foo", Value: "bar"})
+	_ = log.Append(&ConcurrentSet{Key: "bar", Value: "waz"})
+	_ = log.Append(&ConcurrentDelete{Key: "bar"})
+
+	state := &sync.Map{}
+	_ = log.Rewind()
+	_ = log.Replay(state)
+	value, _ := state.Load("foo")
+	fmt.Println(value)
+	// Output: bar
+}
+
+func TestConcurrentReadDuringReplay(t *testing.T) {
+	log, err := New[ConcurrentKV](&MemoryFile{}, []Op[ConcurrentKV]{&ConcurrentSet{}, &ConcurrentDelete{}})
+	assert.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		err = log.Append(&ConcurrentSet{Key: strconv.Itoa(i % 10), Value: strconv.Itoa(i)})
+		assert.NoError(t, err)
+	}
+	err = log.Rewind()
+	assert.NoError(t, err)
+
+	state := &sync.Map{}
+	done := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					state.Range(func(key, value any) bool { return true })
+				}
+			}
+		}()
+	}
+	err = log.Replay(state)
+	close(done)
+	wg.Wait()
+	assert.NoError(t, err)
+	value, ok := state.Load("9")
+	assert.True(t, ok)
+	assert.Equal(t, "999", value)
+}
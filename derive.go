@@ -0,0 +1,63 @@
+package replaylog
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Deriver is an optional interface that an Op can implement to generate
+// follow-up ops when it is applied with AppendAndApply.
+type Deriver[State any] interface {
+	Op[State]
+	// Derive returns ops to append after this op has been applied to state.
+	Derive(state State) ([]Op[State], error)
+}
+
+// AppendAndApply appends event to the log and then applies it to state, as a
+// live counterpart to Replay.
+//
+// If event implements Deriver, the ops it derives from the updated state are
+// then appended atomically and applied to state in turn. Derived ops are not
+// themselves derived from.
+//
+// Replay never calls Derive: derived ops are already recorded in the log, and
+// are replayed like any other op, so replaying a log reproduces the live State
+// only if Derive is deterministic for a given State. If applying an op fails
+// after it has been appended, the op remains in the log.
+func (l *Log[State]) AppendAndApply(state State, event Op[State]) error {
+	event, err := l.append(event)
+	if err != nil {
+		return err
+	}
+	if err := l.applyLive(event, state); err != nil {
+		return err
+	}
+	deriver, ok := event.(Deriver[State])
+	if !ok {
+		return nil
+	}
+	derived, err := deriver.Derive(state)
+	if err != nil {
+		return fmt.Errorf("could not derive ops from %T: %w", event, err)
+	}
+	if len(derived) == 0 {
+		return nil
+	}
+	if derived, err = l.appendAtomic(derived); err != nil {
+		return err
+	}
+	for _, op := range derived {
+		if err := l.applyLive(op, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyLive applies an op that has just been appended to state.
+func (l *Log[State]) applyLive(op Op[State], state State) error {
+	if err := l.applyOp(Frame{Kind: l.events[reflect.TypeOf(op)], Version: l.appVersion}, op, nil, state); err != nil {
+		return fmt.Errorf("could not apply event of type %T: %w", op, err)
+	}
+	return nil
+}
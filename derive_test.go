@@ -0,0 +1,30 @@
+package replaylog
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// setWithAudit derives a Set recording the last key set.
+type setWithAudit struct {
+	Set
+}
+
+func (s *setWithAudit) Derive(state KV) ([]Op[KV], error) {
+	return []Op[KV]{&Set{Key: "audit", Value: s.Key}}, nil
+}
+
+func TestAppendAndApply(t *testing.T) {
+	f := &MemoryFile{}
+	log, err := New[KV](f, []Op[KV]{&Set{}, &Delete{}, &setWithAudit{}})
+	assert.NoError(t, err)
+	live := KV{}
+	assert.NoError(t, log.AppendAndApply(live, &setWithAudit{Set{Key: "foo", Value: "bar"}}))
+	assert.NoError(t, log.AppendAndApply(live, &Delete{Key: "missing"}))
+	assert.Equal(t, KV{"foo": "bar", "audit": "foo"}, live)
+	assert.Equal(t, live, replay(t, log))
+	// The derived op is replayed from the log rather than re-derived.
+	assert.Equal(t, 3, bytes.Count(f.data, []byte("\n")))
+}
@@ -0,0 +1,86 @@
+package replaylog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"unsafe"
+)
+
+// DiffEntry describes an entry at which two logs differ.
+//
+// A or B is nil if the corresponding log has no entry at Index.
+type DiffEntry[State any] struct {
+	Index int
+	A     Op[State]
+	B     Op[State]
+}
+
+// Diff compares two logs entry by entry.
+//
+// The first entry whose kind or encoded event differs is reported. If the
+// logs have different lengths, the first entry present in only one of the logs
+// is also reported. An empty result means the logs are identical.
+//
+// Both logs are read from the start, and their positions restored afterwards.
+func Diff[State any](a, b *Log[State]) ([]DiffEntry[State], error) {
+	if a == b {
+		return nil, nil
+	}
+	// Lock the logs in a fixed order, so that concurrent Diff(a, b) and
+	// Diff(b, a) calls can't deadlock.
+	first, second := a, b
+	if uintptr(unsafe.Pointer(b)) < uintptr(unsafe.Pointer(a)) {
+		first, second = b, a
+	}
+	first.lock.Lock()
+	defer first.lock.Unlock()
+	second.lock.Lock()
+	defer second.lock.Unlock()
+	var diffs []DiffEntry[State]
+	err := a.rewound(func(ra *reader) error {
+		return b.rewound(func(rb *reader) error {
+			diverged := false
+			for index := 0; ; index++ {
+				ea, aerr := a.nextEntry(ra)
+				eb, berr := b.nextEntry(rb)
+				aeof, beof := errors.Is(aerr, io.EOF), errors.Is(berr, io.EOF)
+				if aerr != nil && !aeof {
+					return aerr
+				}
+				if berr != nil && !beof {
+					return berr
+				}
+				if aeof && beof {
+					return nil
+				}
+				if !aeof && !beof {
+					if diverged || (ea.Kind == eb.Kind && bytes.Equal(ea.Event, eb.Event)) {
+						continue
+					}
+					diverged = true
+				}
+				diff := DiffEntry[State]{Index: index}
+				var err error
+				if !aeof {
+					if diff.A, err = a.decodeOp(ea); err != nil {
+						return err
+					}
+				}
+				if !beof {
+					if diff.B, err = b.decodeOp(eb); err != nil {
+						return err
+					}
+				}
+				diffs = append(diffs, diff)
+				if aeof || beof {
+					return nil
+				}
+			}
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return diffs, nil
+}
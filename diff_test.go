@@ -0,0 +1,66 @@
+package replaylog
+
+import (
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestDiff(t *testing.T) {
+	a := newTestLog(t)
+	b := newTestLog(t)
+	appendAll(t, a, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"})
+	appendAll(t, b, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"})
+
+	diffs, err := Diff(a, b)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(diffs))
+
+	appendAll(t, a, &Delete{Key: "foo"}, &Set{Key: "a", Value: "b"})
+	appendAll(t, b, &Delete{Key: "bar"})
+
+	diffs, err = Diff(a, b)
+	assert.NoError(t, err)
+	assert.Equal(t, []DiffEntry[KV]{
+		{Index: 2, A: &Delete{Key: "foo"}, B: &Delete{Key: "bar"}},
+		{Index: 3, A: &Set{Key: "a", Value: "b"}},
+	}, diffs)
+
+	// Positions are restored so appends continue at the end.
+	appendAll(t, b, &Set{Key: "c", Value: "d"})
+	assert.Equal(t, KV{"foo": "bar", "c": "d"}, replay(t, b))
+}
+
+func TestDiffLockOrder(t *testing.T) {
+	a := newTestLog(t)
+	b := newTestLog(t)
+	appendAll(t, a, &Set{Key: "foo", Value: "bar"})
+	appendAll(t, b, &Set{Key: "foo", Value: "waz"})
+	if uintptr(unsafe.Pointer(b)) < uintptr(unsafe.Pointer(a)) {
+		a, b = b, a
+	}
+
+	// While a is locked, as if by a concurrent Diff(a, b), Diff(b, a) must
+	// wait for it without holding b.
+	a.lock.Lock()
+	done := make(chan error)
+	go func() {
+		_, err := Diff(b, a)
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	locked := b.lock.TryLock()
+	if locked {
+		b.lock.Unlock()
+	}
+	a.lock.Unlock()
+	assert.True(t, locked, "Diff(b, a) locked b before a")
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Diff(b, a) didn't complete")
+	}
+}
@@ -0,0 +1,205 @@
+package replaylog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// EntryInfo describes an entry in the log.
+type EntryInfo struct {
+	Index   int   // Index of the entry in the log.
+	Offset  int64 // Byte offset of the entry.
+	Version int   // Application version, set by WithAppVersion.
+	Seq     int   // Sequence number, set by WithSequenceNumbers.
+	// Time the entry was appended if set by WithTimestamps, otherwise zero.
+	Time time.Time
+	// Function and line that appended the entry, set by WithCallerTracking.
+	Caller string
+	// Metadata of the entry, set by AppendWithMeta.
+	Meta map[string]string
+}
+
+// Each calls fn with every decoded op in the log and a description of its
+// entry, without applying them.
+//
+// The log is read from the start and its position restored afterwards.
+// Iteration stops at the first error returned by fn.
+func (l *Log[State]) Each(fn func(info EntryInfo, op Op[State]) error) error {
+	return l.fromStart(func(r *reader) error {
+		for {
+			logEntry, err := l.nextEntry(r)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("entry %d: %w", r.index-1, err)
+			}
+			op, err := l.decodeOp(logEntry)
+			if err != nil {
+				return fmt.Errorf("entry %d: %w", r.index-1, err)
+			}
+			if err := fn(entryInfo(r, logEntry), op); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// EachRaw calls fn with the kind and encoded event of every entry in the log,
+// without decoding them into ops.
+//
+// This is a lower level alternative to Each for decoding events into types
+// other than the registered ops, such as projections with a different State.
+// Events are decompressed, but WithMigrations and WithEventTransform are not
+// applied. The event is only valid until fn returns.
+//
+// The log is read from the start and its position restored afterwards.
+// Iteration stops at the first error returned by fn.
+func (l *Log[State]) EachRaw(fn func(kind int, event json.RawMessage) error) error {
+	return l.fromStart(func(r *reader) error {
+		for {
+			logEntry, err := l.nextEntry(r)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("entry %d: %w", r.index-1, err)
+			}
+			if err := fn(logEntry.Kind, logEntry.Event); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// EachReverse calls fn with every decoded op in the log and its index, from
+// the last to the first, without applying them.
+//
+// The log is read twice: once from the start to find the offset of every
+// entry, then backwards one entry at a time, seeking to each. The position of
+// the log is restored afterwards. Iteration stops at the first error returned
+// by fn.
+func (l *Log[State]) EachReverse(fn func(index int, op Op[State]) error) error {
+	return l.fromStart(func(r *reader) error {
+		var offsets []int64
+		for {
+			if _, err := r.next(); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return fmt.Errorf("entry %d: %w", r.index, err)
+			}
+			offsets = append(offsets, r.start)
+		}
+		for index := len(offsets) - 1; index >= 0; index-- {
+			if _, err := l.f.Seek(offsets[index], io.SeekStart); err != nil {
+				return fmt.Errorf("failed to seek to entry %d: %w", index, err)
+			}
+			logEntry, err := l.nextEntry(l.newReader(l.f, offsets[index]))
+			if err != nil {
+				return fmt.Errorf("entry %d: %w", index, err)
+			}
+			op, err := l.decodeOp(logEntry)
+			if err != nil {
+				return fmt.Errorf("entry %d: %w", index, err)
+			}
+			if err := fn(index, op); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GroupByKind decodes every op in the log, without applying them, and returns
+// them grouped by kind: the index of their type in the ops passed to New.
+//
+// Every op in the log is held in memory at once, so for large logs prefer
+// streaming with Each and aggregating only what is needed.
+func (l *Log[State]) GroupByKind() (map[int][]Op[State], error) {
+	groups := map[int][]Op[State]{}
+	err := l.eachOp(func(index int, logEntry Frame, op Op[State]) error {
+		groups[logEntry.Kind] = append(groups[logEntry.Kind], op)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// entryInfo describes the entry last read by r.
+func entryInfo(r *reader, logEntry Frame) EntryInfo {
+	info := EntryInfo{
+		Index:   r.index - 1,
+		Offset:  r.start,
+		Version: logEntry.Version,
+		Seq:     logEntry.Seq,
+		Caller:  logEntry.Caller,
+		Meta:    logEntry.Meta,
+	}
+	if logEntry.Time != 0 {
+		info.Time = time.Unix(0, logEntry.Time)
+	}
+	return info
+}
+
+// caller returns the first function on the stack outside this package.
+func caller() string {
+	pc := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pc[:runtime.Callers(2, pc)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, packagePath+".") || strings.HasSuffix(frame.File, "_test.go") {
+			return fmt.Sprintf("%s:%d", frame.Function, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// packagePath is the import path of this package.
+var packagePath = reflect.TypeOf(EntryInfo{}).PkgPath()
+
+// EachSnapshot is like Each, but only visits the entries present in the log
+// when it is called, and does not block appends while iterating if the File
+// implements io.ReaderAt.
+//
+// This gives a consistent, terminating view of a log that is concurrently
+// appended to. Files that don't implement io.ReaderAt are read with appends
+// blocked, as for Each.
+func (l *Log[State]) EachSnapshot(fn func(info EntryInfo, op Op[State]) error) error {
+	ra, ok := l.f.(io.ReaderAt)
+	if !ok {
+		return l.Each(fn)
+	}
+	l.lock.Lock()
+	end, err := l.fileSize()
+	l.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	r := l.newReader(io.NewSectionReader(ra, 0, end), 0)
+	for {
+		logEntry, err := l.nextEntry(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", r.index-1, err)
+		}
+		op, err := l.decodeOp(logEntry)
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", r.index-1, err)
+		}
+		if err := fn(entryInfo(r, logEntry), op); err != nil {
+			return err
+		}
+	}
+}
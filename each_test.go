@@ -0,0 +1,109 @@
+package replaylog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestEachWithCallerTracking(t *testing.T) {
+	log := newTestLog(t, WithCallerTracking(), WithTimestamps(), WithAppVersion(2))
+	log.now = func() time.Time { return time.Unix(1000, 0) }
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"})
+	assert.NoError(t, log.AppendAtomic(&Delete{Key: "foo"}))
+
+	var infos []EntryInfo
+	var got []Op[KV]
+	err := log.Each(func(info EntryInfo, op Op[KV]) error {
+		infos = append(infos, info)
+		got = append(got, op)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []Op[KV]{&Set{Key: "foo", Value: "bar"}, &Delete{Key: "foo"}}, got)
+	assert.Equal(t, 2, len(infos))
+	assert.True(t, strings.HasPrefix(infos[0].Caller, "github.com/alecthomas/replaylog.appendAll:"), infos[0].Caller)
+	assert.True(t, strings.HasPrefix(infos[1].Caller, "github.com/alecthomas/replaylog.TestEachWithCallerTracking:"), infos[1].Caller)
+	assert.Equal(t, EntryInfo{Index: 1, Offset: infos[1].Offset, Version: 2, Time: time.Unix(1000, 0), Caller: infos[1].Caller}, infos[1])
+	assert.True(t, infos[1].Offset > 0)
+
+	// Replay ignores the caller.
+	assert.Equal(t, KV{}, replay(t, log))
+}
+
+func TestEachSnapshot(t *testing.T) {
+	log := newTestLog(t)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"})
+
+	done := make(chan struct{})
+	appended := make(chan error)
+	go func() {
+		defer close(appended)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := log.Append(&Set{Key: "waz", Value: "foo"}); err != nil {
+				appended <- err
+				return
+			}
+		}
+	}()
+	var got []Op[KV]
+	err := log.EachSnapshot(func(info EntryInfo, op Op[KV]) error {
+		// Appending doesn't deadlock, and isn't visited.
+		got = append(got, op)
+		return log.Append(&Delete{Key: "foo"})
+	})
+	close(done)
+	assert.NoError(t, <-appended)
+	assert.NoError(t, err)
+	assert.Equal(t, []Op[KV]{&Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"}}, got)
+}
+
+func TestGroupByKind(t *testing.T) {
+	log := newTestLog(t)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Delete{Key: "foo"}, &Set{Key: "bar", Value: "waz"})
+	groups, err := log.GroupByKind()
+	assert.NoError(t, err)
+	assert.Equal(t, map[int][]Op[KV]{
+		0: {&Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"}},
+		1: {&Delete{Key: "foo"}},
+	}, groups)
+}
+
+func TestEachReverse(t *testing.T) {
+	log := newTestLog(t, WithHeader())
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Delete{Key: "foo"}, &Set{Key: "bar", Value: "waz"})
+	var indexes []int
+	var ops []Op[KV]
+	err := log.EachReverse(func(index int, op Op[KV]) error {
+		indexes = append(indexes, index)
+		ops = append(ops, op)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 1, 0}, indexes)
+	assert.Equal(t, []Op[KV]{&Set{Key: "bar", Value: "waz"}, &Delete{Key: "foo"}, &Set{Key: "foo", Value: "bar"}}, ops)
+	// Position is preserved.
+	appendAll(t, log, &Set{Key: "a", Value: "b"})
+	assert.Equal(t, KV{"bar": "waz", "a": "b"}, replay(t, log))
+}
+
+func TestEachRaw(t *testing.T) {
+	log := newTestLog(t, WithCompression(CompressGzip))
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Delete{Key: "foo"})
+	var entries []string
+	err := log.EachRaw(func(kind int, event json.RawMessage) error {
+		entries = append(entries, fmt.Sprintf("%d:%s", kind, event))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`0:{"k":"foo","v":"bar"}`, `1:{"k":"foo"}`}, entries)
+}
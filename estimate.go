@@ -0,0 +1,71 @@
+package replaylog
+
+import "encoding/json"
+
+// Sizer is an optional interface that an Op can implement to report the
+// approximate number of bytes it adds to (or, if negative, removes from) the
+// State it is applied to.
+type Sizer interface {
+	SizeDelta() int
+}
+
+// EstimateSize returns the approximate size in bytes of the State that
+// replaying the whole log would produce, without applying any ops.
+//
+// The estimate is the sum of SizeDelta for each op implementing Sizer; other
+// ops contribute zero. It is only as accurate as the ops' own estimates, and is
+// intended as a rough budget check before a potentially expensive Replay. The
+// position of the log is preserved.
+func (l *Log[State]) EstimateSize() (int, error) {
+	size := 0
+	err := l.eachOp(func(index int, logEntry Frame, op Op[State]) error {
+		if sizer, ok := op.(Sizer); ok {
+			size += sizer.SizeDelta()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// EstimateCompaction returns the current size of the log in bytes, and the
+// size it would have after Compact with the same arguments, without writing
+// anything.
+//
+// The log is replayed from the start into a fresh State from "factory", and
+// the ops returned by "snapshot" for it are encoded as Compact would encode
+// them. Unlike Compact, the result isn't verified. Appends are blocked for the
+// duration, and the position of the log is preserved.
+func (l *Log[State]) EstimateCompaction(factory func() State, snapshot func(State) []Op[State]) (before int64, after int64, err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if before, err = l.flushedSize(); err != nil {
+		return 0, 0, err
+	}
+	original := factory()
+	err = l.rewound(func(r *reader) error {
+		return l.replayShadow(r, original)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	// The scratch log stands in for an empty compacted log, and is never
+	// read or written.
+	scratch := l.withFile(nil)
+	scratch.entries = 0
+	scratch.lamportLoaded = true
+	if l.header {
+		frame, err := json.Marshal(header{Version: FormatVersion})
+		if err != nil {
+			return 0, 0, err
+		}
+		after += int64(len(frame) + 1)
+	}
+	for _, op := range snapshot(original) {
+		frame, err := scratch.encode(op)
+		if err != nil {
+			return 0, 0, err
+		}
+		after += int64(len(frame))
+	}
+	return before, after, nil
+}
@@ -0,0 +1,54 @@
+package replaylog
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func (s *Set) SizeDelta() int    { return len(s.Key) + len(s.Value) }
+func (d *Delete) SizeDelta() int { return -len(d.Key) }
+
+func TestEstimateSize(t *testing.T) {
+	log := newTestLog(t)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Set{Key: "waz", Value: "hello"}, &Delete{Key: "foo"})
+	size, err := log.EstimateSize()
+	assert.NoError(t, err)
+	assert.Equal(t, 6+8-3, size)
+	// Position is preserved.
+	assert.NoError(t, log.Append(&Set{Key: "a", Value: "b"}))
+	assert.Equal(t, KV{"waz": "hello", "a": "b"}, replay(t, log))
+}
+
+func TestEstimateCompaction(t *testing.T) {
+	for _, options := range [][]Option{nil, {WithHeader(), WithSequenceNumbers()}} {
+		log := newTestLog(t, options...)
+		appendAll(t, log,
+			&Set{Key: "foo", Value: "bar"},
+			&Set{Key: "bar", Value: "waz"},
+			&Set{Key: "foo", Value: "waz"},
+			&Delete{Key: "bar"},
+		)
+		factory := func() KV { return KV{} }
+		before, after, err := log.EstimateCompaction(factory, snapshotKV)
+		assert.NoError(t, err)
+		size, err := log.f.Seek(0, io.SeekCurrent)
+		assert.NoError(t, err)
+		assert.Equal(t, size, before)
+
+		// Nothing is written, and the estimate matches the compacted log.
+		appendAll(t, log, &Delete{Key: "none"})
+		dst, err := os.CreateTemp(t.TempDir(), "")
+		assert.NoError(t, err)
+		_, after2, err := log.EstimateCompaction(factory, snapshotKV)
+		assert.NoError(t, err)
+		assert.Equal(t, after, after2)
+		assert.NoError(t, log.Compact(dst, factory, snapshotKV))
+		compacted, err := log.f.Seek(0, io.SeekCurrent)
+		assert.NoError(t, err)
+		assert.Equal(t, compacted, after)
+		assert.True(t, after < before)
+	}
+}
@@ -0,0 +1,104 @@
+package replaylog
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+var errCrash = errors.New("simulated crash")
+
+// faultyFile is a File that simulates a crash on the Nth write or sync.
+//
+// A crashing write persists only the first "partial" bytes of its data. After
+// a crash every operation fails, and crashImage returns the surviving bytes.
+type faultyFile struct {
+	MemoryFile
+	failWrite int // Crash on this write, counting from 1. 0 disables.
+	partial   int // Number of bytes persisted by the crashing write.
+	failSync  int // Crash on this sync, counting from 1. 0 disables.
+	writes    int
+	syncs     int
+	crashed   bool
+}
+
+func (f *faultyFile) Write(p []byte) (int, error) {
+	if f.crashed {
+		return 0, errCrash
+	}
+	f.writes++
+	if f.writes == f.failWrite {
+		f.crashed = true
+		n, _ := f.MemoryFile.Write(p[:f.partial])
+		return n, errCrash
+	}
+	return f.MemoryFile.Write(p)
+}
+
+func (f *faultyFile) Sync() error {
+	if f.crashed {
+		return errCrash
+	}
+	f.syncs++
+	if f.syncs == f.failSync {
+		f.crashed = true
+		return errCrash
+	}
+	return nil
+}
+
+// crashImage returns a File containing the data that survived the crash, as
+// seen by a process restarting afterwards.
+func (f *faultyFile) crashImage() *MemoryFile {
+	return &MemoryFile{data: append([]byte(nil), f.data...)}
+}
+
+func TestCrashDuringAppend(t *testing.T) {
+	workload := []Op[KV]{&Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"}, &Delete{Key: "foo"}}
+	expected := []KV{{}, {"foo": "bar"}, {"foo": "bar", "bar": "waz"}}
+
+	for crashAt := 1; crashAt <= len(workload); crashAt++ {
+		f := &faultyFile{failWrite: crashAt, partial: 10}
+		log, err := New[KV](f, ops)
+		assert.NoError(t, err)
+		for i, op := range workload {
+			err = log.Append(op)
+			if i+1 < crashAt {
+				assert.NoError(t, err)
+			} else {
+				assert.True(t, errors.Is(err, errCrash))
+			}
+		}
+
+		log, err = New[KV](f.crashImage(), ops)
+		assert.NoError(t, err)
+		reports, err := log.Scan()
+		assert.NoError(t, err)
+		assert.Equal(t, crashAt, len(reports))
+		assert.Error(t, reports[crashAt-1].Err)
+
+		state := KV{}
+		err = log.Replay(state)
+		assert.Error(t, err)
+		assert.Equal(t, expected[crashAt-1], state)
+	}
+
+	t.Run("Sync", func(t *testing.T) {
+		f := &faultyFile{failSync: 2}
+		log, err := New[KV](f, ops)
+		assert.NoError(t, err)
+		err = log.Append(workload[0])
+		assert.NoError(t, err)
+		err = log.Append(workload[1])
+		assert.True(t, errors.Is(err, errCrash))
+
+		// The unsynced entry made it to the file anyway.
+		log, err = New[KV](f.crashImage(), ops)
+		assert.NoError(t, err)
+		state := KV{}
+		err = log.Replay(state)
+		assert.NoError(t, err)
+		assert.Equal(t, expected[2], state)
+	})
+}
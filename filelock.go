@@ -0,0 +1,60 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrLocked is returned by New when the log is locked by another process, see
+// WithExclusiveLock.
+var ErrLocked = errors.New("log is locked by another process")
+
+// lockMode is the kind of lock taken by WithExclusiveLock or WithSharedLock.
+type lockMode int
+
+const (
+	lockNone lockMode = iota
+	lockShared
+	lockExclusive
+)
+
+func (m lockMode) String() string {
+	if m == lockShared {
+		return "WithSharedLock"
+	}
+	return "WithExclusiveLock"
+}
+
+// acquireFileLock opens the lock file of the log and locks it, as configured.
+func (l *Log[State]) acquireFileLock() error {
+	if l.fileLock == lockNone {
+		return nil
+	}
+	f, ok := l.f.(*os.File)
+	if !ok {
+		return fmt.Errorf("%s requires an *os.File but got %T", l.fileLock, l.f)
+	}
+	lf, err := os.OpenFile(f.Name()+".lock", os.O_RDWR|os.O_CREATE, l.createMode())
+	if err != nil {
+		return fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := lockFile(lf, l.fileLock == lockExclusive, l.fileLockWait); err != nil {
+		_ = lf.Close()
+		if errors.Is(err, ErrLocked) {
+			return err
+		}
+		return fmt.Errorf("failed to lock %s: %w", lf.Name(), err)
+	}
+	l.lockFile = lf
+	return nil
+}
+
+// releaseFileLock releases any lock taken by acquireFileLock.
+func (l *Log[State]) releaseFileLock() {
+	if l.lockFile != nil {
+		// Closing the file releases the lock.
+		_ = l.lockFile.Close()
+		l.lockFile = nil
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package replaylog
+
+import (
+	"errors"
+	"os"
+)
+
+// lockFile is not supported on this platform.
+func lockFile(f *os.File, exclusive, wait bool) error {
+	return errors.New("file locking is not supported on this platform")
+}
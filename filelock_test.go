@@ -0,0 +1,67 @@
+//go:build unix
+
+package replaylog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func openLogFile(t *testing.T, path string) *os.File {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	assert.NoError(t, err)
+	return f
+}
+
+func TestWithExclusiveLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	log, err := New[KV](openLogFile(t, path), ops, WithExclusiveLock(false))
+	assert.NoError(t, err)
+	assert.NoError(t, log.Append(&Set{Key: "a", Value: "b"}))
+
+	f := openLogFile(t, path)
+	_, err = New[KV](f, ops, WithExclusiveLock(false))
+	assert.True(t, errors.Is(err, ErrLocked), "%v", err)
+	_, err = New[KV](f, ops, WithSharedLock(false))
+	assert.True(t, errors.Is(err, ErrLocked), "%v", err)
+
+	// A waiting New acquires the lock once it is released.
+	acquired := make(chan error)
+	go func() {
+		log, err := New[KV](f, ops, WithExclusiveLock(true))
+		if err == nil {
+			err = log.Close()
+		}
+		acquired <- err
+	}()
+	select {
+	case err := <-acquired:
+		t.Fatalf("lock acquired while held: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	assert.NoError(t, log.Close())
+	assert.NoError(t, <-acquired)
+
+	_, err = New[KV](&MemoryFile{}, ops, WithSharedLock(false))
+	assert.EqualError(t, err, "WithSharedLock requires an *os.File but got *replaylog.MemoryFile")
+}
+
+func TestWithSharedLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	first, err := New[KV](openLogFile(t, path), ops, WithSharedLock(false))
+	assert.NoError(t, err)
+	defer first.Close()
+	second, err := New[KV](openLogFile(t, path), ops, WithSharedLock(false), WithReadOnly())
+	assert.NoError(t, err)
+	defer second.Close()
+	f := openLogFile(t, path)
+	defer f.Close()
+	_, err = New[KV](f, ops, WithExclusiveLock(false))
+	assert.True(t, errors.Is(err, ErrLocked), "%v", err)
+}
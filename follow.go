@@ -0,0 +1,167 @@
+package replaylog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ReplayFollow is like Replay, but rather than stopping at the end of the log
+// it waits for further entries to be durably appended through this Log and
+// applies them as well, until ctx is done or an op returns ErrStopReplay.
+//
+// It returns ctx.Err() if ctx is done, or nil if stopped by an op. Entries
+// are applied with appends blocked, as for ReplayAndContinue, so ops must not
+// append to the log themselves, but appends are not blocked while waiting. As
+// for Replay, the log is left positioned at the end of the entries applied. An
+// error is returned if the log is truncated or replaced, eg. by compaction,
+// while following.
+func (l *Log[State]) ReplayFollow(ctx context.Context, dest State) error {
+	if l.resetBeforeReplay {
+		if err := reset(dest); err != nil {
+			return err
+		}
+	}
+	l.lock.Lock()
+	offset, err := l.f.Seek(0, io.SeekCurrent)
+	l.lock.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to determine log position: %w", err)
+	}
+	return l.follow(ctx, offset, func(r *reader) (bool, error) {
+		return l.replayUntil(r, dest, replayControl[State]{})
+	}, nil)
+}
+
+// Watch calls fn with each op durably appended to the log from now on, in
+// order, until ctx is done or fn returns an error.
+//
+// It returns ctx.Err() if ctx is done, nil if fn returns ErrStopReplay, or the
+// error returned by fn. Unlike Subscribe, ops are read back from the log, so
+// none are dropped however far fn falls behind, and fn may append to the log.
+// As for ReplayFollow, an error is returned if the log is truncated or
+// replaced while watching.
+func (l *Log[State]) Watch(ctx context.Context, fn func(op Op[State]) error) error {
+	l.lock.Lock()
+	offset, err := l.durableSize()
+	l.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	var ops []Op[State]
+	return l.follow(ctx, offset, func(r *reader) (bool, error) {
+		for {
+			logEntry, err := l.nextEntry(r)
+			if errors.Is(err, io.EOF) {
+				return false, nil
+			} else if err != nil {
+				return false, fmt.Errorf("entry at offset %d: %w", r.start, err)
+			}
+			op, err := l.decodeOp(logEntry)
+			if err != nil {
+				return false, fmt.Errorf("entry at offset %d: %w", r.start, err)
+			}
+			ops = append(ops, op)
+		}
+	}, func() (bool, error) {
+		defer func() { ops = ops[:0] }()
+		for _, op := range ops {
+			if err := fn(op); errors.Is(err, ErrStopReplay) {
+				return true, nil
+			} else if err != nil {
+				return true, err
+			}
+		}
+		return false, nil
+	})
+}
+
+// follow calls "read" with the lock held and a reader over the entries durably
+// appended after "offset", then "deliver", if non-nil, without the lock, until
+// either stops or ctx is done, waiting for more entries to be synced between
+// each call.
+func (l *Log[State]) follow(ctx context.Context, offset int64, read func(r *reader) (stop bool, err error), deliver func() (stop bool, err error)) error {
+	l.lock.Lock()
+	f := l.f
+	l.lock.Unlock()
+	for {
+		next, stop, synced, err := l.followOnce(f, offset, read)
+		if err != nil || stop {
+			return err
+		}
+		offset = next
+		if deliver != nil {
+			if stop, err := deliver(); err != nil || stop {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-synced:
+		}
+	}
+}
+
+// followOnce reads the entries between "offset" and the end of the durable
+// entries of the log, returning the offset to continue from and a channel
+// closed after the next sync.
+func (l *Log[State]) followOnce(f seekFile, offset int64, read func(r *reader) (bool, error)) (int64, bool, <-chan struct{}, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.f != f {
+		return 0, false, nil, errors.New("log was replaced while following")
+	}
+	end, err := l.durableSize()
+	if err != nil {
+		return 0, false, nil, err
+	}
+	if end < offset {
+		return 0, false, nil, fmt.Errorf("log was truncated from %d to %d bytes while following", offset, end)
+	}
+	if l.synced == nil {
+		l.synced = make(chan struct{})
+	}
+	synced := l.synced
+	if end == offset {
+		return offset, false, synced, nil
+	}
+	pos, err := l.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, false, nil, fmt.Errorf("failed to determine log position: %w", err)
+	}
+	if _, err := l.f.Seek(offset, io.SeekStart); err != nil {
+		return 0, false, nil, fmt.Errorf("failed to seek to followed entries: %w", err)
+	}
+	r := l.newReader(io.LimitReader(l.f, end-offset), offset)
+	stop, err := read(r)
+	if pos == offset {
+		// Keep a log positioned at the followed entries at their end, so
+		// that appends don't overwrite them.
+		pos = r.offset
+	}
+	if _, serr := l.f.Seek(pos, io.SeekStart); serr != nil && err == nil {
+		err = fmt.Errorf("failed to restore log position: %w", serr)
+	}
+	return r.offset, stop, synced, err
+}
+
+// durableSize returns the size of the log excluding any bytes that have not
+// been synced. Must be called with the lock held.
+func (l *Log[State]) durableSize() (int64, error) {
+	size, err := l.flushedSize()
+	if err != nil {
+		return 0, err
+	}
+	return size - int64(l.pending), nil
+}
+
+// notifySynced wakes any followers after a sync that leaves nothing pending.
+// Must be called with the lock held.
+func (l *Log[State]) notifySynced() {
+	if l.synced != nil {
+		close(l.synced)
+		l.synced = nil
+	}
+}
@@ -0,0 +1,98 @@
+package replaylog
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// lockedKV is a KV that can be read while it is being replayed into.
+type lockedKV struct {
+	sync.Mutex
+	kv KV
+}
+
+type setLocked struct {
+	Key   string `json:"k"`
+	Value string `json:"v"`
+}
+
+func (s *setLocked) Apply(state *lockedKV) error {
+	state.Lock()
+	defer state.Unlock()
+	state.kv[s.Key] = s.Value
+	if s.Key == "stop" {
+		return ErrStopReplay
+	}
+	return nil
+}
+
+func TestReplayFollow(t *testing.T) {
+	log, err := New[*lockedKV](&MemoryFile{}, []Op[*lockedKV]{&setLocked{}})
+	assert.NoError(t, err)
+	assert.NoError(t, log.Append(&setLocked{Key: "a", Value: "1"}))
+	assert.NoError(t, log.Rewind())
+
+	state := &lockedKV{kv: KV{}}
+	done := make(chan error)
+	go func() { done <- log.ReplayFollow(context.Background(), state) }()
+	waitForFollower(t, log)
+	// Appends aren't blocked while following.
+	assert.NoError(t, log.Append(&setLocked{Key: "b", Value: "2"}))
+	assert.NoError(t, log.AppendNoSync(&setLocked{Key: "c", Value: "3"}))
+	assert.NoError(t, log.Barrier())
+	assert.NoError(t, log.Append(&setLocked{Key: "stop", Value: "4"}))
+	assert.NoError(t, <-done)
+	assert.Equal(t, KV{"a": "1", "b": "2", "c": "3", "stop": "4"}, state.kv)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = log.ReplayFollow(ctx, &lockedKV{kv: KV{}})
+	assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+}
+
+func TestWatch(t *testing.T) {
+	log := newTestLog(t)
+	appendAll(t, log, &Set{Key: "before", Value: "watch"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var watched []Op[KV]
+	done := make(chan error)
+	go func() {
+		done <- log.Watch(ctx, func(op Op[KV]) error {
+			watched = append(watched, op)
+			if len(watched) == 1 {
+				// Watchers can append.
+				return log.Append(&Delete{Key: "a"})
+			}
+			if len(watched) == 3 {
+				return ErrStopReplay
+			}
+			return nil
+		})
+	}()
+	waitForFollower(t, log)
+	appendAll(t, log, &Set{Key: "a", Value: "b"}, &Set{Key: "c", Value: "d"})
+	assert.NoError(t, <-done)
+	assert.Equal(t, 3, len(watched))
+	assert.Equal(t, Op[KV](&Set{Key: "a", Value: "b"}), watched[0])
+	assert.Equal(t, []Op[KV]{&Set{Key: "c", Value: "d"}, &Delete{Key: "a"}}, watched[1:])
+}
+
+// waitForFollower waits until a follower of log is waiting for a sync.
+func waitForFollower[State any](t *testing.T, log *Log[State]) {
+	t.Helper()
+	for {
+		log.lock.Lock()
+		waiting := log.synced != nil
+		log.lock.Unlock()
+		if waiting {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
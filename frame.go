@@ -0,0 +1,170 @@
+package replaylog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Frame is a single raw entry in a log, below the typed Op layer.
+//
+// On disk each Frame is a JSON object terminated by a newline:
+//
+//	{"k":<kind>,"e":<event>}
+//
+// where <kind> is the index of the Op type in the slice passed to New and
+// <event> is the JSON encoded Op. Optional fields are omitted when empty:
+//
+//	"v": application version, set by WithAppVersion.
+//	"z": compression algorithm of the event, which is then a base64 encoded
+//	     JSON string of the compressed JSON encoded Op, or the raw compressed
+//	     Op in a binary record.
+//	"p": index of the parent entry, set by AppendWithParent.
+//	"s": sequence number of the entry, starting at 1, set by
+//	     WithSequenceNumbers.
+//	"t": time the entry was appended, in nanoseconds since the Unix epoch,
+//	     set by WithTimestamps.
+//	"c": function and line that appended the entry, set by
+//	     WithCallerTracking.
+//	"n": name of the Op type, written by a NamedLog. <kind> is ignored by a
+//	     NamedLog when this is present.
+//	"l": logical clock of the entry, set by WithLogicalClock.
+//	"m": string metadata of the entry, set by AppendWithMeta.
+//	"g": number of entries in the group started by the entry, including
+//	     itself, set by AppendGroup.
+//	"x": context shared by the entries of a group, set by AppendGroup on the
+//	     first entry of the group.
+//	"r": true if the State is reset before the entry is applied, set by
+//	     CompactState.
+//	"q": hex encoded CRC-32C of the entry without this field, which is always
+//	     last, set by WithEntryChecksums. It is verified when the entry is
+//	     decoded.
+//
+// A log may optionally begin with a header line, see FormatVersion.
+//
+// WithBinaryRecords, each Frame is instead a binary record:
+//
+//	<length> <flags> <envelope length> <envelope> <event> [<checksum>]
+//
+// where <length> is the uvarint encoded length of the rest of the record,
+// <flags> is a single byte, <envelope> is the Frame without its event, encoded
+// by the FrameCodec of the log or otherwise as above, preceded by its uvarint
+// encoded length, and <event> is the raw, possibly compressed, encoded Op. If
+// bit 0 of <flags> is set WithEntryChecksums, the record ends with the
+// big-endian CRC-32C of <flags> up to the end of <event>, and "q" is unused.
+type Frame struct {
+	Kind         int               `json:"k"`
+	Event        json.RawMessage   `json:"e,omitempty"`
+	Version      int               `json:"v,omitempty"`
+	Compression  string            `json:"z,omitempty"`
+	Parent       *int              `json:"p,omitempty"`
+	Seq          int               `json:"s,omitempty"`
+	Time         int64             `json:"t,omitempty"`
+	Name         string            `json:"n,omitempty"`
+	Caller       string            `json:"c,omitempty"`
+	Clock        uint64            `json:"l,omitempty"`
+	Meta         map[string]string `json:"m,omitempty"`
+	Group        int               `json:"g,omitempty"`
+	GroupContext map[string]string `json:"x,omitempty"`
+	Reset        bool              `json:"r,omitempty"`
+	Checksum     string            `json:"q,omitempty"`
+}
+
+// decodeFrame decodes a single newline terminated frame, decompressing its
+// event if necessary.
+func decodeFrame(data []byte, c *compressor) (Frame, error) {
+	frame := Frame{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&frame); err != nil {
+		return frame, fmt.Errorf("corrupt log entry: %w", err)
+	}
+	if frame.Checksum != "" {
+		if err := verifyChecksum(data, frame.Checksum); err != nil {
+			return frame, fmt.Errorf("corrupt log entry: %w", err)
+		}
+		frame.Checksum = ""
+	}
+	if frame.Compression != "" {
+		var compressed []byte
+		if err := json.Unmarshal(frame.Event, &compressed); err != nil {
+			return frame, fmt.Errorf("corrupt compressed log entry: %w", err)
+		}
+		event, err := c.decompress(frame.Compression, compressed)
+		if err != nil {
+			return frame, fmt.Errorf("could not decompress %s log entry: %w", frame.Compression, err)
+		}
+		frame.Event, frame.Compression = event, ""
+	}
+	return frame, nil
+}
+
+// encodeFrame encodes a frame as is, including its newline terminator.
+func encodeFrame(frame Frame) ([]byte, error) {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// FrameReader reads raw Frames from a log without decoding their events. It
+// can't read logs of binary records, see WithBinaryRecords.
+type FrameReader struct {
+	r          *reader
+	compressor compressor
+}
+
+// NewFrameReader creates a FrameReader reading from the current position of r.
+//
+// If r is at the start of a log, any header is validated and skipped.
+func NewFrameReader(r io.Reader) *FrameReader {
+	return &FrameReader{r: newReader(r, 0)}
+}
+
+// Next returns the next Frame, or io.EOF at the end of the log.
+//
+// Compressed events are decompressed.
+func (f *FrameReader) Next() (Frame, error) {
+	data, err := f.r.next()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return Frame{}, err
+		}
+		return Frame{}, fmt.Errorf("failed to read log: %w", err)
+	}
+	return decodeFrame(data, &f.compressor)
+}
+
+// Offset returns the byte offset of the most recent Frame returned by Next,
+// relative to where the FrameReader started.
+func (f *FrameReader) Offset() int64 {
+	return f.r.start
+}
+
+// FrameWriter writes raw Frames to a log.
+type FrameWriter struct {
+	w io.Writer
+}
+
+// NewFrameWriter creates a FrameWriter writing to w.
+func NewFrameWriter(w io.Writer) *FrameWriter {
+	return &FrameWriter{w: w}
+}
+
+// Write a Frame. If the Frame has a Checksum it is recomputed.
+func (f *FrameWriter) Write(frame Frame) error {
+	checksum := frame.Checksum != ""
+	frame.Checksum = ""
+	data, err := encodeFrame(frame)
+	if err != nil {
+		return err
+	}
+	if checksum {
+		data = append(appendChecksum(data[:len(data)-1]), '\n')
+	}
+	_, err = f.w.Write(data)
+	return err
+}
@@ -0,0 +1,41 @@
+package replaylog
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestFrameReaderWriter(t *testing.T) {
+	log := newTestLog(t, WithHeader(), WithEntryCompression(20))
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Set{Key: "long", Value: "a much longer value"})
+
+	err := log.Rewind()
+	assert.NoError(t, err)
+	fr := NewFrameReader(log.f)
+	dst := &MemoryFile{}
+	fw := NewFrameWriter(dst)
+	frames := []Frame{}
+	for {
+		frame, err := fr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.NoError(t, err)
+		frames = append(frames, frame)
+		err = fw.Write(frame)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []Frame{
+		{Kind: 0, Event: json.RawMessage(`{"k":"foo","v":"bar"}`)},
+		{Kind: 0, Event: json.RawMessage(`{"k":"long","v":"a much longer value"}`)},
+	}, frames)
+	assert.Equal(t, `{"k":0,"e":{"k":"foo","v":"bar"}}`+"\n"+`{"k":0,"e":{"k":"long","v":"a much longer value"}}`+"\n", string(dst.data))
+
+	copied, err := New[KV](dst, ops)
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"foo": "bar", "long": "a much longer value"}, replay(t, copied))
+}
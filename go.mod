@@ -1,8 +1,12 @@
 module github.com/alecthomas/replaylog
 
-go 1.18
+go 1.23
 
-require github.com/alecthomas/assert/v2 v2.0.0-alpha8
+require (
+	github.com/alecthomas/assert/v2 v2.0.0-alpha8
+	github.com/klauspost/compress v1.17.11
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
+)
 
 require (
 	github.com/alecthomas/repr v0.0.0-20210801044451-80ca428c5142 // indirect
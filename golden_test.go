@@ -0,0 +1,58 @@
+package replaylog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// goldenOps are the ops appended to each golden log, which replay to
+// goldenState.
+var goldenOps = []Op[KV]{
+	&Set{Key: "foo", Value: "bar"},
+	&Set{Key: "bar", Value: "waz"},
+	&Delete{Key: "foo"},
+	&Set{Key: "long", Value: string(bytes.Repeat([]byte("compressible "), 16))},
+}
+
+var goldenState = KV{"bar": "waz", "long": string(bytes.Repeat([]byte("compressible "), 16))}
+
+// goldenLogs are logs in testdata/golden written by earlier versions of the
+// package, with the options they were written with. They must never be
+// regenerated: a change to the format that fails to replay them breaks
+// existing logs on disk.
+var goldenLogs = map[string][]Option{
+	"plain.log":             nil,
+	"header.log":            {WithHeader()},
+	"gzip.log":              {WithCompression(CompressGzip)},
+	"zstd.log":              {WithCompression(CompressZstd)},
+	"entry-compression.log": {WithEntryCompression(64)},
+	"app-version.log":       {WithAppVersion(3)},
+	"sequence.log":          {WithSequenceNumbers()},
+	"timestamps.log":        {WithTimestamps()},
+	"commit-marker.log":     {WithCommitMarker(2)},
+	"trailer.log":           {WithTrailer()},
+}
+
+// replayGolden replays the golden log "name" with "options" into a new KV.
+func replayGolden(t *testing.T, name string, options ...Option) KV {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "golden", name))
+	assert.NoError(t, err)
+	log, err := New[KV](&MemoryFile{data: data}, ops, append(options, WithReadOnly())...)
+	assert.NoError(t, err)
+	state := KV{}
+	assert.NoError(t, log.Replay(state))
+	return state
+}
+
+func TestGolden(t *testing.T) {
+	for name, options := range goldenLogs {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, goldenState, replayGolden(t, name, options...))
+		})
+	}
+}
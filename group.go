@@ -0,0 +1,120 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrIncompleteGroup is returned by replay when a group written by AppendGroup
+// is missing some of its entries, for example because a crash interrupted the
+// write. None of the ops in the group are applied.
+var ErrIncompleteGroup = errors.New("incomplete group")
+
+// GroupedOp is an optional interface that an Op can implement to receive the
+// context of the group it was appended in by AppendGroup.
+type GroupedOp[State any] interface {
+	Op[State]
+	ApplyInGroup(ctx map[string]string, state State) error
+}
+
+// AppendGroup appends ops to the log as an indivisible group sharing "ctx",
+// with a single write and sync.
+//
+// The context is stored once, in the first entry of the group, and passed to
+// each op implementing GroupedOp when it is applied. On replay no op in the
+// group is applied until every entry in it has been read, so if a crash leaves
+// only part of the group in the log, replay fails with ErrIncompleteGroup
+// without applying any of it, and Repair or OpenRecovering drop the whole
+// group. Replay that is stopped early by an op stops after the group.
+func (l *Log[State]) AppendGroup(ctx map[string]string, events ...Op[State]) error {
+	if len(events) == 0 {
+		return nil
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.encoded = 0
+	hooked := make([]Op[State], 0, len(events))
+	var frames []byte
+	for i, event := range events {
+		event, err := l.appendHook(event)
+		if err != nil {
+			return err
+		}
+		hooked = append(hooked, event)
+		e, err := l.newEntry(event)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			e.Group, e.GroupContext = len(events), ctx
+		}
+		frame, err := l.encodeFrame(e)
+		if err != nil {
+			return err
+		}
+		frames = append(frames, frame...)
+	}
+	if err := l.writeAndSync(frames, len(hooked)); err != nil {
+		return err
+	}
+	if err := l.verifyAppended(hooked); err != nil {
+		return err
+	}
+	for _, event := range hooked {
+		l.publish(event)
+	}
+	return nil
+}
+
+// replayGroup is the group written by AppendGroup that replay is reading.
+type replayGroup[State any] struct {
+	start     int64 // Offset of the first entry.
+	first     int   // Index of the first entry.
+	size      int
+	remaining int // Number of entries in the group still to be read.
+	context   map[string]string
+	members   []groupMember[State] // Decoded ops waiting to be applied.
+}
+
+type groupMember[State any] struct {
+	index    int
+	offset   int64
+	logEntry Frame
+	op       Op[State]
+	parent   Op[State]
+}
+
+// add the entry just read by r to the group if it belongs to one, setting its
+// Group and GroupContext.
+func (g *replayGroup[State]) add(r *reader, logEntry *Frame) error {
+	if logEntry.Group > 0 {
+		if g.remaining > 0 {
+			return fmt.Errorf("%w: entry %d starts a group within the group starting at entry %d", ErrIncompleteGroup, r.index-1, g.first)
+		}
+		*g = replayGroup[State]{start: r.start, first: r.index - 1, size: logEntry.Group, remaining: logEntry.Group, context: logEntry.GroupContext}
+		r.groupStart = r.start
+	}
+	if g.remaining == 0 {
+		return nil
+	}
+	g.remaining--
+	r.inGroup = g.remaining > 0
+	logEntry.Group, logEntry.GroupContext = g.size, g.context
+	return nil
+}
+
+// flush applies the ops of a complete group with "apply", returning true if
+// any of them stopped replay.
+func (g *replayGroup[State]) flush(apply func(index int, offset int64, logEntry Frame, op, parent Op[State]) (bool, error)) (bool, error) {
+	members := g.members
+	g.members = nil
+	stopped := false
+	for _, m := range members {
+		stop, err := apply(m.index, m.offset, m.logEntry, m.op, m.parent)
+		if err != nil {
+			return false, err
+		}
+		stopped = stopped || stop
+	}
+	return stopped, nil
+}
@@ -0,0 +1,94 @@
+package replaylog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+type groupSet struct {
+	Key   string `json:"k"`
+	Value string `json:"v"`
+}
+
+func (g *groupSet) Apply(kv KV) error {
+	kv[g.Key] = g.Value
+	return nil
+}
+
+func (g *groupSet) ApplyInGroup(ctx map[string]string, kv KV) error {
+	kv[g.Key] = ctx["txn"] + ":" + g.Value
+	return nil
+}
+
+var groupOps = []Op[KV]{&Set{}, &Delete{}, &groupSet{}}
+
+func TestAppendGroup(t *testing.T) {
+	f := &MemoryFile{}
+	log, err := New[KV](f, groupOps)
+	assert.NoError(t, err)
+	assert.NoError(t, log.Append(&groupSet{Key: "a", Value: "1"}))
+	assert.NoError(t, log.AppendGroup(map[string]string{"txn": "t1"}, &groupSet{Key: "b", Value: "2"}, &Set{Key: "c", Value: "3"}, &groupSet{Key: "d", Value: "4"}))
+	assert.NoError(t, log.AppendGroup(nil))
+	assert.Equal(t, `{"k":2,"e":{"k":"a","v":"1"}}
+{"k":2,"e":{"k":"b","v":"2"},"g":3,"x":{"txn":"t1"}}
+{"k":0,"e":{"k":"c","v":"3"}}
+{"k":2,"e":{"k":"d","v":"4"}}
+`, string(f.data))
+
+	state := KV{}
+	assert.NoError(t, log.Rewind())
+	assert.NoError(t, log.Replay(state))
+	assert.Equal(t, KV{"a": "1", "b": "t1:2", "c": "3", "d": "t1:4"}, state)
+
+	// Replay stopped part way through a group stops before it.
+	state = KV{}
+	assert.NoError(t, log.Rewind())
+	complete, err := log.ReplayBytes(state, 40)
+	assert.NoError(t, err)
+	assert.False(t, complete)
+	assert.Equal(t, KV{"a": "1"}, state)
+	complete, err = log.ReplayBytes(state, 1000)
+	assert.NoError(t, err)
+	assert.True(t, complete)
+	assert.Equal(t, KV{"a": "1", "b": "t1:2", "c": "3", "d": "t1:4"}, state)
+}
+
+func TestAppendGroupPartialRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	log, err := Open(path, groupOps)
+	assert.NoError(t, err)
+	assert.NoError(t, log.Append(&Set{Key: "a", Value: "1"}))
+	assert.NoError(t, log.AppendGroup(map[string]string{"txn": "t1"}, &groupSet{Key: "b", Value: "2"}, &groupSet{Key: "c", Value: "3"}, &groupSet{Key: "d", Value: "4"}))
+	assert.NoError(t, log.Close())
+
+	// Simulate a crash after writing two of the three entries in the group.
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	healthy := `{"k":0,"e":{"k":"a","v":"1"}}` + "\n"
+	partial := `{"k":2,"e":{"k":"b","v":"2"},"g":3,"x":{"txn":"t1"}}` + "\n" + `{"k":2,"e":{"k":"c","v":"3"}}` + "\n"
+	assert.Equal(t, healthy+partial, string(data[:len(healthy)+len(partial)]))
+	assert.NoError(t, os.Truncate(path, int64(len(healthy)+len(partial))))
+
+	log, err = Open(path, groupOps)
+	assert.NoError(t, err)
+	state := KV{}
+	err = log.Replay(state)
+	assert.True(t, errors.Is(err, ErrIncompleteGroup))
+	assert.EqualError(t, err, "incomplete group: group of 3 entries starting at entry 1 has only 2")
+	assert.Equal(t, KV{"a": "1"}, state)
+	assert.NoError(t, log.Close())
+
+	log, quarantined, err := OpenRecovering(path, groupOps)
+	assert.NoError(t, err)
+	defer log.Close()
+	assert.Equal(t, int64(len(partial)), quarantined)
+	state = KV{}
+	assert.NoError(t, log.Replay(state))
+	assert.Equal(t, KV{"a": "1"}, state)
+	assert.NoError(t, log.AppendGroup(map[string]string{"txn": "t2"}, &groupSet{Key: "b", Value: "2"}))
+	assert.Equal(t, KV{"a": "1", "b": "t2:2"}, replay(t, log))
+}
@@ -0,0 +1,85 @@
+package replaylog
+
+import "time"
+
+// groupCommit tracks the rounds of syncs shared by appends, for
+// WithGroupCommit. Its fields are guarded by the lock of the Log.
+type groupCommit[State any] struct {
+	deferring bool                // True while grouped defers the sync of appends.
+	open      *commitRound[State] // Round that entries written now will be synced by.
+	joined    *commitRound[State] // Round joined by the current append.
+	leading   bool                // True if the current append opened its round.
+}
+
+// commitRound is a single sync shared by every append that joined it.
+type commitRound[State any] struct {
+	done chan struct{} // Closed once the sync has completed.
+	err  error
+	ops  []Op[State] // Ops to publish once they are durable.
+	ids  []string    // IDs reserved for AppendOnce by ops, released if the sync fails.
+}
+
+// join the entries just written to the open round, opening one if necessary.
+func (g *groupCommit[State]) join() {
+	if g.open == nil {
+		g.open = &commitRound[State]{done: make(chan struct{})}
+		g.leading = true
+	}
+	g.joined = g.open
+}
+
+// deferPublish defers publication of op if it was written by an append whose sync is
+// deferred, returning true if it was. Must be called with the lock held.
+func (g *groupCommit[State]) deferPublish(op Op[State]) bool {
+	if !g.deferring || g.joined == nil {
+		return false
+	}
+	g.joined.ops = append(g.joined.ops, op)
+	return true
+}
+
+// grouped calls fn with the lock held. If WithGroupCommit is used, the sync of
+// the entries it writes is deferred until after the lock is released and
+// shared with other appends, and grouped returns once they are durable. Ops
+// published by fn are only published once they are durable.
+func (l *Log[State]) grouped(fn func() error) error {
+	l.lock.Lock()
+	if !l.groupCommit {
+		defer l.lock.Unlock()
+		return fn()
+	}
+	l.commits.deferring = true
+	err := fn()
+	round, leading := l.commits.joined, l.commits.leading
+	l.commits = groupCommit[State]{open: l.commits.open}
+	l.lock.Unlock()
+	if round == nil {
+		return err
+	}
+	if leading {
+		// Give other appends a chance to join before syncing.
+		if l.groupCommitWindow > 0 {
+			time.Sleep(l.groupCommitWindow)
+		}
+		l.lock.Lock()
+		// Entries written from now on are synced by the next round.
+		l.commits.open = nil
+		round.err = l.sync()
+		if round.err == nil {
+			l.pending = 0
+			l.notifySynced()
+			for _, op := range round.ops {
+				l.publish(op)
+			}
+		} else {
+			l.ids.release(round.ids)
+		}
+		l.lock.Unlock()
+		close(round.done)
+	}
+	<-round.done
+	if err != nil {
+		return err
+	}
+	return round.err
+}
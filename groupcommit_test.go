@@ -0,0 +1,166 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// slowSyncFile is a File whose syncs take a while, and which records how many
+// entries were written as of each sync.
+type slowSyncFile struct {
+	MemoryFile
+	writes  int
+	synced  []int
+	syncErr error
+}
+
+func (f *slowSyncFile) Write(p []byte) (int, error) {
+	f.writes++
+	return f.MemoryFile.Write(p)
+}
+
+func (f *slowSyncFile) Sync() error {
+	time.Sleep(time.Millisecond)
+	if f.syncErr != nil {
+		return f.syncErr
+	}
+	f.synced = append(f.synced, f.writes)
+	return nil
+}
+
+func TestWithGroupCommit(t *testing.T) {
+	f := &slowSyncFile{}
+	log, err := New[KV](f, ops, WithGroupCommit(5*time.Millisecond))
+	assert.NoError(t, err)
+	subscribed, unsubscribe := log.Subscribe()
+	defer unsubscribe()
+	const appenders = 20
+	wg := sync.WaitGroup{}
+	errs := make(chan error, appenders)
+	for i := 0; i < appenders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- log.Append(&Set{Key: fmt.Sprintf("k%d", i), Value: "v"})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.True(t, len(f.synced) < appenders, "%d syncs for %d appends", len(f.synced), appenders)
+	assert.Equal(t, appenders, f.synced[len(f.synced)-1])
+	assert.Equal(t, appenders, len(replay(t, log)))
+	// Ops are only published once the shared sync has succeeded.
+	assert.Equal(t, appenders, len(subscribed))
+
+	f.syncErr = errors.New("disk on fire")
+	err = log.AppendAtomic(&Set{Key: "a", Value: "b"}, &Delete{Key: "k0"})
+	assert.EqualError(t, err, "failed to sync log: disk on fire")
+	assert.Equal(t, appenders, len(subscribed))
+	_, err = New[KV](f, ops, WithGroupCommit(-time.Second))
+	assert.EqualError(t, err, "WithGroupCommit: window must not be negative but got -1s")
+}
+
+func TestGroupCommitDurability(t *testing.T) {
+	// Every commit must be covered by a sync that completed before it
+	// returned.
+	f := &slowSyncFile{}
+	log, err := New[KV](f, ops, WithGroupCommit(0))
+	assert.NoError(t, err)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				batch := log.Batch()
+				assert.NoError(t, batch.Add(&Set{Key: fmt.Sprintf("k%d.%d", i, j), Value: "v"}))
+				index, err := batch.Commit()
+				assert.NoError(t, err)
+				// Each commit is a single write.
+				log.lock.Lock()
+				durable := f.synced[len(f.synced)-1]
+				log.lock.Unlock()
+				assert.True(t, durable > index, "entry %d returned before being synced", index)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 100, f.synced[len(f.synced)-1])
+}
+
+func TestGroupCommitAppendOnce(t *testing.T) {
+	f := &slowSyncFile{}
+	log, err := New[KV](f, []Op[KV]{&Set{}, &Delete{}, &delivery{}}, WithGroupCommit(5*time.Millisecond))
+	assert.NoError(t, err)
+	const appenders = 10
+	wg := sync.WaitGroup{}
+	appended := make(chan bool, appenders)
+	for i := 0; i < appenders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := log.AppendOnce(&delivery{Set: Set{Key: "foo", Value: fmt.Sprint(i)}, DeliveryID: "1"})
+			assert.NoError(t, err)
+			appended <- ok
+		}()
+	}
+	wg.Wait()
+	close(appended)
+	count := 0
+	for ok := range appended {
+		if ok {
+			count++
+		}
+	}
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 1, f.writes)
+
+	// The ID is released if the sync fails, so it can be retried.
+	f.syncErr = errors.New("disk on fire")
+	_, err = log.AppendOnce(&delivery{Set: Set{Key: "bar", Value: "waz"}, DeliveryID: "2"})
+	assert.EqualError(t, err, "failed to sync log: disk on fire")
+	f.syncErr = nil
+	ok, err := log.AppendOnce(&delivery{Set: Set{Key: "bar", Value: "waz"}, DeliveryID: "2"})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func BenchmarkGroupCommit(b *testing.B) {
+	for _, window := range []time.Duration{-1, 0, time.Millisecond} {
+		name := "Disabled"
+		if window >= 0 {
+			name = fmt.Sprintf("Window=%s", window)
+		}
+		b.Run(name, func(b *testing.B) {
+			f, err := os.CreateTemp(b.TempDir(), "")
+			assert.NoError(b, err)
+			var options []Option
+			if window >= 0 {
+				options = append(options, WithGroupCommit(window))
+			}
+			log, err := New[KV](f, ops, options...)
+			assert.NoError(b, err)
+			defer log.Close()
+			b.SetParallelism(8)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := log.Append(&Set{Key: "foo", Value: "bar"}); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "appends/s")
+		})
+	}
+}
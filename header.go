@@ -0,0 +1,201 @@
+package replaylog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// FormatVersion is the latest on-disk format version.
+//
+// Supported versions are:
+//
+//  1. Newline delimited JSON entries, with no header.
+//  2. Identical to version 1, but prefixed with a JSON header line of the
+//     form {"replaylog":2}. Written by WithHeader.
+//
+// Readers support all versions up to and including FormatVersion. Logs can be
+// upgraded from version 1 to 2 WithFormatMigration(UpgradeFormat).
+const FormatVersion = 2
+
+var headerPrefix = []byte(`{"replaylog":`)
+
+type header struct {
+	Version int `json:"replaylog"`
+}
+
+// isHeader returns true if the frame at the start of a log is a header.
+func isHeader(frame []byte) bool {
+	return bytes.HasPrefix(frame, headerPrefix)
+}
+
+// parseHeader parses a header frame, returning its format version.
+func parseHeader(frame []byte) (int, error) {
+	h := header{}
+	if err := json.Unmarshal(frame, &h); err != nil {
+		return 0, fmt.Errorf("corrupt log header: %w", err)
+	}
+	if h.Version < 2 || h.Version > FormatVersion {
+		return 0, fmt.Errorf("unsupported log format version %d, expected at most %d", h.Version, FormatVersion)
+	}
+	return h.Version, nil
+}
+
+// initHeader writes a header to the log if it is empty, or otherwise validates
+// the existing header. The log position is preserved if the log is non-empty.
+func (l *Log[State]) initHeader() error {
+	pos, err := l.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to determine log position: %w", err)
+	}
+	end, err := l.f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to determine log size: %w", err)
+	}
+	if end == 0 {
+		if l.readOnly {
+			return nil
+		}
+		frame, err := json.Marshal(header{Version: FormatVersion})
+		if err != nil {
+			return err
+		}
+		return l.writeAndSync(l.terminate(frame), 0)
+	}
+	if _, err := l.f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind log: %w", err)
+	}
+	_, err = l.newReader(l.f, 0).next()
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	if _, serr := l.f.Seek(pos, io.SeekStart); serr != nil && err == nil {
+		err = fmt.Errorf("failed to restore log position: %w", serr)
+	}
+	return err
+}
+
+// formatVersion returns the format version of the log, or 0 if it has no
+// entries or header. The log position is preserved.
+func (l *Log[State]) formatVersion() (int, error) {
+	pos, err := l.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, fmt.Errorf("failed to determine log position: %w", err)
+	}
+	if _, err := l.f.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to rewind log: %w", err)
+	}
+	r := l.newReader(l.f, 0)
+	_, err = r.next()
+	version := r.version
+	if errors.Is(err, io.EOF) {
+		err = nil
+		if version == 1 {
+			version = 0
+		}
+	}
+	if _, serr := l.f.Seek(pos, io.SeekStart); serr != nil && err == nil {
+		err = fmt.Errorf("failed to restore log position: %w", serr)
+	}
+	return version, err
+}
+
+// migrateFormat replaces the log with the result of WithFormatMigration, if it
+// is in an older format version.
+func (l *Log[State]) migrateFormat() error {
+	if l.formatMigration == nil || l.readOnly {
+		return nil
+	}
+	version, err := l.formatVersion()
+	if err != nil || version == 0 || version >= FormatVersion {
+		return err
+	}
+	migrated, err := l.formatMigration(l.f, version)
+	if err != nil {
+		return fmt.Errorf("failed to migrate log from format version %d: %w", version, err)
+	}
+	l.f = seekable(migrated)
+	upgraded, err := l.formatVersion()
+	if err != nil {
+		return fmt.Errorf("migrated log: %w", err)
+	}
+	if upgraded != FormatVersion {
+		return fmt.Errorf("migration from format version %d produced version %d, expected %d", version, upgraded, FormatVersion)
+	}
+	return nil
+}
+
+// UpgradeFormat is a migration for WithFormatMigration that upgrades a newline
+// delimited log, which must be an *os.File, from format version 1 to 2.
+//
+// A copy of the log prefixed with a header is written to a temporary file in
+// the same directory, synced, then atomically renamed over the original, so
+// either the original or the upgraded log survives a crash.
+func UpgradeFormat(old File, version int) (File, error) {
+	f, ok := old.(*os.File)
+	if !ok {
+		return nil, fmt.Errorf("can't upgrade log of type %T, it must be an *os.File", old)
+	}
+	if version != 1 {
+		return nil, fmt.Errorf("can't upgrade log from format version %d", version)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.Name()), filepath.Base(f.Name())+".*.upgrade")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upgraded log: %w", err)
+	}
+	err = writeUpgraded(tmp, f, info.Mode().Perm())
+	if err == nil {
+		if err = os.Rename(tmp.Name(), f.Name()); err != nil {
+			err = fmt.Errorf("failed to replace log with upgraded log: %w", err)
+		}
+	}
+	if err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return nil, err
+	}
+	_ = f.Close()
+	if err := syncDir(filepath.Dir(f.Name())); err != nil {
+		_ = tmp.Close()
+		return nil, fmt.Errorf("failed to sync upgraded log: %w", err)
+	}
+	upgraded := reopenRenamed(tmp, f.Name())
+	if _, err := upgraded.Seek(0, io.SeekStart); err != nil {
+		_ = upgraded.Close()
+		return nil, fmt.Errorf("failed to rewind upgraded log: %w", err)
+	}
+	return upgraded, nil
+}
+
+// writeUpgraded writes a header followed by the contents of f to tmp, and
+// syncs it.
+func writeUpgraded(tmp, f *os.File, mode os.FileMode) error {
+	frame, err := json.Marshal(header{Version: 2})
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(frame, '\n')); err != nil {
+		return fmt.Errorf("failed to write upgraded log: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind log: %w", err)
+	}
+	if _, err := io.Copy(tmp, f); err != nil {
+		return fmt.Errorf("failed to write upgraded log: %w", err)
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		return fmt.Errorf("failed to write upgraded log: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync upgraded log: %w", err)
+	}
+	return nil
+}
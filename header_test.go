@@ -0,0 +1,105 @@
+package replaylog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestHeader(t *testing.T) {
+	t.Run("WritesHeader", func(t *testing.T) {
+		log := newTestLog(t, WithHeader())
+		appendAll(t, log, &Set{Key: "foo", Value: "bar"})
+		data, err := os.ReadFile(log.f.(*os.File).Name())
+		assert.NoError(t, err)
+		assert.Equal(t, `{"replaylog":2}`+"\n"+`{"k":0,"e":{"k":"foo","v":"bar"}}`+"\n", string(data))
+		assert.Equal(t, KV{"foo": "bar"}, replay(t, log))
+		reports, err := log.Scan()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(reports))
+	})
+
+	t.Run("ReadsVersion1", func(t *testing.T) {
+		f := writeTestFile(t, `{"k":0,"e":{"k":"foo","v":"bar"}}`+"\n"+`{"k":0,"e":{"k":"bar","v":"waz"}}`+"\n")
+		log, err := New[KV](f, ops, WithHeader())
+		assert.NoError(t, err)
+		defer log.Close()
+		err = log.Replay(KV{})
+		assert.NoError(t, err)
+		appendAll(t, log, &Delete{Key: "foo"})
+		assert.Equal(t, KV{"bar": "waz"}, replay(t, log))
+	})
+
+	t.Run("RejectsNewerVersion", func(t *testing.T) {
+		f := writeTestFile(t, `{"replaylog":3}`+"\n")
+		_, err := New[KV](f, ops, WithHeader())
+		assert.Error(t, err)
+		log, err := New[KV](f, ops)
+		assert.NoError(t, err)
+		defer log.Close()
+		err = log.Replay(KV{})
+		assert.Error(t, err)
+	})
+}
+
+// writeTestFile creates a temporary file containing content, positioned at
+// its start.
+func writeTestFile(t *testing.T, content string) *os.File {
+	t.Helper()
+	f, err := ioutil.TempFile(t.TempDir(), "")
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+	_, err = f.WriteString(content)
+	assert.NoError(t, err)
+	_, err = f.Seek(0, 0)
+	assert.NoError(t, err)
+	return f
+}
+
+func TestWithFormatMigration(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log")
+	v1 := `{"k":0,"e":{"k":"foo","v":"bar"}}` + "\n"
+	assert.NoError(t, os.WriteFile(path, []byte(v1), 0640))
+	var versions []int
+	migrate := func(old File, version int) (File, error) {
+		versions = append(versions, version)
+		return UpgradeFormat(old, version)
+	}
+	log, err := Open(path, ops, WithFormatMigration(migrate))
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1}, versions)
+	assert.Equal(t, KV{"foo": "bar"}, replay(t, log))
+	appendAll(t, log, &Delete{Key: "foo"})
+	assert.NoError(t, log.Close())
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"replaylog":2}`+"\n"+v1+`{"k":1,"e":{"k":"foo"}}`+"\n", string(data))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+
+	// Logs in the latest format aren't migrated again.
+	log, err = Open(path, ops, WithFormatMigration(migrate))
+	assert.NoError(t, err)
+	assert.NoError(t, log.Close())
+	assert.Equal(t, []int{1}, versions)
+
+	// Nor are empty logs.
+	_, err = New[KV](&MemoryFile{}, ops, WithFormatMigration(migrate))
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1}, versions)
+
+	_, err = New[KV](&MemoryFile{data: []byte(v1)}, ops, WithFormatMigration(UpgradeFormat))
+	assert.EqualError(t, err, "failed to migrate log from format version 1: can't upgrade log of type *replaylog.MemoryFile, it must be an *os.File")
+	_, err = New[KV](&MemoryFile{data: []byte(v1)}, ops, WithFormatMigration(func(old File, version int) (File, error) {
+		return old, nil
+	}))
+	assert.EqualError(t, err, "migration from format version 1 produced version 1, expected 2")
+}
@@ -0,0 +1,23 @@
+package replaylog
+
+// KeyedOp is an optional interface that an Op can implement to report which
+// keys of the State it modifies, for use with History.
+type KeyedOp interface {
+	// Touches returns true if the Op modifies "key".
+	Touches(key string) bool
+}
+
+// History returns, in order, every op in the log that touches "key".
+//
+// Ops that do not implement KeyedOp are ignored. The log is read from the
+// start, and its position restored afterwards.
+func (l *Log[State]) History(key string) ([]Op[State], error) {
+	var history []Op[State]
+	err := l.eachOp(func(index int, logEntry Frame, op Op[State]) error {
+		if keyed, ok := op.(KeyedOp); ok && keyed.Touches(key) {
+			history = append(history, op)
+		}
+		return nil
+	})
+	return history, err
+}
@@ -0,0 +1,18 @@
+package replaylog
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func (s *Set) Touches(key string) bool    { return s.Key == key }
+func (d *Delete) Touches(key string) bool { return d.Key == key }
+
+func TestHistory(t *testing.T) {
+	log := newTestLog(t)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"}, &Delete{Key: "foo"})
+	history, err := log.History("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []Op[KV]{&Set{Key: "foo", Value: "bar"}, &Delete{Key: "foo"}}, history)
+}
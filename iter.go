@@ -0,0 +1,45 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+)
+
+// Ops returns an iterator over the ops recorded in the log from its current
+// position, without applying them.
+//
+// Iteration stops after the first error, which is prefixed with the index of
+// the offending entry. If iteration is stopped early, the
+// log is positioned immediately after the last op yielded.
+func (l *Log[State]) Ops() iter.Seq2[Op[State], error] {
+	return func(yield func(Op[State], error) bool) {
+		r, err := l.currentReader()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for {
+			logEntry, err := l.nextEntry(r)
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				yield(nil, fmt.Errorf("entry %d: %w", r.index-1, err))
+				return
+			}
+			op, err := l.decodeOp(logEntry)
+			if err != nil {
+				yield(nil, fmt.Errorf("entry %d: %w", r.index-1, err))
+				return
+			}
+			if !yield(op, nil) {
+				if err := l.reposition(r); err != nil {
+					yield(nil, err)
+				}
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package replaylog
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestOps(t *testing.T) {
+	log := newTestLog(t)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"}, &Delete{Key: "foo"})
+
+	err := log.Rewind()
+	assert.NoError(t, err)
+	actual := []Op[KV]{}
+	for op, err := range log.Ops() {
+		assert.NoError(t, err)
+		actual = append(actual, op)
+	}
+	assert.Equal(t, []Op[KV]{&Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"}, &Delete{Key: "foo"}}, actual)
+
+	t.Run("StopEarly", func(t *testing.T) {
+		err := log.Rewind()
+		assert.NoError(t, err)
+		for op, err := range log.Ops() {
+			assert.NoError(t, err)
+			assert.Equal(t, Op[KV](&Set{Key: "foo", Value: "bar"}), op)
+			break
+		}
+		// The remainder of the log is replayed from where iteration stopped.
+		state := KV{}
+		err = log.Replay(state)
+		assert.NoError(t, err)
+		assert.Equal(t, KV{"bar": "waz"}, state)
+	})
+}
+
+func TestOpsErrorIndex(t *testing.T) {
+	data := `{"k":0,"e":{"k":"foo","v":"bar"}}` + "\n" + `{"k":9,"e":{}}` + "\n"
+	log, err := New[KV](&MemoryFile{data: []byte(data)}, ops)
+	assert.NoError(t, err)
+	assert.NoError(t, log.Rewind())
+	var lastErr error
+	count := 0
+	for _, err := range log.Ops() {
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		count++
+	}
+	assert.Equal(t, 1, count)
+	assert.Error(t, lastErr)
+	assert.Contains(t, lastErr.Error(), "entry 1: ")
+}
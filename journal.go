@@ -0,0 +1,109 @@
+package replaylog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ReplayWithJournal replays the log from the start into dest, recording the
+// index of each applied entry in "journal" and skipping entries already
+// recorded there by a previous call.
+//
+// This makes recovery resumable for ops with side effects outside of dest,
+// such as writes to an external system, whose Apply can't safely be run
+// twice: if replay is interrupted it can be repeated with the same journal to
+// continue after the last recorded entry. Note that skipped ops are not
+// applied to dest at all, so dest only reflects the ops applied by this call.
+//
+// Each index is synced to the journal after its op is applied, so an op
+// interrupted between the two is applied again when resuming; the journal
+// narrows this window to a single op, but can't remove it. A partial record
+// at the end of the journal, left by a crash, is truncated if the journal
+// implements Truncater, otherwise an error is returned.
+//
+// The journal must be positioned at its start, and is left at its end.
+func (l *Log[State]) ReplayWithJournal(dest State, journal File) error {
+	defer l.startReplaying()()
+	applied, err := readJournal(journal)
+	if err != nil {
+		return err
+	}
+	if err := l.Rewind(); err != nil {
+		return err
+	}
+	r, err := l.startReplay(dest)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	var journalErr error
+	_, err = l.replayUntil(r, dest, replayControl[State]{
+		accept: func(Frame) (apply, more bool) {
+			_, seen := applied[r.index-1]
+			return !seen, true
+		},
+		dispatch: func(logEntry Frame, op, parent Op[State]) error {
+			err := l.apply(logEntry, op, parent, dest)
+			if err != nil && !errors.Is(err, ErrStopReplay) {
+				return err
+			}
+			if journalErr = writeJournal(journal, r.index-1); journalErr != nil {
+				return ErrStopReplay
+			}
+			return err
+		},
+	})
+	if journalErr != nil {
+		return journalErr
+	}
+	return err
+}
+
+// readJournal reads the indices recorded in a journal by ReplayWithJournal,
+// leaving it positioned at its end.
+func readJournal(journal File) (map[int]struct{}, error) {
+	data, err := io.ReadAll(journal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	if complete < len(data) {
+		truncater, ok := journal.(Truncater)
+		if !ok {
+			return nil, fmt.Errorf("journal ends with a partial record %q", data[complete:])
+		}
+		if err := truncater.Truncate(int64(complete)); err != nil {
+			return nil, fmt.Errorf("failed to truncate partial journal record: %w", err)
+		}
+		if _, err := seekable(journal).Seek(int64(complete), io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to truncate partial journal record: %w", err)
+		}
+	}
+	applied := map[int]struct{}{}
+	for i, line := range bytes.Split(data[:complete], []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		index, err := strconv.Atoi(string(line))
+		if err != nil || index < 0 {
+			return nil, fmt.Errorf("corrupt journal record %d: %q", i, line)
+		}
+		applied[index] = struct{}{}
+	}
+	return applied, nil
+}
+
+// writeJournal records that the entry at "index" was applied, and syncs the
+// journal.
+func writeJournal(journal File, index int) error {
+	if _, err := journal.Write([]byte(strconv.Itoa(index) + "\n")); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := syncFile(journal); err != nil {
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+	return nil
+}
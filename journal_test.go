@@ -0,0 +1,69 @@
+package replaylog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+type outbox struct {
+	sent []string
+	down bool
+}
+
+type sendEmail struct {
+	To string `json:"to"`
+}
+
+func (s *sendEmail) Apply(o *outbox) error {
+	if o.down && s.To == "carol" {
+		return errors.New("mail server down")
+	}
+	o.sent = append(o.sent, s.To)
+	return nil
+}
+
+func TestReplayWithJournal(t *testing.T) {
+	log, err := New[*outbox](&MemoryFile{}, []Op[*outbox]{&sendEmail{}})
+	assert.NoError(t, err)
+	for _, to := range []string{"alice", "bob", "carol", "dave"} {
+		assert.NoError(t, log.Append(&sendEmail{To: to}))
+	}
+	path := filepath.Join(t.TempDir(), "journal")
+	journal, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	assert.NoError(t, err)
+	first := &outbox{down: true}
+	assert.Error(t, log.ReplayWithJournal(first, journal))
+	assert.Equal(t, []string{"alice", "bob"}, first.sent)
+	assert.NoError(t, journal.Close())
+
+	// A crash part way through writing a record leaves a partial record.
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "0\n1\n", string(data))
+	assert.NoError(t, os.WriteFile(path, []byte("0\n1\n2"), 0600))
+
+	journal, err = os.OpenFile(path, os.O_RDWR, 0)
+	assert.NoError(t, err)
+	defer journal.Close()
+	second := &outbox{}
+	assert.NoError(t, log.ReplayWithJournal(second, journal))
+	assert.Equal(t, []string{"carol", "dave"}, second.sent)
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "0\n1\n2\n3\n", string(data))
+
+	// The log is positioned at its end.
+	assert.NoError(t, log.Append(&sendEmail{To: "eve"}))
+	_, err = journal.Seek(0, 0)
+	assert.NoError(t, err)
+	third := &outbox{}
+	assert.NoError(t, log.ReplayWithJournal(third, journal))
+	assert.Equal(t, []string{"eve"}, third.sent)
+
+	err = log.ReplayWithJournal(&outbox{}, &MemoryFile{data: []byte("0\nx\n")})
+	assert.EqualError(t, err, `corrupt journal record 1: "x"`)
+}
@@ -0,0 +1,50 @@
+// Package kv provides a durable key-value store built on replaylog, and serves
+// as an example of how to design Ops.
+//
+// Ops have pointer receivers and stable JSON tags, and are registered in a
+// fixed order by Ops, so existing logs remain readable as the package evolves.
+package kv
+
+import (
+	"github.com/alecthomas/replaylog"
+)
+
+// KV is a map State of string keys to values of type V.
+type KV[V any] map[string]V
+
+// Set a key to a value.
+type Set[V any] struct {
+	Key   string `json:"k"`
+	Value V      `json:"v"`
+}
+
+func (s *Set[V]) Apply(kv KV[V]) error {
+	kv[s.Key] = s.Value
+	return nil
+}
+
+// Delete a key, which need not exist.
+type Delete[V any] struct {
+	Key string `json:"k"`
+}
+
+func (d *Delete[V]) Apply(kv KV[V]) error {
+	delete(kv, d.Key)
+	return nil
+}
+
+// Ops returns the Ops of a KV, in the order they must be registered with a Log.
+func Ops[V any]() []replaylog.Op[KV[V]] {
+	return []replaylog.Op[KV[V]]{&Set[V]{}, &Delete[V]{}}
+}
+
+// New creates a Log of KV[V] with Set and Delete registered.
+func New[V any](f replaylog.File, options ...replaylog.Option) (*replaylog.Log[KV[V]], error) {
+	return replaylog.New[KV[V]](f, Ops[V](), options...)
+}
+
+// Open opens or creates the KV log at "path" and replays it, returning the log
+// positioned for appending and the replayed KV.
+func Open[V any](path string) (*replaylog.Log[KV[V]], KV[V], error) {
+	return replaylog.OpenAndReplay(path, func() KV[V] { return KV[V]{} }, Ops[V]()...)
+}
@@ -0,0 +1,53 @@
+package kv
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+type point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+func TestKV(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "")
+	assert.NoError(t, err)
+	log, err := New[point](f)
+	assert.NoError(t, err)
+	defer log.Close()
+	assert.NoError(t, log.Append(&Set[point]{Key: "a", Value: point{X: 1, Y: 2}}))
+	assert.NoError(t, log.Append(&Set[point]{Key: "b", Value: point{X: 3, Y: 4}}))
+	assert.NoError(t, log.Append(&Delete[point]{Key: "a"}))
+	assert.NoError(t, log.Append(&Delete[point]{Key: "missing"}))
+	assert.NoError(t, log.Rewind())
+	state := KV[point]{}
+	assert.NoError(t, log.Replay(state))
+	assert.Equal(t, KV[point]{"b": {X: 3, Y: 4}}, state)
+
+	data, err := os.ReadFile(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, `{"k":0,"e":{"k":"a","v":{"x":1,"y":2}}}
+{"k":0,"e":{"k":"b","v":{"x":3,"y":4}}}
+{"k":1,"e":{"k":"a"}}
+{"k":1,"e":{"k":"missing"}}
+`, string(data))
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv.log")
+	log, state, err := Open[string](path)
+	assert.NoError(t, err)
+	assert.Equal(t, KV[string]{}, state)
+	assert.NoError(t, log.Append(&Set[string]{Key: "foo", Value: "bar"}))
+	assert.NoError(t, log.Append(&Set[string]{Key: "bar", Value: "waz"}))
+	assert.NoError(t, log.Close())
+
+	log, state, err = Open[string](path)
+	assert.NoError(t, err)
+	defer log.Close()
+	assert.Equal(t, KV[string]{"foo": "bar", "bar": "waz"}, state)
+}
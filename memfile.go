@@ -0,0 +1,153 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// MemoryFile is a File held entirely in memory, for tests and for embedding a
+// Log where durability isn't required. The zero value is an empty file.
+//
+// It implements io.Seeker, io.ReaderAt, Truncater and Syncer, so every
+// operation that doesn't require an *os.File is supported. Sync is a no-op.
+type MemoryFile struct {
+	lock sync.Mutex
+	data []byte
+	pos  int64
+}
+
+// NewMemoryFile returns a MemoryFile containing a copy of data, positioned at
+// its start.
+func NewMemoryFile(data []byte) *MemoryFile {
+	return &MemoryFile{data: append([]byte(nil), data...)}
+}
+
+// Bytes returns a copy of the contents of the file.
+func (m *MemoryFile) Bytes() []byte {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]byte(nil), m.data...)
+}
+
+func (m *MemoryFile) Read(p []byte) (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.pos >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[m.pos:])
+	m.pos += int64(n)
+	return n, nil
+}
+
+func (m *MemoryFile) ReadAt(p []byte, off int64) (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Write writes p at the current position, extending the file if necessary.
+func (m *MemoryFile) Write(p []byte) (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if end := m.pos + int64(len(p)); end > int64(len(m.data)) {
+		m.data = append(m.data, make([]byte, end-int64(len(m.data)))...)
+	}
+	n := copy(m.data[m.pos:], p)
+	m.pos += int64(n)
+	return n, nil
+}
+
+func (m *MemoryFile) Seek(offset int64, whence int) (int64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += m.pos
+	case io.SeekEnd:
+		offset += int64(len(m.data))
+	default:
+		return m.pos, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return m.pos, fmt.Errorf("can't seek to negative offset %d", offset)
+	}
+	m.pos = offset
+	return m.pos, nil
+}
+
+// Truncate changes the size of the file, without changing its position.
+func (m *MemoryFile) Truncate(size int64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if size < 0 {
+		return fmt.Errorf("can't truncate to negative size %d", size)
+	}
+	if size <= int64(len(m.data)) {
+		m.data = m.data[:size]
+	} else {
+		m.data = append(m.data, make([]byte, size-int64(len(m.data)))...)
+	}
+	return nil
+}
+
+func (m *MemoryFile) Sync() error { return nil }
+
+// Close does nothing, so the contents remain available from Bytes.
+func (m *MemoryFile) Close() error { return nil }
+
+// NewFromReadWriter is New for an io.ReadWriter that may not implement
+// io.Closer, such as a network stream or a bytes.Buffer.
+//
+// Closing the Log closes rw only if it implements io.Closer. As for any File,
+// rw is synced only if it implements Syncer, and if it doesn't implement
+// io.Seeker the log is read and appended to forward-only, so operations that
+// need to seek fail with ErrNotSeekable. Other optional interfaces, such as
+// Truncater, are only used if rw implements io.Closer.
+func NewFromReadWriter[State any](rw io.ReadWriter, ops []Op[State], options ...Option) (*Log[State], error) {
+	if rw == nil {
+		return nil, errors.New("NewFromReadWriter: nil io.ReadWriter")
+	}
+	if f, ok := rw.(File); ok {
+		return New(f, ops, options...)
+	}
+	f := nopCloser{rw}
+	if s, ok := rw.(io.Seeker); ok {
+		return New[State](nopSeekCloser{f, s}, ops, options...)
+	}
+	return New[State](f, ops, options...)
+}
+
+// nopCloser is a File with a no-op Close that syncs the io.ReadWriter it wraps
+// if it implements Syncer.
+type nopCloser struct {
+	io.ReadWriter
+}
+
+func (nopCloser) Close() error { return nil }
+
+func (n nopCloser) Sync() error {
+	if s, ok := n.ReadWriter.(Syncer); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// nopSeekCloser is a nopCloser for an io.ReadWriter that can seek.
+type nopSeekCloser struct {
+	nopCloser
+	io.Seeker
+}
@@ -0,0 +1,43 @@
+package replaylog
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestMemoryFile(t *testing.T) {
+	f := &MemoryFile{}
+	log, err := New[KV](f, ops, WithHeader())
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "a", Value: "1"}, &Set{Key: "b", Value: "2"}, &Delete{Key: "a"})
+	assert.Equal(t, KV{"b": "2"}, replay(t, log))
+
+	assert.NoError(t, log.TruncateAt(2))
+	assert.Equal(t, KV{"a": "1", "b": "2"}, replay(t, log))
+	assert.NoError(t, log.Close())
+
+	log, err = New[KV](NewMemoryFile(f.Bytes()), ops, WithHeader())
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"a": "1", "b": "2"}, replay(t, log))
+}
+
+func TestNewFromReadWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	buf.WriteString(`{"k":0,"e":{"k":"foo","v":"bar"}}` + "\n")
+	log, err := NewFromReadWriter[KV](buf, ops)
+	assert.NoError(t, err)
+	state := KV{}
+	assert.NoError(t, log.Replay(state))
+	assert.Equal(t, KV{"foo": "bar"}, state)
+	appendAll(t, log, &Delete{Key: "foo"})
+	assert.Equal(t, `{"k":1,"e":{"k":"foo"}}`+"\n", buf.String())
+	err = log.Rewind()
+	assert.True(t, errors.Is(err, ErrNotSeekable), "%v", err)
+	assert.NoError(t, log.Close())
+
+	_, err = NewFromReadWriter[KV](nil, ops)
+	assert.EqualError(t, err, "NewFromReadWriter: nil io.ReadWriter")
+}
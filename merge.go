@@ -0,0 +1,113 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MergeSorted appends every entry of srcs to dst in a single timeline ordered
+// by the timestamps recorded with WithTimestamps.
+//
+// Each source must have been written with WithTimestamps and be individually
+// sorted by time, which holds for a log written by a single process with a
+// monotonic clock; MergeSorted fails if either assumption is violated, after
+// appending every entry before the violation. Entries with the same timestamp
+// are ordered by the index of their source in srcs, then by their order within
+// that source. Ops are re-encoded using the options of dst as for Transcode,
+// preserving their original timestamps if dst records timestamps.
+//
+// Sources are read from the start, and their positions restored afterwards.
+func MergeSorted[State any](dst *Log[State], srcs ...*Log[State]) error {
+	seen := map[*Log[State]]bool{dst: true}
+	for _, src := range srcs {
+		if seen[src] {
+			return errors.New("can't merge a log more than once, or into itself")
+		}
+		seen[src] = true
+	}
+	cursors := make([]*mergeCursor[State], len(srcs))
+	var open func(i int) error
+	open = func(i int) error {
+		if i == len(srcs) {
+			return mergeCursors(dst, cursors)
+		}
+		return srcs[i].fromStart(func(r *reader) error {
+			cursors[i] = &mergeCursor[State]{log: srcs[i], source: i, r: r}
+			if err := cursors[i].advance(); err != nil {
+				return err
+			}
+			return open(i + 1)
+		})
+	}
+	return open(0)
+}
+
+// mergeCursor is the next entry of a source log in MergeSorted.
+type mergeCursor[State any] struct {
+	log    *Log[State]
+	source int
+	r      *reader
+	done   bool
+	index  int
+	entry  Frame
+	op     Op[State]
+}
+
+// advance the cursor to the next entry of its source.
+func (c *mergeCursor[State]) advance() error {
+	prev := c.entry.Time
+	logEntry, err := c.log.nextEntry(c.r)
+	if errors.Is(err, io.EOF) {
+		c.done = true
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("source %d: entry %d: %w", c.source, c.r.index-1, err)
+	}
+	c.index = c.r.index - 1
+	if logEntry.Time == 0 {
+		return fmt.Errorf("source %d: entry %d has no timestamp", c.source, c.index)
+	}
+	if logEntry.Time < prev {
+		return fmt.Errorf("source %d: entry %d is earlier than the entry before it", c.source, c.index)
+	}
+	if c.op, err = c.log.decodeOp(logEntry); err != nil {
+		return fmt.Errorf("source %d: entry %d: %w", c.source, c.index, err)
+	}
+	c.entry = logEntry
+	return nil
+}
+
+// mergeCursors appends the earliest entry of the cursors to dst until all of
+// them are exhausted.
+func mergeCursors[State any](dst *Log[State], cursors []*mergeCursor[State]) error {
+	for {
+		var next *mergeCursor[State]
+		for _, c := range cursors {
+			if !c.done && (next == nil || c.entry.Time < next.entry.Time) {
+				next = c
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		e, err := dst.newEntry(next.op)
+		if err != nil {
+			return fmt.Errorf("source %d: entry %d: %w", next.source, next.index, err)
+		}
+		e.Version = next.entry.Version
+		if dst.timestamps {
+			e.Time = next.entry.Time
+		}
+		frame, err := dst.encodeFrame(e)
+		if err != nil {
+			return fmt.Errorf("source %d: entry %d: %w", next.source, next.index, err)
+		}
+		if err := dst.appendFrames(frame, 1); err != nil {
+			return err
+		}
+		if err := next.advance(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package replaylog
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestMergeSorted(t *testing.T) {
+	shard := func(entries ...any) *Log[KV] {
+		log := newTestLog(t, WithTimestamps())
+		for i := 0; i < len(entries); i += 2 {
+			ts := entries[i].(int)
+			log.now = func() time.Time { return time.Unix(0, int64(ts)) }
+			appendAll(t, log, entries[i+1].(Op[KV]))
+		}
+		return log
+	}
+	a := shard(1, &Set{Key: "a", Value: "1"}, 4, &Set{Key: "a", Value: "4"})
+	b := shard(2, &Set{Key: "b", Value: "2"}, 4, &Delete{Key: "a"}, 5, &Set{Key: "b", Value: "5"})
+	c := shard(3, &Set{Key: "c", Value: "3"})
+	dst := newTestLog(t, WithTimestamps())
+	assert.NoError(t, MergeSorted(dst, a, b, c))
+	data, err := os.ReadFile(dst.f.(*os.File).Name())
+	assert.NoError(t, err)
+	assert.Equal(t, `{"k":0,"e":{"k":"a","v":"1"},"t":1}
+{"k":0,"e":{"k":"b","v":"2"},"t":2}
+{"k":0,"e":{"k":"c","v":"3"},"t":3}
+{"k":0,"e":{"k":"a","v":"4"},"t":4}
+{"k":1,"e":{"k":"a"},"t":4}
+{"k":0,"e":{"k":"b","v":"5"},"t":5}
+`, string(data))
+	assert.Equal(t, KV{"b": "5", "c": "3"}, replay(t, dst))
+
+	unsorted := shard(2, &Set{Key: "a", Value: "2"}, 1, &Set{Key: "a", Value: "1"})
+	err = MergeSorted(newTestLog(t), unsorted)
+	assert.EqualError(t, err, "source 0: entry 1 is earlier than the entry before it")
+
+	untimed := newTestLog(t)
+	appendAll(t, untimed, &Set{Key: "a", Value: "1"})
+	err = MergeSorted(newTestLog(t), a, untimed)
+	assert.EqualError(t, err, "source 1: entry 0 has no timestamp")
+
+	err = MergeSorted(dst, a, dst)
+	assert.Error(t, err)
+}
@@ -0,0 +1,33 @@
+package replaylog
+
+// AppendWithMeta appends an Op to the log along with string metadata, such as
+// a request or trace ID, stored in its entry rather than the op.
+//
+// Metadata is ignored by replay, but is available from Each in EntryInfo.Meta
+// and from FrameReader. Entries appended without metadata don't store any.
+func (l *Log[State]) AppendWithMeta(event Op[State], meta map[string]string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.encoded = 0
+	event, err := l.appendHook(event)
+	if err != nil {
+		return err
+	}
+	e, err := l.newEntry(event)
+	if err != nil {
+		return err
+	}
+	e.Meta = meta
+	frame, err := l.encodeFrame(e)
+	if err != nil {
+		return err
+	}
+	if err := l.writeAndSync(frame, 1); err != nil {
+		return err
+	}
+	if err := l.verifyAppended([]Op[State]{event}); err != nil {
+		return err
+	}
+	l.publish(event)
+	return nil
+}
@@ -0,0 +1,33 @@
+package replaylog
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestAppendWithMeta(t *testing.T) {
+	f := &MemoryFile{}
+	log, err := New[KV](f, ops)
+	assert.NoError(t, err)
+	assert.NoError(t, log.AppendWithMeta(&Set{Key: "foo", Value: "bar"}, map[string]string{"request": "r1", "user": "alice"}))
+	assert.NoError(t, log.AppendWithMeta(&Delete{Key: "foo"}, nil))
+	assert.NoError(t, log.Append(&Set{Key: "bar", Value: "waz"}))
+	assert.Equal(t, `{"k":0,"e":{"k":"foo","v":"bar"},"m":{"request":"r1","user":"alice"}}
+{"k":1,"e":{"k":"foo"}}
+{"k":0,"e":{"k":"bar","v":"waz"}}
+`, string(f.data))
+
+	var metas []map[string]string
+	err = log.Each(func(info EntryInfo, op Op[KV]) error {
+		metas = append(metas, info.Meta)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]string{{"request": "r1", "user": "alice"}, nil, nil}, metas)
+
+	state := KV{}
+	assert.NoError(t, log.Rewind())
+	assert.NoError(t, log.Replay(state))
+	assert.Equal(t, KV{"bar": "waz"}, state)
+}
@@ -0,0 +1,24 @@
+package replaylog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// mirrorText writes a description of op to the text mirror, if any, as
+// configured by WithTextMirror.
+func (l *Log[State]) mirrorText(op Op[State]) {
+	if l.textMirror == nil {
+		return
+	}
+	var text string
+	if stringer, ok := op.(fmt.Stringer); ok {
+		text = stringer.String()
+	} else {
+		text = fmt.Sprintf("%+v", op)
+	}
+	text = strings.ReplaceAll(text, "\n", `\n`)
+	if _, err := fmt.Fprintln(l.textMirror, text); err != nil && l.observer.OnTextMirrorError != nil {
+		l.observer.OnTextMirrorError(err)
+	}
+}
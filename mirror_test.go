@@ -0,0 +1,39 @@
+package replaylog
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+type describedSet struct{ Set }
+
+func (d *describedSet) String() string { return "set " + d.Key + "=" + d.Value }
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errors.New("mirror unavailable") }
+
+func TestTextMirror(t *testing.T) {
+	w := &strings.Builder{}
+	f := &MemoryFile{}
+	log, err := New[KV](f, []Op[KV]{&Set{}, &Delete{}, &describedSet{}}, WithTextMirror(w))
+	assert.NoError(t, err)
+	assert.NoError(t, log.Append(&Set{Key: "foo", Value: "bar"}))
+	assert.NoError(t, log.AppendAtomic(&describedSet{Set{Key: "bar", Value: "waz"}}, &Delete{Key: "foo"}))
+	assert.Equal(t, "&{Key:foo Value:bar}\nset bar=waz\n&{Key:foo}\n", w.String())
+	assert.Equal(t, KV{"bar": "waz"}, replay(t, log))
+
+	t.Run("Errors", func(t *testing.T) {
+		var mirrorErr error
+		log, err := New[KV](&MemoryFile{}, ops, WithTextMirror(failingWriter{}), WithObserver(Observer{
+			OnTextMirrorError: func(err error) { mirrorErr = err },
+		}))
+		assert.NoError(t, err)
+		assert.NoError(t, log.Append(&Set{Key: "foo", Value: "bar"}))
+		assert.EqualError(t, mirrorErr, "mirror unavailable")
+		assert.Equal(t, KV{"foo": "bar"}, replay(t, log))
+	})
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package replaylog
+
+// mmapReader is not supported on this platform.
+func (l *Log[State]) mmapReader() (*reader, bool) {
+	return nil, false
+}
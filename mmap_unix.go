@@ -0,0 +1,35 @@
+//go:build unix
+
+package replaylog
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// mmapReader returns a reader over a memory mapping of the log, positioned at
+// the current position of the log, or false if the log can't be mapped.
+func (l *Log[State]) mmapReader() (*reader, bool) {
+	f, ok := l.f.(*os.File)
+	if !ok {
+		return nil, false
+	}
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 || int64(int(info.Size())) != info.Size() {
+		return nil, false
+	}
+	pos, err := f.Seek(0, io.SeekCurrent)
+	if err != nil || pos > info.Size() {
+		return nil, false
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, false
+	}
+	r := newDataReader(data, pos)
+	r.delim = l.delimiter
+	r.binary = l.binaryFraming()
+	r.release = func() { _ = syscall.Munmap(data) }
+	return r, true
+}
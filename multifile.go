@@ -0,0 +1,77 @@
+package replaylog
+
+import (
+	"fmt"
+	"io"
+)
+
+// MultiFile is a File that mirrors writes to one or more additional Files.
+//
+// Reads and seeks are served by the primary File. Each write is applied to the
+// primary and then to every mirror at the same offset, and Sync only succeeds
+// once every File has been synced. If the primary becomes corrupt, a mirror
+// can be used in its place.
+type MultiFile struct {
+	primary seekFile
+	mirrors []seekFile
+}
+
+var _ File = (*MultiFile)(nil)
+
+// NewMultiFile creates a File that writes to primary and all mirrors.
+func NewMultiFile(primary File, mirrors ...File) *MultiFile {
+	m := &MultiFile{primary: seekable(primary)}
+	for _, mirror := range mirrors {
+		m.mirrors = append(m.mirrors, seekable(mirror))
+	}
+	return m
+}
+
+func (m *MultiFile) Read(p []byte) (int, error) { return m.primary.Read(p) }
+
+func (m *MultiFile) Seek(offset int64, whence int) (int64, error) {
+	return m.primary.Seek(offset, whence)
+}
+
+func (m *MultiFile) Write(p []byte) (int, error) {
+	pos, err := m.primary.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	n, err := m.primary.Write(p)
+	if err != nil {
+		return n, err
+	}
+	for i, mirror := range m.mirrors {
+		if _, err := mirror.Seek(pos, io.SeekStart); err != nil {
+			return n, fmt.Errorf("mirror %d: %w", i, err)
+		}
+		if _, err := mirror.Write(p); err != nil {
+			return n, fmt.Errorf("mirror %d: %w", i, err)
+		}
+	}
+	return n, nil
+}
+
+func (m *MultiFile) Sync() error {
+	if err := syncFile(m.primary); err != nil {
+		return err
+	}
+	for i, mirror := range m.mirrors {
+		if err := syncFile(mirror); err != nil {
+			return fmt.Errorf("mirror %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Close all Files, returning the first error encountered.
+func (m *MultiFile) Close() error {
+	err := m.primary.Close()
+	for i, mirror := range m.mirrors {
+		if merr := mirror.Close(); merr != nil && err == nil {
+			err = fmt.Errorf("mirror %d: %w", i, merr)
+		}
+	}
+	return err
+}
@@ -0,0 +1,39 @@
+package replaylog
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestMultiFile(t *testing.T) {
+	dir := t.TempDir()
+	primary, err := ioutil.TempFile(dir, "")
+	assert.NoError(t, err)
+	mirror, err := ioutil.TempFile(dir, "")
+	assert.NoError(t, err)
+
+	log, err := New[KV](NewMultiFile(primary, mirror), ops)
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"})
+	// Replaying moves the primary's position, the mirror must stay in step.
+	assert.Equal(t, KV{"foo": "bar"}, replay(t, log))
+	appendAll(t, log, &Set{Key: "bar", Value: "waz"})
+	err = log.Close()
+	assert.NoError(t, err)
+
+	expected, err := os.ReadFile(primary.Name())
+	assert.NoError(t, err)
+	actual, err := os.ReadFile(mirror.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), string(actual))
+
+	f, err := os.OpenFile(mirror.Name(), os.O_RDWR, 0600)
+	assert.NoError(t, err)
+	log, err = New[KV](f, ops)
+	assert.NoError(t, err)
+	defer log.Close()
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, replay(t, log))
+}
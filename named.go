@@ -0,0 +1,103 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// NamedLog is a Log that identifies each entry by the name of its Op type,
+// rather than its position in the slice of ops, so ops may be freely
+// reordered or removed without affecting existing logs.
+type NamedLog[State any] struct {
+	*Log[State]
+}
+
+// NewNamed creates a new NamedLog for recording mutation operations against the
+// type State.
+//
+// "ops" maps the name recorded in the log to each supported mutation type.
+// Names must not change between instantiations.
+func NewNamed[State any](f File, ops map[string]Op[State], options ...Option) (*NamedLog[State], error) {
+	names := make([]string, 0, len(ops))
+	for name := range ops {
+		if name == "" {
+			return nil, errors.New("op names must not be empty")
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	positional := make([]Op[State], len(names))
+	kinds := make(map[string]int, len(names))
+	types := make(map[reflect.Type]string, len(names))
+	for kind, name := range names {
+		op := ops[name]
+		if other, ok := types[reflect.TypeOf(op)]; ok {
+			return nil, fmt.Errorf("op %T is registered as both %q and %q", op, other, name)
+		}
+		types[reflect.TypeOf(op)] = name
+		positional[kind] = op
+		kinds[name] = kind
+	}
+	l, err := New(f, positional, options...)
+	if err != nil {
+		return nil, err
+	}
+	for kind, name := range l.legacyKinds {
+		if _, ok := kinds[name]; name != "" && !ok {
+			return nil, fmt.Errorf("WithLegacyKinds: kind %d is named %q, which is not registered", kind, name)
+		}
+	}
+	l.names = names
+	l.kinds = kinds
+	return &NamedLog[State]{l}, nil
+}
+
+// MigrateToNamed appends every entry in the positional log src to dst, naming
+// each entry of kind K in src "names[K]".
+//
+// Every kind present in src must have a name, and the op registered with dst
+// under that name must be of the same type. This is checked before anything is
+// written to dst. Application versions, timestamps and metadata are preserved.
+//
+// src is read from the start, and its position restored afterwards.
+func MigrateToNamed[State any](src *Log[State], dst *NamedLog[State], names []string) error {
+	if src == dst.Log {
+		return errors.New("can't migrate a log into itself")
+	}
+	err := src.eachOp(func(index int, logEntry Frame, op Op[State]) error {
+		if logEntry.Kind < 0 || logEntry.Kind >= len(names) || names[logEntry.Kind] == "" {
+			return fmt.Errorf("entry %d: no name for kind %d", index, logEntry.Kind)
+		}
+		name := names[logEntry.Kind]
+		kind, ok := dst.kinds[name]
+		if !ok {
+			return fmt.Errorf("entry %d: no op named %q in destination", index, name)
+		}
+		if expected := reflect.TypeOf(dst.ops[kind]); expected != reflect.TypeOf(op) {
+			return fmt.Errorf("entry %d: op %s of kind %d is named %q, but that is %s in destination", index, reflect.TypeOf(op), logEntry.Kind, name, expected)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return src.eachOp(func(index int, logEntry Frame, op Op[State]) error {
+		e, err := dst.newEntry(op)
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", index, err)
+		}
+		e.Version = logEntry.Version
+		if logEntry.Time != 0 {
+			e.Time = logEntry.Time
+		}
+		e.Meta = logEntry.Meta
+		e.Group, e.GroupContext = logEntry.Group, logEntry.GroupContext
+		frame, err := dst.encodeFrame(e)
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", index, err)
+		}
+		return dst.appendFrames(frame, 1)
+	})
+}
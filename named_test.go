@@ -0,0 +1,84 @@
+package replaylog
+
+import (
+	"os"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestMigrateToNamed(t *testing.T) {
+	src := newTestLog(t)
+	appendAll(t, src, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"}, &Delete{Key: "foo"})
+
+	f := writeTestFile(t, "")
+	dst, err := NewNamed[KV](f, map[string]Op[KV]{"set": &Set{}, "delete": &Delete{}})
+	assert.NoError(t, err)
+	err = MigrateToNamed(src, dst, []string{"set", "delete"})
+	assert.NoError(t, err)
+	data, err := os.ReadFile(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, `{"k":1,"e":{"k":"foo","v":"bar"},"n":"set"}
+{"k":1,"e":{"k":"bar","v":"waz"},"n":"set"}
+{"k":0,"e":{"k":"foo"},"n":"delete"}
+`, string(data))
+	assert.Equal(t, replay(t, src), replay(t, dst.Log))
+
+	// Reordering and adding ops doesn't affect the log.
+	_, err = f.Seek(0, 0)
+	assert.NoError(t, err)
+	reordered, err := NewNamed[KV](f, map[string]Op[KV]{"a": &copyOp{}, "set": &Set{}, "delete": &Delete{}})
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"bar": "waz"}, replay(t, reordered.Log))
+
+	// Positional entries can't be read by a NamedLog.
+	positional, err := New[KV](f, []Op[KV]{&Delete{}, &Set{}})
+	assert.NoError(t, err)
+	appendAll(t, positional, &Set{Key: "waz", Value: "foo"})
+	err = reordered.Rewind()
+	assert.NoError(t, err)
+	assert.Error(t, reordered.Replay(KV{}))
+}
+
+func TestMigrateToNamedValidatesNames(t *testing.T) {
+	src := newTestLog(t)
+	appendAll(t, src, &Set{Key: "foo", Value: "bar"}, &Delete{Key: "foo"})
+	f := writeTestFile(t, "")
+	dst, err := NewNamed[KV](f, map[string]Op[KV]{"set": &Set{}, "delete": &Delete{}})
+	assert.NoError(t, err)
+
+	err = MigrateToNamed(src, dst, []string{"set"})
+	assert.EqualError(t, err, "entry 1: no name for kind 1")
+	err = MigrateToNamed(src, dst, []string{"delete", "set"})
+	assert.Error(t, err)
+	data, err := os.ReadFile(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, "", string(data))
+
+	_, err = NewNamed[KV](f, map[string]Op[KV]{"set": &Set{}, "other": &Set{}})
+	assert.Error(t, err)
+}
+
+func TestWithLegacyKinds(t *testing.T) {
+	f := writeTestFile(t, "")
+	positional, err := New[KV](f, ops)
+	assert.NoError(t, err)
+	appendAll(t, positional, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"}, &Delete{Key: "foo"})
+
+	named, err := NewNamed[KV](f, map[string]Op[KV]{"set": &Set{}, "delete": &Delete{}}, WithLegacyKinds([]string{"set", "delete"}))
+	assert.NoError(t, err)
+	appendAll(t, named.Log, &Set{Key: "new", Value: "entry"})
+	assert.Equal(t, KV{"bar": "waz", "new": "entry"}, replay(t, named.Log))
+	data, err := os.ReadFile(f.Name())
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `{"k":1,"e":{"k":"new","v":"entry"},"n":"set"}`)
+
+	// Kinds without a legacy name are unknown.
+	named, err = NewNamed[KV](f, map[string]Op[KV]{"set": &Set{}, "delete": &Delete{}}, WithLegacyKinds([]string{"set"}))
+	assert.NoError(t, err)
+	assert.NoError(t, named.Rewind())
+	assert.EqualError(t, named.Replay(KV{}), "unknown legacy event kind 1")
+
+	_, err = NewNamed[KV](f, map[string]Op[KV]{"set": &Set{}}, WithLegacyKinds([]string{"set", "delete"}))
+	assert.EqualError(t, err, `WithLegacyKinds: kind 1 is named "delete", which is not registered`)
+}
@@ -0,0 +1,82 @@
+package replaylog
+
+import (
+	"fmt"
+	"time"
+)
+
+// Observer receives notifications about the activity of a Log.
+//
+// All fields are optional. Callbacks are invoked synchronously, so must be fast.
+type Observer struct {
+	// OnSlowReplay is called once during a Replay that has run for longer
+	// than the duration set by WithReplayDeadlineWarning, with the number of
+	// entries applied so far. Replay continues regardless.
+	OnSlowReplay func(elapsed time.Duration, applied int)
+
+	// OnSnapshotError is called when writing a snapshot configured by
+	// WithPeriodicSnapshot fails. The append that triggered the snapshot
+	// still succeeds, and a snapshot is attempted again after another period.
+	OnSnapshotError func(err error)
+
+	// OnTextMirrorError is called when writing to the text mirror configured
+	// by WithTextMirror fails. The append still succeeds.
+	OnTextMirrorError func(err error)
+
+	// OnReplayError is called when a replay fails at the entry at "index",
+	// with the category of the failure, before the error is returned.
+	OnReplayError func(index int, category ErrorCategory, err error)
+
+	// OnQuarantine is called by OpenRecovering after the corrupt tail of a
+	// log, "size" bytes starting at "offset", has been moved to the file at
+	// "path".
+	OnQuarantine func(path string, offset, size int64)
+}
+
+// ReplayError is returned by Replay and its variants when an entry can't be
+// replayed, identifying the entry. Use errors.As to retrieve it.
+type ReplayError struct {
+	Index    int   // Index of the entry in the log.
+	Offset   int64 // Offset of the entry in the log, in bytes.
+	Kind     int   // Kind of the entry, or -1 if it couldn't be decoded or its name isn't registered.
+	Category ErrorCategory
+	Err      error
+}
+
+// Error returns the message of Err, which already identifies the entry.
+func (e *ReplayError) Error() string { return e.Err.Error() }
+
+func (e *ReplayError) Unwrap() error { return e.Err }
+
+// ErrorCategory classifies the errors reported to Observer.OnReplayError.
+type ErrorCategory int
+
+// Categories of replay errors.
+const (
+	// ErrorDecode is an entry that couldn't be read or decoded, or that
+	// doesn't match its schema.
+	ErrorDecode ErrorCategory = iota
+	// ErrorChecksum is an entry that failed an integrity check, such as a
+	// sequence number written WithSequenceNumbers.
+	ErrorChecksum
+	// ErrorApply is an op that returned an error when applied.
+	ErrorApply
+	// ErrorUnknownKind is an entry of a kind, or with a name, that is not
+	// registered with the Log.
+	ErrorUnknownKind
+)
+
+func (c ErrorCategory) String() string {
+	switch c {
+	case ErrorDecode:
+		return "decode"
+	case ErrorChecksum:
+		return "checksum"
+	case ErrorApply:
+		return "apply"
+	case ErrorUnknownKind:
+		return "unknown-kind"
+	default:
+		return fmt.Sprintf("ErrorCategory(%d)", int(c))
+	}
+}
@@ -0,0 +1,129 @@
+package replaylog
+
+import (
+	"errors"
+	"io"
+)
+
+// IdentifiedOp is an optional interface that an Op can implement to be
+// appended at most once with AppendOnce.
+//
+// The ID must be encoded as part of the op, so that it is recovered when the
+// op is decoded from the log.
+type IdentifiedOp interface {
+	// ID uniquely identifies the op across redeliveries.
+	ID() string
+}
+
+// opIDs is the set of IDs of the IdentifiedOps in the log.
+type opIDs struct {
+	seen map[string]struct{}
+	// complete is true once every entry in the log has been added to seen.
+	complete bool
+}
+
+func (o *opIDs) reset() {
+	o.seen = map[string]struct{}{}
+	o.complete = false
+}
+
+// add the ID of op to the set if it is an IdentifiedOp and the set is being
+// tracked.
+func (o *opIDs) add(op any) {
+	if o.seen == nil {
+		return
+	}
+	if op, ok := op.(IdentifiedOp); ok {
+		o.seen[op.ID()] = struct{}{}
+	}
+}
+
+// reserve adds the ID of op to the set like add, returning it if it wasn't
+// already in the set.
+func (o *opIDs) reserve(op any) (string, bool) {
+	if o.seen == nil {
+		return "", false
+	}
+	identified, ok := op.(IdentifiedOp)
+	if !ok {
+		return "", false
+	}
+	id := identified.ID()
+	if _, seen := o.seen[id]; seen {
+		return "", false
+	}
+	o.seen[id] = struct{}{}
+	return id, true
+}
+
+// release IDs added by reserve.
+func (o *opIDs) release(ids []string) {
+	for _, id := range ids {
+		delete(o.seen, id)
+	}
+}
+
+// AppendOnce appends op to the log unless an op with the same ID has already
+// been appended, returning true if op was appended.
+//
+// Ops that don't implement IdentifiedOp are always appended. The set of IDs
+// is collected by a full replay of the log and kept current by appends, or if
+// the log has not been replayed in full, by scanning the log on first use.
+// WithGroupCommit, the ID of each op is reserved once it is written, so that a
+// concurrent AppendOnce of the same ID isn't appended while waiting for the
+// shared sync, and released if the sync fails.
+func (l *Log[State]) AppendOnce(op Op[State]) (appended bool, err error) {
+	err = l.grouped(func() error {
+		if op, err = l.appendHook(op); err != nil {
+			return err
+		}
+		if identified, ok := op.(IdentifiedOp); ok {
+			if !l.ids.complete {
+				if err := l.scanIDs(); err != nil {
+					return err
+				}
+			}
+			if _, seen := l.ids.seen[identified.ID()]; seen {
+				return nil
+			}
+		}
+		if err := l.appendLocked(op); err != nil {
+			return err
+		}
+		appended = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return appended, nil
+}
+
+// scanIDs collects the IDs of every IdentifiedOp in the log.
+func (l *Log[State]) scanIDs() error {
+	ids := opIDs{seen: map[string]struct{}{}}
+	err := l.rewound(func(r *reader) error {
+		for {
+			logEntry, err := l.nextEntry(r)
+			if errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if l.skipUnknown() && !l.knownKind(logEntry.Kind) {
+				continue
+			}
+			op, err := l.decodeOp(logEntry)
+			if err != nil {
+				return err
+			}
+			ids.add(op)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	ids.complete = true
+	l.ids = ids
+	return nil
+}
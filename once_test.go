@@ -0,0 +1,66 @@
+package replaylog
+
+import (
+	"os"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// delivery is a Set with an ID.
+type delivery struct {
+	Set
+	DeliveryID string `json:"id"`
+}
+
+func (d *delivery) ID() string { return d.DeliveryID }
+
+func TestAppendOnce(t *testing.T) {
+	deliveryOps := []Op[KV]{&Set{}, &Delete{}, &delivery{}}
+	f, err := os.CreateTemp(t.TempDir(), "")
+	assert.NoError(t, err)
+	log, err := New[KV](f, deliveryOps)
+	assert.NoError(t, err)
+	defer log.Close()
+	appended, err := log.AppendOnce(&delivery{Set: Set{Key: "foo", Value: "bar"}, DeliveryID: "1"})
+	assert.NoError(t, err)
+	assert.True(t, appended)
+	appended, err = log.AppendOnce(&delivery{Set: Set{Key: "foo", Value: "waz"}, DeliveryID: "1"})
+	assert.NoError(t, err)
+	assert.False(t, appended)
+	appended, err = log.AppendOnce(&Set{Key: "bar", Value: "waz"})
+	assert.NoError(t, err)
+	assert.True(t, appended)
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, replay(t, log))
+
+	// IDs are collected by replay.
+	reopen := func() *Log[KV] {
+		f, err := os.OpenFile(f.Name(), os.O_RDWR, 0600)
+		assert.NoError(t, err)
+		log, err := New[KV](f, deliveryOps)
+		assert.NoError(t, err)
+		t.Cleanup(func() { _ = log.Close() })
+		return log
+	}
+	log = reopen()
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, replay(t, log))
+	assert.True(t, log.ids.complete)
+	appended, err = log.AppendOnce(&delivery{Set: Set{Key: "foo", Value: "waz"}, DeliveryID: "1"})
+	assert.NoError(t, err)
+	assert.False(t, appended)
+
+	// Or by scanning the log if it hasn't been replayed.
+	log = reopen()
+	assert.False(t, log.ids.complete)
+	appended, err = log.AppendOnce(&delivery{Set: Set{Key: "foo", Value: "waz"}, DeliveryID: "1"})
+	assert.NoError(t, err)
+	assert.False(t, appended)
+	assert.True(t, log.ids.complete)
+
+	// An op whose entry was truncated away can be appended again.
+	assert.NoError(t, log.TruncateAt(0))
+	appended, err = log.AppendOnce(&delivery{Set: Set{Key: "foo", Value: "waz"}, DeliveryID: "1"})
+	assert.NoError(t, err)
+	assert.True(t, appended)
+	assert.Equal(t, KV{"foo": "waz"}, replay(t, log))
+}
@@ -0,0 +1,148 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// CompactOnline is like Compact, but only blocks appends briefly at the end,
+// so that it can be used on a live log.
+//
+// The log must be an *os.File, and can't use WithSequenceNumbers since entries
+// are moved. Compaction proceeds as follows:
+//
+//  1. With the lock held, the end of the log is recorded as the cut-off.
+//  2. Without the lock, the log up to the cut-off is replayed from a second
+//     handle into a fresh State from "factory", and the ops returned by
+//     "snapshot" for it are written to a temporary file in the same
+//     directory, then verified as for Compact. Appends continue to the
+//     original log meanwhile.
+//  3. With the lock held, the entries appended after the cut-off are copied
+//     verbatim to the end of the temporary file, which is synced and
+//     atomically renamed over the original. The log then switches to it,
+//     positioned at its end.
+//
+// If any step fails the temporary file is removed and the original log is left
+// untouched. An error is returned if the log is compacted or truncated by
+// other means before the switch-over.
+func (l *Log[State]) CompactOnline(factory func() State, snapshot func(State) []Op[State]) error {
+	if l.readOnly {
+		return ErrReadOnly
+	}
+	if l.sequenceNumbers {
+		return errors.New("can't compact a log WithSequenceNumbers online")
+	}
+	src, cutoff, err := l.cutoff()
+	if err != nil {
+		return err
+	}
+
+	h, err := os.Open(src.Name())
+	if err != nil {
+		return fmt.Errorf("failed to open log for compaction: %w", err)
+	}
+	defer h.Close()
+	original := factory()
+	prefix := l.withFile(h)
+	if _, err := prefix.replayUntil(prefix.newReader(io.LimitReader(h, cutoff), 0), original, replayControl[State]{shadow: true}); err != nil {
+		return err
+	}
+	dst, err := os.CreateTemp(filepath.Dir(src.Name()), filepath.Base(src.Name())+".*.compact")
+	if err != nil {
+		return fmt.Errorf("failed to create compacted log: %w", err)
+	}
+	if err := l.switchOver(src, h, dst, cutoff, original, factory, snapshot); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+		return err
+	}
+	return nil
+}
+
+// cutoff returns the File of the log and its size, for step 1 of
+// CompactOnline.
+func (l *Log[State]) cutoff() (*os.File, int64, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	src, ok := l.f.(*os.File)
+	if !ok {
+		return nil, 0, fmt.Errorf("can't compact log of type %T online, it must be an *os.File", l.f)
+	}
+	size, err := l.flushedSize()
+	return src, size, err
+}
+
+// switchOver writes the compacted log to dst, then copies the entries after
+// "cutoff" from h to it before replacing src. It implements steps 2 and 3 of
+// CompactOnline.
+func (l *Log[State]) switchOver(src, h, dst *os.File, cutoff int64, original State, factory func() State, snapshot func(State) []Op[State]) error {
+	compacted, err := l.writeCompacted(dst, original, factory, snapshot(original), false)
+	if err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.f != seekFile(src) {
+		return errors.New("log was replaced during online compaction")
+	}
+	end, err := l.flushedSize()
+	if err != nil {
+		return err
+	}
+	if end < cutoff {
+		return fmt.Errorf("log was truncated during online compaction from %d to %d bytes", cutoff, end)
+	}
+	if _, err := h.Seek(cutoff, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek to entries appended during compaction: %w", err)
+	}
+	if _, err := io.CopyN(dst, h, end-cutoff); err != nil {
+		return fmt.Errorf("failed to copy entries appended during compaction: %w", err)
+	}
+	if err := dst.Sync(); err != nil {
+		return fmt.Errorf("failed to sync compacted log: %w", err)
+	}
+	if err := os.Rename(dst.Name(), src.Name()); err != nil {
+		return fmt.Errorf("failed to replace log with compacted log: %w", err)
+	}
+	_ = l.f.Close()
+	l.f = reopenRenamed(dst, src.Name())
+	l.buf = nil
+	l.size = compacted.size + end - cutoff
+	l.entries = -1
+	l.pending = 0
+	l.forgetEntries()
+	if l.snapshotEvery > 0 {
+		// Offsets in the previous snapshot refer to the original log.
+		l.snapshots = periodicSnapshots[State]{}
+	}
+	return nil
+}
+
+// flushedSize flushes any buffered writes, returning the size of the log. Must
+// be called with the lock held.
+func (l *Log[State]) flushedSize() (int64, error) {
+	if err := l.buffer().Flush(); err != nil {
+		return 0, fmt.Errorf("failed to flush log: %w", err)
+	}
+	return l.fileSize()
+}
+
+// reopenRenamed returns a handle to f, which has been renamed to "path" and is
+// positioned at its end, that reports its new name so that it can be replaced
+// again. If f can't be reopened, it is returned as is.
+func reopenRenamed(f *os.File, path string) *os.File {
+	reopened, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return f
+	}
+	if _, err := reopened.Seek(0, io.SeekEnd); err != nil {
+		_ = reopened.Close()
+		return f
+	}
+	_ = f.Close()
+	return reopened
+}
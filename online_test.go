@@ -0,0 +1,46 @@
+package replaylog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestCompactOnline(t *testing.T) {
+	log := newTestLog(t)
+	path := log.f.(*os.File).Name()
+	appendAll(t, log,
+		&Set{Key: "foo", Value: "bar"},
+		&Set{Key: "bar", Value: "waz"},
+		&Set{Key: "foo", Value: "waz"},
+		&Delete{Key: "bar"},
+	)
+	// Appends made while the compacted log is being written go to the
+	// original log, and are carried over at switch-over.
+	err := log.CompactOnline(func() KV { return KV{} }, func(state KV) []Op[KV] {
+		appendAll(t, log, &Set{Key: "live", Value: "1"}, &Delete{Key: "foo"})
+		return snapshotKV(state)
+	})
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "after", Value: "2"})
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"k":0,"e":{"k":"foo","v":"waz"}}
+{"k":0,"e":{"k":"live","v":"1"}}
+{"k":1,"e":{"k":"foo"}}
+{"k":0,"e":{"k":"after","v":"2"}}
+`, string(data))
+	assert.Equal(t, KV{"live": "1", "after": "2"}, replay(t, log))
+	matches, err := filepath.Glob(path + ".*.compact")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(matches))
+
+	err = log.CompactOnline(func() KV { return KV{} }, func(KV) []Op[KV] { return nil })
+	assert.True(t, errors.Is(err, ErrCompactionMismatch))
+	appendAll(t, log, &Delete{Key: "live"})
+	assert.Equal(t, KV{"after": "2"}, replay(t, log))
+}
@@ -0,0 +1,67 @@
+package replaylog
+
+import (
+	"fmt"
+	"os"
+)
+
+// Open opens or creates the log at "path", with "ops" and options as for New.
+//
+// The file is created with the mode set by WithFileMode, or 0600 by default.
+func Open[State any](path string, ops []Op[State], opts ...Option) (*Log[State], error) {
+	o := &options{}
+	for _, option := range opts {
+		if err := option(o); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, o.createMode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log %q: %w", path, err)
+	}
+	log, err := New[State](f, ops, opts...)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to create log %q: %w", path, err)
+	}
+	return log, nil
+}
+
+// OpenRecovering is like Open, but first recovers from a corrupt tail, such as
+// an entry torn by a crash, returning the number of bytes removed.
+//
+// Everything from the first entry that can't be decoded, as for Repair, is
+// moved to a quarantine file named "<path>.corrupt.<timestamp>" for later
+// investigation, where the timestamp is in nanoseconds since the Unix epoch.
+// The quarantine file is written to a temporary file and synced before being
+// renamed into place, then the log is truncated to its healthy prefix and
+// Observer.OnQuarantine is called.
+func OpenRecovering[State any](path string, ops []Op[State], opts ...Option) (*Log[State], int64, error) {
+	log, err := Open(path, ops, opts...)
+	if err != nil {
+		return nil, 0, err
+	}
+	quarantined, err := log.quarantineTail(path)
+	if err != nil {
+		_ = log.Close()
+		return nil, 0, fmt.Errorf("failed to recover log %q: %w", path, err)
+	}
+	return log, quarantined, nil
+}
+
+// OpenAndReplay opens or creates the log at "path", replays it into a new
+// State created by "factory", and returns the Log positioned for appending
+// along with the replayed State.
+func OpenAndReplay[State any](path string, factory func() State, ops ...Op[State]) (*Log[State], State, error) {
+	var state State
+	log, err := Open(path, ops)
+	if err != nil {
+		return nil, state, err
+	}
+	state = factory()
+	if err := log.Replay(state); err != nil {
+		_ = log.Close()
+		return nil, state, fmt.Errorf("failed to replay log %q: %w", path, err)
+	}
+	return log, state, nil
+}
@@ -0,0 +1,65 @@
+package replaylog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestOpenAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	factory := func() KV { return KV{} }
+	log, state, err := OpenAndReplay(path, factory, ops...)
+	assert.NoError(t, err)
+	assert.Equal(t, KV{}, state)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"})
+	assert.NoError(t, log.Close())
+
+	log, state, err = OpenAndReplay(path, factory, ops...)
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, state)
+	appendAll(t, log, &Delete{Key: "foo"})
+	assert.NoError(t, log.Close())
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"k":0,"e":{"k":"foo","v":"bar"}}
+{"k":0,"e":{"k":"bar","v":"waz"}}
+{"k":1,"e":{"k":"foo"}}
+`, string(data))
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"k":7,"e":{}}`+"\n"), 0600))
+	_, _, err = OpenAndReplay(path, factory, ops...)
+	assert.EqualError(t, err, `failed to replay log "`+path+`": unknown event kind 7`)
+}
+
+func TestWithFileMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	log, err := Open(path, ops, WithFileMode(0640))
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"})
+	assert.NoError(t, log.Close())
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	// Existing files keep their permissions.
+	log, err = Open(path, ops, WithFileMode(0644))
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"foo": "bar"}, replay(t, log))
+	assert.NoError(t, log.Close())
+	info, err = os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	log, err = Open(filepath.Join(t.TempDir(), "log"), ops)
+	assert.NoError(t, err)
+	info, err = os.Stat(log.f.(*os.File).Name())
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	assert.NoError(t, log.Close())
+
+	_, err = Open(path, ops, WithFileMode(os.ModeDir|0700))
+	assert.EqualError(t, err, "WithFileMode: mode must only contain permission bits but got drwx------")
+}
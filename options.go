@@ -0,0 +1,1070 @@
+package replaylog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// An Option configures a Log.
+type Option func(o *options) error
+
+type options struct {
+	resetBeforeReplay    bool
+	replayFilter         any // func(Op[State]) bool
+	syncAttempts         int
+	syncBackoff          time.Duration
+	sizeHint             bool
+	appVersion           int
+	compression          Compression
+	compressionLevel     int
+	compressionThreshold int
+	applyTimeout         time.Duration
+	header               bool
+	readOnly             bool
+	maxLogSize           int64
+	observer             Observer
+	replayDeadline       time.Duration
+	snapshotEvery        int
+	snapshotMarshal      any // func(State) ([]byte, error)
+	snapshotStore        SnapshotStore
+	autoSnapshot         bool // Replay restores from snapshotStore, see WithSnapshotStore.
+	commitMarker         bool
+	commitMarkerEvery    int
+	schemas              map[int]*jsonschema.Schema
+	sequenceNumbers      bool
+	timestamps           bool
+	now                  func() time.Time // Overrides time.Now in tests.
+	coalesce             any              // func(prev, next Op[State]) (Op[State], bool)
+	appendHook           any              // func(op Op[State]) (Op[State], error)
+	mmap                 bool
+	trailer              bool
+	writeBuffer          func(f File) WriteBuffer
+	validateOps          bool
+	callerTracking       bool
+	migrations           map[int]func(json.RawMessage) (json.RawMessage, error)
+	textMirror           io.Writer
+	unknownKinds         UnknownKindPolicy
+	applyAttempts        int
+	applyBackoff         func(attempt int) time.Duration
+	retryable            func(err error) bool
+	recentCache          int
+	skipCloseSync        bool
+	useNumber            bool
+	stagedWrites         bool
+	kindHandlers         map[int]any // func(Op[State], State) error
+	eventTransform       func(kind int, event json.RawMessage) (json.RawMessage, error)
+	delimiter            byte
+	stateSizeLimit       int
+	stateSize            any // func(State) int
+	stateSizeEvery       int
+	fallbackOp           any // RawOp[State]
+	zstdDictionary       []byte
+	writeTimeout         time.Duration
+	segmentSize          int64
+	verifyOnAppend       bool
+	sizeThreshold        int64
+	sizeWatcher          func(size int64)
+	logicalClock         bool
+	sandboxedReplay      bool
+	fileMode             os.FileMode
+	assignIDs            bool
+	formatMigration      func(old File, version int) (File, error)
+	ringRetention        int64
+	codec                Codec
+	groupCommit          bool
+	groupCommitWindow    time.Duration
+	entryChecksums       bool
+	fileLock             lockMode
+	fileLockWait         bool
+	legacyKinds          []string
+	onUnknownKind        func(kind int, raw []byte) error
+	onApplyError         any // func(index int, op Op[State], err error) error
+	binaryRecords        bool
+}
+
+// hooks are the State-typed options of a Log, resolved by New.
+type hooks[State any] struct {
+	replayFilter    func(Op[State]) bool
+	snapshotMarshal func(State) ([]byte, error)
+	coalesce        func(prev, next Op[State]) (Op[State], bool)
+	appendHook      func(op Op[State]) (Op[State], error)
+	kindHandlers    map[int]func(op Op[State], state State) error
+	stateSize       func(State) int
+	fallbackOp      RawOp[State]
+	onApplyError    func(index int, op Op[State], err error) error
+}
+
+func resolveHooks[State any](o *options) (h hooks[State], err error) {
+	if h.replayFilter, err = typedOption[func(Op[State]) bool]("WithReplayFilter", o.replayFilter); err != nil {
+		return h, err
+	}
+	if h.snapshotMarshal, err = typedOption[func(State) ([]byte, error)]("WithPeriodicSnapshot", o.snapshotMarshal); err != nil {
+		return h, err
+	}
+	if h.coalesce, err = typedOption[func(prev, next Op[State]) (Op[State], bool)]("WithCoalesce", o.coalesce); err != nil {
+		return h, err
+	}
+	if h.appendHook, err = typedOption[func(Op[State]) (Op[State], error)]("WithAppendHook", o.appendHook); err != nil {
+		return h, err
+	}
+	if h.stateSize, err = typedOption[func(State) int]("WithStateSizeLimit", o.stateSize); err != nil {
+		return h, err
+	}
+	if h.fallbackOp, err = typedOption[RawOp[State]]("WithFallbackOp", o.fallbackOp); err != nil {
+		return h, err
+	}
+	if h.onApplyError, err = typedOption[func(int, Op[State], error) error]("WithOnApplyError", o.onApplyError); err != nil {
+		return h, err
+	}
+	for kind, handler := range o.kindHandlers {
+		if h.kindHandlers == nil {
+			h.kindHandlers = map[int]func(Op[State], State) error{}
+		}
+		if h.kindHandlers[kind], err = typedOption[func(Op[State], State) error]("WithKindHandler", handler); err != nil {
+			return h, err
+		}
+	}
+	return h, nil
+}
+
+// typedOption asserts that the value of a State-typed option has type T.
+func typedOption[T any](name string, v any) (T, error) {
+	var zero T
+	if v == nil {
+		return zero, nil
+	}
+	t, ok := v.(T)
+	if !ok {
+		return zero, fmt.Errorf("%s: expected %T but got %T", name, zero, v)
+	}
+	return t, nil
+}
+
+// WithResetBeforeReplay resets the destination State at the start of each Replay.
+//
+// If State implements Resettable its Reset method is called, otherwise map
+// States are cleared. Any other State type will cause Replay to fail.
+func WithResetBeforeReplay() Option {
+	return func(o *options) error {
+		o.resetBeforeReplay = true
+		return nil
+	}
+}
+
+// WithReplayFilter skips applying decoded ops for which keep returns false.
+//
+// "keep" must be a func(Op[State]) bool for the State type of the Log.
+func WithReplayFilter[State any](keep func(op Op[State]) bool) Option {
+	return func(o *options) error {
+		o.replayFilter = keep
+		return nil
+	}
+}
+
+// WithSyncRetry retries a failed Sync up to "attempts" times in total, waiting
+// "backoff" between each attempt.
+//
+// If every attempt fails, Append returns an error wrapping ErrNotDurable.
+func WithSyncRetry(attempts int, backoff time.Duration) Option {
+	return func(o *options) error {
+		if attempts < 1 {
+			return fmt.Errorf("WithSyncRetry: attempts must be at least 1 but got %d", attempts)
+		}
+		o.syncAttempts = attempts
+		o.syncBackoff = backoff
+		return nil
+	}
+}
+
+// WithApplyRetry retries an Op that fails to apply during Replay up to
+// "attempts" times in total, waiting backoff(attempt) after each failed
+// attempt, starting from 1. If "backoff" is nil, retries are immediate.
+//
+// Only errors accepted by the predicate set by WithRetryable are retried, or
+// all errors if it is not set. ErrStopReplay is never retried. An Op may be
+// applied more than once, so it must leave the State unchanged if it fails.
+func WithApplyRetry(attempts int, backoff func(attempt int) time.Duration) Option {
+	return func(o *options) error {
+		if attempts < 1 {
+			return fmt.Errorf("WithApplyRetry: attempts must be at least 1 but got %d", attempts)
+		}
+		o.applyAttempts = attempts
+		o.applyBackoff = backoff
+		return nil
+	}
+}
+
+// WithRetryable sets the predicate used by WithApplyRetry to decide whether an
+// error returned by Apply is transient. Errors it rejects fail Replay
+// immediately.
+func WithRetryable(retryable func(err error) bool) Option {
+	return func(o *options) error {
+		o.retryable = retryable
+		return nil
+	}
+}
+
+// WithSizeHint calls Grow on States implementing Grower with the number of
+// entries remaining in the log before Replay applies them.
+//
+// This requires an additional pass over the log to count its entries.
+func WithSizeHint() Option {
+	return func(o *options) error {
+		o.sizeHint = true
+		return nil
+	}
+}
+
+// WithAppVersion stamps each appended entry with an application version.
+//
+// During Replay the version is passed to ops implementing VersionedOp, allowing
+// them to handle payloads written by older versions of the application.
+func WithAppVersion(version int) Option {
+	return func(o *options) error {
+		if version < 0 {
+			return fmt.Errorf("WithAppVersion: version must not be negative but got %d", version)
+		}
+		o.appVersion = version
+		return nil
+	}
+}
+
+// WithCompression compresses each appended entry independently.
+//
+// Replay decompresses entries regardless of this option, so logs may freely
+// mix compressed and uncompressed entries.
+func WithCompression(compression Compression) Option {
+	return func(o *options) error {
+		if compression < CompressNone || compression > CompressZstd {
+			return fmt.Errorf("WithCompression: unknown compression %d", compression)
+		}
+		o.compression = compression
+		return nil
+	}
+}
+
+// WithCompressionLevel sets the algorithm specific level used by WithCompression.
+//
+// The default of 0 selects the default level of the algorithm.
+func WithCompressionLevel(level int) Option {
+	return func(o *options) error {
+		o.compressionLevel = level
+		return nil
+	}
+}
+
+// WithZstdDictionary compresses entries with zstd using a pre-trained
+// dictionary, which greatly improves the compression of small entries that
+// share structure. The dictionary can be trained offline from sample ops, eg.
+// with "zstd --train".
+//
+// Compression defaults to CompressZstd unless set by WithCompression, and any
+// other compression is an error. The dictionary is not recorded in the log, so
+// it must be stored and shipped alongside it: a log compressed with a
+// dictionary can only be replayed with the same dictionary.
+func WithZstdDictionary(dict []byte) Option {
+	return func(o *options) error {
+		if len(dict) == 0 {
+			return errors.New("WithZstdDictionary: dictionary must not be empty")
+		}
+		if o.compression == CompressNone {
+			o.compression = CompressZstd
+		}
+		o.zstdDictionary = dict
+		return nil
+	}
+}
+
+// WithApplyTimeout fails Replay with ErrApplyTimeout if any single Op takes
+// longer than "timeout" to apply.
+//
+// Each Apply runs in its own goroutine. Go provides no way to stop a goroutine,
+// so an Op that times out continues running in the background and may still
+// mutate the State. The State should be discarded after a timeout.
+func WithApplyTimeout(timeout time.Duration) Option {
+	return func(o *options) error {
+		o.applyTimeout = timeout
+		return nil
+	}
+}
+
+// WithWriteTimeout fails appends with ErrWriteTimeout if writing and syncing
+// them takes longer than "timeout", eg. because the File is on a hung network
+// filesystem.
+//
+// A timeout marks the log as degraded, so that further appends fail fast with
+// ErrWriteTimeout until ResetDegraded is called, and Close doesn't attempt to
+// finish the log. Go provides no way to cancel a blocked write, so it may
+// still complete in the background, and the contents of the log should be
+// considered inconsistent after a timeout.
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(o *options) error {
+		o.writeTimeout = timeout
+		return nil
+	}
+}
+
+// WithHeader writes a format version header when creating a new log.
+//
+// Logs are readable with or without this option. See FormatVersion for the
+// supported versions.
+func WithHeader() Option {
+	return func(o *options) error {
+		o.header = true
+		return nil
+	}
+}
+
+// WithFormatMigration upgrades existing logs in an older format version, as
+// described by FormatVersion, when they are opened by New.
+//
+// "migrate" is called with the log and its version, and must return the log
+// in the latest format, positioned at its start, which is then used in place
+// of the original. It should replace the original atomically, so that a crash
+// part way through doesn't lose the log, as UpgradeFormat does. It isn't
+// called for empty logs, or WithReadOnly.
+func WithFormatMigration(migrate func(old File, version int) (File, error)) Option {
+	return func(o *options) error {
+		o.formatMigration = migrate
+		return nil
+	}
+}
+
+// WithReadOnly prevents all modifications to the log.
+//
+// Operations that would write to the log return ErrReadOnly without touching
+// the File, so a File opened with os.O_RDONLY can be used safely.
+func WithReadOnly() Option {
+	return func(o *options) error {
+		o.readOnly = true
+		return nil
+	}
+}
+
+// WithMaxLogSize rejects appends with ErrLogFull if they would grow the log
+// beyond "size" bytes.
+//
+// The size of the log is determined once by New, then tracked as entries are
+// appended.
+func WithMaxLogSize(size int64) Option {
+	return func(o *options) error {
+		if size <= 0 {
+			return fmt.Errorf("WithMaxLogSize: size must be positive but got %d", size)
+		}
+		o.maxLogSize = size
+		return nil
+	}
+}
+
+// WithSizeWatcher calls "fn" with the size of the log when an append grows it
+// to "threshold" bytes or more, eg. to raise an alert or trigger compaction.
+//
+// "fn" is called once per crossing: it is called again only after the log has
+// shrunk below the threshold, such as by compaction, then grown past it. The
+// size is determined once by New, then tracked as entries are appended. "fn"
+// is called with the lock of the Log held, so it must be fast and must not
+// call methods on the Log.
+func WithSizeWatcher(threshold int64, fn func(size int64)) Option {
+	return func(o *options) error {
+		if threshold <= 0 {
+			return fmt.Errorf("WithSizeWatcher: threshold must be positive but got %d", threshold)
+		}
+		o.sizeThreshold = threshold
+		o.sizeWatcher = fn
+		return nil
+	}
+}
+
+// WithEntryCompression only compresses entries whose encoded op is larger than
+// "threshold" bytes, storing smaller entries uncompressed.
+//
+// Compression defaults to CompressZstd unless set by WithCompression.
+func WithEntryCompression(threshold int) Option {
+	return func(o *options) error {
+		if threshold < 0 {
+			return fmt.Errorf("WithEntryCompression: threshold must not be negative but got %d", threshold)
+		}
+		if o.compression == CompressNone {
+			o.compression = CompressZstd
+		}
+		o.compressionThreshold = threshold
+		return nil
+	}
+}
+
+// WithObserver sets an Observer to be notified of Log activity.
+func WithObserver(observer Observer) Option {
+	return func(o *options) error {
+		o.observer = observer
+		return nil
+	}
+}
+
+// WithReplayDeadlineWarning notifies Observer.OnSlowReplay when a Replay takes
+// longer than "deadline", without otherwise affecting the Replay.
+func WithReplayDeadlineWarning(deadline time.Duration) Option {
+	return func(o *options) error {
+		o.replayDeadline = deadline
+		return nil
+	}
+}
+
+// WithPeriodicSnapshot writes a snapshot of the State to "path" after every
+// "everyN" appended entries, for use with ReplayFromSnapshot.
+//
+// "marshal" must be a func(State) ([]byte, error) for the State type of the
+// Log. The snapshot is written atomically by renaming a temporary file in the
+// same directory over "path".
+//
+// The Log does not have access to the caller's State, so it maintains its own
+// copy by replaying entries appended since the previous snapshot. This doubles
+// the memory used by the State, and the append that triggers a snapshot also
+// pays for applying the last "everyN" entries, marshalling the State and
+// syncing the snapshot file. The first snapshot replays the whole log unless
+// the Log was initialised with ReplayFromSnapshot. Failures are reported to
+// Observer.OnSnapshotError and do not fail the append, which is already durable.
+func WithPeriodicSnapshot[State any](everyN int, marshal func(State) ([]byte, error), path string) Option {
+	return func(o *options) error {
+		if everyN < 1 {
+			return fmt.Errorf("WithPeriodicSnapshot: everyN must be at least 1 but got %d", everyN)
+		}
+		o.snapshotEvery = everyN
+		o.snapshotMarshal = marshal
+		o.snapshotStore = FileSnapshotStore(path)
+		o.autoSnapshot = false
+		return nil
+	}
+}
+
+// WithGroupCommit shares the sync of entries written by concurrent calls to
+// Append, AppendAtomic and Batch.Commit, so that a burst of appends incurs a
+// single sync rather than one each.
+//
+// Each append still writes its entries with the lock held, then waits for
+// "window" to let other appends write theirs, and syncs them all at once.
+// Appends only return once a sync that began after their write has succeeded,
+// so they are as durable as without this option, but each append is delayed
+// by up to "window". Subscribers are notified once the shared sync succeeds.
+// If it fails, every append it covers returns the error.
+func WithGroupCommit(window time.Duration) Option {
+	return func(o *options) error {
+		if window < 0 {
+			return fmt.Errorf("WithGroupCommit: window must not be negative but got %s", window)
+		}
+		o.groupCommit = true
+		o.groupCommitWindow = window
+		return nil
+	}
+}
+
+// WithCommitMarker appends a commit marker to the log on Close, and after
+// every "every" appended entries if "every" is positive.
+//
+// A log that ends with a commit marker was not truncated by a crash, which
+// ReplayClean reports. Markers are ignored by Replay, but logs containing them
+// can't be read by versions of this package that predate this option.
+func WithCommitMarker(every int) Option {
+	return func(o *options) error {
+		if every < 0 {
+			return fmt.Errorf("WithCommitMarker: every must not be negative but got %d", every)
+		}
+		o.commitMarker = true
+		o.commitMarkerEvery = every
+		return nil
+	}
+}
+
+// WithSchemas validates the event of each entry against a JSON Schema before
+// it is decoded, keyed by kind.
+//
+// Kinds without a schema are not validated. Entries that fail validation cause
+// Replay and Validate to fail.
+func WithSchemas(schemas map[int]string) Option {
+	return func(o *options) error {
+		o.schemas = make(map[int]*jsonschema.Schema, len(schemas))
+		for kind, schema := range schemas {
+			compiler := jsonschema.NewCompiler()
+			url := fmt.Sprintf("replaylog:///kind/%d", kind)
+			if err := compiler.AddResource(url, strings.NewReader(schema)); err != nil {
+				return fmt.Errorf("WithSchemas: kind %d: %w", kind, err)
+			}
+			compiled, err := compiler.Compile(url)
+			if err != nil {
+				return fmt.Errorf("WithSchemas: kind %d: %w", kind, err)
+			}
+			o.schemas[kind] = compiled
+		}
+		return nil
+	}
+}
+
+// WithSequenceNumbers stamps each appended entry with its sequence number,
+// starting at 1 for the first entry in the log.
+//
+// Replay verifies that sequence numbers increase by one, returning an error
+// wrapping ErrSequenceMismatch if entries are missing, repeated or reordered.
+// Appending requires the entries in the log to be counted once.
+func WithSequenceNumbers() Option {
+	return func(o *options) error {
+		o.sequenceNumbers = true
+		return nil
+	}
+}
+
+// WithTimestamps records the time each entry is appended, for use with
+// ReplayRange.
+func WithTimestamps() Option {
+	return func(o *options) error {
+		o.timestamps = true
+		return nil
+	}
+}
+
+// WithLogicalClock stamps each appended entry with the next value of a Lamport
+// clock, which is passed to ops implementing ClockedOp on replay.
+//
+// Each entry's clock is one more than the greater of the clock of the previous
+// entry and, for ops implementing ReceivedClock, the clock received with the
+// op. The clock is recovered from the log by the first append after it is
+// opened, so it increases monotonically across restarts.
+func WithLogicalClock() Option {
+	return func(o *options) error {
+		o.logicalClock = true
+		return nil
+	}
+}
+
+// WithAssignedIDs calls AssignID on each appended op implementing IDAssigner
+// with the sequence number of its entry, before it is encoded.
+//
+// On replay the same IDs are reassigned from the entries before they are
+// applied, so an op's ID is stable even if it isn't encoded. WithAssignedIDs
+// implies WithSequenceNumbers, so that IDs can be recovered when replay starts
+// part way through the log.
+func WithAssignedIDs() Option {
+	return func(o *options) error {
+		o.assignIDs = true
+		o.sequenceNumbers = true
+		return nil
+	}
+}
+
+// WithSandboxedReplay checks that ops are deterministic during Replay, failing
+// with ErrNonDeterministic at the first op that isn't.
+//
+// Each op is also applied to two independent States, starting from empty
+// States at the start of each replay, which are then compared with
+// reflect.DeepEqual. This catches ops whose effect depends on external state,
+// such as the time or random numbers, but triples the cost of replay, so it is
+// intended for testing.
+func WithSandboxedReplay() Option {
+	return func(o *options) error {
+		o.sandboxedReplay = true
+		return nil
+	}
+}
+
+// WithFileMode sets the permissions of log files created by Open and
+// NewSegmented. The default is 0600. Existing files keep their permissions.
+func WithFileMode(mode os.FileMode) Option {
+	return func(o *options) error {
+		if mode&^os.ModePerm != 0 {
+			return fmt.Errorf("WithFileMode: mode must only contain permission bits but got %s", mode)
+		}
+		o.fileMode = mode
+		return nil
+	}
+}
+
+// createMode returns the mode of created log files.
+func (o *options) createMode() os.FileMode {
+	if o.fileMode == 0 {
+		return 0600
+	}
+	return o.fileMode
+}
+
+// clock returns the current time.
+func (o *options) clock() time.Time {
+	if o.now != nil {
+		return o.now()
+	}
+	return time.Now()
+}
+
+// WithCoalesce merges consecutive ops passed to AppendAtomic before they are
+// written, eg. to keep only the last of several Sets of the same key.
+//
+// "merge" must be a func(prev, next Op[State]) (Op[State], bool) for the State
+// type of the Log. It is called with each op and the result of merging the ops
+// before it, and returns the op to write in place of both, or false if they
+// can't be merged. Ops are only coalesced within a single unsynced write, so
+// an op is never merged with an entry already in the log.
+func WithCoalesce[State any](merge func(prev, next Op[State]) (Op[State], bool)) Option {
+	return func(o *options) error {
+		o.coalesce = merge
+		return nil
+	}
+}
+
+// WithAppendHook passes every op appended to the log through "hook" before it
+// is encoded, for enforcing invariants in one place.
+//
+// "hook" must be a func(op Op[State]) (Op[State], error) for the State type of
+// the Log. It returns the op to write in place of op, which may be op itself,
+// or an error to reject the append. Ops passed to AppendAtomic are hooked
+// before they are coalesced, and ops added to a Batch are hooked by Add.
+func WithAppendHook[State any](hook func(op Op[State]) (Op[State], error)) Option {
+	return func(o *options) error {
+		o.appendHook = hook
+		return nil
+	}
+}
+
+// WithMmap replays from a memory mapped view of the log when the File is an
+// *os.File, rather than reading it through a buffer. It requires WithReadOnly.
+//
+// Mapping is only supported on Unix platforms. Elsewhere, or if the File can't
+// be mapped, Replay silently falls back to reading the File. Frames are decoded
+// directly from the mapping, which is released when Replay returns, so Ops
+// must not retain any raw bytes passed to them past Apply.
+func WithMmap() Option {
+	return func(o *options) error {
+		o.mmap = true
+		return nil
+	}
+}
+
+// WithEntryChecksums adds a CRC-32C checksum of each entry to it, so that an
+// entry that was torn or corrupted on disk is detected rather than decoded.
+//
+// Entries that don't match their checksum fail to decode with an error
+// wrapping ErrChecksumMismatch, which ReplayTolerant and ReplayTruncating
+// treat as corruption. Entries without a checksum, such as those written
+// before this option was used, are not checked. Logs containing checksums
+// can't be read by versions of this package that predate this option.
+func WithEntryChecksums() Option {
+	return func(o *options) error {
+		o.entryChecksums = true
+		return nil
+	}
+}
+
+// WithExclusiveLock takes an exclusive advisory lock on the log for the
+// lifetime of the Log, so that other processes using WithExclusiveLock or
+// WithSharedLock can't open it concurrently.
+//
+// If "wait" is true New blocks until the lock is available, otherwise it
+// returns ErrLocked. The lock is held on a file alongside the log, named by
+// appending ".lock" to the name of the log, which must be an *os.File, so that
+// it survives the log being replaced by compaction. The lock file is left in
+// place by Close. Locks are advisory, so processes that don't use these
+// options aren't excluded.
+func WithExclusiveLock(wait bool) Option {
+	return func(o *options) error {
+		o.fileLock = lockExclusive
+		o.fileLockWait = wait
+		return nil
+	}
+}
+
+// WithSharedLock is like WithExclusiveLock, but takes a shared lock, for
+// processes that only replay the log. Any number of processes can hold a
+// shared lock at once, but not while another holds an exclusive lock.
+func WithSharedLock(wait bool) Option {
+	return func(o *options) error {
+		o.fileLock = lockShared
+		o.fileLockWait = wait
+		return nil
+	}
+}
+
+// WithLegacyKinds lets a NamedLog read entries without a name, such as those
+// written by a positional Log, reading an entry of kind K as the op named
+// "names[K]".
+//
+// This allows a positional log to be switched to NewNamed in place, without
+// MigrateToNamed. Every non-empty name must be registered with NewNamed, and
+// entries of kinds without a name are treated as unknown kinds. New entries
+// are always written with their name. This has no effect on a positional Log.
+func WithLegacyKinds(names []string) Option {
+	return func(o *options) error {
+		o.legacyKinds = names
+		return nil
+	}
+}
+
+// WithTrailer appends a trailer containing a CRC64 checksum of the entire log
+// on Close, which VerifyTrailer checks.
+//
+// The trailer must only ever be the last line of the log, so it is removed
+// before the first append after the log is opened and rewritten by Close. This
+// requires the File to implement Truncater, and means logs with a trailer must
+// always be opened WithTrailer to be appended to. Close reads the entire log to
+// compute the checksum.
+func WithTrailer() Option {
+	return func(o *options) error {
+		o.trailer = true
+		return nil
+	}
+}
+
+// WithWriteBuffer replaces the WriteBuffer that appended entries are written
+// through. "factory" is called with the File of the Log when it is first
+// written to.
+func WithWriteBuffer(factory func(f File) WriteBuffer) Option {
+	return func(o *options) error {
+		o.writeBuffer = factory
+		return nil
+	}
+}
+
+// WithValidateOps makes New check that a zero value of each op can be JSON
+// encoded, so an op with an unencodable field, such as a channel, is reported
+// at startup rather than by the first Append.
+func WithValidateOps() Option {
+	return func(o *options) error {
+		o.validateOps = true
+		return nil
+	}
+}
+
+// WithCallerTracking records the function and line that appended each entry,
+// as reported by Each.
+//
+// This is intended as a debugging aid, as walking the stack adds overhead to
+// every append.
+func WithCallerTracking() Option {
+	return func(o *options) error {
+		o.callerTracking = true
+		return nil
+	}
+}
+
+// WithMigrations transforms the encoded events of the given kinds before they
+// are decoded, allowing old payloads to be migrated to the current shape of an
+// op without changing the op itself.
+//
+// Migrations must accept events that are already in the current shape.
+func WithMigrations(migrations map[int]func(event json.RawMessage) (json.RawMessage, error)) Option {
+	return func(o *options) error {
+		o.migrations = migrations
+		return nil
+	}
+}
+
+// WithTextMirror writes a one-line human-readable description of each
+// appended op to w, for debugging. Ops implementing fmt.Stringer are described
+// by their String method, others with "%+v".
+//
+// The mirror is best-effort and does not affect the log or Replay: it is
+// written after each op is durably appended, and write errors are reported to
+// Observer.OnTextMirrorError rather than failing the append.
+func WithTextMirror(w io.Writer) Option {
+	return func(o *options) error {
+		o.textMirror = w
+		return nil
+	}
+}
+
+// UnknownKindPolicy determines how Replay handles entries of a kind that is
+// not registered with the Log, such as those appended by a newer version of
+// an application.
+type UnknownKindPolicy int
+
+// Policies for WithUnknownKindPolicy.
+const (
+	// FailUnknown fails Replay at the first entry of an unknown kind.
+	FailUnknown UnknownKindPolicy = iota
+	// SkipUnknown skips entries of unknown kinds without decoding them.
+	SkipUnknown
+)
+
+// WithUnknownKindPolicy sets how Replay handles entries of unregistered kinds,
+// or with unregistered names for a NamedLog. The default is FailUnknown.
+//
+// SkipUnknown allows an older reader to tolerate ops added by a newer writer,
+// for example during a rolling deployment, at the cost of silently ignoring
+// them.
+func WithUnknownKindPolicy(policy UnknownKindPolicy) Option {
+	return func(o *options) error {
+		if policy < FailUnknown || policy > SkipUnknown {
+			return fmt.Errorf("WithUnknownKindPolicy: unknown policy %d", policy)
+		}
+		o.unknownKinds = policy
+		return nil
+	}
+}
+
+// RawOp receives entries of kinds that are not registered with the Log, as
+// configured by WithFallbackOp.
+type RawOp[State any] interface {
+	// ApplyRaw applies the encoded event of an entry of an unknown kind to
+	// state. "kind" is -1 for an unregistered name in a NamedLog.
+	ApplyRaw(kind int, raw json.RawMessage, state State) error
+}
+
+// WithFallbackOp passes entries of unregistered kinds to the ApplyRaw method of
+// "fallback" during Replay, rather than failing or skipping them as for
+// WithUnknownKindPolicy, which it takes precedence over.
+//
+// The raw event is passed after decompression, but before WithEventTransform
+// and WithMigrations, which only apply to registered kinds. ReplaySharded
+// can't route raw events to a shard, so skips them.
+func WithFallbackOp[State any](fallback RawOp[State]) Option {
+	return func(o *options) error {
+		o.fallbackOp = fallback
+		return nil
+	}
+}
+
+// WithOnUnknownKind calls fn during Replay for each entry of an unregistered
+// kind, or with an unregistered name for a NamedLog, with its raw encoded
+// event. "kind" is -1 for an unregistered name.
+//
+// If fn returns nil the entry is skipped, otherwise Replay fails with the
+// error. This takes precedence over WithUnknownKindPolicy, and can't be
+// combined with WithFallbackOp.
+func WithOnUnknownKind(fn func(kind int, raw []byte) error) Option {
+	return func(o *options) error {
+		o.onUnknownKind = fn
+		return nil
+	}
+}
+
+// WithOnApplyError calls fn during Replay when the op of the entry at "index"
+// fails to apply, including failures detected by WithSandboxedReplay, with the
+// error that would be returned.
+//
+// If fn returns nil the op is skipped and Replay continues, otherwise Replay
+// fails with the error returned, so fn can log and continue, collect
+// diagnostics or abort. An op that failed may have partially modified the
+// State before returning its error.
+func WithOnApplyError[State any](fn func(index int, op Op[State], err error) error) Option {
+	return func(o *options) error {
+		o.onApplyError = fn
+		return nil
+	}
+}
+
+// WithRecentCache keeps the last "n" ops appended to or replayed from the log
+// in memory, for fast access with Recent.
+//
+// The cache holds references to n decoded ops, so its memory cost is n times
+// the typical size of an op.
+func WithRecentCache(n int) Option {
+	return func(o *options) error {
+		if n < 1 {
+			return fmt.Errorf("WithRecentCache: size must be at least 1 but got %d", n)
+		}
+		o.recentCache = n
+		return nil
+	}
+}
+
+// WithSkipCloseSync skips the final Sync of the File when the Log is closed.
+// Buffered writes are still flushed, and ops appended with AppendNoSync are
+// still synced.
+func WithSkipCloseSync() Option {
+	return func(o *options) error {
+		o.skipCloseSync = true
+		return nil
+	}
+}
+
+// WithUseNumber decodes numbers in interface-typed fields of ops as
+// json.Number rather than float64, preserving the precision of large integers
+// such as 64-bit IDs.
+func WithUseNumber() Option {
+	return func(o *options) error {
+		o.useNumber = true
+		return nil
+	}
+}
+
+// WithCodec encodes the events of ops with codec rather than encoding/json,
+// eg. to store []byte fields compactly or to preserve numeric precision.
+//
+// Codecs other than JSONCodec, the default, imply WithBinaryRecords, storing
+// the output of the codec as is, and may also encode the envelope of each
+// record by implementing FrameCodec. The same codec must be used every time
+// the log is opened, and WithValidateOps and WithSchemas, which check JSON,
+// can't be combined with another codec.
+func WithCodec(codec Codec) Option {
+	return func(o *options) error {
+		o.codec = codec
+		return nil
+	}
+}
+
+// WithBinaryRecords frames entries as length-prefixed binary records rather
+// than delimited JSON objects, so that events, including those compressed
+// WithCompression or encoded by the Codec set WithCodec, are stored as raw
+// bytes rather than base64 encoded JSON strings.
+//
+// A log must always be opened with the same framing. Rewind, Replay and the
+// other readers work unchanged, but binary records can't be combined with
+// WithHeader, WithCommitMarker, WithTrailer, WithDelimiter or Annotate, which
+// add delimited lines to the log, nor read by FrameReader. Scan can't
+// resynchronise after an entry with a corrupt length. See Frame for the record
+// format.
+func WithBinaryRecords() Option {
+	return func(o *options) error {
+		o.binaryRecords = true
+		return nil
+	}
+}
+
+// binaryCodec returns the codec set by WithCodec, or nil if events are encoded
+// as JSON.
+func (o *options) binaryCodec() Codec {
+	switch o.codec.(type) {
+	case nil, JSONCodec, *JSONCodec:
+		return nil
+	}
+	return o.codec
+}
+
+// binaryFraming returns true if entries are binary records, see
+// WithBinaryRecords.
+func (o *options) binaryFraming() bool {
+	return o.binaryRecords || o.binaryCodec() != nil
+}
+
+// WithStagedWrites protects against torn entries by first writing each append
+// to a staging file alongside the log, named by appending ".staged" to the
+// name of the log, which must be an *os.File.
+//
+// Each append is written to the staging file along with its offset and
+// checksum, and the staging file synced, before the entries are written to the
+// log itself. Once the log has been synced the staging file is cleared. If New
+// finds a complete staged append, it ensures the log contains exactly those
+// entries at that offset, by truncating the log and rewriting them if
+// necessary. An incomplete staged append was never written to the log, so it
+// is discarded.
+//
+// This doubles the writes and syncs of every append.
+func WithStagedWrites() Option {
+	return func(o *options) error {
+		o.stagedWrites = true
+		return nil
+	}
+}
+
+// WithKindHandler replays entries of "kind" by calling "handler" instead of
+// the Apply method of the op, allowing the same log to build different
+// projections of its ops.
+//
+// "handler" must be a func(op Op[State], state State) error for the State type
+// of the Log. Kinds without a handler are applied as usual.
+func WithKindHandler[State any](kind int, handler func(op Op[State], state State) error) Option {
+	return func(o *options) error {
+		if o.kindHandlers == nil {
+			o.kindHandlers = map[int]any{}
+		}
+		o.kindHandlers[kind] = handler
+		return nil
+	}
+}
+
+// WithEventTransform transforms the encoded event of every entry before it is
+// decoded, without changing the log, allowing sweeping changes across all
+// kinds such as renaming a field.
+//
+// The transform is applied before any migration set by WithMigrations.
+func WithEventTransform(transform func(kind int, event json.RawMessage) (json.RawMessage, error)) Option {
+	return func(o *options) error {
+		o.eventTransform = transform
+		return nil
+	}
+}
+
+// WithDelimiter terminates each frame of the log with "delim" instead of a
+// newline, for example '\x1e' (the ASCII record separator) to embed the log in
+// a format where newlines are significant.
+//
+// The delimiter must be an ASCII control character, which JSON always escapes
+// so it can never appear within an encoded frame. Logs must be replayed with
+// the same delimiter they were written with.
+func WithDelimiter(delim byte) Option {
+	return func(o *options) error {
+		if delim == 0 || delim >= 0x20 {
+			return fmt.Errorf("WithDelimiter: delimiter must be a non-NUL ASCII control character but got %q", delim)
+		}
+		o.delimiter = delim
+		return nil
+	}
+}
+
+// WithStateSizeLimit aborts Replay with ErrStateTooLarge if the size of the
+// State, as returned by "sizeOf", exceeds "limit".
+//
+// "sizeOf" must be a func(State) int for the State type of the Log, and may
+// measure size in any unit consistent with "limit". It is called after every
+// applied op, or every N ops as set by WithStateSizeCheckInterval. The log is
+// left positioned after the op that exceeded the limit.
+func WithStateSizeLimit[State any](limit int, sizeOf func(State) int) Option {
+	return func(o *options) error {
+		if limit <= 0 {
+			return fmt.Errorf("WithStateSizeLimit: limit must be positive but got %d", limit)
+		}
+		o.stateSizeLimit = limit
+		o.stateSize = sizeOf
+		return nil
+	}
+}
+
+// WithStateSizeCheckInterval checks the size of the State for
+// WithStateSizeLimit only after every "every" applied ops, to bound the cost
+// of measuring it.
+func WithStateSizeCheckInterval(every int) Option {
+	return func(o *options) error {
+		if every <= 0 {
+			return fmt.Errorf("WithStateSizeCheckInterval: interval must be positive but got %d", every)
+		}
+		o.stateSizeEvery = every
+		return nil
+	}
+}
+
+// WithVerifyOnAppend reads back every op appended by Append and AppendAtomic
+// once it has been synced, and returns an error if it doesn't decode to an op
+// deeply equal to the one appended.
+//
+// This catches storage and encoding faults at write time rather than on the
+// next Replay, at the cost of a seek and read per append. The File must be
+// seekable.
+func WithVerifyOnAppend() Option {
+	return func(o *options) error {
+		o.verifyOnAppend = true
+		return nil
+	}
+}
+
+// WithSnapshotStore manages snapshots of the State automatically, saving one
+// to "store" after every "everyN" appended entries and restoring from the
+// latest one on Replay.
+//
+// State must implement Snapshotter. A Replay from the start of the log
+// restores dest from the stored snapshot, if any, then applies only the
+// entries appended after it. Snapshots are maintained as for
+// WithPeriodicSnapshot, which this replaces.
+func WithSnapshotStore(store SnapshotStore, everyN int) Option {
+	return func(o *options) error {
+		if everyN < 1 {
+			return fmt.Errorf("WithSnapshotStore: everyN must be at least 1 but got %d", everyN)
+		}
+		o.snapshotEvery = everyN
+		o.snapshotMarshal = nil
+		o.snapshotStore = store
+		o.autoSnapshot = true
+		return nil
+	}
+}
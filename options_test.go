@@ -0,0 +1,748 @@
+package replaylog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+type resettableKV struct {
+	KV
+	resets int
+}
+
+func (r *resettableKV) Reset() {
+	r.resets++
+	for key := range r.KV {
+		delete(r.KV, key)
+	}
+}
+
+func TestWithResetBeforeReplay(t *testing.T) {
+	log := newTestLog(t, WithResetBeforeReplay())
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"})
+
+	t.Run("Map", func(t *testing.T) {
+		state := KV{"stale": "value"}
+		err := log.Rewind()
+		assert.NoError(t, err)
+		err = log.Replay(state)
+		assert.NoError(t, err)
+		assert.Equal(t, KV{"foo": "bar"}, state)
+	})
+
+	t.Run("Resettable", func(t *testing.T) {
+		f, err := ioutil.TempFile(t.TempDir(), "")
+		assert.NoError(t, err)
+		rlog, err := New[*resettableKV](f, []Op[*resettableKV]{}, WithResetBeforeReplay())
+		assert.NoError(t, err)
+		defer rlog.Close()
+		state := &resettableKV{KV: KV{"stale": "value"}}
+		err = rlog.Replay(state)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, state.resets)
+		assert.Equal(t, KV{}, state.KV)
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		f, err := ioutil.TempFile(t.TempDir(), "")
+		assert.NoError(t, err)
+		slog, err := New[*struct{}](f, []Op[*struct{}]{}, WithResetBeforeReplay())
+		assert.NoError(t, err)
+		defer slog.Close()
+		err = slog.Replay(&struct{}{})
+		assert.Error(t, err)
+	})
+}
+
+func TestWithReplayFilter(t *testing.T) {
+	log := newTestLog(t, WithReplayFilter(func(op Op[KV]) bool {
+		_, isDelete := op.(*Delete)
+		return !isDelete
+	}))
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"}, &Delete{Key: "foo"})
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, replay(t, log))
+
+	f, err := ioutil.TempFile(t.TempDir(), "")
+	assert.NoError(t, err)
+	defer f.Close()
+	_, err = New[KV](f, ops, WithReplayFilter(func(op Op[struct{}]) bool { return true }))
+	assert.Error(t, err)
+}
+
+type flakySyncFile struct {
+	*os.File
+	failures int
+}
+
+func (f *flakySyncFile) Sync() error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("transient sync failure")
+	}
+	return f.File.Sync()
+}
+
+func TestWithSyncRetry(t *testing.T) {
+	w, err := ioutil.TempFile(t.TempDir(), "")
+	assert.NoError(t, err)
+	f := &flakySyncFile{File: w}
+	log, err := New[KV](f, ops, WithSyncRetry(3, time.Millisecond))
+	assert.NoError(t, err)
+	defer log.Close()
+
+	f.failures = 2
+	err = log.Append(&Set{Key: "foo", Value: "bar"})
+	assert.NoError(t, err)
+
+	f.failures = 3
+	err = log.Append(&Set{Key: "bar", Value: "waz"})
+	assert.True(t, errors.Is(err, ErrNotDurable))
+	assert.True(t, log.PendingBytes() > 0)
+
+	err = log.Append(&Delete{Key: "waz"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, log.PendingBytes())
+
+	// The entry was still written.
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, replay(t, log))
+}
+
+type growKV struct {
+	KV
+	hint int
+}
+
+func (g *growKV) Grow(hint int) {
+	g.hint = hint
+	g.KV = make(KV, hint)
+}
+
+type growSet Set
+
+func (s *growSet) Apply(state *growKV) error {
+	state.KV[s.Key] = s.Value
+	return nil
+}
+
+func TestWithSizeHint(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "")
+	assert.NoError(t, err)
+	log, err := New[*growKV](f, []Op[*growKV]{&growSet{}}, WithSizeHint())
+	assert.NoError(t, err)
+	defer log.Close()
+	for _, key := range []string{"a", "b", "c"} {
+		err = log.Append(&growSet{Key: key, Value: key})
+		assert.NoError(t, err)
+	}
+	err = log.Rewind()
+	assert.NoError(t, err)
+	state := &growKV{}
+	err = log.Replay(state)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, state.hint)
+	assert.Equal(t, KV{"a": "a", "b": "b", "c": "c"}, state.KV)
+}
+
+// rename was introduced in version 2, replacing the "from" field with "old".
+type rename struct {
+	From string `json:"from,omitempty"`
+	Old  string `json:"old,omitempty"`
+	To   string `json:"to"`
+}
+
+func (r *rename) Apply(state KV) error { return r.ApplyVersioned(2, state) }
+
+func (r *rename) ApplyVersioned(version int, state KV) error {
+	from := r.Old
+	if version < 2 {
+		from = r.From
+	}
+	state[r.To] = state[from]
+	delete(state, from)
+	return nil
+}
+
+func TestWithAppVersion(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "")
+	assert.NoError(t, err)
+	versionedOps := []Op[KV]{&Set{}, &rename{}}
+	log, err := New[KV](f, versionedOps, WithAppVersion(1))
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "a", Value: "1"}, &rename{From: "a", To: "b"})
+
+	log, err = New[KV](f, versionedOps, WithAppVersion(2))
+	assert.NoError(t, err)
+	defer log.Close()
+	appendAll(t, log, &rename{Old: "b", To: "c"})
+	assert.Equal(t, KV{"c": "1"}, replay(t, log))
+}
+
+type slowOp struct {
+	Delay time.Duration `json:"d"`
+}
+
+func (s *slowOp) Apply(state KV) error {
+	time.Sleep(s.Delay)
+	return nil
+}
+
+func TestWithApplyTimeout(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "")
+	assert.NoError(t, err)
+	log, err := New[KV](f, []Op[KV]{&Set{}, &slowOp{}}, WithApplyTimeout(50*time.Millisecond))
+	assert.NoError(t, err)
+	defer log.Close()
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &slowOp{Delay: time.Millisecond}, &slowOp{Delay: time.Second})
+	err = log.Rewind()
+	assert.NoError(t, err)
+	err = log.Replay(KV{})
+	assert.True(t, errors.Is(err, ErrApplyTimeout))
+	assert.Contains(t, err.Error(), "event 2 of type *replaylog.slowOp")
+}
+
+// hangingFile is a File whose Sync blocks until "release" is closed, once
+// "hang" is set. Blocked Syncs signal "released" when they return.
+type hangingFile struct {
+	MemoryFile
+	hang     bool
+	release  chan struct{}
+	released chan struct{}
+}
+
+func (h *hangingFile) Sync() error {
+	if h.hang {
+		<-h.release
+		h.released <- struct{}{}
+	}
+	return nil
+}
+
+func (h *hangingFile) Close() error { return nil }
+
+func TestWithWriteTimeout(t *testing.T) {
+	f := &hangingFile{release: make(chan struct{}), released: make(chan struct{})}
+	log, err := New[KV](f, ops, WithWriteTimeout(50*time.Millisecond))
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"})
+	f.hang = true
+	err = log.Append(&Set{Key: "bar", Value: "waz"})
+	assert.True(t, errors.Is(err, ErrWriteTimeout))
+	assert.True(t, log.Degraded())
+
+	// Appends fail fast until the log is reset.
+	err = log.Append(&Delete{Key: "foo"})
+	assert.True(t, errors.Is(err, ErrWriteTimeout))
+	close(f.release)
+	<-f.released
+	f.hang = false
+	log.ResetDegraded()
+	appendAll(t, log, &Delete{Key: "foo"})
+	assert.NoError(t, log.Close())
+}
+
+func TestWithReadOnly(t *testing.T) {
+	w := newTestLog(t)
+	appendAll(t, w, &Set{Key: "foo", Value: "bar"})
+
+	f, err := os.Open(w.f.(*os.File).Name())
+	assert.NoError(t, err)
+	log, err := New[KV](f, ops, WithReadOnly(), WithHeader())
+	assert.NoError(t, err)
+	defer log.Close()
+	err = log.Append(&Set{Key: "bar", Value: "waz"})
+	assert.True(t, errors.Is(err, ErrReadOnly))
+	err = log.AppendAtomic(&Set{Key: "bar", Value: "waz"})
+	assert.True(t, errors.Is(err, ErrReadOnly))
+	assert.Equal(t, KV{"foo": "bar"}, replay(t, log))
+}
+
+func TestWithMaxLogSize(t *testing.T) {
+	w := newTestLog(t)
+	appendAll(t, w, &Set{Key: "foo", Value: "bar"}) // 31 bytes
+
+	f, err := os.OpenFile(w.f.(*os.File).Name(), os.O_RDWR, 0600)
+	assert.NoError(t, err)
+	log, err := New[KV](f, ops, WithMaxLogSize(70))
+	assert.NoError(t, err)
+	defer log.Close()
+	err = log.Replay(KV{})
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "bar", Value: "waz"})
+	err = log.Append(&Delete{Key: "foo"})
+	assert.True(t, errors.Is(err, ErrLogFull))
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, replay(t, log))
+}
+
+func TestWithReplayDeadlineWarning(t *testing.T) {
+	var warnings []int
+	f, err := ioutil.TempFile(t.TempDir(), "")
+	assert.NoError(t, err)
+	log, err := New[KV](f, []Op[KV]{&Set{}, &slowOp{}},
+		WithReplayDeadlineWarning(20*time.Millisecond),
+		WithObserver(Observer{OnSlowReplay: func(elapsed time.Duration, applied int) {
+			assert.True(t, elapsed >= 20*time.Millisecond)
+			warnings = append(warnings, applied)
+		}}))
+	assert.NoError(t, err)
+	defer log.Close()
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &slowOp{Delay: 30 * time.Millisecond}, &Set{Key: "bar", Value: "waz"})
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, replay(t, log))
+	assert.Equal(t, []int{2}, warnings)
+}
+
+func TestWithSequenceNumbers(t *testing.T) {
+	f := writeTestFile(t, `{"k":0,"e":{"k":"foo","v":"bar"}}`+"\n")
+	log, err := New[KV](f, ops, WithSequenceNumbers())
+	assert.NoError(t, err)
+	err = log.Replay(KV{})
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "bar", Value: "waz"})
+	assert.NoError(t, log.AppendAtomic(&Delete{Key: "foo"}, &Set{Key: "waz", Value: "foo"}))
+	data, err := os.ReadFile(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, `{"k":0,"e":{"k":"foo","v":"bar"}}
+{"k":0,"e":{"k":"bar","v":"waz"},"s":2}
+{"k":1,"e":{"k":"foo"},"s":3}
+{"k":0,"e":{"k":"waz","v":"foo"},"s":4}
+`, string(data))
+	assert.Equal(t, KV{"bar": "waz", "waz": "foo"}, replay(t, log))
+
+	f = writeTestFile(t, `{"k":0,"e":{"k":"foo","v":"bar"},"s":1}`+"\n"+`{"k":0,"e":{"k":"bar","v":"waz"},"s":3}`+"\n")
+	log, err = New[KV](f, ops)
+	assert.NoError(t, err)
+	err = log.Replay(KV{})
+	assert.True(t, errors.Is(err, ErrSequenceMismatch))
+	assert.EqualError(t, err, "unexpected sequence number: entry 1 has sequence number 3, expected 2")
+}
+
+func TestWithCoalesce(t *testing.T) {
+	log := newTestLog(t, WithCoalesce(func(prev, next Op[KV]) (Op[KV], bool) {
+		p, pok := prev.(*Set)
+		n, nok := next.(*Set)
+		if pok && nok && p.Key == n.Key {
+			return n, true
+		}
+		return nil, false
+	}))
+	err := log.AppendAtomic(&Set{Key: "foo", Value: "1"}, &Set{Key: "foo", Value: "2"}, &Set{Key: "bar", Value: "3"}, &Set{Key: "foo", Value: "4"})
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "foo", Value: "5"})
+	data, err := os.ReadFile(log.f.(*os.File).Name())
+	assert.NoError(t, err)
+	assert.Equal(t, `{"k":0,"e":{"k":"foo","v":"2"}}
+{"k":0,"e":{"k":"bar","v":"3"}}
+{"k":0,"e":{"k":"foo","v":"4"}}
+{"k":0,"e":{"k":"foo","v":"5"}}
+`, string(data))
+}
+
+func TestWithAppendHook(t *testing.T) {
+	log := newTestLog(t, WithAppendHook(func(op Op[KV]) (Op[KV], error) {
+		switch op := op.(type) {
+		case *Delete:
+			return nil, fmt.Errorf("can't delete %q", op.Key)
+		case *Set:
+			return &Set{Key: strings.ToLower(op.Key), Value: op.Value}, nil
+		}
+		return op, nil
+	}))
+	appendAll(t, log, &Set{Key: "FOO", Value: "bar"})
+	err := log.Append(&Delete{Key: "foo"})
+	assert.EqualError(t, err, `append of *replaylog.Delete rejected: can't delete "foo"`)
+	err = log.AppendAtomic(&Set{Key: "Bar", Value: "waz"}, &Delete{Key: "foo"})
+	assert.Error(t, err)
+	assert.NoError(t, log.AppendAtomic(&Set{Key: "Bar", Value: "waz"}))
+	data, err := os.ReadFile(log.f.(*os.File).Name())
+	assert.NoError(t, err)
+	assert.Equal(t, `{"k":0,"e":{"k":"foo","v":"bar"}}
+{"k":0,"e":{"k":"bar","v":"waz"}}
+`, string(data))
+}
+
+func TestWithMmap(t *testing.T) {
+	w := newTestLog(t)
+	appendAll(t, w, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"}, &Delete{Key: "foo"})
+
+	f, err := os.Open(w.f.(*os.File).Name())
+	assert.NoError(t, err)
+	_, err = New[KV](f, ops, WithMmap())
+	assert.Error(t, err)
+	log, err := New[KV](f, ops, WithReadOnly(), WithMmap())
+	assert.NoError(t, err)
+	defer log.Close()
+	assert.Equal(t, KV{"bar": "waz"}, replay(t, log))
+
+	assert.NoError(t, log.Rewind())
+	state := KV{}
+	_, err = log.ReplayUntilState(state, func(state KV) bool { return len(state) == 2 })
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, state)
+	err = log.Replay(state)
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"bar": "waz"}, state)
+}
+
+func TestWithValidateOps(t *testing.T) {
+	_, err := New[KV](&MemoryFile{}, []Op[KV]{&Set{}, &unencodable{}}, WithValidateOps())
+	assert.EqualError(t, err, "op 1 of type *replaylog.unencodable can't be encoded: json: unsupported type: chan int")
+	_, err = New[KV](&MemoryFile{}, []Op[KV]{&Set{}, &unencodable{}})
+	assert.NoError(t, err)
+	_, err = New[KV](&MemoryFile{}, ops, WithValidateOps())
+	assert.NoError(t, err)
+}
+
+func TestWithMigrations(t *testing.T) {
+	f := writeTestFile(t, `{"k":0,"e":{"key":"foo","value":"bar"}}`+"\n"+`{"k":0,"e":{"k":"bar","v":"waz"}}`+"\n")
+	// Set was previously encoded with "key" and "value" fields.
+	log, err := New[KV](f, ops, WithMigrations(map[int]func(json.RawMessage) (json.RawMessage, error){
+		0: func(event json.RawMessage) (json.RawMessage, error) {
+			fields := map[string]json.RawMessage{}
+			if err := json.Unmarshal(event, &fields); err != nil {
+				return nil, err
+			}
+			for from, to := range map[string]string{"key": "k", "value": "v"} {
+				if value, ok := fields[from]; ok {
+					fields[to] = value
+					delete(fields, from)
+				}
+			}
+			return json.Marshal(fields)
+		},
+	}))
+	assert.NoError(t, err)
+	state := KV{}
+	err = log.Replay(state)
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, state)
+
+	_, err = New[KV](f, ops, WithMigrations(map[int]func(json.RawMessage) (json.RawMessage, error){5: nil}))
+	assert.Error(t, err)
+}
+
+// swap is an op unknown to readers using ops.
+type swap struct {
+	A string `json:"a"`
+	B string `json:"b"`
+}
+
+func (s *swap) Apply(state KV) error {
+	state[s.A], state[s.B] = state[s.B], state[s.A]
+	return nil
+}
+
+func TestWithUnknownKindPolicy(t *testing.T) {
+	f := &MemoryFile{}
+	writer, err := New[KV](f, []Op[KV]{&Set{}, &Delete{}, &swap{}})
+	assert.NoError(t, err)
+	assert.NoError(t, writer.AppendAtomic(&Set{Key: "foo", Value: "bar"}, &swap{A: "foo", B: "waz"}, &Set{Key: "bar", Value: "waz"}))
+
+	reader, err := New[KV](f, ops)
+	assert.NoError(t, err)
+	assert.NoError(t, reader.Rewind())
+	err = reader.Replay(KV{})
+	assert.EqualError(t, err, "unknown event kind 2")
+
+	reader, err = New[KV](f, ops, WithUnknownKindPolicy(SkipUnknown))
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, replay(t, reader))
+
+	_, err = New[KV](f, ops, WithUnknownKindPolicy(UnknownKindPolicy(7)))
+	assert.Error(t, err)
+}
+
+// unknownOps records the raw events of entries of unknown kinds.
+type unknownOps struct{}
+
+func (unknownOps) ApplyRaw(kind int, raw json.RawMessage, state KV) error {
+	state[fmt.Sprintf("unknown-%d", kind)] = string(raw)
+	return nil
+}
+
+func TestWithFallbackOp(t *testing.T) {
+	f := &MemoryFile{}
+	writer, err := New[KV](f, []Op[KV]{&Set{}, &Delete{}, &swap{}})
+	assert.NoError(t, err)
+	assert.NoError(t, writer.AppendAtomic(&Set{Key: "foo", Value: "bar"}, &swap{A: "foo", B: "waz"}, &Set{Key: "bar", Value: "waz"}))
+
+	reader, err := New[KV](f, ops, WithFallbackOp[KV](unknownOps{}), WithUnknownKindPolicy(SkipUnknown))
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz", "unknown-2": `{"a":"foo","b":"waz"}`}, replay(t, reader))
+}
+
+var errTransient = errors.New("resource temporarily locked")
+
+// flakyOp fails with errTransient until it has been attempted "failures" times.
+type flakyOp struct {
+	Failures int `json:"f"`
+}
+
+var flakyAttempts int
+
+func (f *flakyOp) Apply(state KV) error {
+	flakyAttempts++
+	if flakyAttempts <= f.Failures {
+		return errTransient
+	}
+	state["flaky"] = "applied"
+	return nil
+}
+
+func TestWithApplyRetry(t *testing.T) {
+	f := &MemoryFile{}
+	flakyOps := []Op[KV]{&Set{}, &flakyOp{}}
+	log, err := New[KV](f, flakyOps)
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &flakyOp{Failures: 2})
+
+	var backoffs []int
+	log, err = New[KV](f, flakyOps,
+		WithApplyRetry(3, func(attempt int) time.Duration {
+			backoffs = append(backoffs, attempt)
+			return 0
+		}),
+		WithRetryable(func(err error) bool { return errors.Is(err, errTransient) }))
+	assert.NoError(t, err)
+	flakyAttempts = 0
+	assert.Equal(t, KV{"foo": "bar", "flaky": "applied"}, replay(t, log))
+	assert.Equal(t, 3, flakyAttempts)
+	assert.Equal(t, []int{1, 2}, backoffs)
+
+	t.Run("NotRetryable", func(t *testing.T) {
+		log, err := New[KV](f, flakyOps, WithApplyRetry(3, nil), WithRetryable(func(error) bool { return false }))
+		assert.NoError(t, err)
+		flakyAttempts = 0
+		assert.NoError(t, log.Rewind())
+		err = log.Replay(KV{})
+		assert.True(t, errors.Is(err, errTransient))
+		assert.Equal(t, 1, flakyAttempts)
+	})
+}
+
+// setAny stores an arbitrary JSON payload.
+type setAny struct {
+	Key     string `json:"k"`
+	Payload any    `json:"p"`
+}
+
+func (s *setAny) Apply(state KV) error {
+	state[s.Key] = fmt.Sprint(s.Payload)
+	return nil
+}
+
+func TestWithUseNumber(t *testing.T) {
+	f := &MemoryFile{}
+	anyOps := []Op[KV]{&setAny{}}
+	log, err := New[KV](f, anyOps)
+	assert.NoError(t, err)
+	appendAll(t, log, &setAny{Key: "id", Payload: int64(9007199254740993)})
+	assert.Equal(t, KV{"id": "9.007199254740992e+15"}, replay(t, log))
+
+	log, err = New[KV](f, anyOps, WithUseNumber())
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"id": "9007199254740993"}, replay(t, log))
+}
+
+func TestWithKindHandler(t *testing.T) {
+	f := &MemoryFile{}
+	log, err := New[KV](f, ops)
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Delete{Key: "foo"}, &Delete{Key: "bar"})
+
+	// Count deletes rather than applying them.
+	log, err = New[KV](f, ops, WithKindHandler(1, func(op Op[KV], state KV) error {
+		state["deletes"] += "x"
+		return nil
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"foo": "bar", "deletes": "xx"}, replay(t, log))
+
+	_, err = New[KV](f, ops, WithKindHandler(2, func(Op[KV], KV) error { return nil }))
+	assert.EqualError(t, err, "WithKindHandler: kind 2 is not registered")
+}
+
+func TestWithEventTransform(t *testing.T) {
+	f := &MemoryFile{data: []byte(`{"k":0,"e":{"key":"foo","v":"bar"}}
+{"k":0,"e":{"key":"bar","v":"waz"}}
+{"k":1,"e":{"key":"foo"}}
+`)}
+	log, err := New[KV](f, ops, WithEventTransform(func(kind int, event json.RawMessage) (json.RawMessage, error) {
+		return bytes.Replace(event, []byte(`"key":`), []byte(`"k":`), 1), nil
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"bar": "waz"}, replay(t, log))
+	assert.Contains(t, string(f.data), `"key":"foo"`)
+}
+
+func TestWithDelimiter(t *testing.T) {
+	f := &MemoryFile{}
+	options := []Option{WithDelimiter('\x1e'), WithHeader(), WithCommitMarker(2), WithTrailer()}
+	log, err := New[KV](f, ops, options...)
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "foo", Value: "line\nbreak"}, &Set{Key: "bar", Value: "waz"}, &Delete{Key: "bar"})
+	assert.NoError(t, log.Annotate("note"))
+	assert.NoError(t, log.Close())
+	assert.False(t, bytes.ContainsRune(f.data, '\n'))
+	// Header, three entries, annotation, two commit markers and trailer.
+	assert.Equal(t, 8, bytes.Count(f.data, []byte{'\x1e'}))
+
+	log, err = New[KV](f, ops, options...)
+	assert.NoError(t, err)
+	assert.NoError(t, log.VerifyTrailer())
+	state := KV{}
+	assert.NoError(t, log.Rewind())
+	clean, err := log.ReplayClean(state)
+	assert.NoError(t, err)
+	assert.True(t, clean)
+	assert.Equal(t, KV{"foo": "line\nbreak"}, state)
+
+	_, err = New[KV](f, ops, WithDelimiter('|'))
+	assert.Error(t, err)
+}
+
+func TestWithStateSizeLimit(t *testing.T) {
+	checks := 0
+	log := newTestLog(t, WithStateSizeCheckInterval(2), WithStateSizeLimit(2, func(state KV) int {
+		checks++
+		return len(state)
+	}))
+	appendAll(t, log,
+		&Set{Key: "a", Value: "1"},
+		&Set{Key: "b", Value: "2"},
+		&Set{Key: "c", Value: "3"},
+		&Set{Key: "d", Value: "4"},
+		&Set{Key: "e", Value: "5"},
+	)
+	assert.NoError(t, log.Rewind())
+	state := KV{}
+	err := log.Replay(state)
+	assert.True(t, errors.Is(err, ErrStateTooLarge))
+	assert.EqualError(t, err, "after event 3: state too large: size 4 exceeds limit 2")
+	assert.Equal(t, 2, checks)
+
+	// The log is positioned after the op that exceeded the limit.
+	state = KV{}
+	err = log.Replay(state)
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"e": "5"}, state)
+}
+
+func TestWithSizeWatcher(t *testing.T) {
+	var sizes []int64
+	f := &MemoryFile{}
+	log, err := New[KV](f, ops, WithSizeWatcher(60, func(size int64) { sizes = append(sizes, size) }))
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "a", Value: "1"})
+	assert.Equal(t, 0, len(sizes))
+	appendAll(t, log, &Set{Key: "b", Value: "2"}, &Set{Key: "c", Value: "3"})
+	assert.Equal(t, []int64{60}, sizes)
+
+	// Shrinking below the threshold rearms the watcher.
+	assert.NoError(t, log.TruncateAt(1))
+	appendAll(t, log, &Delete{Key: "a"})
+	assert.Equal(t, []int64{60}, sizes)
+	appendAll(t, log, &Delete{Key: "b"})
+	assert.Equal(t, []int64{60, 74}, sizes)
+}
+
+type failingOp struct{}
+
+func (failingOp) Apply(KV) error { return errors.New("failed") }
+
+func TestObserverOnReplayError(t *testing.T) {
+	type replayError struct {
+		index    int
+		category ErrorCategory
+	}
+	var errs []replayError
+	observer := WithObserver(Observer{OnReplayError: func(index int, category ErrorCategory, err error) {
+		errs = append(errs, replayError{index, category})
+	}})
+	for _, test := range []struct {
+		log      string
+		expected replayError
+	}{
+		{`{"k":0,"e":{"k":"a","v":"1"}}` + "\n" + `{"k":0,"e":`, replayError{1, ErrorDecode}},
+		{`{"k":0,"e":{"k":"a","v":"1"}}` + "\n" + `{"k":5,"e":{}}`, replayError{1, ErrorUnknownKind}},
+		{`{"k":0,"e":{"k":"a","v":1}}`, replayError{0, ErrorDecode}},
+		{`{"k":0,"e":{"k":"a","v":"1"},"s":1}` + "\n" + `{"k":0,"e":{"k":"a","v":"1"},"s":3}`, replayError{1, ErrorChecksum}},
+		{`{"k":2,"e":{}}`, replayError{0, ErrorApply}},
+	} {
+		errs = nil
+		log, err := New[KV](writeTestFile(t, test.log+"\n"), []Op[KV]{&Set{}, &Delete{}, failingOp{}}, observer)
+		assert.NoError(t, err)
+		assert.Error(t, log.Replay(KV{}))
+		assert.Equal(t, []replayError{test.expected}, errs, test.log)
+	}
+	assert.Equal(t, "unknown-kind", ErrorUnknownKind.String())
+}
+
+func TestReplayError(t *testing.T) {
+	data := `{"k":0,"e":{"k":"a","v":"1"}}` + "\n" + `{"k":2,"e":{}}` + "\n"
+	log, err := New[KV](writeTestFile(t, data), []Op[KV]{&Set{}, &Delete{}, failingOp{}})
+	assert.NoError(t, err)
+	err = log.Replay(KV{})
+	var replayErr *ReplayError
+	assert.True(t, errors.As(err, &replayErr), "%v", err)
+	assert.Equal(t, ReplayError{Index: 1, Offset: 30, Kind: 2, Category: ErrorApply, Err: replayErr.Err}, *replayErr)
+	assert.EqualError(t, err, "could not apply event 1 of type replaylog.failingOp: failed")
+}
+
+func TestWithOnUnknownKind(t *testing.T) {
+	data := `{"k":0,"e":{"k":"a","v":"1"}}` + "\n" + `{"k":5,"e":{"x":1}}` + "\n" + `{"k":0,"e":{"k":"b","v":"2"}}` + "\n"
+	var raw []string
+	log, err := New[KV](writeTestFile(t, data), ops, WithOnUnknownKind(func(kind int, event []byte) error {
+		raw = append(raw, fmt.Sprintf("%d:%s", kind, event))
+		return nil
+	}))
+	assert.NoError(t, err)
+	state := KV{}
+	assert.NoError(t, log.Replay(state))
+	assert.Equal(t, KV{"a": "1", "b": "2"}, state)
+	assert.Equal(t, []string{`5:{"x":1}`}, raw)
+
+	log, err = New[KV](writeTestFile(t, data), ops, WithOnUnknownKind(func(kind int, event []byte) error {
+		return fmt.Errorf("unexpected kind %d", kind)
+	}))
+	assert.NoError(t, err)
+	err = log.Replay(KV{})
+	var replayErr *ReplayError
+	assert.True(t, errors.As(err, &replayErr), "%v", err)
+	assert.Equal(t, 1, replayErr.Index)
+	assert.Equal(t, ErrorUnknownKind, replayErr.Category)
+	assert.EqualError(t, err, "unexpected kind 5")
+
+	_, err = New[KV](writeTestFile(t, data), ops, WithOnUnknownKind(func(int, []byte) error { return nil }), WithFallbackOp[KV](unknownOps{}))
+	assert.EqualError(t, err, "WithOnUnknownKind can't be combined with WithFallbackOp")
+}
+
+func TestWithOnApplyError(t *testing.T) {
+	data := `{"k":0,"e":{"k":"a","v":"1"}}` + "\n" + `{"k":2,"e":{}}` + "\n" + `{"k":0,"e":{"k":"b","v":"2"}}` + "\n"
+	var failed []int
+	log, err := New[KV](writeTestFile(t, data), []Op[KV]{&Set{}, &Delete{}, failingOp{}}, WithOnApplyError(func(index int, op Op[KV], err error) error {
+		failed = append(failed, index)
+		return nil
+	}))
+	assert.NoError(t, err)
+	state := KV{}
+	assert.NoError(t, log.Replay(state))
+	assert.Equal(t, KV{"a": "1", "b": "2"}, state)
+	assert.Equal(t, []int{1}, failed)
+
+	abort := errors.New("abort")
+	log, err = New[KV](writeTestFile(t, data), []Op[KV]{&Set{}, &Delete{}, failingOp{}}, WithOnApplyError(func(index int, op Op[KV], err error) error {
+		return fmt.Errorf("%w: %v", abort, err)
+	}))
+	assert.NoError(t, err)
+	err = log.Replay(KV{})
+	assert.True(t, errors.As(err, new(*ReplayError)), "%v", err)
+	assert.True(t, errors.Is(err, abort), "%v", err)
+}
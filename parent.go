@@ -0,0 +1,87 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ParentedOp is an optional interface that an Op can implement to receive the
+// parent Op it was appended with by AppendWithParent.
+//
+// Resolving parents requires the File to implement io.ReaderAt, and Replay to
+// start from the beginning of the log.
+type ParentedOp[State any] interface {
+	Op[State]
+	ApplyWithParent(parent Op[State], state State) error
+}
+
+// AppendWithParent appends an Op to the log, recording that it depends on the
+// existing entry at index "parent".
+func (l *Log[State]) AppendWithParent(event Op[State], parent int) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.encoded = 0
+	event, err := l.appendHook(event)
+	if err != nil {
+		return err
+	}
+	count, err := l.count()
+	if err != nil {
+		return err
+	}
+	if parent < 0 || parent >= count {
+		return fmt.Errorf("parent entry %d does not exist in log of %d entries", parent, count)
+	}
+	e, err := l.newEntry(event)
+	if err != nil {
+		return err
+	}
+	e.Parent = &parent
+	frame, err := l.encodeFrame(e)
+	if err != nil {
+		return err
+	}
+	if err := l.writeAndSync(frame, 1); err != nil {
+		return err
+	}
+	l.publish(event)
+	return nil
+}
+
+// count returns the number of entries in the log, counting them if they have
+// not been counted before. Must be called with the lock held.
+func (l *Log[State]) count() (int, error) {
+	if l.entries >= 0 {
+		return l.entries, nil
+	}
+	err := l.rewound(func(r *reader) error {
+		for {
+			if _, err := r.next(); errors.Is(err, io.EOF) {
+				l.entries = r.index
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+	})
+	return l.entries, err
+}
+
+// parentOp reads and decodes the entry at index "parent".
+func (l *Log[State]) parentOp(offsets []int64, parent int) (Op[State], error) {
+	if parent < 0 || parent >= len(offsets) {
+		return nil, fmt.Errorf("can't resolve parent entry %d", parent)
+	}
+	ra, ok := l.f.(io.ReaderAt)
+	if !ok {
+		return nil, fmt.Errorf("can't resolve parent entry %d: log File does not implement io.ReaderAt", parent)
+	}
+	r := l.newReader(io.NewSectionReader(ra, offsets[parent], math.MaxInt64-offsets[parent]), offsets[parent])
+	logEntry, err := l.nextEntry(r)
+	if err != nil {
+		return nil, fmt.Errorf("parent entry %d: %w", parent, err)
+	}
+	return l.decodeOp(logEntry)
+}
@@ -0,0 +1,43 @@
+package replaylog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// copyOp copies the value set by its parent Set op to another key.
+type copyOp struct {
+	To string `json:"to"`
+}
+
+func (c *copyOp) Apply(state KV) error { return fmt.Errorf("copy requires a parent") }
+
+func (c *copyOp) ApplyWithParent(parent Op[KV], state KV) error {
+	set, ok := parent.(*Set)
+	if !ok {
+		return fmt.Errorf("expected parent *Set but got %T", parent)
+	}
+	state[c.To] = set.Value
+	return nil
+}
+
+func TestAppendWithParent(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "")
+	assert.NoError(t, err)
+	log, err := New[KV](f, []Op[KV]{&Set{}, &Delete{}, &copyOp{}}, WithHeader())
+	assert.NoError(t, err)
+	defer log.Close()
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Set{Key: "foo", Value: "waz"})
+
+	err = log.AppendWithParent(&copyOp{To: "a"}, 0)
+	assert.NoError(t, err)
+	err = log.AppendWithParent(&copyOp{To: "b"}, 1)
+	assert.NoError(t, err)
+	err = log.AppendWithParent(&copyOp{To: "c"}, 4)
+	assert.Error(t, err)
+
+	assert.Equal(t, KV{"foo": "waz", "a": "bar", "b": "waz"}, replay(t, log))
+}
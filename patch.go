@@ -0,0 +1,70 @@
+package replaylog
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Patch is an Op that applies an RFC 7386 JSON merge patch to a State.
+//
+// The State must be a pointer to a JSON encodable value, typically a struct.
+// Fields present in the patch replace those in the State, nested objects are
+// merged recursively, and fields set to null are reset to their zero value.
+//
+// Register it with New as &Patch[State]{}.
+type Patch[State any] struct {
+	Patch json.RawMessage `json:"p"`
+}
+
+// NewPatchOp creates a Patch Op from a JSON merge patch.
+func NewPatchOp[State any](patch json.RawMessage) *Patch[State] {
+	return &Patch[State]{Patch: patch}
+}
+
+func (p *Patch[State]) Apply(state State) error {
+	v := reflect.ValueOf(state)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("can't patch state of type %T, it must be a non-nil pointer", state)
+	}
+	var patch any
+	if err := json.Unmarshal(p.Patch, &patch); err != nil {
+		return fmt.Errorf("invalid merge patch: %w", err)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	var target any
+	if err := json.Unmarshal(data, &target); err != nil {
+		return err
+	}
+	if data, err = json.Marshal(mergePatch(target, patch)); err != nil {
+		return err
+	}
+	v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	if err := json.Unmarshal(data, state); err != nil {
+		return fmt.Errorf("could not apply merge patch: %w", err)
+	}
+	return nil
+}
+
+// mergePatch implements the MergePatch algorithm from RFC 7386.
+func mergePatch(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergePatch(targetObject[key], value)
+		}
+	}
+	return targetObject
+}
@@ -0,0 +1,45 @@
+package replaylog
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+type patchAddress struct {
+	Street string `json:"street,omitempty"`
+	City   string `json:"city,omitempty"`
+}
+
+type patchUser struct {
+	Name    string         `json:"name,omitempty"`
+	Email   string         `json:"email,omitempty"`
+	Address *patchAddress  `json:"address,omitempty"`
+	Tags    []string       `json:"tags,omitempty"`
+	Extra   map[string]int `json:"extra,omitempty"`
+}
+
+func TestPatch(t *testing.T) {
+	log, err := New[*patchUser](&MemoryFile{}, []Op[*patchUser]{&Patch[*patchUser]{}})
+	assert.NoError(t, err)
+	for _, patch := range []string{
+		`{"name":"Alice","email":"alice@example.com","address":{"street":"1 Main St","city":"Springfield"},"tags":["a"]}`,
+		`{"address":{"city":"Shelbyville"},"tags":["b","c"],"extra":{"x":1,"y":2}}`,
+		`{"email":null,"extra":{"x":null}}`,
+	} {
+		err = log.Append(NewPatchOp[*patchUser](json.RawMessage(patch)))
+		assert.NoError(t, err)
+	}
+	err = log.Rewind()
+	assert.NoError(t, err)
+	state := &patchUser{}
+	err = log.Replay(state)
+	assert.NoError(t, err)
+	assert.Equal(t, &patchUser{
+		Name:    "Alice",
+		Address: &patchAddress{Street: "1 Main St", City: "Shelbyville"},
+		Tags:    []string{"b", "c"},
+		Extra:   map[string]int{"y": 2},
+	}, state)
+}
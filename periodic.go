@@ -0,0 +1,166 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+)
+
+// periodicSnapshots is the state maintained by WithPeriodicSnapshot.
+type periodicSnapshots[State any] struct {
+	state  State // Copy of the State, valid up to offset.
+	valid  bool  // False if state must be rebuilt from the start of the log.
+	offset int64
+	since  int // Entries appended since the last snapshot.
+}
+
+// snapshotFile is the on-disk format of a periodic snapshot.
+type snapshotFile struct {
+	Offset int64  `json:"offset"`
+	State  []byte `json:"state"`
+}
+
+// ReplayFromSnapshot restores dest from a snapshot written by
+// WithPeriodicSnapshot, then replays the entries appended after the snapshot.
+//
+// If no snapshot exists at "path", the whole log is replayed into dest. As
+// with Replay, parents of ops implementing ParentedOp can't be resolved when
+// replaying only the tail of the log.
+func (l *Log[State]) ReplayFromSnapshot(path string, unmarshal func(data []byte, dest State) error, dest State) error {
+	defer l.startReplaying()()
+	return l.replayFromStore(FileSnapshotStore(path), unmarshal, dest)
+}
+
+// replayFromStore restores dest from the latest snapshot in store, then
+// replays the entries appended after it, or replays the whole log if there is
+// no snapshot.
+func (l *Log[State]) replayFromStore(store SnapshotStore, unmarshal func(data []byte, dest State) error, dest State) error {
+	state, offset, err := store.Load()
+	if errors.Is(err, os.ErrNotExist) {
+		if err := l.Rewind(); err != nil {
+			return err
+		}
+		return l.replayLog(dest)
+	} else if err != nil {
+		return err
+	}
+	size, err := l.fileSize()
+	if err != nil {
+		return err
+	}
+	if offset < 0 || offset > size {
+		return fmt.Errorf("snapshot is at offset %d, beyond the end of the log at %d", offset, size)
+	}
+	if err := unmarshal(state, dest); err != nil {
+		return fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+	if l.hooks.snapshotMarshal != nil {
+		shadow := newState[State]()
+		if err := unmarshal(state, shadow); err != nil {
+			return fmt.Errorf("failed to restore snapshot: %w", err)
+		}
+		l.lock.Lock()
+		l.snapshots = periodicSnapshots[State]{state: shadow, valid: true, offset: offset}
+		l.lock.Unlock()
+	}
+	if _, err := l.f.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek to snapshot offset: %w", err)
+	}
+	return l.replay(l.newReader(l.f, offset), dest)
+}
+
+// periodicSnapshot counts appended entries, writing a snapshot if one is due.
+// Must be called with the lock held.
+func (l *Log[State]) periodicSnapshot(entries int) {
+	if l.snapshotEvery == 0 || entries == 0 {
+		return
+	}
+	l.snapshots.since += entries
+	if l.snapshots.since < l.snapshotEvery {
+		return
+	}
+	l.snapshotNow()
+}
+
+// snapshotNow writes a periodic snapshot, reporting any failure to the
+// Observer. Must be called with the lock held.
+func (l *Log[State]) snapshotNow() {
+	l.snapshots.since = 0
+	if err := l.writePeriodicSnapshot(); err != nil {
+		l.snapshots.valid = false
+		if l.observer.OnSnapshotError != nil {
+			l.observer.OnSnapshotError(err)
+		}
+	}
+}
+
+// writePeriodicSnapshot brings the copy of the State up to date and writes it
+// to the snapshot path. Must be called with the lock held.
+func (l *Log[State]) writePeriodicSnapshot() error {
+	pos, err := l.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to determine log position: %w", err)
+	}
+	if !l.snapshots.valid {
+		l.snapshots = periodicSnapshots[State]{state: newState[State]()}
+	}
+	if _, err := l.f.Seek(l.snapshots.offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek to previous snapshot: %w", err)
+	}
+	r := l.newReader(l.f, l.snapshots.offset)
+	err = l.replayShadow(r, l.snapshots.state)
+	if _, serr := l.f.Seek(pos, io.SeekStart); serr != nil && err == nil {
+		err = fmt.Errorf("failed to restore log position: %w", serr)
+	}
+	if err != nil {
+		return err
+	}
+	l.snapshots.offset = r.offset
+	l.snapshots.valid = true
+	state, err := l.hooks.snapshotMarshal(l.snapshots.state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	return l.snapshotStore.Save(state, r.offset)
+}
+
+// writeFileAtomic writes data to a temporary file, syncs it, then renames it
+// over path.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // nolint: errcheck
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace snapshot: %w", err)
+	}
+	return nil
+}
+
+// newState returns an empty State, allocating maps and pointers.
+func newState[State any]() State {
+	var state State
+	t := reflect.TypeOf(&state).Elem()
+	switch t.Kind() {
+	case reflect.Map:
+		reflect.ValueOf(&state).Elem().Set(reflect.MakeMap(t))
+	case reflect.Ptr:
+		reflect.ValueOf(&state).Elem().Set(reflect.New(t.Elem()))
+	}
+	return state
+}
@@ -0,0 +1,60 @@
+package replaylog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestPeriodicSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "snapshot")
+	marshal := func(kv KV) ([]byte, error) { return json.Marshal(kv) }
+	unmarshal := func(data []byte, kv KV) error { return json.Unmarshal(data, &kv) }
+
+	f, err := os.Create(filepath.Join(dir, "log"))
+	assert.NoError(t, err)
+	log, err := New[KV](f, ops, WithPeriodicSnapshot(2, marshal, path))
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "a", Value: "1"})
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	appendAll(t, log, &Set{Key: "b", Value: "2"}, &Delete{Key: "a"})
+	snapshot := snapshotFile{}
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &snapshot))
+	assert.Equal(t, `{"a":"1","b":"2"}`, string(snapshot.State))
+	appendAll(t, log, &Set{Key: "c", Value: "3"})
+	assert.NoError(t, log.Close())
+
+	f, err = os.OpenFile(filepath.Join(dir, "log"), os.O_RDWR, 0)
+	assert.NoError(t, err)
+	log, err = New[KV](f, ops, WithPeriodicSnapshot(2, marshal, path))
+	assert.NoError(t, err)
+	defer log.Close()
+	state := KV{}
+	err = log.ReplayFromSnapshot(path, unmarshal, state)
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"b": "2", "c": "3"}, state)
+
+	// The restored snapshot seeds the Log's copy of the State.
+	appendAll(t, log, &Set{Key: "d", Value: "4"}, &Delete{Key: "b"})
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &snapshot))
+	assert.Equal(t, `{"c":"3","d":"4"}`, string(snapshot.State))
+	assert.Equal(t, KV{"c": "3", "d": "4"}, replay(t, log))
+}
+
+func TestReplayFromMissingSnapshot(t *testing.T) {
+	log := newTestLog(t)
+	appendAll(t, log, &Set{Key: "a", Value: "1"})
+	state := KV{}
+	err := log.ReplayFromSnapshot(filepath.Join(t.TempDir(), "missing"), nil, state)
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"a": "1"}, state)
+}
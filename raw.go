@@ -0,0 +1,74 @@
+package replaylog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// AppendRaw appends an entry of the given kind with "event" as its JSON
+// encoded payload, for producers that already hold serialised events.
+//
+// The payload must decode into the Op registered for kind, so that the log
+// remains replayable, and is otherwise written as is. If WithAppendHook is
+// used the op returned by the hook is encoded instead. The entry is synced as
+// for Append.
+func (l *Log[State]) AppendRaw(kind int, event []byte) error {
+	if !json.Valid(event) {
+		return fmt.Errorf("raw event of kind %d is not valid JSON", kind)
+	}
+	op, err := l.decodeOp(Frame{Kind: kind, Event: event})
+	if err != nil {
+		return err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.hooks.appendHook != nil {
+		hooked, err := l.appendHook(op)
+		if err != nil {
+			return err
+		}
+		return l.appendLocked(hooked)
+	}
+	l.encoded = 0
+	if err := l.assignID(op); err != nil {
+		return err
+	}
+	e, err := l.stampEntry(Frame{Kind: kind, Event: event}, op)
+	if err != nil {
+		return err
+	}
+	data, err := l.encodeFrame(e)
+	if err != nil {
+		return err
+	}
+	if err := l.writeAndSync(data, 1); err != nil {
+		return err
+	}
+	if err := l.verifyAppended([]Op[State]{op}); err != nil {
+		return err
+	}
+	l.publish(op)
+	return nil
+}
+
+// AsWriter returns an io.Writer that appends each buffer passed to Write as a
+// single entry of the given kind using AppendRaw.
+//
+// Partial writes are not buffered across calls, so each call to Write must
+// contain exactly one complete event.
+func (l *Log[State]) AsWriter(kind int) io.Writer {
+	return rawWriter[State]{log: l, kind: kind}
+}
+
+type rawWriter[State any] struct {
+	log  *Log[State]
+	kind int
+}
+
+func (w rawWriter[State]) Write(p []byte) (int, error) {
+	if err := w.log.AppendRaw(w.kind, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,40 @@
+package replaylog
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestAppendRaw(t *testing.T) {
+	f := &MemoryFile{}
+	log, err := New[KV](f, ops)
+	assert.NoError(t, err)
+	ch, unsubscribe := log.Subscribe()
+	defer unsubscribe()
+	assert.NoError(t, log.AppendRaw(0, []byte("{\n  \"k\": \"foo\",\n  \"v\": \"bar\"\n}")))
+	assert.Equal(t, Op[KV](&Set{Key: "foo", Value: "bar"}), <-ch)
+	assert.Equal(t, `{"k":0,"e":{"k":"foo","v":"bar"}}`+"\n", string(f.data))
+
+	assert.EqualError(t, log.AppendRaw(2, []byte(`{}`)), "unknown event kind 2")
+	assert.EqualError(t, log.AppendRaw(0, []byte(`{"k":`)), "raw event of kind 0 is not valid JSON")
+	err = log.AppendRaw(0, []byte(`{"k":1}`))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "could not decode event of kind 0")
+}
+
+func TestAsWriter(t *testing.T) {
+	log := newTestLog(t)
+	w := log.AsWriter(0)
+	for i := 0; i < 3; i++ {
+		n, err := fmt.Fprintf(w, `{"k":"k%d","v":"v"}`+"\n", i)
+		assert.NoError(t, err)
+		assert.Equal(t, 19, n)
+	}
+	_, err := log.AsWriter(1).Write([]byte(`{"k":"k1"}`))
+	assert.NoError(t, err)
+	_, err = w.Write([]byte(`{"k":"k`))
+	assert.Error(t, err)
+	assert.Equal(t, KV{"k0": "v", "k2": "v"}, replay(t, log))
+}
@@ -0,0 +1,231 @@
+package replaylog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// reader reads delimited frames from a log, tracking the offset of
+// each frame.
+type reader struct {
+	br     *bufio.Reader
+	data   []byte // If non-nil, frames are sliced directly from data instead of br.
+	offset int64  // Offset of the next frame.
+	start  int64  // Offset of the last frame returned by next.
+	index  int    // Number of frames returned by next.
+	// Format version of the log, if the reader started at the beginning of
+	// the log, otherwise 0.
+	version      int
+	release      func()            // Releases data, if set.
+	onAnnotation func(line []byte) // Called with each annotation, if set.
+	delim        byte              // Frame delimiter, set by WithDelimiter.
+	binary       bool              // Frames are binary records, see WithBinaryRecords.
+	// Offset of the first entry of the group written by AppendGroup that is
+	// being read, if inGroup is set.
+	groupStart int64
+	inGroup    bool
+}
+
+// newReader creates a reader over r, which is positioned at "offset".
+func newReader(r io.Reader, offset int64) *reader {
+	rd := &reader{br: bufio.NewReader(r), offset: offset, start: offset, delim: '\n'}
+	if offset == 0 {
+		rd.version = 1
+	}
+	return rd
+}
+
+// newDataReader creates a reader over the whole contents of a log, starting at
+// "offset".
+func newDataReader(data []byte, offset int64) *reader {
+	rd := &reader{data: data, offset: offset, start: offset, delim: '\n'}
+	if offset == 0 {
+		rd.version = 1
+	}
+	return rd
+}
+
+// close releases any resources held by the reader.
+func (r *reader) close() {
+	if r.release != nil {
+		r.release()
+		r.release = nil
+	}
+}
+
+// readLine returns the next line, including its terminator, or the next
+// binary record.
+func (r *reader) readLine() ([]byte, error) {
+	if r.binary {
+		return r.readRecord()
+	}
+	if r.data != nil {
+		rest := r.data[r.offset:]
+		if i := bytes.IndexByte(rest, r.delim); i >= 0 {
+			return rest[:i+1], nil
+		}
+		return rest, io.EOF
+	}
+	line, err := r.br.ReadSlice(r.delim)
+	if errors.Is(err, bufio.ErrBufferFull) {
+		buf := append([]byte(nil), line...)
+		for errors.Is(err, bufio.ErrBufferFull) {
+			line, err = r.br.ReadSlice(r.delim)
+			buf = append(buf, line...)
+		}
+		line = buf
+	}
+	return line, err
+}
+
+// next returns the next non-empty frame without its delimiter, or io.EOF.
+//
+// A log header is validated and skipped, as are commit markers, trailers and
+// annotations.
+//
+// The returned slice is only valid until the next call to next.
+func (r *reader) next() ([]byte, error) {
+	for {
+		line, err := r.readLine()
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		start := r.offset
+		r.offset += int64(len(line))
+		if r.binary {
+			if len(line) == 0 {
+				return nil, err
+			}
+			r.start = start
+			r.index++
+			return line, nil
+		}
+		if n := len(line); n > 0 && line[n-1] == r.delim {
+			line = line[:n-1]
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if start == 0 && isHeader(line) {
+			if r.version, err = parseHeader(line); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if isCommitMarker(line) || isTrailer(line) {
+			continue
+		}
+		if isAnnotation(line) {
+			if r.onAnnotation != nil {
+				r.onAnnotation(line)
+			}
+			continue
+		}
+		r.start = start
+		r.index++
+		return line, nil
+	}
+}
+
+// newReader creates a reader over r, which is positioned at "offset", using
+// the delimiter of the log.
+func (l *Log[State]) newReader(r io.Reader, offset int64) *reader {
+	rd := newReader(r, offset)
+	rd.delim = l.delimiter
+	rd.binary = l.binaryFraming()
+	return rd
+}
+
+// fromStart calls fn with a reader positioned at the start of the log, then
+// restores the previous file position.
+func (l *Log[State]) fromStart(fn func(r *reader) error) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.rewound(fn)
+}
+
+// rewound is fromStart without locking.
+func (l *Log[State]) rewound(fn func(r *reader) error) error {
+	pos, err := l.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to determine log position: %w", err)
+	}
+	if _, err = l.f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind log: %w", err)
+	}
+	err = fn(l.newReader(l.f, 0))
+	if _, serr := l.f.Seek(pos, io.SeekStart); serr != nil && err == nil {
+		err = fmt.Errorf("failed to restore log position: %w", serr)
+	}
+	return err
+}
+
+// currentReader returns a reader at the current position of the log.
+func (l *Log[State]) currentReader() (*reader, error) {
+	pos, err := l.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine log position: %w", err)
+	}
+	return l.newReader(l.f, pos), nil
+}
+
+// reposition the log just after the last frame consumed by r, discarding any
+// data r has buffered.
+func (l *Log[State]) reposition(r *reader) error {
+	if _, err := l.f.Seek(r.offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to reposition log: %w", err)
+	}
+	return nil
+}
+
+// remaining counts the entries between the current position and the end of the
+// log, without changing the position.
+func (l *Log[State]) remaining() (int, error) {
+	r, err := l.currentReader()
+	if err != nil {
+		return 0, err
+	}
+	pos := r.offset
+	for {
+		_, err := r.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read log: %w", err)
+		}
+	}
+	if _, err := l.f.Seek(pos, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to reposition log: %w", err)
+	}
+	return r.index, nil
+}
+
+// eachOp calls fn with each decoded op in the log from the start, then
+// restores the previous file position.
+func (l *Log[State]) eachOp(fn func(index int, logEntry Frame, op Op[State]) error) error {
+	return l.fromStart(func(r *reader) error {
+		for {
+			logEntry, err := l.nextEntry(r)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("entry %d: %w", r.index-1, err)
+			}
+			op, err := l.decodeOp(logEntry)
+			if err != nil {
+				return fmt.Errorf("entry %d: %w", r.index-1, err)
+			}
+			if err := fn(r.index-1, logEntry, op); err != nil {
+				return err
+			}
+		}
+	})
+}
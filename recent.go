@@ -0,0 +1,46 @@
+package replaylog
+
+import "sync"
+
+// recentOps is a ring buffer of the most recent ops, for WithRecentCache.
+type recentOps[State any] struct {
+	lock sync.Mutex
+	ops  []Op[State]
+	next int // Index of the slot for the next op once ops is full.
+}
+
+// push op into the ring, which holds at most "size" ops.
+func (r *recentOps[State]) push(size int, op Op[State]) {
+	if size == 0 {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.ops) < size {
+		r.ops = append(r.ops, op)
+		return
+	}
+	r.ops[r.next] = op
+	r.next = (r.next + 1) % size
+}
+
+func (r *recentOps[State]) reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.ops = nil
+	r.next = 0
+}
+
+// Recent returns up to the last N ops appended to or replayed from the log,
+// oldest first, where N is set by WithRecentCache.
+//
+// The cache is filled by appends and by replays, and cleared when a replay
+// starts from the beginning of the log, so after replaying a log in full it
+// holds its last N ops.
+func (l *Log[State]) Recent() []Op[State] {
+	l.recent.lock.Lock()
+	defer l.recent.lock.Unlock()
+	out := make([]Op[State], 0, len(l.recent.ops))
+	out = append(out, l.recent.ops[l.recent.next:]...)
+	return append(out, l.recent.ops[:l.recent.next]...)
+}
@@ -0,0 +1,29 @@
+package replaylog
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestRecent(t *testing.T) {
+	f := &MemoryFile{}
+	log, err := New[KV](f, ops, WithRecentCache(2))
+	assert.NoError(t, err)
+	assert.Equal(t, []Op[KV]{}, log.Recent())
+	appendAll(t, log, &Set{Key: "a", Value: "1"})
+	assert.Equal(t, []Op[KV]{&Set{Key: "a", Value: "1"}}, log.Recent())
+	appendAll(t, log, &Set{Key: "b", Value: "2"}, &Delete{Key: "a"})
+	assert.Equal(t, []Op[KV]{&Set{Key: "b", Value: "2"}, &Delete{Key: "a"}}, log.Recent())
+
+	// Populated by replay on startup.
+	log, err = New[KV](f, ops, WithRecentCache(2))
+	assert.NoError(t, err)
+	replay(t, log)
+	assert.Equal(t, []Op[KV]{&Set{Key: "b", Value: "2"}, &Delete{Key: "a"}}, log.Recent())
+	// Replaying again from the start doesn't duplicate entries.
+	replay(t, log)
+	assert.Equal(t, []Op[KV]{&Set{Key: "b", Value: "2"}, &Delete{Key: "a"}}, log.Recent())
+	appendAll(t, log, &Set{Key: "c", Value: "3"})
+	assert.Equal(t, []Op[KV]{&Delete{Key: "a"}, &Set{Key: "c", Value: "3"}}, log.Recent())
+}
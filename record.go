@@ -0,0 +1,150 @@
+package replaylog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// FrameCodec is an optional interface that a Codec can implement to also
+// encode the envelope of each binary record, see WithBinaryRecords. Otherwise
+// envelopes are encoded as JSON.
+type FrameCodec interface {
+	// MarshalFrame encodes every field of frame except its Event, which is
+	// always nil.
+	MarshalFrame(frame Frame) ([]byte, error)
+	// UnmarshalFrame decodes an envelope encoded by MarshalFrame into frame.
+	UnmarshalFrame(data []byte, frame *Frame) error
+}
+
+// recordChecksum is set in the flags of a binary record that ends with the
+// CRC-32C of the rest of its body, written WithEntryChecksums.
+const recordChecksum byte = 1
+
+// encodeRecord encodes a frame, whose event is already compressed if
+// necessary, as a binary record.
+func (l *Log[State]) encodeRecord(e Frame) ([]byte, error) {
+	event := e.Event
+	e.Event = nil
+	var envelope []byte
+	var err error
+	if codec, ok := l.codec.(FrameCodec); ok {
+		envelope, err = codec.MarshalFrame(e)
+	} else {
+		envelope, err = json.Marshal(e)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event: %w", err)
+	}
+	var flags byte
+	if l.entryChecksums {
+		flags |= recordChecksum
+	}
+	body := make([]byte, 0, 1+binary.MaxVarintLen64+len(envelope)+len(event)+crc32.Size)
+	body = append(body, flags)
+	body = binary.AppendUvarint(body, uint64(len(envelope)))
+	body = append(body, envelope...)
+	body = append(body, event...)
+	if flags&recordChecksum != 0 {
+		body = binary.BigEndian.AppendUint32(body, crc32.Checksum(body, crc32Table))
+	}
+	record := make([]byte, 0, binary.MaxVarintLen64+len(body))
+	record = binary.AppendUvarint(record, uint64(len(body)))
+	return append(record, body...), nil
+}
+
+// decodeRecord decodes a single binary record, decompressing its event if
+// necessary.
+func (l *Log[State]) decodeRecord(data []byte) (Frame, error) {
+	frame := Frame{}
+	size, n := binary.Uvarint(data)
+	if n <= 0 || size != uint64(len(data)-n) {
+		return frame, fmt.Errorf("corrupt log entry: %w", io.ErrUnexpectedEOF)
+	}
+	body := data[n:]
+	if len(body) == 0 {
+		return frame, errors.New("corrupt log entry: empty record")
+	}
+	flags := body[0]
+	if flags&^recordChecksum != 0 {
+		return frame, fmt.Errorf("corrupt log entry: unknown record flags %#x", flags)
+	}
+	if flags&recordChecksum != 0 {
+		if len(body) < 1+crc32.Size {
+			return frame, fmt.Errorf("corrupt log entry: %w", io.ErrUnexpectedEOF)
+		}
+		end := len(body) - crc32.Size
+		if crc32.Checksum(body[:end], crc32Table) != binary.BigEndian.Uint32(body[end:]) {
+			return frame, fmt.Errorf("corrupt log entry: %w", ErrChecksumMismatch)
+		}
+		body = body[:end]
+	}
+	size, n = binary.Uvarint(body[1:])
+	if n <= 0 || size > uint64(len(body)-1-n) {
+		return frame, fmt.Errorf("corrupt log entry: %w", io.ErrUnexpectedEOF)
+	}
+	envelope := body[1+n : 1+n+int(size)]
+	var err error
+	if codec, ok := l.codec.(FrameCodec); ok {
+		err = codec.UnmarshalFrame(envelope, &frame)
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(envelope))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&frame)
+	}
+	if err != nil {
+		return frame, fmt.Errorf("corrupt log entry: %w", err)
+	}
+	frame.Event = append(json.RawMessage(nil), body[1+n+int(size):]...)
+	if frame.Compression != "" {
+		event, err := l.compressor.decompress(frame.Compression, frame.Event)
+		if err != nil {
+			return frame, fmt.Errorf("could not decompress %s log entry: %w", frame.Compression, err)
+		}
+		frame.Event, frame.Compression = event, ""
+	}
+	return frame, nil
+}
+
+// readRecord returns the next binary record, including its length prefix. At
+// the end of the log it returns any partial record with io.EOF.
+func (r *reader) readRecord() ([]byte, error) {
+	if r.data != nil {
+		rest := r.data[r.offset:]
+		size, n := binary.Uvarint(rest)
+		if n <= 0 || size > uint64(len(rest)-n) {
+			return rest, io.EOF
+		}
+		return rest[:n+int(size)], nil
+	}
+	var record []byte
+	for {
+		b, err := r.br.ReadByte()
+		if err != nil {
+			return record, err
+		}
+		record = append(record, b)
+		if b < 0x80 || len(record) == binary.MaxVarintLen64 {
+			break
+		}
+	}
+	size, n := binary.Uvarint(record)
+	if n <= 0 {
+		// Leave the corrupt prefix to fail decoding.
+		return record, nil
+	}
+	buf := bytes.NewBuffer(record)
+	// Copy rather than allocating "size" bytes up front, as a corrupt length
+	// may be arbitrarily large.
+	if _, err := io.CopyN(buf, r.br, int64(min(size, uint64(1<<62)))); err != nil {
+		if errors.Is(err, io.EOF) {
+			return buf.Bytes(), io.EOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
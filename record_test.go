@@ -0,0 +1,120 @@
+package replaylog
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestBinaryRecords(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "")
+	assert.NoError(t, err)
+	log, err := New[KV](f, ops, WithBinaryRecords())
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "a", Value: "b"}, &Delete{Key: "a"}, &Set{Key: "c", Value: "d\ne"})
+	assert.Equal(t, KV{"c": "d\ne"}, replay(t, log))
+	assert.NoError(t, log.Close())
+
+	data, err := os.ReadFile(f.Name())
+	assert.NoError(t, err)
+	first := "\x1a\x00\x07" + `{"k":0}` + `{"k":"a","v":"b"}`
+	assert.Equal(t, first, string(data[:len(first)]))
+
+	for _, options := range [][]Option{{WithBinaryRecords()}, {WithBinaryRecords(), WithReadOnly(), WithMmap()}} {
+		rf, err := os.Open(f.Name())
+		assert.NoError(t, err)
+		reopened, err := New[KV](rf, ops, options...)
+		assert.NoError(t, err)
+		state := KV{}
+		assert.NoError(t, reopened.Replay(state))
+		assert.Equal(t, KV{"c": "d\ne"}, state)
+		assert.NoError(t, reopened.Close())
+	}
+
+	_, err = New[KV](&MemoryFile{}, ops, WithBinaryRecords(), WithHeader())
+	assert.EqualError(t, err, "WithHeader can't be used with binary records")
+	_, err = New[KV](&MemoryFile{}, ops, WithBinaryRecords(), WithDelimiter('\x1e'))
+	assert.EqualError(t, err, "WithDelimiter can't be used with binary records")
+	log, err = New[KV](&MemoryFile{}, ops, WithCodec(GobCodec{}))
+	assert.NoError(t, err)
+	assert.EqualError(t, log.Annotate("note"), "can't annotate a log of binary records")
+}
+
+func TestBinaryRecordsCompression(t *testing.T) {
+	var value string
+	for i := 0; i < 200; i++ {
+		value += strconv.Itoa(i * i)
+	}
+	sizes := map[bool]int{}
+	for _, binary := range []bool{false, true} {
+		f := &MemoryFile{}
+		options := []Option{WithCompression(CompressGzip)}
+		if binary {
+			options = append(options, WithBinaryRecords())
+		}
+		log, err := New[KV](f, ops, options...)
+		assert.NoError(t, err)
+		appendAll(t, log, &Set{Key: "a", Value: value})
+		assert.Equal(t, KV{"a": value}, replay(t, log))
+		sizes[binary] = len(f.data)
+	}
+	// Compressed events aren't base64 encoded.
+	assert.True(t, sizes[true] < sizes[false]*4/5, "%v", sizes)
+}
+
+func TestBinaryRecordsCorruption(t *testing.T) {
+	f := &MemoryFile{}
+	log, err := New[KV](f, ops, WithBinaryRecords(), WithEntryChecksums())
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "a", Value: "b"}, &Set{Key: "c", Value: "d"})
+	size := len(f.data)
+
+	// A garbled event fails its checksum.
+	f.data[size-6] ^= 0xff
+	err = log.Rewind()
+	assert.NoError(t, err)
+	err = log.Replay(KV{})
+	assert.True(t, errors.Is(err, ErrChecksumMismatch), "%v", err)
+	f.data[size-6] ^= 0xff
+
+	// A torn final record is truncated by ReplayTolerant.
+	f.data = f.data[:size-3]
+	assert.NoError(t, log.Rewind())
+	state := KV{}
+	discarded, err := log.ReplayTolerant(state)
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"a": "b"}, state)
+	assert.Equal(t, int64(size/2-3), discarded)
+}
+
+// kindOnlyCodec is a FrameCodec that only encodes the kind of each entry, as a
+// single byte.
+type kindOnlyCodec struct{ JSONCodec }
+
+func (kindOnlyCodec) MarshalFrame(frame Frame) ([]byte, error) {
+	return []byte{byte(frame.Kind)}, nil
+}
+
+func (kindOnlyCodec) UnmarshalFrame(data []byte, frame *Frame) error {
+	if len(data) != 1 {
+		return errors.New("invalid envelope")
+	}
+	frame.Kind = int(data[0])
+	return nil
+}
+
+func TestFrameCodec(t *testing.T) {
+	f := &MemoryFile{}
+	log, err := New[KV](f, ops, WithCodec(kindOnlyCodec{}), WithBinaryRecords())
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "a", Value: "b"}, &Delete{Key: "a"}, &Set{Key: "c", Value: "d"})
+	assert.Equal(t, KV{"c": "d"}, replay(t, log))
+	event, err := json.Marshal(&Delete{Key: "a"})
+	assert.NoError(t, err)
+	second := "\x14\x00\x01\x00" + `{"k":"a","v":"b"}` + string([]byte{byte(3 + len(event)), 0, 1, 1}) + string(event)
+	assert.Equal(t, second, string(f.data[:len(second)]))
+}
@@ -0,0 +1,43 @@
+package replaylog
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// OpsBuilder builds the ordered slice of ops passed to New.
+type OpsBuilder[State any] struct {
+	ops   []Op[State]
+	types map[reflect.Type]int
+}
+
+// Ops starts building the ordered slice of ops for New, eg.
+//
+//	ops := Ops[KV]().Add(&Set{}).Add(&Delete{}).Done()
+//
+// As with the slice form, ops must only ever be added to the end.
+func Ops[State any]() *OpsBuilder[State] {
+	return &OpsBuilder[State]{types: map[reflect.Type]int{}}
+}
+
+// Add the next op.
+//
+// Add panics if op is nil or its type has already been added, as this is
+// always a programming error.
+func (b *OpsBuilder[State]) Add(op Op[State]) *OpsBuilder[State] {
+	v := reflect.ValueOf(op)
+	if op == nil || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		panic(fmt.Sprintf("op %d is nil", len(b.ops)))
+	}
+	if kind, ok := b.types[v.Type()]; ok {
+		panic(fmt.Sprintf("op %d of type %T was already added as op %d", len(b.ops), op, kind))
+	}
+	b.types[v.Type()] = len(b.ops)
+	b.ops = append(b.ops, op)
+	return b
+}
+
+// Done returns the ops in the order they were added.
+func (b *OpsBuilder[State]) Done() []Op[State] {
+	return b.ops
+}
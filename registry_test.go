@@ -0,0 +1,16 @@
+package replaylog
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestOpsBuilder(t *testing.T) {
+	built := Ops[KV]().Add(&Set{}).Add(&Delete{}).Done()
+	assert.Equal(t, ops, built)
+
+	assert.Panics(t, func() { Ops[KV]().Add(&Set{}).Add(&Set{}) })
+	assert.Panics(t, func() { Ops[KV]().Add(nil) })
+	assert.Panics(t, func() { Ops[KV]().Add((*Set)(nil)) })
+}
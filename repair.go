@@ -0,0 +1,325 @@
+package replaylog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Repair copies the healthy prefix of the log to dst, returning the number of
+// entries recovered and the number dropped.
+//
+// The prefix ends at the first entry that can't be decoded, as reported by
+// Scan, and every entry from there on is dropped even if later entries are
+// healthy, as they may depend on the corrupt one. The prefix is copied byte
+// for byte, so dst is a clean log in the same format that can replace the
+// original. dst is synced if it implements Syncer.
+//
+// The log is read from the start, and its position restored afterwards.
+func (l *Log[State]) Repair(dst File) (recovered int, dropped int, err error) {
+	err = l.fromStart(func(r *reader) error {
+		var end int64
+		end, recovered, dropped, err = l.healthyPrefix(r)
+		if err != nil {
+			return err
+		}
+		if _, err := l.f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to rewind log: %w", err)
+		}
+		if _, err := io.CopyN(dst, l.f, end); err != nil {
+			return fmt.Errorf("failed to copy healthy entries: %w", err)
+		}
+		if err := syncFile(dst); err != nil {
+			return fmt.Errorf("failed to sync repaired log: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return recovered, dropped, nil
+}
+
+// ReplayTolerant is like Replay, but tolerates a torn final entry left by a
+// crash part way through an append, returning the number of bytes discarded.
+//
+// If the last entry in the log is incomplete or malformed JSON, and there is
+// no further data after it, every entry before it is applied and the log is
+// truncated back to the end of the last complete entry, leaving it positioned
+// there for appending. A malformed entry followed by more data is a genuinely
+// corrupt log, and is still an error, as are entries that decode but can't be
+// applied. The File must implement Truncater for a torn entry to be discarded.
+//
+// If the torn entry is part of a group written by AppendGroup, the whole group
+// is discarded, as it can never be complete.
+func (l *Log[State]) ReplayTolerant(dest State) (discarded int64, err error) {
+	defer l.startReplaying()()
+	r, err := l.startReplay(dest)
+	if err != nil {
+		return 0, err
+	}
+	defer r.close()
+	err = l.replay(r, dest)
+	if err == nil || !isTornEntry(err) || l.readOnly {
+		return 0, err
+	}
+	// Only the final entry can be torn, anything after it means the log is
+	// corrupt.
+	if _, nerr := r.next(); !errors.Is(nerr, io.EOF) {
+		return 0, err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	t, ok := l.f.(Truncater)
+	if !ok {
+		return 0, err
+	}
+	end, serr := l.f.Seek(0, io.SeekEnd)
+	if serr != nil {
+		return 0, fmt.Errorf("failed to determine log size: %w", serr)
+	}
+	cut := r.start
+	if r.inGroup {
+		cut = r.groupStart
+	}
+	if err := t.Truncate(cut); err != nil {
+		return 0, fmt.Errorf("failed to truncate torn entry: %w", err)
+	}
+	if _, err := l.f.Seek(cut, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to reposition log: %w", err)
+	}
+	l.size = cut
+	l.entries = -1
+	// Every op that was applied is still in the log, but IDs were collected
+	// from a discarded group.
+	l.ids.reset()
+	if l.snapshots.offset > cut {
+		l.snapshots.valid = false
+	}
+	return end - cut, l.sync()
+}
+
+// isTornEntry returns true if err is from decoding a frame that was
+// truncated or garbled, rather than a well-formed entry that couldn't be
+// decoded into an op or applied.
+func isTornEntry(err error) bool {
+	var syntax *json.SyntaxError
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, ErrChecksumMismatch) || errors.As(err, &syntax)
+}
+
+// ReplayTruncating is like Replay, but first truncates the log at the end of
+// its healthy prefix, returning the number of entries dropped.
+//
+// As for Repair, the prefix ends at the first entry that can't be decoded,
+// such as one that doesn't match its checksum WithEntryChecksums, and every
+// entry from there on is dropped even if later entries are healthy. The
+// File must implement Truncater if any entries are dropped, and the log can't
+// be WithReadOnly. If the log was positioned beyond the new end, it is
+// positioned at the end before replaying.
+func (l *Log[State]) ReplayTruncating(dest State) (dropped int, err error) {
+	defer l.startReplaying()()
+	if dropped, err = l.truncateUnhealthy(); err != nil {
+		return 0, err
+	}
+	r, err := l.startReplay(dest)
+	if err != nil {
+		return dropped, err
+	}
+	defer r.close()
+	return dropped, l.replay(r, dest)
+}
+
+// truncateUnhealthy truncates the log at the end of its healthy prefix, for
+// ReplayTruncating.
+func (l *Log[State]) truncateUnhealthy() (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	var end int64
+	var dropped int
+	err := l.rewound(func(r *reader) (err error) {
+		end, _, dropped, err = l.healthyPrefix(r)
+		return err
+	})
+	if err != nil || dropped == 0 {
+		return 0, err
+	}
+	if l.readOnly {
+		return 0, ErrReadOnly
+	}
+	t, ok := l.f.(Truncater)
+	if !ok {
+		return 0, fmt.Errorf("can't truncate %d corrupt entries of log of type %T, it must implement Truncater", dropped, l.f)
+	}
+	pos, err := l.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, fmt.Errorf("failed to determine log position: %w", err)
+	}
+	if err := t.Truncate(end); err != nil {
+		return 0, fmt.Errorf("failed to truncate corrupt entries: %w", err)
+	}
+	if pos > end {
+		if _, err := l.f.Seek(end, io.SeekStart); err != nil {
+			return 0, fmt.Errorf("failed to reposition log: %w", err)
+		}
+	}
+	l.size = end
+	l.entries = -1
+	l.forgetEntries()
+	if l.snapshots.offset > end {
+		l.snapshots.valid = false
+	}
+	return dropped, l.sync()
+}
+
+// healthyPrefix reads every entry from r, returning the offset at which the
+// healthy prefix of the log ends along with the number of entries in and after
+// it. A group written by AppendGroup is only healthy if all of its entries
+// are. r is left at the end of the log.
+func (l *Log[State]) healthyPrefix(r *reader) (end int64, recovered int, dropped int, err error) {
+	end = -1 // Once known.
+	var groupStart int64
+	groupRemaining, groupEntries := 0, 0
+	// corrupt ends the prefix at the entry just read or, if it is part of a
+	// group, at the start of the group.
+	corrupt := func() {
+		end = r.start
+		if groupRemaining > 0 {
+			end = groupStart
+			recovered -= groupEntries
+			dropped += groupEntries
+		}
+	}
+	for {
+		frame, err := r.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if end >= 0 {
+			dropped++
+			continue
+		}
+		logEntry, err := l.decodeEntry(frame)
+		// Entries of unknown kinds that replay skips are healthy.
+		if err == nil && (!l.skipUnknown() || l.knownKind(logEntry.Kind)) {
+			_, err = l.decodeOp(logEntry)
+		}
+		if err == nil && logEntry.Group > 0 && groupRemaining > 0 {
+			err = ErrIncompleteGroup
+		}
+		if err != nil {
+			corrupt()
+			dropped++
+			continue
+		}
+		if logEntry.Group > 0 {
+			groupStart, groupRemaining, groupEntries = r.start, logEntry.Group, 0
+		}
+		if groupRemaining > 0 {
+			groupRemaining--
+			groupEntries++
+		}
+		recovered++
+	}
+	if end < 0 && groupRemaining > 0 {
+		corrupt()
+	}
+	if end < 0 {
+		end = r.offset
+	}
+	return end, recovered, dropped, nil
+}
+
+// quarantineTail moves everything after the healthy prefix of the log at
+// "path" to a quarantine file, for OpenRecovering.
+func (l *Log[State]) quarantineTail(path string) (int64, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.readOnly {
+		return 0, ErrReadOnly
+	}
+	t, ok := l.f.(Truncater)
+	if !ok {
+		return 0, fmt.Errorf("can't truncate log: File of type %T does not implement Truncater", l.f)
+	}
+	var end, size int64
+	var tail []byte
+	err := l.rewound(func(r *reader) (err error) {
+		if end, _, _, err = l.healthyPrefix(r); err != nil {
+			return err
+		}
+		size = r.offset
+		if end == size {
+			return nil
+		}
+		if _, err := l.f.Seek(end, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek to corrupt tail: %w", err)
+		}
+		tail = make([]byte, size-end)
+		if _, err := io.ReadFull(l.f, tail); err != nil {
+			return fmt.Errorf("failed to read corrupt tail: %w", err)
+		}
+		return nil
+	})
+	if err != nil || end == size {
+		return 0, err
+	}
+	quarantine := fmt.Sprintf("%s.corrupt.%d", path, l.clock().UnixNano())
+	if err := writeQuarantine(quarantine, tail, l.createMode()); err != nil {
+		return 0, err
+	}
+	if err := t.Truncate(end); err != nil {
+		return 0, fmt.Errorf("failed to truncate log: %w", err)
+	}
+	if pos, err := l.f.Seek(0, io.SeekCurrent); err != nil {
+		return 0, fmt.Errorf("failed to determine log position: %w", err)
+	} else if pos > end {
+		if _, err := l.f.Seek(end, io.SeekStart); err != nil {
+			return 0, fmt.Errorf("failed to reposition log: %w", err)
+		}
+	}
+	l.size = end
+	l.entries = -1
+	l.forgetEntries()
+	if l.snapshots.offset > end {
+		l.snapshots.valid = false
+	}
+	if err := l.sync(); err != nil {
+		return 0, err
+	}
+	if l.observer.OnQuarantine != nil {
+		l.observer.OnQuarantine(quarantine, end, size-end)
+	}
+	return size - end, nil
+}
+
+// writeQuarantine atomically creates the file at "path" containing data.
+func writeQuarantine(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create quarantine file: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(mode)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write quarantine file: %w", err)
+	}
+	return syncDir(filepath.Dir(path))
+}
@@ -0,0 +1,145 @@
+package replaylog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestRepair(t *testing.T) {
+	log := newTestLog(t, WithHeader())
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"})
+	_, err := log.f.Write([]byte(`{"k":0,"e":{"k":"trunc` + "\n"))
+	assert.NoError(t, err)
+	appendAll(t, log, &Delete{Key: "foo"}, &Set{Key: "waz", Value: "foo"})
+
+	dst := &MemoryFile{}
+	recovered, dropped, err := log.Repair(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, recovered)
+	assert.Equal(t, 3, dropped)
+
+	repaired, err := New[KV](dst, ops)
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, replay(t, repaired))
+	appendAll(t, repaired, &Delete{Key: "bar"})
+	assert.Equal(t, KV{"foo": "bar"}, replay(t, repaired))
+
+	// A healthy log is copied in full.
+	dst = &MemoryFile{}
+	recovered, dropped, err = repaired.Repair(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, recovered)
+	assert.Equal(t, 0, dropped)
+	assert.Equal(t, string(dst.data), string(repaired.f.(*MemoryFile).data))
+}
+
+func TestOpenRecovering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	healthy := `{"k":0,"e":{"k":"foo","v":"bar"}}` + "\n"
+	tail := `{"k":0,"e":{"k":"trunc` + "\n" + `{"k":1,"e":{"k":"foo"}}` + "\n" + `{"k":0,"e"`
+	assert.NoError(t, os.WriteFile(path, []byte(healthy+tail), 0600))
+	var quarantined []string
+	observer := WithObserver(Observer{OnQuarantine: func(path string, offset, size int64) {
+		quarantined = append(quarantined, path)
+		assert.Equal(t, int64(len(healthy)), offset)
+		assert.Equal(t, int64(len(tail)), size)
+	}})
+	log, n, err := OpenRecovering(path, ops, observer)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(tail)), n)
+	state := KV{}
+	assert.NoError(t, log.Replay(state))
+	assert.Equal(t, KV{"foo": "bar"}, state)
+	assert.NoError(t, log.Append(&Set{Key: "bar", Value: "waz"}))
+	assert.NoError(t, log.Close())
+
+	matches, err := filepath.Glob(path + ".corrupt.*")
+	assert.NoError(t, err)
+	assert.Equal(t, quarantined, matches)
+	data, err := os.ReadFile(matches[0])
+	assert.NoError(t, err)
+	assert.Equal(t, tail, string(data))
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, healthy+`{"k":0,"e":{"k":"bar","v":"waz"}}`+"\n", string(data))
+
+	// A healthy log is left alone.
+	log, n, err = OpenRecovering(path, ops, observer)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	assert.NoError(t, log.Close())
+	assert.Equal(t, 1, len(quarantined))
+
+	// As is a log with entries of a newer kind that replay skips.
+	newer := `{"k":0,"e":{"k":"a","v":"1"}}` + "\n" + `{"k":7,"e":{"x":1}}` + "\n" + `{"k":0,"e":{"k":"b","v":"2"}}` + "\n"
+	assert.NoError(t, os.WriteFile(path, []byte(newer), 0600))
+	log, n, err = OpenRecovering(path, ops, WithUnknownKindPolicy(SkipUnknown))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	state = KV{}
+	assert.NoError(t, log.Replay(state))
+	assert.Equal(t, KV{"a": "1", "b": "2"}, state)
+	dst := &MemoryFile{}
+	recovered, dropped, err := log.Repair(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, recovered)
+	assert.Equal(t, 0, dropped)
+	assert.NoError(t, log.Close())
+}
+
+func TestReplayTolerant(t *testing.T) {
+	healthy := `{"k":0,"e":{"k":"foo","v":"bar"}}` + "\n" + `{"k":0,"e":{"k":"bar","v":"waz"}}` + "\n"
+	for _, torn := range []string{`{"k":1,"e":{"k":"fo`, `{"k":1,"e":{"k":"foo"}` + "\n", "\x00\x00\x00\n\n"} {
+		f := &MemoryFile{data: []byte(healthy + torn)}
+		log, err := New[KV](f, ops)
+		assert.NoError(t, err)
+		state := KV{}
+		discarded, err := log.ReplayTolerant(state)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(torn)), discarded)
+		assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, state)
+		assert.NoError(t, log.Append(&Delete{Key: "foo"}))
+		assert.Equal(t, healthy+`{"k":1,"e":{"k":"foo"}}`+"\n", string(f.data))
+	}
+
+	// Corruption followed by more entries is not a torn entry.
+	corrupt := healthy + `{"k":1,"e":{"k":"fo` + "\n" + `{"k":1,"e":{"k":"bar"}}` + "\n"
+	f := &MemoryFile{data: []byte(corrupt)}
+	log, err := New[KV](f, ops)
+	assert.NoError(t, err)
+	_, err = log.ReplayTolerant(KV{})
+	assert.Error(t, err)
+	assert.Equal(t, corrupt, string(f.data))
+
+	// A torn entry within a group discards the whole group, which would
+	// otherwise never be complete.
+	f = &MemoryFile{data: []byte(healthy)}
+	log, err = New[KV](f, ops)
+	assert.NoError(t, err)
+	assert.NoError(t, log.Replay(KV{}))
+	assert.NoError(t, log.AppendGroup(nil, &Set{Key: "a", Value: "1"}, &Set{Key: "b", Value: "2"}, &Set{Key: "c", Value: "3"}))
+	assert.NoError(t, log.Close())
+	second := len(healthy) + bytes.IndexByte(f.data[len(healthy):], '\n') + 1
+	f = NewMemoryFile(f.data[:second+10])
+	log, err = New[KV](f, ops)
+	assert.NoError(t, err)
+	state := KV{}
+	discarded, err := log.ReplayTolerant(state)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(second+10-len(healthy)), discarded)
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, state)
+	assert.Equal(t, healthy, string(f.data))
+	assert.NoError(t, log.Append(&Delete{Key: "foo"}))
+	assert.Equal(t, KV{"bar": "waz"}, replay(t, log))
+
+	// Nor is a well-formed entry that can't be decoded.
+	f = &MemoryFile{data: []byte(healthy + `{"k":7,"e":{}}` + "\n")}
+	log, err = New[KV](f, ops)
+	assert.NoError(t, err)
+	_, err = log.ReplayTolerant(KV{})
+	assert.EqualError(t, err, "unknown event kind 7")
+}
@@ -0,0 +1,262 @@
+package replaylog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ReplayUntilState replays ops into dest until "done" returns true for the
+// State resulting from an applied op, or the end of the log is reached.
+//
+// If stopped early, the log is positioned immediately after the last applied
+// op, so a subsequent Replay continues from there. Like the other replay
+// methods that can stop early, it returns true only if replay stopped because
+// it reached the end of the log: if "done" returns true for the last op,
+// reachedEOF is false.
+func (l *Log[State]) ReplayUntilState(dest State, done func(state State) bool) (reachedEOF bool, err error) {
+	defer l.startReplaying()()
+	r, err := l.startReplay(dest)
+	if err != nil {
+		return false, err
+	}
+	defer r.close()
+	stopped, err := l.replayUntil(r, dest, replayControl[State]{
+		stop: func(Op[State]) bool { return done(dest) },
+	})
+	return !stopped && err == nil, err
+}
+
+// ReplayRange replays the log from the start into dest, applying only ops
+// appended within [from, to] as recorded by WithTimestamps. The position of
+// the log is preserved.
+//
+// Entries without a timestamp are not applied. Because the log is append
+// ordered, timestamps are assumed to be monotonic, so replay stops at the
+// first entry after "to". If an earlier entry had a timestamp before that of
+// its predecessor, for example due to the clock being adjusted, the whole log
+// is scanned instead.
+func (l *Log[State]) ReplayRange(dest State, from, to time.Time) error {
+	defer l.startReplaying()()
+	if l.resetBeforeReplay {
+		if err := reset(dest); err != nil {
+			return err
+		}
+	}
+	fromNS, toNS := from.UnixNano(), to.UnixNano()
+	var prev int64
+	monotonic := true
+	return l.fromStart(func(r *reader) error {
+		_, err := l.replayUntil(r, dest, replayControl[State]{
+			accept: func(logEntry Frame) (apply, more bool) {
+				if logEntry.Time == 0 {
+					return false, true
+				}
+				if logEntry.Time < prev {
+					monotonic = false
+				}
+				prev = logEntry.Time
+				if logEntry.Time > toNS {
+					return false, !monotonic
+				}
+				return logEntry.Time >= fromNS, true
+			},
+		})
+		return err
+	})
+}
+
+// ReplayIndexRange replays only the entries of the log at indices in
+// [start, end) into dest, leaving the log positioned after entry end-1, or at
+// its end if it has fewer entries.
+//
+// The first "start" entries are skipped without being decoded, so each of a
+// number of workers can cheaply reconstruct its own range of the log.
+func (l *Log[State]) ReplayIndexRange(dest State, start, end int) error {
+	if start < 0 || start > end {
+		return fmt.Errorf("invalid entry range [%d, %d)", start, end)
+	}
+	defer l.startReplaying()()
+	if err := l.Rewind(); err != nil {
+		return err
+	}
+	r, err := l.startReplay(dest)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	for r.index < start {
+		if _, err := r.next(); errors.Is(err, io.EOF) {
+			return l.reposition(r)
+		} else if err != nil {
+			return fmt.Errorf("entry %d: %w", r.index, err)
+		}
+	}
+	_, err = l.replayUntil(r, dest, replayControl[State]{
+		accept: func(Frame) (apply, more bool) {
+			more = r.index <= end
+			return more, more
+		},
+	})
+	return err
+}
+
+// ReplayMatching replays the log from the start into dest, applying only
+// entries for which "match" returns true, leaving the log positioned at its
+// end.
+//
+// "match" is called with the kind and encoded event of each entry before it is
+// decoded, so entries it rejects, for example with a cheap bytes.Contains, are
+// never unmarshalled. The event is as stored in the log, after decompression
+// but before any WithMigrations or WithEventTransform.
+func (l *Log[State]) ReplayMatching(dest State, match func(kind int, raw json.RawMessage) bool) error {
+	defer l.startReplaying()()
+	if err := l.Rewind(); err != nil {
+		return err
+	}
+	r, err := l.startReplay(dest)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	_, err = l.replayUntil(r, dest, replayControl[State]{
+		accept: func(logEntry Frame) (apply, more bool) {
+			return match(logEntry.Kind, logEntry.Event), true
+		},
+	})
+	return err
+}
+
+// ReplayBytes is like Replay, but stops before the first entry that would take
+// the number of bytes of the log read beyond maxBytes, leaving the log
+// positioned at the start of that entry. It returns true if the end of the log
+// was reached.
+//
+// This allows a log to be replayed incrementally in chunks of bounded size.
+func (l *Log[State]) ReplayBytes(dest State, maxBytes int64) (reachedEOF bool, err error) {
+	defer l.startReplaying()()
+	r, err := l.startReplay(dest)
+	if err != nil {
+		return false, err
+	}
+	defer r.close()
+	start := r.offset
+	stopped, err := l.replayUntil(r, dest, replayControl[State]{
+		accept: func(Frame) (apply, more bool) {
+			more = r.offset-start <= maxBytes
+			return more, more
+		},
+	})
+	return !stopped && err == nil, err
+}
+
+// LastOp returns the last op successfully applied by a replay of the log, or
+// false if no op has been applied.
+//
+// LastOp must not be called concurrently with a replay.
+func (l *Log[State]) LastOp() (Op[State], bool) {
+	return l.lastOp, l.lastOp != nil
+}
+
+// ReplayResult summarises a Replay.
+type ReplayResult struct {
+	// Applied is the number of entries applied.
+	Applied int
+	// Bytes is the number of bytes of the log read.
+	Bytes int64
+	// Kinds is the number of entries applied of each kind.
+	Kinds map[int]int
+	// Duration of the Replay.
+	Duration time.Duration
+	// ReachedEOF is true if the Replay consumed the whole log, rather than
+	// being stopped early by ErrStopReplay.
+	ReachedEOF bool
+}
+
+// ReplayStats is like Replay, but also returns a summary of the entries
+// replayed. The summary is valid up to the point of failure if an error is
+// returned.
+func (l *Log[State]) ReplayStats(dest State) (ReplayResult, error) {
+	defer l.startReplaying()()
+	start := time.Now()
+	result := ReplayResult{Kinds: map[int]int{}}
+	r, err := l.startReplay(dest)
+	if err != nil {
+		return result, err
+	}
+	defer r.close()
+	offset := r.offset
+	stopped, err := l.replayUntil(r, dest, replayControl[State]{stats: &result})
+	result.ReachedEOF = !stopped && err == nil
+	result.Bytes = r.offset - offset
+	result.Duration = time.Since(start)
+	return result, err
+}
+
+// ReplayFiles replays each of "files" in order into dest, as if they were a
+// single log, from their current positions to EOF.
+//
+// The files are decoded with the ops and options of l, and any error
+// identifies the index of the file that failed.
+func (l *Log[State]) ReplayFiles(dest State, files []File) error {
+	defer l.startReplaying()()
+	if l.resetBeforeReplay {
+		if err := reset(dest); err != nil {
+			return err
+		}
+	}
+	for i, f := range files {
+		part := l.withFile(f)
+		r, err := part.currentReader()
+		if err != nil {
+			return fmt.Errorf("file %d: %w", i, err)
+		}
+		if err := part.replay(r, dest); err != nil {
+			return fmt.Errorf("file %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// ReplayAndContinue replays the log from its current position to the end into
+// dest, then positions it at the logical end of the log for Append.
+//
+// Unlike Replay, the log is locked for the duration, so concurrent appends
+// can't interleave with the replay, and it fails rather than leaving the log
+// positioned before any data that could not be replayed. Ops that return
+// ErrStopReplay don't stop it. Ops must not append to the log while it is
+// being replayed.
+func (l *Log[State]) ReplayAndContinue(dest State) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	r, err := l.startReplay(dest)
+	if err != nil {
+		return err
+	}
+	for {
+		stopped, err := l.replayUntil(r, dest, replayControl[State]{})
+		r.close()
+		if err != nil {
+			return err
+		}
+		if !stopped {
+			break
+		}
+		// The log has been repositioned after the stopping op, so
+		// continue with a fresh reader rather than what r has buffered.
+		if r, err = l.currentReader(); err != nil {
+			return err
+		}
+	}
+	end, err := l.f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to seek to end of log: %w", err)
+	}
+	if end != r.offset {
+		_ = l.reposition(r)
+		return fmt.Errorf("log has %d bytes after the last replayed entry at offset %d", end-r.offset, r.offset)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package replaylog
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestReplayUntilState(t *testing.T) {
+	log := newTestLog(t)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"}, &Delete{Key: "foo"})
+	err := log.Rewind()
+	assert.NoError(t, err)
+
+	state := KV{}
+	eof, err := log.ReplayUntilState(state, func(state KV) bool { return state["bar"] == "waz" })
+	assert.NoError(t, err)
+	assert.False(t, eof)
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, state)
+
+	eof, err = log.ReplayUntilState(state, func(state KV) bool { return false })
+	assert.NoError(t, err)
+	assert.True(t, eof)
+	assert.Equal(t, KV{"bar": "waz"}, state)
+}
+
+func TestReplayRange(t *testing.T) {
+	now := time.Unix(1000, 0)
+	log := newTestLog(t, WithTimestamps())
+	log.now = func() time.Time { return now }
+	at := func(ts int64, op Op[KV]) {
+		now = time.Unix(ts, 0)
+		appendAll(t, log, op)
+	}
+	at(1000, &Set{Key: "a", Value: "1"})
+	at(2000, &Set{Key: "b", Value: "2"})
+	at(3000, &Set{Key: "c", Value: "3"})
+	at(4000, &Delete{Key: "b"})
+
+	state := KV{}
+	err := log.ReplayRange(state, time.Time{}, time.Unix(2000, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"a": "1", "b": "2"}, state)
+
+	state = KV{}
+	err = log.ReplayRange(state, time.Unix(1500, 0), time.Unix(3500, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"b": "2", "c": "3"}, state)
+
+	// A clock adjustment disables the early exit.
+	at(2500, &Set{Key: "d", Value: "4"})
+	state = KV{}
+	err = log.ReplayRange(state, time.Time{}, time.Unix(3000, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"a": "1", "b": "2", "c": "3"}, state)
+
+	// The position of the log is preserved.
+	appendAll(t, log, &Set{Key: "e", Value: "5"})
+	assert.Equal(t, KV{"a": "1", "c": "3", "d": "4", "e": "5"}, replay(t, log))
+}
+
+func TestReplayStats(t *testing.T) {
+	log := newTestLog(t)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"}, &Delete{Key: "foo"})
+	err := log.Rewind()
+	assert.NoError(t, err)
+	state := KV{}
+	result, err := log.ReplayStats(state)
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"bar": "waz"}, state)
+	assert.Equal(t, 3, result.Applied)
+	assert.Equal(t, int64(len(`{"k":0,"e":{"k":"foo","v":"bar"}}`+"\n")*2+len(`{"k":1,"e":{"k":"foo"}}`+"\n")), result.Bytes)
+	assert.Equal(t, map[int]int{0: 2, 1: 1}, result.Kinds)
+	assert.True(t, result.Duration > 0)
+	assert.True(t, result.ReachedEOF)
+}
+
+func TestReplayFiles(t *testing.T) {
+	log := newTestLog(t, WithResetBeforeReplay())
+	files := []File{
+		writeTestFile(t, `{"k":0,"e":{"k":"foo","v":"bar"}}`+"\n"),
+		writeTestFile(t, `{"k":0,"e":{"k":"bar","v":"waz"}}`+"\n"+`{"k":1,"e":{"k":"foo"}}`+"\n"),
+		writeTestFile(t, `{"k":0,"e":{"k":"waz","v":"foo"}}`+"\n"),
+	}
+	state := KV{"stale": "x"}
+	err := log.ReplayFiles(state, files)
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"bar": "waz", "waz": "foo"}, state)
+
+	files = []File{
+		writeTestFile(t, `{"k":0,"e":{"k":"foo","v":"bar"}}`+"\n"),
+		writeTestFile(t, `{"k":7,"e":{}}`+"\n"),
+	}
+	err = log.ReplayFiles(KV{}, files)
+	assert.EqualError(t, err, "file 1: unknown event kind 7")
+}
+
+func TestLastOp(t *testing.T) {
+	log := newTestLog(t)
+	_, ok := log.LastOp()
+	assert.False(t, ok)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Delete{Key: "foo"})
+	replay(t, log)
+	op, ok := log.LastOp()
+	assert.True(t, ok)
+	assert.Equal(t, Op[KV](&Delete{Key: "foo"}), op)
+}
+
+func TestReplayBytes(t *testing.T) {
+	log := newTestLog(t)
+	// Each entry is 34 bytes.
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"}, &Set{Key: "waz", Value: "foo"})
+	assert.NoError(t, log.Rewind())
+	state := KV{}
+	eof, err := log.ReplayBytes(state, 33)
+	assert.NoError(t, err)
+	assert.False(t, eof)
+	assert.Equal(t, KV{}, state)
+	eof, err = log.ReplayBytes(state, 34*2+10)
+	assert.NoError(t, err)
+	assert.False(t, eof)
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, state)
+	eof, err = log.ReplayBytes(state, 1000)
+	assert.NoError(t, err)
+	assert.True(t, eof)
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz", "waz": "foo"}, state)
+}
+
+func TestReplayAndContinue(t *testing.T) {
+	f := &readAheadFile{}
+	log, err := New[KV](f, []Op[KV]{&Set{}, &Delete{}, stopOp{}})
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, stopOp{}, &Set{Key: "bar", Value: "waz"})
+	assert.NoError(t, log.Rewind())
+	state := KV{}
+	assert.NoError(t, log.ReplayAndContinue(state))
+	assert.Equal(t, KV{"foo": "bar", "stopped": "true", "bar": "waz"}, state)
+	assert.NoError(t, log.Append(&Delete{Key: "foo"}))
+	assert.Equal(t, `{"k":0,"e":{"k":"foo","v":"bar"}}
+{"k":2,"e":{}}
+{"k":0,"e":{"k":"bar","v":"waz"}}
+{"k":1,"e":{"k":"foo"}}
+`, string(f.data))
+
+	// Data that can't be replayed is not appended to.
+	f.data = append(f.data, `{"k":0,"e":{"k":"trunc`...)
+	assert.NoError(t, log.Rewind())
+	assert.Error(t, log.ReplayAndContinue(KV{}))
+}
+
+func TestReplayIndexRange(t *testing.T) {
+	log := newTestLog(t)
+	appendAll(t, log, &Set{Key: "a", Value: "1"}, &Set{Key: "b", Value: "2"}, &Set{Key: "c", Value: "3"}, &Set{Key: "d", Value: "4"})
+	state := KV{}
+	assert.NoError(t, log.ReplayIndexRange(state, 1, 3))
+	assert.Equal(t, KV{"b": "2", "c": "3"}, state)
+	assert.NoError(t, log.Replay(state))
+	assert.Equal(t, KV{"b": "2", "c": "3", "d": "4"}, state)
+
+	state = KV{}
+	assert.NoError(t, log.ReplayIndexRange(state, 2, 10))
+	assert.Equal(t, KV{"c": "3", "d": "4"}, state)
+	state = KV{}
+	assert.NoError(t, log.ReplayIndexRange(state, 5, 10))
+	assert.Equal(t, KV{}, state)
+	assert.NoError(t, log.ReplayIndexRange(state, 2, 2))
+	assert.Equal(t, KV{}, state)
+
+	assert.EqualError(t, log.ReplayIndexRange(state, 3, 1), "invalid entry range [3, 1)")
+}
+
+func TestReplayMatching(t *testing.T) {
+	log := newTestLog(t)
+	appendAll(t, log, &Set{Key: "a", Value: "1"}, &Set{Key: "b", Value: "2"}, &Delete{Key: "a"}, &Set{Key: "ab", Value: "3"})
+	// A corrupt event is never decoded if it doesn't match.
+	f := log.f.(*os.File)
+	_, err := f.WriteString(`{"k":0,"e":{"k":1}}` + "\n")
+	assert.NoError(t, err)
+	var kinds []int
+	state := KV{}
+	err = log.ReplayMatching(state, func(kind int, raw json.RawMessage) bool {
+		kinds = append(kinds, kind)
+		return bytes.Contains(raw, []byte(`"a`))
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"ab": "3"}, state)
+	assert.Equal(t, []int{0, 0, 1, 0, 0}, kinds)
+
+	err = log.ReplayMatching(KV{}, func(int, json.RawMessage) bool { return true })
+	assert.Error(t, err)
+}
@@ -5,46 +5,169 @@
 // from the log by starting with an empty state, reading each operation
 // from the log, and applying it to the state until the final state is reached.
 //
-// The Log is NOT safe for concurrent use between multiple processes. It is safe
-// for concurrent use within a single Go process.
+// The Log is NOT safe for concurrent use between multiple processes unless
+// they all use WithExclusiveLock or WithSharedLock. It is safe for concurrent
+// use within a single Go process.
+//
+// The Log never accesses a State directly, other than through Op methods and
+// the optional interfaces documented on each method. Ops are applied
+// sequentially from the goroutine calling Replay, so a State that is read
+// concurrently with Replay only needs to be safe for a single writer and any
+// locking can be left to the Ops themselves.
 package replaylog
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"reflect"
 	"sync"
+	"time"
 )
 
+// ErrNotDurable is returned when an entry was written to the log, but the log
+// could not be synced to stable storage.
+//
+// The entry may or may not be present in the log after a crash.
+var ErrNotDurable = errors.New("log entry written but not synced")
+
+// ErrReadOnly is returned when attempting to modify a log opened WithReadOnly.
+var ErrReadOnly = errors.New("log is read-only")
+
+// ErrLogFull is returned when an append would grow the log beyond the size set
+// by WithMaxLogSize.
+var ErrLogFull = errors.New("log is full")
+
+// ErrSequenceMismatch is returned by Replay when an entry written
+// WithSequenceNumbers does not have the expected sequence number, indicating
+// that entries are missing, repeated or reordered.
+var ErrSequenceMismatch = errors.New("unexpected sequence number")
+
+// ErrStopReplay can be returned by an Op to stop Replay after it has been
+// applied, eg. if it supersedes every later op.
+//
+// Replay then returns nil rather than an error, and leaves the log positioned
+// after the Op, so a subsequent Replay continues from there. Use
+// ReplayResult.ReachedEOF from ReplayStats to distinguish this from reaching
+// the end of the log.
+var ErrStopReplay = errors.New("stop replay")
+
+// ErrNotSeekable is returned by operations that need to seek a File that does
+// not implement io.Seeker.
+var ErrNotSeekable = errors.New("log file is not seekable")
+
+// ErrApplyTimeout is returned by Replay when an Op takes longer to apply than
+// the duration set by WithApplyTimeout.
+var ErrApplyTimeout = errors.New("timed out applying op")
+
+// ErrWriteTimeout is returned by appends when writing to or syncing the log
+// takes longer than the duration set by WithWriteTimeout, and thereafter until
+// ResetDegraded is called.
+var ErrWriteTimeout = errors.New("timed out writing to log")
+
+var errDegraded = fmt.Errorf("%w: log is degraded by an earlier timeout", ErrWriteTimeout)
+
+// ErrStateTooLarge is returned by Replay when the State grows beyond the limit
+// set by WithStateSizeLimit.
+var ErrStateTooLarge = errors.New("state too large")
+
+// ErrReplayInProgress is returned by appends to a Log while it is being
+// replayed, as the replay would otherwise race with the write.
+var ErrReplayInProgress = errors.New("replay in progress")
+
 // Op to apply to mutate the State.
 type Op[State any] interface {
 	Apply(state State) error
 }
 
+// Resettable is an optional interface that State can implement to be cleared
+// before a Replay when the WithResetBeforeReplay option is used.
+type Resettable interface {
+	Reset()
+}
+
+// VersionedOp is an optional interface that an Op can implement to receive the
+// application version its entry was written with, as set by WithAppVersion.
+//
+// Entries written without an application version have version 0.
+type VersionedOp[State any] interface {
+	Op[State]
+	ApplyVersioned(version int, state State) error
+}
+
+// Grower is an optional interface that State can implement to pre-allocate
+// capacity before a Replay when the WithSizeHint option is used.
+type Grower interface {
+	// Grow the State to accommodate "hint" more ops.
+	Grow(hint int)
+}
+
 // Log for recording mutation operations on State.
 type Log[State any] struct {
 	lock   sync.Mutex
-	f      File
-	enc    *json.Encoder
+	f      seekFile
 	events map[reflect.Type]int
 	ops    []Op[State]
-}
-
-type entry struct {
-	Kind  int             `json:"k"`
-	Event json.RawMessage `json:"e"`
+	options
+	hooks          hooks[State]
+	subscribers    subscribers[State]
+	compressor     compressor
+	snapshots      periodicSnapshots[State]
+	pending        int      // Bytes written but not yet synced.
+	size           int64    // Size of the log, tracked if WithMaxLogSize or WithSizeWatcher is used.
+	entries        int      // Number of entries in the log, or -1 if not yet counted.
+	sinceMarker    int      // Entries appended since the last commit marker.
+	encoded        int      // Entries encoded but not yet written, for WithSequenceNumbers.
+	names          []string // Names of each kind, for a NamedLog.
+	kinds          map[string]int
+	trailerChecked bool        // True once any trailer has been removed before appending.
+	buf            WriteBuffer // Created on first use, see buffer.
+	lastOp         Op[State]   // Last op applied by a replay.
+	recent         recentOps[State]
+	staging        *os.File           // Staging file, for WithStagedWrites.
+	ids            opIDs              // IDs of IdentifiedOps, for AppendOnce.
+	degraded       bool               // True once a write has timed out, see WithWriteTimeout.
+	lastWrite      int64              // Bytes written by the last append, for WithVerifyOnAppend.
+	replays        int                // Replays in progress, see ErrReplayInProgress.
+	sizeAlerted    bool               // True once the log has grown past the WithSizeWatcher threshold.
+	lamport        uint64             // Last logical clock value, for WithLogicalClock.
+	lamportLoaded  bool               // True once lamport has been recovered from the log.
+	commits        groupCommit[State] // Rounds of WithGroupCommit.
+	lockFile       *os.File           // Lock file, for WithExclusiveLock and WithSharedLock.
+	synced         chan struct{}      // Closed after each sync that leaves nothing pending, for followers.
 }
 
 // The File interface required by the Log.
+//
+// Files should also implement io.Seeker. A File that doesn't is forward-only:
+// it can be replayed once from its current position and appended to, but
+// operations that need to seek elsewhere, such as Rewind, return an error
+// wrapping ErrNotSeekable.
+//
+// Files that implement Syncer are synced after every append. Files that don't,
+// such as in-memory buffers, are assumed to need no syncing.
 type File interface {
-	// Sync commits the current contents of the file to stable storage.
-	Sync() error
 	io.Reader
 	io.Writer
 	io.Closer
-	io.Seeker
+}
+
+// Syncer is an optional interface that a File can implement to be committed to
+// stable storage. *os.File implements it.
+type Syncer interface {
+	// Sync commits the current contents of the file to stable storage.
+	Sync() error
+}
+
+// syncFile syncs f if it implements Syncer.
+func syncFile(f File) error {
+	if s, ok := f.(Syncer); ok {
+		return s.Sync()
+	}
+	return nil
 }
 
 // New creates a new Log for recording mutation operations against the type State.
@@ -53,77 +176,1119 @@ type File interface {
 // following constraints: they must be in the same order between instantiations,
 // individual ops must not be removed, new op's must be appended, each op must be
 // JSON-encodable, and must be forwards and backwards compatible.
-func New[State any](f File, ops []Op[State]) (*Log[State], error) { // nolint: varnamelen
+func New[State any](f File, ops []Op[State], options ...Option) (*Log[State], error) { // nolint: varnamelen
 	eventTypes := make(map[reflect.Type]int, len(ops))
 	for i, op := range ops {
 		eventTypes[reflect.TypeOf(op)] = i
 	}
-	return &Log[State]{
-		f:      f,
-		ops:    ops,
-		enc:    json.NewEncoder(f),
-		events: eventTypes,
-	}, nil
+	l := &Log[State]{
+		f:       seekable(f),
+		ops:     ops,
+		events:  eventTypes,
+		entries: -1,
+	}
+	for _, option := range options {
+		if err := option(&l.options); err != nil {
+			return nil, err
+		}
+	}
+	if l.binaryFraming() {
+		switch {
+		case l.delimiter != 0:
+			return nil, errors.New("WithDelimiter can't be used with binary records")
+		case l.header:
+			return nil, errors.New("WithHeader can't be used with binary records")
+		case l.commitMarker:
+			return nil, errors.New("WithCommitMarker can't be used with binary records")
+		case l.trailer:
+			return nil, errors.New("WithTrailer can't be used with binary records")
+		}
+	}
+	if l.delimiter == 0 {
+		l.delimiter = '\n'
+	}
+	if l.zstdDictionary != nil {
+		if l.compression != CompressZstd {
+			return nil, fmt.Errorf("WithZstdDictionary requires %s compression but got %s", CompressZstd, l.compression)
+		}
+		l.compressor.dict = l.zstdDictionary
+	}
+	if l.binaryCodec() != nil {
+		if l.validateOps {
+			return nil, fmt.Errorf("WithValidateOps can't be used with codec %T", l.codec)
+		}
+		if l.schemas != nil {
+			return nil, fmt.Errorf("WithSchemas can't be used with codec %T", l.codec)
+		}
+	}
+	if l.onUnknownKind != nil && l.fallbackOp != nil {
+		return nil, errors.New("WithOnUnknownKind can't be combined with WithFallbackOp")
+	}
+	if l.validateOps {
+		if err := validateOps(ops); err != nil {
+			return nil, err
+		}
+	}
+	if l.mmap && !l.readOnly {
+		return nil, errors.New("WithMmap requires WithReadOnly")
+	}
+	for kind := range l.schemas {
+		if kind < 0 || kind >= len(ops) {
+			return nil, fmt.Errorf("WithSchemas: kind %d is not registered", kind)
+		}
+	}
+	for kind := range l.migrations {
+		if kind < 0 || kind >= len(ops) {
+			return nil, fmt.Errorf("WithMigrations: kind %d is not registered", kind)
+		}
+	}
+	for kind := range l.kindHandlers {
+		if kind < 0 || kind >= len(ops) {
+			return nil, fmt.Errorf("WithKindHandler: kind %d is not registered", kind)
+		}
+	}
+	var err error
+	if l.hooks, err = resolveHooks[State](&l.options); err != nil {
+		return nil, err
+	}
+	if l.autoSnapshot {
+		if l.hooks.snapshotMarshal, err = snapshotterMarshal[State](); err != nil {
+			return nil, err
+		}
+	}
+	if err := l.acquireFileLock(); err != nil {
+		return nil, err
+	}
+	if err := l.init(); err != nil {
+		l.releaseFileLock()
+		return nil, err
+	}
+	return l, nil
+}
+
+// init recovers and prepares the log for use once its options are applied.
+func (l *Log[State]) init() error {
+	if err := l.migrateFormat(); err != nil {
+		return err
+	}
+	if l.stagedWrites {
+		if l.readOnly || l.writeBuffer != nil {
+			return errors.New("WithStagedWrites can't be used with WithReadOnly or WithWriteBuffer")
+		}
+		if err := l.openStaging(); err != nil {
+			return err
+		}
+	}
+	if l.header {
+		if err := l.initHeader(); err != nil {
+			return err
+		}
+	}
+	if l.tracksSize() {
+		var err error
+		if l.size, err = l.fileSize(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Append an Op to the log.
+//
+// The log is synced before Append returns. To amortise the cost of syncing,
+// use AppendAtomic or a Batch to append several ops with a single sync, or
+// WithGroupCommit to share syncs between concurrent appends.
 func (l *Log[State]) Append(event Op[State]) error {
+	_, err := l.append(event)
+	return err
+}
+
+// append is Append, returning the op written after any WithAppendHook.
+func (l *Log[State]) append(event Op[State]) (Op[State], error) {
+	err := l.grouped(func() (err error) {
+		if event, err = l.appendHook(event); err != nil {
+			return err
+		}
+		return l.appendLocked(event)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// appendLocked writes a single op, which has already passed the append hook.
+// Must be called with the lock held.
+func (l *Log[State]) appendLocked(event Op[State]) error {
+	l.encoded = 0
+	data, err := l.encode(event)
+	if err != nil {
+		return err
+	}
+	if err := l.writeAndSync(data, 1); err != nil {
+		return err
+	}
+	if err := l.verifyAppended([]Op[State]{event}); err != nil {
+		return err
+	}
+	l.publish(event)
+	return nil
+}
+
+// appendHook passes event through the WithAppendHook, if any.
+func (l *Log[State]) appendHook(event Op[State]) (Op[State], error) {
+	if l.hooks.appendHook == nil {
+		return event, nil
+	}
+	hooked, err := l.hooks.appendHook(event)
+	if err != nil {
+		return nil, fmt.Errorf("append of %T rejected: %w", event, err)
+	}
+	return hooked, nil
+}
+
+// AppendAtomic appends multiple Ops to the log with a single write and sync.
+//
+// Every Op is encoded before anything is written, so if any Op fails to encode
+// none of them are appended. This does not protect against a crash part way
+// through the write. Consecutive Ops are first merged if WithCoalesce is used.
+func (l *Log[State]) AppendAtomic(events ...Op[State]) error {
+	_, err := l.appendAtomic(events)
+	return err
+}
+
+// appendAtomic is AppendAtomic, returning the ops written after any
+// WithAppendHook and WithCoalesce.
+func (l *Log[State]) appendAtomic(events []Op[State]) (written []Op[State], err error) {
+	err = l.grouped(func() error {
+		written, err = l.appendAtomicLocked(events)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return written, nil
+}
+
+// appendAtomicLocked is appendAtomic. Must be called with the lock held.
+func (l *Log[State]) appendAtomicLocked(events []Op[State]) ([]Op[State], error) {
+	l.encoded = 0
+	hooked := make([]Op[State], 0, len(events))
+	for _, event := range events {
+		event, err := l.appendHook(event)
+		if err != nil {
+			return nil, err
+		}
+		hooked = append(hooked, event)
+	}
+	events = l.coalesce(hooked)
+	var frames []byte
+	for _, event := range events {
+		data, err := l.encode(event)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, data...)
+	}
+	if len(frames) == 0 {
+		return nil, nil
+	}
+	if err := l.writeAndSync(frames, len(events)); err != nil {
+		return nil, err
+	}
+	if err := l.verifyAppended(events); err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		l.publish(event)
+	}
+	return events, nil
+}
+
+// coalesce consecutive events as configured by WithCoalesce.
+func (l *Log[State]) coalesce(events []Op[State]) []Op[State] {
+	if l.hooks.coalesce == nil || len(events) < 2 {
+		return events
+	}
+	out := []Op[State]{events[0]}
+	for _, event := range events[1:] {
+		if merged, ok := l.hooks.coalesce(out[len(out)-1], event); ok {
+			out[len(out)-1] = merged
+		} else {
+			out = append(out, event)
+		}
+	}
+	return out
+}
+
+// appendFrames writes and syncs pre-encoded entries to the log.
+func (l *Log[State]) appendFrames(frames []byte, entries int) error {
 	l.lock.Lock()
 	defer l.lock.Unlock()
+	return l.writeAndSync(frames, entries)
+}
+
+// writeAndSync writes "entries" framed entries to the log and syncs it. Must be
+// called with the lock held.
+func (l *Log[State]) writeAndSync(frames []byte, entries int) error {
+	return l.writeFrames(frames, entries, true)
+}
+
+// writeFrames writes "entries" framed entries to the log, syncing it if "sync"
+// is true or WithStagedWrites is used. Must be called with the lock held.
+func (l *Log[State]) writeFrames(frames []byte, entries int, sync bool) error {
+	defer func() { l.encoded = 0 }()
+	if l.readOnly {
+		return ErrReadOnly
+	}
+	if l.replays > 0 {
+		return ErrReplayInProgress
+	}
+	if l.degraded {
+		return errDegraded
+	}
+	if l.trailer && !l.trailerChecked {
+		if err := l.removeTrailer(); err != nil {
+			return err
+		}
+		l.trailerChecked = true
+	}
+	frames = l.withCommitMarker(frames, entries)
+	if l.maxLogSize > 0 && l.size+int64(len(frames)) > l.maxLogSize {
+		return fmt.Errorf("%w: appending %d bytes would exceed the maximum size of %d bytes", ErrLogFull, len(frames), l.maxLogSize)
+	}
+	sync = sync || l.staging != nil
+	deferred := sync && l.commits.deferring && l.staging == nil
+	if deferred {
+		sync = false
+	}
+	written := false
+	err := l.withWriteTimeout(func() error {
+		if l.staging != nil {
+			if err := l.stage(frames); err != nil {
+				return err
+			}
+		}
+		if err := l.write(frames); err != nil {
+			return err
+		}
+		written = true
+		if sync {
+			return l.sync()
+		}
+		return nil
+	})
+	if errors.Is(err, ErrWriteTimeout) || !written {
+		return err
+	}
+	l.size += int64(len(frames))
+	l.watchSize()
+	l.lastWrite = int64(len(frames))
+	l.pending += len(frames)
+	if l.entries >= 0 {
+		l.entries += entries
+	}
+	if err != nil {
+		return err
+	}
+	if sync {
+		l.pending = 0
+		l.notifySynced()
+	}
+	if deferred {
+		l.commits.join()
+	}
+	if l.staging != nil {
+		// The entries are durable, so failing to clear the staging file
+		// is harmless: recovery will find them already in the log.
+		_ = l.unstage()
+	}
+	l.periodicSnapshot(entries)
+	return nil
+}
+
+// tracksSize returns true if options require the size of the log to be
+// tracked.
+func (l *Log[State]) tracksSize() bool {
+	return l.maxLogSize > 0 || l.sizeWatcher != nil
+}
+
+// watchSize calls the WithSizeWatcher if the log has grown past its threshold.
+// Must be called with the lock held.
+func (l *Log[State]) watchSize() {
+	if l.sizeWatcher == nil {
+		return
+	}
+	if l.size < l.sizeThreshold {
+		l.sizeAlerted = false
+	} else if !l.sizeAlerted {
+		l.sizeAlerted = true
+		l.sizeWatcher(l.size)
+	}
+}
+
+// PendingBytes returns the number of bytes written to the log that have not
+// yet been synced to stable storage.
+//
+// This is non-zero only if a previous sync failed, or ops have been appended
+// with AppendNoSync since the last Barrier.
+func (l *Log[State]) PendingBytes() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.pending
+}
+
+// encode an Op into a framed log entry.
+func (l *Log[State]) encode(event Op[State]) ([]byte, error) {
+	e, err := l.newEntry(event)
+	if err != nil {
+		return nil, err
+	}
+	return l.encodeFrame(e)
+}
+
+// newEntry creates a log entry for an Op.
+func (l *Log[State]) newEntry(event Op[State]) (Frame, error) {
+	if err := l.assignID(event); err != nil {
+		return Frame{}, err
+	}
+	e, err := l.marshalEntry(event)
+	if err != nil {
+		return Frame{}, err
+	}
+	return l.stampEntry(e, event)
+}
+
+// marshalEntry creates a log entry containing only the kind and encoded event
+// of an Op.
+func (l *Log[State]) marshalEntry(event Op[State]) (Frame, error) {
 	kind, ok := l.events[reflect.TypeOf(event)]
 	if !ok {
-		return fmt.Errorf("unregistered event of type %T", event)
+		return Frame{}, fmt.Errorf("unregistered event of type %T", event)
 	}
-	data, err := json.Marshal(event)
+	data, err := l.marshalEvent(event)
 	if err != nil {
-		return fmt.Errorf("could not encode event of type %T: %w", event, err)
+		return Frame{}, fmt.Errorf("could not encode event of type %T: %w", event, err)
 	}
-	e := entry{Kind: kind, Event: data}
-	err = l.enc.Encode(e)
-	if err != nil {
-		return fmt.Errorf("failed to encode event: %w", err)
+	return Frame{Kind: kind, Event: data}, nil
+}
+
+// marshalEvent encodes an event with the codec of the log.
+func (l *Log[State]) marshalEvent(event any) (json.RawMessage, error) {
+	if codec := l.binaryCodec(); codec != nil {
+		return codec.Marshal(event)
+	}
+	return json.Marshal(event)
+}
+
+// stampEntry adds the metadata configured by options to a marshalled entry of
+// "event" that is about to be written.
+func (l *Log[State]) stampEntry(e Frame, event Op[State]) (Frame, error) {
+	e.Version = l.appVersion
+	if l.timestamps {
+		e.Time = l.clock().UnixNano()
+	}
+	if l.names != nil {
+		e.Name = l.names[e.Kind]
 	}
-	err = l.f.Sync()
+	if l.callerTracking {
+		e.Caller = caller()
+	}
+	if l.sequenceNumbers {
+		count, err := l.count()
+		if err != nil {
+			return Frame{}, err
+		}
+		l.encoded++
+		e.Seq = count + l.encoded
+	}
+	if l.logicalClock {
+		clock, err := l.tick(event)
+		if err != nil {
+			return Frame{}, err
+		}
+		e.Clock = clock
+	}
+	return e, nil
+}
+
+// encodeFrame encodes a log entry, compressing its event if configured.
+func (l *Log[State]) encodeFrame(e Frame) ([]byte, error) {
+	if l.compression != CompressNone && len(e.Event) > l.compressionThreshold {
+		compressed, err := l.compressor.compress(l.compression, l.compressionLevel, e.Event)
+		if err != nil {
+			return nil, fmt.Errorf("could not compress event of kind %d: %w", e.Kind, err)
+		}
+		e.Compression = l.compression.String()
+		if l.binaryFraming() {
+			e.Event = compressed
+			return l.encodeRecord(e)
+		}
+		// Compressed events in delimited frames are stored as base64
+		// encoded JSON strings.
+		if e.Event, err = json.Marshal(compressed); err != nil {
+			return nil, fmt.Errorf("could not encode compressed event of kind %d: %w", e.Kind, err)
+		}
+	} else if l.binaryFraming() {
+		return l.encodeRecord(e)
+	}
+	data, err := encodeFrame(e)
 	if err != nil {
-		return fmt.Errorf("failed to sync log: %w", err)
+		return nil, err
+	}
+	if l.entryChecksums {
+		return l.terminate(appendChecksum(data[:len(data)-1])), nil
+	}
+	data[len(data)-1] = l.delimiter
+	return data, nil
+}
+
+// terminate appends the delimiter of the log to a frame.
+func (l *Log[State]) terminate(frame []byte) []byte {
+	return append(frame, l.delimiter)
+}
+
+// write a framed entry to the log.
+func (l *Log[State]) write(frame []byte) error {
+	if _, err := l.buffer().Write(frame); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
 	}
 	return nil
 }
 
+// withWriteTimeout runs fn, which writes to or syncs the log, failing with
+// ErrWriteTimeout and degrading the log if it doesn't return within the
+// duration set by WithWriteTimeout. Must be called with the lock held.
+func (l *Log[State]) withWriteTimeout(fn func() error) error {
+	if l.writeTimeout <= 0 {
+		return fn()
+	}
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	timer := time.NewTimer(l.writeTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		l.degraded = true
+		return fmt.Errorf("%w after %s", ErrWriteTimeout, l.writeTimeout)
+	}
+}
+
+// Degraded returns true if a write has timed out, as configured by
+// WithWriteTimeout, so that appends fail until ResetDegraded is called.
+func (l *Log[State]) Degraded() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.degraded
+}
+
+// ResetDegraded allows appends to a log degraded by a write timeout to be
+// attempted again.
+//
+// The timed out write may have completed in the background, or may still be
+// in progress, so the log should be verified, eg. with Scan, before it is
+// trusted again.
+func (l *Log[State]) ResetDegraded() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.degraded = false
+}
+
+// sync the log to stable storage, retrying as configured by WithSyncRetry.
+func (l *Log[State]) sync() error {
+	attempts := l.syncAttempts
+	if attempts == 0 {
+		attempts = 1
+	}
+	buf := l.buffer()
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("failed to flush log: %w", err)
+	}
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(l.syncBackoff)
+		}
+		if err = buf.Sync(); err == nil {
+			return nil
+		}
+	}
+	if l.syncAttempts == 0 {
+		return fmt.Errorf("failed to sync log: %w", err)
+	}
+	return fmt.Errorf("%w: failed to sync log after %d attempts: %s", ErrNotDurable, attempts, err)
+}
+
 // Replay operations previously recorded into the log into "dest".
 //
-// After Replay, Append can be used to continue
+// After Replay the log is positioned at the end of the last entry, so Append
+// can be used to continue. Appends made while any replay of the log is in
+// progress fail with ErrReplayInProgress, except during ReplayAndContinue,
+// which blocks them until it completes.
 func (l *Log[State]) Replay(dest State) error {
-	dec := json.NewDecoder(l.f)
-	dec.DisallowUnknownFields()
+	defer l.startReplaying()()
+	if l.autoSnapshot {
+		pos, err := l.f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("failed to determine log position: %w", err)
+		}
+		if pos == 0 {
+			return l.replayFromStore(l.snapshotStore, restoreSnapshotter[State], dest)
+		}
+	}
+	return l.replayLog(dest)
+}
+
+// startReplaying marks a replay as in progress until the returned function is
+// called, so that appends are rejected rather than racing with it.
+func (l *Log[State]) startReplaying() func() {
+	l.lock.Lock()
+	l.replays++
+	l.lock.Unlock()
+	return func() {
+		l.lock.Lock()
+		l.replays--
+		l.lock.Unlock()
+	}
+}
+
+// replayLog is Replay without restoring from a WithSnapshotStore.
+func (l *Log[State]) replayLog(dest State) error {
+	r, err := l.startReplay(dest)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	return l.replay(r, dest)
+}
+
+// startReplay prepares dest for replay, returning a reader at the current
+// position of the log.
+func (l *Log[State]) startReplay(dest State) (*reader, error) {
+	if l.resetBeforeReplay {
+		if err := reset(dest); err != nil {
+			return nil, err
+		}
+	}
+	if grower, ok := any(dest).(Grower); ok && l.sizeHint {
+		hint, err := l.remaining()
+		if err != nil {
+			return nil, err
+		}
+		grower.Grow(hint)
+	}
+	if l.mmap {
+		if r, ok := l.mmapReader(); ok {
+			return r, nil
+		}
+	}
+	return l.currentReader()
+}
+
+// replay entries from r into dest until EOF.
+func (l *Log[State]) replay(r *reader, dest State) error {
+	_, err := l.replayUntil(r, dest, replayControl[State]{})
+	return err
+}
+
+// replayShadow is replay into a State maintained internally by the log.
+func (l *Log[State]) replayShadow(r *reader, dest State) error {
+	_, err := l.replayUntil(r, dest, replayControl[State]{shadow: true})
+	return err
+}
+
+// replayControl customises which entries replayUntil applies, and when it stops.
+type replayControl[State any] struct {
+	// stop replay if it returns true after applying an op.
+	stop func(op Op[State]) bool
+	// accept is called for each entry before it is decoded. If "apply" is
+	// false the entry is skipped, and if "more" is false replay stops
+	// before the entry.
+	accept func(logEntry Frame) (apply, more bool)
+	// stats, if non-nil, accumulates counts of applied entries.
+	stats *ReplayResult
+	// dispatch, if non-nil, is called with each decoded op instead of
+	// applying it to dest.
+	dispatch func(logEntry Frame, op, parent Op[State]) error
+	// keep, if non-nil, skips decoded ops for which it returns false.
+	keep func(op Op[State]) bool
+	// shadow is true when replaying into a State maintained internally by
+	// the log, so LastOp and Recent are not updated.
+	shadow bool
+}
+
+// replayUntil replays entries from r into dest until EOF, or until stopped by
+// "ctl". If stopped, the log is positioned after the last consumed entry and
+// replayUntil returns true.
+func (l *Log[State]) replayUntil(r *reader, dest State, ctl replayControl[State]) (bool, error) {
+	// Offsets of each entry, used to look up parents if replaying from the
+	// start of the log.
+	var offsets []int64
+	seq := 0 // Sequence number of the previous entry, if any.
+	var deadline time.Time
+	if l.replayDeadline > 0 && l.observer.OnSlowReplay != nil {
+		deadline = time.Now().Add(l.replayDeadline)
+	}
+	applied := 0
+	if r.offset == 0 && !ctl.shadow {
+		l.recent.reset()
+	}
+	// Only replays that see every entry can collect the IDs for AppendOnce.
+	trackIDs := !ctl.shadow && ctl.accept == nil
+	if r.offset == 0 && trackIDs {
+		l.ids.reset()
+	}
+	var sandboxed *sandbox[State]
+	if l.sandboxedReplay && !ctl.shadow && ctl.dispatch == nil {
+		sandboxed = &sandbox[State]{a: newState[State](), b: newState[State]()}
+	}
+	// applyEntry applies a decoded op, returning true if replay should stop
+	// after it.
+	applyEntry := func(index int, offset int64, logEntry Frame, event, parent Op[State]) (bool, error) {
+		if sandboxed != nil {
+			if err := l.applySandboxed(sandboxed, index, logEntry, parent); err != nil {
+				return false, l.applyFailed(ctl, index, offset, logEntry, event, err)
+			}
+		}
+		var err error
+		if ctl.dispatch != nil {
+			err = ctl.dispatch(logEntry, event, parent)
+		} else {
+			err = l.apply(logEntry, event, parent, dest)
+		}
+		stopped := errors.Is(err, ErrStopReplay)
+		if err != nil && !stopped {
+			err = fmt.Errorf("could not apply event %d of type %T: %w", index, event, err)
+			return false, l.applyFailed(ctl, index, offset, logEntry, event, err)
+		}
+		applied++
+		if !ctl.shadow {
+			l.lastOp = event
+			l.recent.push(l.recentCache, event)
+		}
+		if ctl.stats != nil {
+			ctl.stats.Applied++
+			ctl.stats.Kinds[logEntry.Kind]++
+		}
+		if err := l.checkStateSize(ctl, dest, applied); err != nil {
+			if rerr := l.reposition(r); rerr != nil {
+				return false, rerr
+			}
+			return false, fmt.Errorf("after event %d: %w", index, err)
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			l.observer.OnSlowReplay(time.Since(deadline)+l.replayDeadline, applied)
+			deadline = time.Time{}
+		}
+		return stopped || (ctl.stop != nil && ctl.stop(event)), nil
+	}
+	// Ops in a group written by AppendGroup are only applied once every
+	// entry in the group has been read.
+	var group replayGroup[State]
 	for {
-		logEntry := entry{}
-		err := dec.Decode(&logEntry)
+		logEntry, err := l.nextEntry(r)
 		if errors.Is(err, io.EOF) {
-			break
+			if group.remaining > 0 {
+				err = fmt.Errorf("%w: group of %d entries starting at entry %d has only %d", ErrIncompleteGroup, group.size, group.first, group.size-group.remaining)
+				return false, l.replayError(ctl, &ReplayError{Index: group.first, Offset: group.start, Kind: -1, Category: ErrorDecode, Err: err})
+			}
+			if stopped, err := group.flush(applyEntry); err != nil || stopped {
+				return stopped, err
+			}
+			// Don't rely on the File position after EOF, as it may have
+			// been affected by buffering.
+			if trackIDs && l.ids.seen != nil {
+				l.ids.complete = true
+			}
+			return false, l.reposition(r)
+		}
+		if err != nil {
+			category := ErrorDecode
+			if errors.Is(err, errUnknownName) {
+				category = ErrorUnknownKind
+			}
+			return false, l.replayError(ctl, &ReplayError{Index: r.index - 1, Offset: r.start, Kind: -1, Category: category, Err: err})
+		}
+		if group.remaining == 0 {
+			// The last entry of a group was skipped.
+			if stopped, err := group.flush(applyEntry); err != nil {
+				return false, err
+			} else if stopped {
+				r.offset = r.start
+				return true, l.reposition(r)
+			}
+		}
+		if r.version != 0 {
+			offsets = append(offsets, r.start)
+		}
+		if err := checkSeq(r, logEntry, &seq); err != nil {
+			return false, l.replayError(ctl, l.entryError(r, logEntry, ErrorChecksum, err))
+		}
+		if err := group.add(r, &logEntry); err != nil {
+			return false, l.replayError(ctl, l.entryError(r, logEntry, ErrorDecode, err))
+		}
+		if l.onUnknownKind != nil && !l.knownKind(logEntry.Kind) {
+			if err := l.onUnknownKind(logEntry.Kind, logEntry.Event); err != nil {
+				return false, l.replayError(ctl, l.entryError(r, logEntry, ErrorUnknownKind, err))
+			}
+			continue
+		}
+		if l.unknownKinds == SkipUnknown && l.hooks.fallbackOp == nil && !l.knownKind(logEntry.Kind) {
+			continue
+		}
+		if ctl.accept != nil {
+			apply, more := ctl.accept(logEntry)
+			if !more {
+				// Stop before the whole group, so it is replayed together.
+				r.offset = r.start
+				if logEntry.Group > 0 {
+					r.offset = group.start
+				}
+				return true, l.reposition(r)
+			}
+			if !apply {
+				continue
+			}
+		}
+		if l.hooks.fallbackOp != nil && !l.knownKind(logEntry.Kind) {
+			if ctl.dispatch != nil {
+				continue
+			}
+			if err := l.hooks.fallbackOp.ApplyRaw(logEntry.Kind, logEntry.Event, dest); err != nil {
+				err = fmt.Errorf("could not apply event %d of unknown kind %d: %w", r.index-1, logEntry.Kind, err)
+				return false, l.replayError(ctl, l.entryError(r, logEntry, ErrorApply, err))
+			}
+			continue
 		}
+		event, err := l.decodeOp(logEntry)
 		if err != nil {
-			return fmt.Errorf("corrupt log entry: %w", err)
+			category := ErrorDecode
+			if !l.knownKind(logEntry.Kind) {
+				category = ErrorUnknownKind
+			}
+			return false, l.replayError(ctl, l.entryError(r, logEntry, category, err))
 		}
-		opType := reflect.TypeOf(l.ops[logEntry.Kind])
-		var event Op[State]
-		if opType.Kind() == reflect.Ptr {
-			event = reflect.New(opType.Elem()).Interface().(Op[State])
+		l.reassignID(r, logEntry, event)
+		if trackIDs {
+			l.ids.add(event)
+		}
+		if l.hooks.replayFilter != nil && !l.hooks.replayFilter(event) {
+			continue
+		}
+		if ctl.keep != nil && !ctl.keep(event) {
+			continue
+		}
+		var parent Op[State]
+		if _, ok := event.(ParentedOp[State]); ok && logEntry.Parent != nil {
+			if parent, err = l.parentOp(offsets, *logEntry.Parent); err != nil {
+				return false, l.replayError(ctl, l.entryError(r, logEntry, ErrorDecode, fmt.Errorf("entry %d: %w", r.index-1, err)))
+			}
+		}
+		var stopped bool
+		if logEntry.Group > 0 {
+			group.members = append(group.members, groupMember[State]{r.index - 1, r.start, logEntry, event, parent})
+			if group.remaining > 0 {
+				continue
+			}
+			stopped, err = group.flush(applyEntry)
 		} else {
-			event = reflect.New(opType).Elem().Interface().(Op[State])
+			stopped, err = applyEntry(r.index-1, r.start, logEntry, event, parent)
+		}
+		if err != nil {
+			return false, err
+		}
+		if stopped {
+			return true, l.reposition(r)
+		}
+	}
+}
+
+// replayError reports err to Observer.OnReplayError, returning it.
+func (l *Log[State]) replayError(ctl replayControl[State], err *ReplayError) error {
+	if !ctl.shadow && l.observer.OnReplayError != nil {
+		l.observer.OnReplayError(err.Index, err.Category, err.Err)
+	}
+	return err
+}
+
+// entryError returns a ReplayError for the entry just read by r.
+func (l *Log[State]) entryError(r *reader, logEntry Frame, category ErrorCategory, err error) *ReplayError {
+	return &ReplayError{Index: r.index - 1, Offset: r.start, Kind: logEntry.Kind, Category: category, Err: err}
+}
+
+// applyFailed handles an error applying the op of the entry at "index" with
+// the WithOnApplyError hook, if any, returning nil if the op should be
+// skipped.
+func (l *Log[State]) applyFailed(ctl replayControl[State], index int, offset int64, logEntry Frame, op Op[State], err error) error {
+	if l.hooks.onApplyError != nil {
+		if err = l.hooks.onApplyError(index, op, err); err == nil {
+			return nil
+		}
+	}
+	return l.replayError(ctl, &ReplayError{Index: index, Offset: offset, Kind: logEntry.Kind, Category: ErrorApply, Err: err})
+}
+
+// checkStateSize enforces WithStateSizeLimit once "applied" ops have been
+// applied to dest.
+func (l *Log[State]) checkStateSize(ctl replayControl[State], dest State, applied int) error {
+	if l.hooks.stateSize == nil || ctl.dispatch != nil {
+		return nil
+	}
+	if l.stateSizeEvery > 1 && applied%l.stateSizeEvery != 0 {
+		return nil
+	}
+	if size := l.hooks.stateSize(dest); size > l.stateSizeLimit {
+		return fmt.Errorf("%w: size %d exceeds limit %d", ErrStateTooLarge, size, l.stateSizeLimit)
+	}
+	return nil
+}
+
+// checkSeq verifies the sequence number of logEntry, if it has one, against
+// its position in the log or the sequence number of the previous entry.
+func checkSeq(r *reader, logEntry Frame, prev *int) error {
+	if logEntry.Seq == 0 {
+		*prev = 0
+		return nil
+	}
+	expected := *prev + 1
+	if r.version != 0 {
+		expected = r.index
+	}
+	if (r.version != 0 || *prev != 0) && logEntry.Seq != expected {
+		return fmt.Errorf("%w: entry %d has sequence number %d, expected %d", ErrSequenceMismatch, r.index-1, logEntry.Seq, expected)
+	}
+	*prev = logEntry.Seq
+	return nil
+}
+
+// apply a decoded op to dest, retrying as configured by WithApplyRetry.
+func (l *Log[State]) apply(logEntry Frame, op, parent Op[State], dest State) error {
+	for attempt := 1; ; attempt++ {
+		err := l.applyWithTimeout(logEntry, op, parent, dest)
+		if err == nil || errors.Is(err, ErrStopReplay) || attempt >= l.applyAttempts {
+			return err
+		}
+		if l.retryable != nil && !l.retryable(err) {
+			return err
+		}
+		if l.applyBackoff != nil {
+			time.Sleep(l.applyBackoff(attempt))
+		}
+	}
+}
+
+// applyWithTimeout applies a decoded op to dest, subject to WithApplyTimeout.
+func (l *Log[State]) applyWithTimeout(logEntry Frame, op, parent Op[State], dest State) error {
+	if l.applyTimeout <= 0 {
+		return l.applyOp(logEntry, op, parent, dest)
+	}
+	done := make(chan error, 1)
+	go func() { done <- l.applyOp(logEntry, op, parent, dest) }()
+	timer := time.NewTimer(l.applyTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("%w after %s", ErrApplyTimeout, l.applyTimeout)
+	}
+}
+
+func (l *Log[State]) applyOp(logEntry Frame, op, parent Op[State], dest State) error {
+	if logEntry.Reset {
+		if err := reset(dest); err != nil {
+			return err
+		}
+	}
+	if handler, ok := l.hooks.kindHandlers[logEntry.Kind]; ok {
+		return handler(op, dest)
+	}
+	if parented, ok := op.(ParentedOp[State]); ok && parent != nil {
+		return parented.ApplyWithParent(parent, dest)
+	}
+	if grouped, ok := op.(GroupedOp[State]); ok && logEntry.Group > 0 {
+		return grouped.ApplyInGroup(logEntry.GroupContext, dest)
+	}
+	if clocked, ok := op.(ClockedOp[State]); ok {
+		return clocked.ApplyWithClock(logEntry.Clock, dest)
+	}
+	if versioned, ok := op.(VersionedOp[State]); ok {
+		return versioned.ApplyVersioned(logEntry.Version, dest)
+	}
+	return op.Apply(dest)
+}
+
+// nextEntry reads and decodes the next entry from r.
+func (l *Log[State]) nextEntry(r *reader) (Frame, error) {
+	frame, err := r.next()
+	if err != nil {
+		return Frame{}, err
+	}
+	return l.decodeEntry(frame)
+}
+
+// errUnknownName is returned by decodeEntry for an entry of a NamedLog with a
+// name that is not registered.
+var errUnknownName = errors.New("unknown event name")
+
+// decodeEntry decodes a single framed log entry.
+func (l *Log[State]) decodeEntry(data []byte) (Frame, error) {
+	frame, err := l.decodeFrame(data)
+	if err != nil || l.kinds == nil {
+		return frame, err
+	}
+	name := frame.Name
+	if name == "" {
+		if l.legacyKinds == nil {
+			return frame, fmt.Errorf("entry of kind %d has no name, use MigrateToNamed or WithLegacyKinds to read positional logs", frame.Kind)
+		}
+		if frame.Kind >= 0 && frame.Kind < len(l.legacyKinds) {
+			name = l.legacyKinds[frame.Kind]
+		}
+		if name == "" && !l.skipUnknown() {
+			return frame, fmt.Errorf("unknown legacy event kind %d", frame.Kind)
 		}
-		err = json.Unmarshal(logEntry.Event, event)
+	}
+	kind, ok := l.kinds[name]
+	if !ok && l.skipUnknown() {
+		frame.Kind = -1
+		return frame, nil
+	} else if !ok {
+		return frame, fmt.Errorf("%w %q", errUnknownName, name)
+	}
+	frame.Kind = kind
+	return frame, nil
+}
+
+// decodeFrame decodes a single frame of the log, as a binary record
+// WithBinaryRecords.
+func (l *Log[State]) decodeFrame(data []byte) (Frame, error) {
+	if l.binaryFraming() {
+		return l.decodeRecord(data)
+	}
+	return decodeFrame(data, &l.compressor)
+}
+
+// skipUnknown returns true if entries of unknown kinds are not an error, either
+// because they are skipped or passed to a WithFallbackOp or WithOnUnknownKind.
+func (l *Log[State]) skipUnknown() bool {
+	return l.unknownKinds == SkipUnknown || l.hooks.fallbackOp != nil || l.onUnknownKind != nil
+}
+
+// knownKind returns true if kind is registered with the log.
+func (l *Log[State]) knownKind(kind int) bool {
+	return kind >= 0 && kind < len(l.ops)
+}
+
+// decodeOp decodes the event in a log entry into its registered Op type.
+func (l *Log[State]) decodeOp(logEntry Frame) (Op[State], error) {
+	if !l.knownKind(logEntry.Kind) {
+		return nil, fmt.Errorf("unknown event kind %d", logEntry.Kind)
+	}
+	if l.eventTransform != nil {
+		event, err := l.eventTransform(logEntry.Kind, logEntry.Event)
 		if err != nil {
-			return fmt.Errorf("could not decode event of kind %d into type %s: %w", logEntry.Kind, opType, err)
+			return nil, fmt.Errorf("could not transform event of kind %d: %w", logEntry.Kind, err)
 		}
-		err = event.Apply(dest)
+		logEntry.Event = event
+	}
+	if migrate, ok := l.migrations[logEntry.Kind]; ok {
+		event, err := migrate(logEntry.Event)
 		if err != nil {
-			return fmt.Errorf("could not apply event: %w", err)
+			return nil, fmt.Errorf("could not migrate event of kind %d: %w", logEntry.Kind, err)
+		}
+		logEntry.Event = event
+	}
+	if err := l.validateSchema(logEntry); err != nil {
+		return nil, err
+	}
+	opType := reflect.TypeOf(l.ops[logEntry.Kind])
+	var ptr reflect.Value
+	if opType.Kind() == reflect.Ptr {
+		ptr = reflect.New(opType.Elem())
+	} else {
+		ptr = reflect.New(opType)
+	}
+	err := l.unmarshalEvent(logEntry.Event, ptr.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("could not decode event of kind %d into type %s: %w", logEntry.Kind, opType, err)
+	}
+	if opType.Kind() == reflect.Ptr {
+		return ptr.Interface().(Op[State]), nil
+	}
+	return ptr.Elem().Interface().(Op[State]), nil
+}
+
+// unmarshalEvent decodes an event, subject to WithCodec and WithUseNumber.
+func (l *Log[State]) unmarshalEvent(data []byte, v any) error {
+	if codec := l.binaryCodec(); codec != nil {
+		return codec.Unmarshal(data, v)
+	}
+	if !l.useNumber {
+		return json.Unmarshal(data, v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// validateOps checks that a zero value of each op can be JSON encoded.
+func validateOps[State any](ops []Op[State]) error {
+	for kind, op := range ops {
+		t := reflect.TypeOf(op)
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if _, err := json.Marshal(reflect.New(t).Interface()); err != nil {
+			return fmt.Errorf("op %d of type %T can't be encoded: %w", kind, op, err)
 		}
 	}
 	return nil
 }
 
+// reset dest to its empty state.
+func reset(dest any) error {
+	if r, ok := dest.(Resettable); ok {
+		r.Reset()
+		return nil
+	}
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Map || v.IsNil() {
+		return fmt.Errorf("can't reset state of type %T, it must be a non-nil map or implement Resettable", dest)
+	}
+	for _, key := range v.MapKeys() {
+		v.SetMapIndex(key, reflect.Value{})
+	}
+	return nil
+}
+
+// OpTypes returns the registered Op types, indexed by kind.
+func (l *Log[State]) OpTypes() []reflect.Type {
+	types := make([]reflect.Type, len(l.ops))
+	for i, op := range l.ops {
+		types[i] = reflect.TypeOf(op)
+	}
+	return types
+}
+
+// fileSize returns the size of the log File, preserving its position.
+func (l *Log[State]) fileSize() (int64, error) {
+	pos, err := l.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, fmt.Errorf("failed to determine log position: %w", err)
+	}
+	size, err := l.f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, fmt.Errorf("failed to determine log size: %w", err)
+	}
+	if _, err := l.f.Seek(pos, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to restore log position: %w", err)
+	}
+	return size, nil
+}
+
 // Rewind to beginning of log.
 func (l *Log[State]) Rewind() error {
 	_, err := l.f.Seek(0, io.SeekStart)
@@ -134,6 +1299,56 @@ func (l *Log[State]) Rewind() error {
 }
 
 // Close the Log file.
+//
+// Unless the log is read-only, any buffered writes are first flushed and the
+// File synced, unless WithSkipCloseSync is used. If WithCommitMarker is used,
+// a commit marker is appended to the log beforehand, followed by a trailer if
+// WithTrailer is used. The File is closed regardless, and the first error
+// encountered is returned.
 func (l *Log[State]) Close() error {
-	return l.f.Close()
+	var err error
+	if !l.readOnly {
+		l.lock.Lock()
+		if l.degraded {
+			err = errDegraded
+		} else {
+			err = l.finish()
+		}
+		l.lock.Unlock()
+	}
+	if l.staging != nil {
+		_ = l.staging.Close()
+	}
+	if cerr := l.f.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	l.releaseFileLock()
+	return err
+}
+
+// finish writes the commit marker and trailer to the end of the log, as
+// configured, then flushes and syncs it. Must be called with the lock held.
+func (l *Log[State]) finish() error {
+	if l.trailer {
+		if err := l.removeTrailer(); err != nil {
+			return err
+		}
+	}
+	if l.commitMarker {
+		if err := l.closeWithMarker(); err != nil {
+			return fmt.Errorf("failed to write commit marker: %w", err)
+		}
+	}
+	if l.trailer {
+		if err := l.writeTrailer(); err != nil {
+			return fmt.Errorf("failed to write trailer: %w", err)
+		}
+	}
+	if l.skipCloseSync && l.pending == 0 {
+		if err := l.buffer().Flush(); err != nil {
+			return fmt.Errorf("failed to flush log: %w", err)
+		}
+		return nil
+	}
+	return l.sync()
 }
@@ -1,8 +1,12 @@
 package replaylog
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/alecthomas/assert/v2"
@@ -99,3 +103,155 @@ func TestLog(t *testing.T) {
 		})
 	})
 }
+
+// newTestLog creates a Log[KV] backed by a temporary file.
+func newTestLog(t *testing.T, options ...Option) *Log[KV] {
+	t.Helper()
+	f, err := ioutil.TempFile(t.TempDir(), "")
+	assert.NoError(t, err)
+	log, err := New[KV](f, ops, options...)
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = log.Close() })
+	return log
+}
+
+// appendAll appends ops to log, failing the test on error.
+func appendAll(t *testing.T, log *Log[KV], ops ...Op[KV]) {
+	t.Helper()
+	for _, op := range ops {
+		err := log.Append(op)
+		assert.NoError(t, err)
+	}
+}
+
+// replay rewinds log and replays it into a fresh KV.
+func replay(t *testing.T, log *Log[KV]) KV {
+	t.Helper()
+	err := log.Rewind()
+	assert.NoError(t, err)
+	state := KV{}
+	err = log.Replay(state)
+	assert.NoError(t, err)
+	return state
+}
+
+type unencodable struct {
+	C chan int
+}
+
+func (u *unencodable) Apply(state KV) error { return nil }
+
+func TestAppendAtomic(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "")
+	assert.NoError(t, err)
+	log, err := New[KV](f, []Op[KV]{&Set{}, &Delete{}, &unencodable{}})
+	assert.NoError(t, err)
+	defer log.Close()
+
+	err = log.AppendAtomic(&Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"})
+	assert.NoError(t, err)
+	err = log.AppendAtomic(&Delete{Key: "foo"}, &Set{Key: "waz", Value: "foo"}, &unencodable{C: make(chan int)})
+	assert.Error(t, err)
+	assert.Equal(t, 0, log.PendingBytes())
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, replay(t, log))
+}
+
+func TestOpTypes(t *testing.T) {
+	log := newTestLog(t)
+	assert.Equal(t, []reflect.Type{reflect.TypeOf(&Set{}), reflect.TypeOf(&Delete{})}, log.OpTypes())
+}
+
+// readAheadFile is a File whose position overshoots the end of the data when a
+// Read reaches EOF, as some buffered File implementations do.
+type readAheadFile struct {
+	MemoryFile
+}
+
+func (f *readAheadFile) Read(p []byte) (int, error) {
+	n, err := f.MemoryFile.Read(p)
+	if errors.Is(err, io.EOF) {
+		f.pos += 16
+	}
+	return n, err
+}
+
+func TestAppendAfterReplayWithReadAhead(t *testing.T) {
+	f := &readAheadFile{}
+	log, err := New[KV](f, ops)
+	assert.NoError(t, err)
+	assert.NoError(t, log.Append(&Set{Key: "foo", Value: "bar"}))
+	assert.NoError(t, log.Rewind())
+	assert.NoError(t, log.Replay(KV{}))
+	assert.NoError(t, log.Append(&Set{Key: "bar", Value: "waz"}))
+	assert.Equal(t, `{"k":0,"e":{"k":"foo","v":"bar"}}`+"\n"+`{"k":0,"e":{"k":"bar","v":"waz"}}`+"\n", string(f.data))
+}
+
+// stopOp stops replay after applying.
+type stopOp struct{}
+
+func (stopOp) Apply(state KV) error {
+	state["stopped"] = "true"
+	return fmt.Errorf("superseded: %w", ErrStopReplay)
+}
+
+func TestErrStopReplay(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "")
+	assert.NoError(t, err)
+	log, err := New[KV](f, []Op[KV]{&Set{}, stopOp{}})
+	assert.NoError(t, err)
+	defer log.Close()
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, stopOp{}, &Set{Key: "bar", Value: "waz"})
+	assert.NoError(t, log.Rewind())
+	state := KV{}
+	err = log.Replay(state)
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"foo": "bar", "stopped": "true"}, state)
+	err = log.Replay(state)
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"foo": "bar", "stopped": "true", "bar": "waz"}, state)
+}
+
+func TestErrReplayInProgress(t *testing.T) {
+	replaying := make(chan struct{})
+	release := make(chan struct{})
+	log, err := New[KV](&MemoryFile{}, ops, WithReplayFilter(func(op Op[KV]) bool {
+		if set, ok := op.(*Set); ok && set.Key == "block" {
+			close(replaying)
+			<-release
+		}
+		return true
+	}))
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "block", Value: "1"})
+	assert.NoError(t, log.Rewind())
+	state := KV{}
+	done := make(chan error)
+	go func() { done <- log.Replay(state) }()
+	<-replaying
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() { errs <- log.Append(&Set{Key: "late", Value: "2"}) }()
+	}
+	for i := 0; i < cap(errs); i++ {
+		assert.True(t, errors.Is(<-errs, ErrReplayInProgress))
+	}
+	close(release)
+	assert.NoError(t, <-done)
+	assert.Equal(t, KV{"block": "1"}, state)
+	assert.NoError(t, log.Append(&Set{Key: "late", Value: "2"}))
+}
+
+// unsyncedFile is a File that does not implement Syncer.
+type unsyncedFile struct {
+	io.ReadWriteSeeker
+}
+
+func (unsyncedFile) Close() error { return nil }
+
+func TestFileWithoutSync(t *testing.T) {
+	f := unsyncedFile{&MemoryFile{}}
+	log, err := New[KV](f, ops, WithSyncRetry(3, 0))
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"})
+	assert.Equal(t, KV{"foo": "bar"}, replay(t, log))
+}
@@ -0,0 +1,41 @@
+// Package replaylogtest provides helpers for testing the Ops of a replaylog.
+package replaylogtest
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/alecthomas/replaylog"
+)
+
+// AssertCodecRoundtrip encodes op with each of "codecs" and decodes it back
+// into a new value of the same type, returning an error if any decoded value
+// is not deeply equal to op.
+//
+// This catches fields that one codec handles but another does not, before a
+// log is transcoded between them.
+func AssertCodecRoundtrip[State any](op replaylog.Op[State], codecs ...replaylog.Codec) error {
+	t := reflect.TypeOf(op)
+	for i, codec := range codecs {
+		data, err := codec.Marshal(op)
+		if err != nil {
+			return fmt.Errorf("codec %d (%T): failed to encode %T: %w", i, codec, op, err)
+		}
+		var decoded reflect.Value
+		if t.Kind() == reflect.Ptr {
+			decoded = reflect.New(t.Elem())
+		} else {
+			decoded = reflect.New(t)
+		}
+		if err := codec.Unmarshal(data, decoded.Interface()); err != nil {
+			return fmt.Errorf("codec %d (%T): failed to decode %T: %w", i, codec, op, err)
+		}
+		if t.Kind() != reflect.Ptr {
+			decoded = decoded.Elem()
+		}
+		if !reflect.DeepEqual(op, decoded.Interface()) {
+			return fmt.Errorf("codec %d (%T): %T does not round trip: encoded %+v but decoded %+v", i, codec, op, op, decoded.Interface())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package replaylogtest
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/alecthomas/replaylog"
+)
+
+type KV map[string]string
+
+type Set struct {
+	Key   string `json:"k"`
+	Value string `json:"v"`
+	// Cached is not encoded as JSON, but is by gob.
+	Cached int `json:"-"`
+}
+
+func (s *Set) Apply(state KV) error {
+	state[s.Key] = s.Value
+	return nil
+}
+
+func TestAssertCodecRoundtrip(t *testing.T) {
+	err := AssertCodecRoundtrip[KV](&Set{Key: "foo", Value: "bar"}, replaylog.JSONCodec{}, replaylog.GobCodec{})
+	assert.NoError(t, err)
+
+	err = AssertCodecRoundtrip[KV](&Set{Key: "foo", Value: "bar", Cached: 1}, replaylog.GobCodec{}, replaylog.JSONCodec{})
+	assert.EqualError(t, err, "codec 1 (replaylog.JSONCodec): *replaylogtest.Set does not round trip: encoded &{Key:foo Value:bar Cached:1} but decoded &{Key:foo Value:bar Cached:0}")
+}
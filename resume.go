@@ -0,0 +1,97 @@
+package replaylog
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ResumeToken records the position reached by ReplayChunk.
+//
+// The zero value starts from the beginning of the log. Tokens are comparable,
+// and can be persisted with MarshalText and UnmarshalText.
+//
+// A token also records the SchemaFingerprint of the log it was created from,
+// since its offset may refer to a different entry once the ops change.
+type ResumeToken struct {
+	offset      int64
+	index       int
+	fingerprint string
+}
+
+// Index of the next entry to be replayed.
+func (t ResumeToken) Index() int { return t.index }
+
+func (t ResumeToken) MarshalText() ([]byte, error) {
+	if t.fingerprint == "" {
+		return []byte(fmt.Sprintf("%d.%d", t.offset, t.index)), nil
+	}
+	return []byte(fmt.Sprintf("%d.%d.%s", t.offset, t.index, t.fingerprint)), nil
+}
+
+func (t *ResumeToken) UnmarshalText(text []byte) error {
+	parts := strings.SplitN(string(text), ".", 3)
+	if len(parts) < 2 {
+		return fmt.Errorf("invalid resume token %q", text)
+	}
+	token := ResumeToken{}
+	var err error
+	if token.offset, err = strconv.ParseInt(parts[0], 10, 64); err != nil {
+		return fmt.Errorf("invalid resume token %q: %w", text, err)
+	}
+	if token.index, err = strconv.Atoi(parts[1]); err != nil {
+		return fmt.Errorf("invalid resume token %q: %w", text, err)
+	}
+	if token.offset < 0 || token.index < 0 {
+		return fmt.Errorf("invalid resume token %q", text)
+	}
+	if len(parts) == 3 {
+		token.fingerprint = parts[2]
+	}
+	*t = token
+	return nil
+}
+
+// ReplayChunk replays up to "maxEntries" entries into dest, starting from the
+// position recorded in "token", and returns a token for the next chunk.
+//
+// The returned token is equal to "token" once the end of the log is reached.
+// The position of the log is preserved, so chunks may be replayed while
+// appending.
+//
+// If "token" was created by a log with a different SchemaFingerprint, or
+// before tokens recorded one, an error wrapping ErrSchemaMismatch is returned
+// and nothing is replayed. The caller must then replay from the zero value.
+func (l *Log[State]) ReplayChunk(dest State, token ResumeToken, maxEntries int) (ResumeToken, error) {
+	defer l.startReplaying()()
+	if maxEntries < 1 {
+		return token, fmt.Errorf("maxEntries must be at least 1 but got %d", maxEntries)
+	}
+	fingerprint := l.SchemaFingerprint()
+	if token != (ResumeToken{}) && token.fingerprint != fingerprint {
+		return token, fmt.Errorf("%w: resume token is for schema %q but log has %q", ErrSchemaMismatch, token.fingerprint, fingerprint)
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	next := token
+	err := l.rewound(func(*reader) error {
+		if _, err := l.f.Seek(token.offset, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek to resume token: %w", err)
+		}
+		r := l.newReader(l.f, token.offset)
+		seen := 0
+		_, err := l.replayUntil(r, dest, replayControl[State]{
+			accept: func(Frame) (apply, more bool) {
+				seen++
+				return true, seen <= maxEntries
+			},
+		})
+		if err != nil {
+			return err
+		}
+		next = ResumeToken{offset: r.offset, index: token.index + min(seen, maxEntries), fingerprint: fingerprint}
+		return nil
+	})
+	return next, err
+}
@@ -0,0 +1,75 @@
+package replaylog
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestReplayChunk(t *testing.T) {
+	log := newTestLog(t, WithHeader())
+	appendAll(t, log, &Set{Key: "a", Value: "1"}, &Set{Key: "b", Value: "2"}, &Set{Key: "c", Value: "3"}, &Delete{Key: "a"}, &Set{Key: "d", Value: "4"})
+
+	state := KV{}
+	token, err := log.ReplayChunk(state, ResumeToken{}, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"a": "1", "b": "2"}, state)
+	assert.Equal(t, 2, token.Index())
+
+	// Tokens survive serialisation.
+	text, err := token.MarshalText()
+	assert.NoError(t, err)
+	token = ResumeToken{}
+	assert.NoError(t, token.UnmarshalText(text))
+
+	token, err = log.ReplayChunk(state, token, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"b": "2", "c": "3"}, state)
+	token, err = log.ReplayChunk(state, token, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, token.Index())
+	end, err := log.ReplayChunk(state, token, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, token, end)
+	assert.Equal(t, KV{"b": "2", "c": "3", "d": "4"}, state)
+
+	// The position of the log is unchanged.
+	appendAll(t, log, &Set{Key: "e", Value: "5"})
+	_, err = log.ReplayChunk(state, end, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"b": "2", "c": "3", "d": "4", "e": "5"}, state)
+
+	assert.Error(t, token.UnmarshalText([]byte("garbage")))
+}
+
+func TestReplayChunkSchemaMismatch(t *testing.T) {
+	log := newTestLog(t)
+	appendAll(t, log, &Set{Key: "a", Value: "1"}, &Set{Key: "b", Value: "2"})
+	token, err := log.ReplayChunk(KV{}, ResumeToken{}, 1)
+	assert.NoError(t, err)
+	text, err := token.MarshalText()
+	assert.NoError(t, err)
+	assert.Equal(t, "30.1."+log.SchemaFingerprint(), string(text))
+
+	// A log whose ops have changed rejects the token.
+	f, err := os.Open(log.f.(*os.File).Name())
+	assert.NoError(t, err)
+	other, err := New[KV](f, []Op[KV]{&Set{}, &Delete{}, &Set{}})
+	assert.NoError(t, err)
+	_, err = other.ReplayChunk(KV{}, token, 1)
+	assert.True(t, errors.Is(err, ErrSchemaMismatch))
+
+	// As do tokens persisted without a fingerprint.
+	legacy := ResumeToken{}
+	assert.NoError(t, legacy.UnmarshalText([]byte("30.1")))
+	state := KV{}
+	_, err = log.ReplayChunk(state, legacy, 1)
+	assert.True(t, errors.Is(err, ErrSchemaMismatch))
+	assert.Equal(t, KV{}, state)
+
+	_, err = other.ReplayChunk(state, ResumeToken{}, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"a": "1", "b": "2"}, state)
+}
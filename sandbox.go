@@ -0,0 +1,36 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrNonDeterministic is returned by Replay WithSandboxedReplay when applying
+// an op to two identical States produces different results.
+var ErrNonDeterministic = errors.New("op is not deterministic")
+
+// sandbox holds the pair of States maintained by WithSandboxedReplay.
+type sandbox[State any] struct {
+	a, b State
+}
+
+// applySandboxed applies two independently decoded copies of the op in
+// logEntry to each State of the sandbox, returning an error wrapping
+// ErrNonDeterministic if the States then differ.
+func (l *Log[State]) applySandboxed(s *sandbox[State], index int, logEntry Frame, parent Op[State]) error {
+	a, err := l.decodeOp(logEntry)
+	if err != nil {
+		return err
+	}
+	b, err := l.decodeOp(logEntry)
+	if err != nil {
+		return err
+	}
+	errA := l.applyOp(logEntry, a, parent, s.a)
+	errB := l.applyOp(logEntry, b, parent, s.b)
+	if (errA == nil) != (errB == nil) || !reflect.DeepEqual(s.a, s.b) {
+		return fmt.Errorf("%w: entry %d of type %T", ErrNonDeterministic, index, a)
+	}
+	return nil
+}
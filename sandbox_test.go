@@ -0,0 +1,35 @@
+package replaylog
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+var impureCounter int
+
+// impureSet sets a key to a value that changes every time it is applied.
+type impureSet struct {
+	Key string `json:"k"`
+}
+
+func (i *impureSet) Apply(state KV) error {
+	impureCounter++
+	state[i.Key] = strconv.Itoa(impureCounter)
+	return nil
+}
+
+func TestWithSandboxedReplay(t *testing.T) {
+	log, err := New[KV](&MemoryFile{}, []Op[KV]{&Set{}, &Delete{}, &impureSet{}}, WithSandboxedReplay())
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "a", Value: "1"}, &Delete{Key: "a"}, &Set{Key: "b", Value: "2"})
+	assert.Equal(t, KV{"b": "2"}, replay(t, log))
+
+	appendAll(t, log, &impureSet{Key: "c"})
+	assert.NoError(t, log.Rewind())
+	err = log.Replay(KV{})
+	assert.True(t, errors.Is(err, ErrNonDeterministic))
+	assert.EqualError(t, err, "op is not deterministic: entry 3 of type *replaylog.impureSet")
+}
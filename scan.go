@@ -0,0 +1,51 @@
+package replaylog
+
+import (
+	"errors"
+	"io"
+)
+
+// EntryReport describes the health of a single entry in a log.
+type EntryReport struct {
+	Index  int
+	Offset int64 // Byte offset of the entry in the log.
+	Length int64 // Length of the entry in bytes, including its delimiter.
+	Kind   int   // Kind of the entry, or -1 if its envelope is corrupt.
+	Err    error // Non-nil if the entry could not be decoded.
+}
+
+// Scan every entry in the log, reporting the health of each.
+//
+// Unlike Replay, Scan does not stop at corrupt entries but resynchronises on
+// the next entry delimiter. Ops are decoded but not applied. An error is only
+// returned if the log itself could not be read.
+//
+// The log is scanned from the start, and its position restored afterwards.
+func (l *Log[State]) Scan() ([]EntryReport, error) {
+	var reports []EntryReport
+	err := l.fromStart(func(r *reader) error {
+		for {
+			frame, err := r.next()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			report := EntryReport{
+				Index:  r.index - 1,
+				Offset: r.start,
+				Length: r.offset - r.start,
+				Kind:   -1,
+			}
+			logEntry, err := l.decodeEntry(frame)
+			if err == nil {
+				report.Kind = logEntry.Kind
+				_, err = l.decodeOp(logEntry)
+			}
+			report.Err = err
+			reports = append(reports, report)
+		}
+	})
+	return reports, err
+}
@@ -0,0 +1,33 @@
+package replaylog
+
+import (
+	"io"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestScan(t *testing.T) {
+	log := newTestLog(t)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"})
+	_, err := log.f.Write([]byte(`{"k":0,"e":{"k":"trunc` + "\n" + `{"k":7,"e":{}}` + "\n"))
+	assert.NoError(t, err)
+	appendAll(t, log, &Delete{Key: "foo"})
+
+	reports, err := log.Scan()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(reports))
+	for i, report := range reports {
+		assert.Equal(t, i, report.Index)
+	}
+	assert.Equal(t, []int{0, -1, 7, 1}, []int{reports[0].Kind, reports[1].Kind, reports[2].Kind, reports[3].Kind})
+	assert.NoError(t, reports[0].Err)
+	assert.Error(t, reports[1].Err)
+	assert.Error(t, reports[2].Err)
+	assert.NoError(t, reports[3].Err)
+	assert.Equal(t, reports[0].Offset+reports[0].Length, reports[1].Offset)
+
+	end, err := log.f.Seek(0, io.SeekCurrent)
+	assert.NoError(t, err)
+	assert.Equal(t, reports[3].Offset+reports[3].Length, end)
+}
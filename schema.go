@@ -0,0 +1,125 @@
+package replaylog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type schemaEntry struct {
+	Kind int    `json:"kind"`
+	Type string `json:"type"`
+}
+
+// SchemaSnapshot serialises the mapping of kinds to registered Op types.
+//
+// The snapshot is intended to be committed alongside the code and checked with
+// VerifySchemaSnapshot in a test, to catch accidental changes to the order of
+// registered ops.
+func (l *Log[State]) SchemaSnapshot() []byte {
+	schema := make([]schemaEntry, len(l.ops))
+	for kind, op := range l.ops {
+		schema[kind] = schemaEntry{Kind: kind, Type: typeName(reflect.TypeOf(op))}
+	}
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return append(data, '\n')
+}
+
+// VerifySchemaSnapshot verifies that the registered ops are compatible with a
+// snapshot previously produced by SchemaSnapshot.
+//
+// Every kind in the snapshot must still be registered with the same type. Ops
+// registered after those in the snapshot are allowed.
+func (l *Log[State]) VerifySchemaSnapshot(prev []byte) error {
+	var schema []schemaEntry
+	if err := json.Unmarshal(prev, &schema); err != nil {
+		return fmt.Errorf("invalid schema snapshot: %w", err)
+	}
+	var problems []string
+	for _, expected := range schema {
+		if expected.Kind < 0 || expected.Kind >= len(l.ops) {
+			problems = append(problems, fmt.Sprintf("kind %d (%s) is no longer registered", expected.Kind, expected.Type))
+			continue
+		}
+		if actual := typeName(reflect.TypeOf(l.ops[expected.Kind])); actual != expected.Type {
+			problems = append(problems, fmt.Sprintf("kind %d changed from %s to %s", expected.Kind, expected.Type, actual))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("schema is incompatible with snapshot: %s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// SchemaFingerprint returns a stable hash of the encoded structure of every
+// registered op: its kind, type, and recursively the JSON names, options and
+// types of its exported fields.
+//
+// Like SchemaSnapshot, the fingerprint is intended to be committed and checked
+// in a test. It changes whenever the encoding of any op might, such as when a
+// JSON tag is renamed, so unlike VerifySchemaSnapshot it also catches
+// incompatible changes to the fields of an op. Types implementing
+// json.Marshaler are fingerprinted by name only.
+func (l *Log[State]) SchemaFingerprint() string {
+	h := sha256.New()
+	for kind, op := range l.ops {
+		fmt.Fprintf(h, "%d=%s\n", kind, describeType(reflect.TypeOf(op), map[reflect.Type]bool{}))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// describeType describes the JSON encoding of t for SchemaFingerprint.
+func describeType(t reflect.Type, seen map[reflect.Type]bool) string {
+	if t.Implements(jsonMarshalerType) {
+		return typeName(t)
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + describeType(t.Elem(), seen)
+	case reflect.Slice:
+		return "[]" + describeType(t.Elem(), seen)
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), describeType(t.Elem(), seen))
+	case reflect.Map:
+		return "map[" + describeType(t.Key(), seen) + "]" + describeType(t.Elem(), seen)
+	case reflect.Struct:
+		name := typeName(t)
+		if seen[t] {
+			return name
+		}
+		seen[t] = true
+		fields := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if !field.IsExported() && !field.Anonymous || tag == "-" {
+				continue
+			}
+			fields = append(fields, fmt.Sprintf("%s %q %s", field.Name, tag, describeType(field.Type, seen)))
+		}
+		return name + "{" + strings.Join(fields, "; ") + "}"
+	default:
+		return t.Kind().String()
+	}
+}
+
+// typeName returns the fully qualified name of t, eg. "*github.com/foo/bar.Op".
+func typeName(t reflect.Type) string {
+	prefix := ""
+	for t.Kind() == reflect.Ptr {
+		prefix += "*"
+		t = t.Elem()
+	}
+	if t.PkgPath() == "" {
+		return prefix + t.String()
+	}
+	return prefix + t.PkgPath() + "." + t.Name()
+}
@@ -0,0 +1,48 @@
+package replaylog
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestSchemaSnapshot(t *testing.T) {
+	log := newTestLog(t)
+	snapshot := log.SchemaSnapshot()
+	assert.Equal(t, `[
+  {
+    "kind": 0,
+    "type": "*github.com/alecthomas/replaylog.Set"
+  },
+  {
+    "kind": 1,
+    "type": "*github.com/alecthomas/replaylog.Delete"
+  }
+]
+`, string(snapshot))
+	assert.NoError(t, log.VerifySchemaSnapshot(snapshot))
+
+	extended, err := New[KV](&MemoryFile{}, []Op[KV]{&Set{}, &Delete{}, &copyOp{}})
+	assert.NoError(t, err)
+	assert.NoError(t, extended.VerifySchemaSnapshot(snapshot))
+
+	reordered, err := New[KV](&MemoryFile{}, []Op[KV]{&Delete{}, &Set{}})
+	assert.NoError(t, err)
+	assert.Error(t, reordered.VerifySchemaSnapshot(snapshot))
+
+	removed, err := New[KV](&MemoryFile{}, []Op[KV]{&Set{}})
+	assert.NoError(t, err)
+	assert.Error(t, removed.VerifySchemaSnapshot(snapshot))
+}
+
+func TestSchemaFingerprint(t *testing.T) {
+	log := newTestLog(t)
+	assert.Equal(t, `*github.com/alecthomas/replaylog.Set{Key "k" string; Value "v" string}`,
+		describeType(reflect.TypeOf(&Set{}), map[reflect.Type]bool{}))
+	assert.Equal(t, "53b6ae85db8741275803e7ac9a5cdd1b8106b7d6d2a91bddfd59e064f0d19c80", log.SchemaFingerprint())
+
+	reordered, err := New[KV](&MemoryFile{}, []Op[KV]{&Delete{}, &Set{}})
+	assert.NoError(t, err)
+	assert.NotEqual(t, log.SchemaFingerprint(), reordered.SchemaFingerprint())
+}
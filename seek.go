@@ -0,0 +1,106 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BuildIndex returns the byte offset of the start of each entry in the log, for
+// use with SeekWithIndex.
+//
+// The index only covers entries present when it was built, so it must be
+// rebuilt after appending, and is invalidated entirely by compaction or
+// truncation. The position of the log is preserved.
+func (l *Log[State]) BuildIndex() ([]int64, error) {
+	var offsets []int64
+	err := l.fromStart(func(r *reader) error {
+		for {
+			_, err := r.next()
+			if errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			offsets = append(offsets, r.start)
+		}
+	})
+	return offsets, err
+}
+
+// SeekToEntry positions the log at the start of entry "index", so that Step or
+// Replay continue from there, scanning the log to find it.
+//
+// Appends are written at the current position, so the log must be positioned
+// at its end again, eg. by replaying it, before appending.
+func (l *Log[State]) SeekToEntry(index int) error {
+	offsets, err := l.BuildIndex()
+	if err != nil {
+		return err
+	}
+	return l.SeekWithIndex(offsets, index)
+}
+
+// SeekWithIndex is SeekToEntry using an index previously returned by
+// BuildIndex, avoiding a scan of the log.
+func (l *Log[State]) SeekWithIndex(offsets []int64, index int) error {
+	if index < 0 || index >= len(offsets) {
+		return fmt.Errorf("entry %d does not exist in index of %d entries", index, len(offsets))
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, err := l.f.Seek(offsets[index], io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek to entry %d: %w", index, err)
+	}
+	return nil
+}
+
+// seekFile is a File that can seek.
+type seekFile interface {
+	File
+	io.Seeker
+}
+
+// seekable returns f if it implements io.Seeker, or otherwise wraps it in a
+// forward-only seekFile.
+func seekable(f File) seekFile {
+	if s, ok := f.(seekFile); ok {
+		return s
+	}
+	return &forwardOnlyFile{File: f}
+}
+
+// forwardOnlyFile tracks the position of a File that can't seek. Seeking to
+// the current position succeeds, and any other seek fails with ErrNotSeekable.
+type forwardOnlyFile struct {
+	File
+	pos int64
+}
+
+func (f *forwardOnlyFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.pos += int64(n)
+	return n, err
+}
+
+func (f *forwardOnlyFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	f.pos += int64(n)
+	return n, err
+}
+
+func (f *forwardOnlyFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	default:
+		return f.pos, fmt.Errorf("%w: can't seek relative to the end", ErrNotSeekable)
+	}
+	if offset != f.pos {
+		return f.pos, fmt.Errorf("%w: can't seek from offset %d to %d", ErrNotSeekable, f.pos, offset)
+	}
+	return f.pos, nil
+}
+
+func (f *forwardOnlyFile) Sync() error { return syncFile(f.File) }
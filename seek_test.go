@@ -0,0 +1,59 @@
+package replaylog
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// streamFile is a File that can't seek.
+type streamFile struct {
+	bytes.Buffer
+}
+
+func (s *streamFile) Sync() error  { return nil }
+func (s *streamFile) Close() error { return nil }
+
+func TestForwardOnlyFile(t *testing.T) {
+	f := &streamFile{}
+	f.WriteString(`{"k":0,"e":{"k":"foo","v":"bar"}}` + "\n" + `{"k":0,"e":{"k":"bar","v":"waz"}}` + "\n")
+	log, err := New[KV](f, ops)
+	assert.NoError(t, err)
+	state := KV{}
+	err = log.Replay(state)
+	assert.NoError(t, err)
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, state)
+
+	err = log.Rewind()
+	assert.True(t, errors.Is(err, ErrNotSeekable))
+	appendAll(t, log, &Delete{Key: "foo"})
+	assert.Equal(t, `{"k":1,"e":{"k":"foo"}}`+"\n", f.String())
+
+	_, err = New[KV](&streamFile{}, ops, WithMaxLogSize(100))
+	assert.True(t, errors.Is(err, ErrNotSeekable))
+}
+
+func TestSeekToEntry(t *testing.T) {
+	log := newTestLog(t, WithHeader())
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"}, &Delete{Key: "foo"})
+	offsets, err := log.BuildIndex()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(offsets))
+	assert.True(t, offsets[0] > 0)
+	assert.Equal(t, offsets[0]+int64(len(`{"k":0,"e":{"k":"foo","v":"bar"}}`+"\n")), offsets[1])
+
+	assert.NoError(t, log.SeekWithIndex(offsets, 2))
+	op, _, _, err := log.Step(KV{})
+	assert.NoError(t, err)
+	assert.Equal(t, Op[KV](&Delete{Key: "foo"}), op)
+
+	assert.NoError(t, log.SeekToEntry(1))
+	state := KV{}
+	assert.NoError(t, log.Replay(state))
+	assert.Equal(t, KV{"bar": "waz"}, state)
+
+	err = log.SeekToEntry(3)
+	assert.EqualError(t, err, "entry 3 does not exist in index of 3 entries")
+}
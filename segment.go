@@ -0,0 +1,492 @@
+package replaylog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// manifestName is the name of the manifest in the directory of a SegmentedLog.
+const manifestName = "manifest.json"
+
+// defaultSegmentSize is the segment size used if WithSegmentSize is not set.
+const defaultSegmentSize = 64 << 20
+
+// WithSegmentSize sets the size in bytes beyond which a SegmentedLog rolls
+// over to a new segment. The default is 64MiB. It is ignored by New.
+func WithSegmentSize(size int64) Option {
+	return func(o *options) error {
+		if size <= 0 {
+			return fmt.Errorf("WithSegmentSize: size must be positive but got %d", size)
+		}
+		o.segmentSize = size
+		return nil
+	}
+}
+
+// WithRingRetention makes a SegmentedLog a ring bounded to roughly maxBytes:
+// each time it rolls over to a new segment, the oldest sealed segments are
+// deleted until the total size of the segments is within maxBytes. The active
+// segment is never deleted. It is ignored by New.
+//
+// This is a lossy mode for logs whose old entries are expendable, such as
+// activity or audit trails: Replay only applies the surviving segments, so
+// the result is partial state that can't be used for full reconstruction.
+func WithRingRetention(maxBytes int64) Option {
+	return func(o *options) error {
+		if maxBytes <= 0 {
+			return fmt.Errorf("WithRingRetention: maxBytes must be positive but got %d", maxBytes)
+		}
+		o.ringRetention = maxBytes
+		return nil
+	}
+}
+
+// SegmentInfo describes one segment of a SegmentedLog in its manifest.
+type SegmentInfo struct {
+	Name  string `json:"name"`  // File name of the segment, relative to the directory.
+	First int    `json:"first"` // Index of the first entry in the segment.
+	Last  int    `json:"last"`  // Index of the last entry, or First-1 if the segment is empty.
+	Size  int64  `json:"size"`  // Size of the segment in bytes.
+}
+
+// manifest lists the segments of a SegmentedLog in replay order.
+type manifest struct {
+	Segments []SegmentInfo `json:"segments"`
+}
+
+// SegmentedLog is a log split across a directory of segment files, rolling
+// over to a new segment once the current one exceeds the size set by
+// WithSegmentSize.
+//
+// The segments are listed in a manifest.json in the directory, with the range
+// of entries and size of each, which is the source of truth for replay order.
+// The manifest is replaced atomically whenever the set of segments changes.
+// Only the last, active, segment is appended to, and its range and size in
+// the manifest are updated when it is sealed or the log is closed.
+type SegmentedLog[State any] struct {
+	lock      sync.Mutex
+	dir       string
+	ops       []Op[State]
+	options   []Option
+	size      int64 // Size at which to roll over to a new segment.
+	delim     byte
+	mode      os.FileMode // Mode of created segments.
+	segments  []SegmentInfo
+	active    *Log[State]
+	retention int64 // Total size of segments to retain, if non-zero.
+	binary    bool  // Segments consist of binary records, see WithBinaryRecords.
+}
+
+// NewSegmented opens or creates a SegmentedLog in "dir".
+//
+// "ops" are as for New, and "opts" are applied to each segment. If the
+// manifest is missing or corrupt it is rebuilt from the segment files in the
+// directory, ordered by name.
+func NewSegmented[State any](dir string, ops []Op[State], opts ...Option) (*SegmentedLog[State], error) {
+	// Only the options that apply to the directory as a whole are needed here,
+	// the rest are applied by New to each segment.
+	o := &options{}
+	for _, option := range opts {
+		if err := option(o); err != nil {
+			return nil, err
+		}
+	}
+	s := &SegmentedLog[State]{
+		dir:       dir,
+		ops:       ops,
+		options:   opts,
+		size:      o.segmentSize,
+		retention: o.ringRetention,
+		delim:     o.delimiter,
+		binary:    o.binaryFraming(),
+		mode:      o.createMode(),
+	}
+	if s.size == 0 {
+		s.size = defaultSegmentSize
+	}
+	if s.delim == 0 {
+		s.delim = '\n'
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	segments, err := s.readManifest()
+	if err != nil {
+		if segments, err = s.rebuildManifest(); err != nil {
+			return nil, err
+		}
+	}
+	s.segments = segments
+	if len(s.segments) == 0 {
+		s.segments = []SegmentInfo{{Name: segmentName(0), First: 0, Last: -1}}
+	}
+	if err := s.openActive(); err != nil {
+		return nil, err
+	}
+	if err := s.writeManifest(); err != nil {
+		_ = s.active.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// segmentName returns the file name of the segment starting at entry "first".
+func segmentName(first int) string {
+	return fmt.Sprintf("%020d.log", first)
+}
+
+// readManifest reads and validates the manifest.
+func (s *SegmentedLog[State]) readManifest() ([]SegmentInfo, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, manifestName))
+	if err != nil {
+		return nil, err
+	}
+	m := manifest{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("corrupt manifest: %w", err)
+	}
+	next := 0
+	for i, segment := range m.Segments {
+		if i > 0 && segment.First != next {
+			return nil, fmt.Errorf("corrupt manifest: segment %q starts at entry %d, expected %d", segment.Name, segment.First, next)
+		}
+		if segment.Last < segment.First-1 || segment.Name != filepath.Base(segment.Name) {
+			return nil, fmt.Errorf("corrupt manifest: invalid segment %q", segment.Name)
+		}
+		if _, err := os.Stat(filepath.Join(s.dir, segment.Name)); err != nil {
+			return nil, fmt.Errorf("corrupt manifest: %w", err)
+		}
+		next = segment.Last + 1
+	}
+	return m.Segments, nil
+}
+
+// rebuildManifest scans the segment files in the directory, in name order.
+func (s *SegmentedLog[State]) rebuildManifest() ([]SegmentInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list log directory: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".log") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	var segments []SegmentInfo
+	first := 0
+	if len(names) > 0 {
+		// Earlier segments may have been deleted, so they are numbered from
+		// the name of the first.
+		if n, err := strconv.Atoi(strings.TrimSuffix(names[0], ".log")); err == nil && n >= 0 {
+			first = n
+		}
+	}
+	for _, name := range names {
+		count, size, err := s.scanSegment(name)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, SegmentInfo{Name: name, First: first, Last: first + count - 1, Size: size})
+		first += count
+	}
+	return segments, nil
+}
+
+// scanSegment counts the entries in a segment file.
+func (s *SegmentedLog[State]) scanSegment(name string) (count int, size int64, err error) {
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open segment: %w", err)
+	}
+	defer f.Close()
+	r := newReader(f, 0)
+	r.delim = s.delim
+	r.binary = s.binary
+	for {
+		if _, err := r.next(); errors.Is(err, io.EOF) {
+			return r.index, r.offset, nil
+		} else if err != nil {
+			return 0, 0, fmt.Errorf("segment %q: %w", name, err)
+		}
+	}
+}
+
+// writeManifest atomically replaces the manifest. Must be called with the lock
+// held, or before the log is shared.
+func (s *SegmentedLog[State]) writeManifest() error {
+	data, err := json.MarshalIndent(manifest{Segments: s.segments}, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, manifestName)
+	tmp, err := os.CreateTemp(s.dir, manifestName+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if _, err = tmp.Write(append(data, '\n')); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return syncDir(s.dir)
+}
+
+// syncDir syncs a directory so that renames within it are durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	// Not all platforms support syncing directories.
+	_ = d.Sync()
+	return nil
+}
+
+// openActive opens the last segment for appending.
+func (s *SegmentedLog[State]) openActive() error {
+	info := &s.segments[len(s.segments)-1]
+	f, err := os.OpenFile(filepath.Join(s.dir, info.Name), os.O_RDWR|os.O_CREATE, s.mode)
+	if err != nil {
+		return fmt.Errorf("failed to open segment: %w", err)
+	}
+	active, err := New(f, s.ops, s.options...)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	active.lock.Lock()
+	count, err := active.count()
+	if err == nil {
+		active.size, err = active.f.Seek(0, io.SeekEnd)
+	}
+	active.lock.Unlock()
+	if err != nil {
+		_ = active.Close()
+		return fmt.Errorf("segment %q: %w", info.Name, err)
+	}
+	info.Last = info.First + count - 1
+	info.Size = active.size
+	s.active = active
+	return nil
+}
+
+// Segments returns the segments of the log, as recorded in its manifest, with
+// the range and size of the active segment brought up to date.
+func (s *SegmentedLog[State]) Segments() []SegmentInfo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.refreshActive()
+	return append([]SegmentInfo(nil), s.segments...)
+}
+
+// refreshActive updates the range and size of the active segment. Must be
+// called with the lock held.
+func (s *SegmentedLog[State]) refreshActive() {
+	info := &s.segments[len(s.segments)-1]
+	s.active.lock.Lock()
+	defer s.active.lock.Unlock()
+	info.Last = info.First + s.active.entries - 1
+	info.Size = s.active.size
+}
+
+// Append an Op to the active segment, rolling over to a new segment if it
+// has grown beyond the segment size.
+func (s *SegmentedLog[State]) Append(event Op[State]) error {
+	return s.AppendAtomic(event)
+}
+
+// AppendAtomic appends multiple Ops to the active segment with a single write
+// and sync, as for Log.AppendAtomic, rolling over to a new segment afterwards
+// if it has grown beyond the segment size.
+func (s *SegmentedLog[State]) AppendAtomic(events ...Op[State]) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.active.AppendAtomic(events...); err != nil {
+		return err
+	}
+	if s.active.size < s.size {
+		return nil
+	}
+	return s.roll()
+}
+
+// Roll seals the active segment and starts a new one, regardless of its size.
+// Rolling an empty segment does nothing.
+func (s *SegmentedLog[State]) Roll() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.roll()
+}
+
+func (s *SegmentedLog[State]) roll() error {
+	s.refreshActive()
+	sealed := &s.segments[len(s.segments)-1]
+	if sealed.Last < sealed.First {
+		return nil
+	}
+	if err := s.active.Close(); err != nil {
+		return fmt.Errorf("failed to seal segment %q: %w", sealed.Name, err)
+	}
+	if stat, err := os.Stat(filepath.Join(s.dir, sealed.Name)); err == nil {
+		sealed.Size = stat.Size()
+	}
+	first := sealed.Last + 1
+	s.segments = append(s.segments, SegmentInfo{Name: segmentName(first), First: first, Last: first - 1})
+	if err := s.openActive(); err != nil {
+		return err
+	}
+	if err := s.writeManifest(); err != nil {
+		return err
+	}
+	if s.retention == 0 {
+		return nil
+	}
+	var total int64
+	for _, segment := range s.segments {
+		total += segment.Size
+	}
+	n := 0
+	for ; n < len(s.segments)-1 && total > s.retention; n++ {
+		total -= s.segments[n].Size
+	}
+	_, err := s.deleteSegments(n)
+	return err
+}
+
+// Replay every segment in manifest order into dest, leaving the active
+// segment positioned at its end for appending.
+func (s *SegmentedLog[State]) Replay(dest State) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.active.resetBeforeReplay {
+		if err := reset(dest); err != nil {
+			return err
+		}
+	}
+	for _, segment := range s.segments[:len(s.segments)-1] {
+		if err := s.replaySealed(segment, dest); err != nil {
+			return err
+		}
+	}
+	if err := s.active.Rewind(); err != nil {
+		return err
+	}
+	r, err := s.active.currentReader()
+	if err != nil {
+		return err
+	}
+	if err := s.active.replay(r, dest); err != nil {
+		return fmt.Errorf("segment %q: %w", s.segments[len(s.segments)-1].Name, err)
+	}
+	return nil
+}
+
+func (s *SegmentedLog[State]) replaySealed(segment SegmentInfo, dest State) error {
+	f, err := os.Open(filepath.Join(s.dir, segment.Name))
+	if err != nil {
+		return fmt.Errorf("failed to open segment: %w", err)
+	}
+	defer f.Close()
+	part := s.active.withFile(f)
+	if err := part.replay(part.newReader(part.f, 0), dest); err != nil {
+		return fmt.Errorf("segment %q: %w", segment.Name, err)
+	}
+	return nil
+}
+
+// DeleteSegmentsBefore deletes every sealed segment whose entries all precede
+// entry "index", returning the number of segments deleted.
+//
+// The manifest is updated before the files are removed, so a crash part way
+// through leaves at worst unreferenced segment files. Replay then starts from
+// the first remaining segment, so this is typically used once a snapshot of
+// the State at or after "index" has been taken.
+func (s *SegmentedLog[State]) DeleteSegmentsBefore(index int) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	n := 0
+	for n < len(s.segments)-1 && s.segments[n].Last < index {
+		n++
+	}
+	return s.deleteSegments(n)
+}
+
+// Checkpoint starts a new segment with a SnapshotOp holding "state",
+// serialised as for Log.Checkpoint, then deletes every earlier segment,
+// returning the number deleted. SnapshotOp must be registered with the log.
+//
+// "state" must be the result of replaying the whole log. The checkpoint is
+// synced before the manifest is updated, so a crash part way through leaves
+// the earlier segments in place, which Replay then restores over.
+func (s *SegmentedLog[State]) Checkpoint(state State) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	op, err := s.active.checkpointOp(state)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.roll(); err != nil {
+		return 0, err
+	}
+	if err := s.active.AppendAtomic(op); err != nil {
+		return 0, fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	s.refreshActive()
+	return s.deleteSegments(len(s.segments) - 1)
+}
+
+// deleteSegments deletes the first "n" segments, as for DeleteSegmentsBefore.
+// Must be called with the lock held.
+func (s *SegmentedLog[State]) deleteSegments(n int) (int, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	deleted := s.segments[:n]
+	s.segments = append([]SegmentInfo(nil), s.segments[n:]...)
+	if err := s.writeManifest(); err != nil {
+		s.segments = append(deleted, s.segments...)
+		return 0, err
+	}
+	for _, segment := range deleted {
+		if err := os.Remove(filepath.Join(s.dir, segment.Name)); err != nil && !os.IsNotExist(err) {
+			return n, fmt.Errorf("failed to delete segment: %w", err)
+		}
+	}
+	return n, nil
+}
+
+// Close the active segment and record its final range and size in the
+// manifest.
+func (s *SegmentedLog[State]) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.refreshActive()
+	err := s.active.Close()
+	info := &s.segments[len(s.segments)-1]
+	if stat, serr := os.Stat(filepath.Join(s.dir, info.Name)); serr == nil {
+		info.Size = stat.Size()
+	}
+	if merr := s.writeManifest(); err == nil {
+		err = merr
+	}
+	return err
+}
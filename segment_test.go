@@ -0,0 +1,143 @@
+package replaylog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestSegmentedLog(t *testing.T) {
+	dir := t.TempDir()
+	// Each entry is 33 bytes, so segments roll after every second entry.
+	log, err := NewSegmented(dir, ops, WithSegmentSize(60))
+	assert.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, log.Append(&Set{Key: fmt.Sprintf("k%d", i), Value: "vvv"}))
+	}
+	assert.Equal(t, []SegmentInfo{
+		{Name: "00000000000000000000.log", First: 0, Last: 1, Size: 66},
+		{Name: "00000000000000000002.log", First: 2, Last: 3, Size: 66},
+		{Name: "00000000000000000004.log", First: 4, Last: 4, Size: 33},
+	}, log.Segments())
+	assert.NoError(t, log.Close())
+
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"name": "00000000000000000004.log"`)
+
+	expected := KV{"k0": "vvv", "k1": "vvv", "k2": "vvv", "k3": "vvv", "k4": "vvv"}
+	log, err = NewSegmented(dir, ops, WithSegmentSize(60))
+	assert.NoError(t, err)
+	state := KV{}
+	assert.NoError(t, log.Replay(state))
+	assert.Equal(t, expected, state)
+	assert.NoError(t, log.Append(&Delete{Key: "k0"}))
+	assert.Equal(t, 3, len(log.Segments()))
+	assert.NoError(t, log.Close())
+
+	// A corrupt manifest is rebuilt from the segments in the directory.
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "manifest.json"), []byte("{"), 0600))
+	log, err = NewSegmented(dir, ops, WithSegmentSize(60))
+	assert.NoError(t, err)
+	segments := log.Segments()
+	assert.Equal(t, 3, len(segments))
+	assert.Equal(t, SegmentInfo{Name: "00000000000000000004.log", First: 4, Last: 5, Size: 56}, segments[2])
+	state = KV{}
+	assert.NoError(t, log.Replay(state))
+	delete(expected, "k0")
+	assert.Equal(t, expected, state)
+
+	n, err := log.DeleteSegmentsBefore(4)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	_, err = os.Stat(filepath.Join(dir, "00000000000000000000.log"))
+	assert.True(t, os.IsNotExist(err))
+	state = KV{}
+	assert.NoError(t, log.Replay(state))
+	assert.Equal(t, KV{"k4": "vvv"}, state)
+	assert.NoError(t, log.Close())
+
+	log, err = NewSegmented(dir, ops)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, log.Segments()[0].First)
+	assert.NoError(t, log.Close())
+}
+
+func TestSegmentedLogRoll(t *testing.T) {
+	log, err := NewSegmented(t.TempDir(), ops)
+	assert.NoError(t, err)
+	defer log.Close()
+	assert.NoError(t, log.Roll())
+	assert.Equal(t, 1, len(log.Segments()))
+	assert.NoError(t, log.AppendAtomic(&Set{Key: "a", Value: "b"}, &Set{Key: "c", Value: "d"}))
+	assert.NoError(t, log.Roll())
+	assert.Equal(t, []SegmentInfo{
+		{Name: "00000000000000000000.log", First: 0, Last: 1, Size: 60},
+		{Name: "00000000000000000002.log", First: 2, Last: 1},
+	}, log.Segments())
+	state := KV{}
+	assert.NoError(t, log.Replay(state))
+	assert.Equal(t, KV{"a": "b", "c": "d"}, state)
+}
+
+func TestSegmentedLogRingRetention(t *testing.T) {
+	dir := t.TempDir()
+	// Each entry is 33 bytes, so segments hold two entries and the ring
+	// retains the active segment and at most two sealed ones.
+	log, err := NewSegmented(dir, ops, WithSegmentSize(60), WithRingRetention(140))
+	assert.NoError(t, err)
+	for i := 0; i < 9; i++ {
+		assert.NoError(t, log.Append(&Set{Key: fmt.Sprintf("k%d", i), Value: "vvv"}))
+	}
+	assert.Equal(t, []SegmentInfo{
+		{Name: "00000000000000000004.log", First: 4, Last: 5, Size: 66},
+		{Name: "00000000000000000006.log", First: 6, Last: 7, Size: 66},
+		{Name: "00000000000000000008.log", First: 8, Last: 8, Size: 33},
+	}, log.Segments())
+	_, err = os.Stat(filepath.Join(dir, "00000000000000000002.log"))
+	assert.True(t, os.IsNotExist(err))
+	state := KV{}
+	assert.NoError(t, log.Replay(state))
+	assert.Equal(t, KV{"k4": "vvv", "k5": "vvv", "k6": "vvv", "k7": "vvv", "k8": "vvv"}, state)
+	assert.NoError(t, log.Close())
+
+	// A rebuilt manifest keeps the numbering of the surviving segments.
+	assert.NoError(t, os.Remove(filepath.Join(dir, "manifest.json")))
+	log, err = NewSegmented(dir, ops, WithSegmentSize(60), WithRingRetention(140))
+	assert.NoError(t, err)
+	defer log.Close()
+	assert.Equal(t, 4, log.Segments()[0].First)
+
+	_, err = NewSegmented(dir, ops, WithRingRetention(0))
+	assert.EqualError(t, err, "WithRingRetention: maxBytes must be positive but got 0")
+}
+
+func TestSegmentedLogCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	ops := checkpointOps
+	log, err := NewSegmented(dir, ops, WithSegmentSize(60))
+	assert.NoError(t, err)
+	state := snapshotKVState{}
+	for i := 0; i < 5; i++ {
+		op := &setSnapshotKV{Key: fmt.Sprintf("k%d", i%2), Value: fmt.Sprint(i)}
+		assert.NoError(t, log.Append(op))
+		assert.NoError(t, op.Apply(state))
+	}
+	assert.Equal(t, 3, len(log.Segments()))
+	deleted, err := log.Checkpoint(state)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, deleted)
+	assert.Equal(t, []SegmentInfo{{Name: "00000000000000000005.log", First: 5, Last: 5, Size: 38}}, log.Segments())
+	assert.NoError(t, log.Append(&setSnapshotKV{Key: "k2", Value: "5"}))
+	assert.NoError(t, log.Close())
+
+	log, err = NewSegmented(dir, ops, WithSegmentSize(60))
+	assert.NoError(t, err)
+	defer log.Close()
+	replayed := snapshotKVState{}
+	assert.NoError(t, log.Replay(replayed))
+	assert.Equal(t, snapshotKVState{"k0": "4", "k1": "3", "k2": "5"}, replayed)
+}
@@ -0,0 +1,114 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// shardBuffer is the number of ops buffered for each shard during
+// ReplaySharded.
+const shardBuffer = 64
+
+// errShardFailed stops ReplaySharded after a shard has failed.
+var errShardFailed = errors.New("shard failed")
+
+// ReplaySharded replays the log into a set of independent States, applying
+// ops to different shards concurrently.
+//
+// Each entry is decoded once and routed to dests[shardOf(op)], or to every
+// shard if shardOf returns -1. Each shard has its own goroutine, so:
+//
+//   - Ops routed to a shard, including broadcast ops, are applied to it in log
+//     order.
+//   - There is no ordering between ops applied to different shards, so ops
+//     must not depend on the States of other shards.
+//   - A broadcast op is the same value for every shard, and may be applied to
+//     several shards at once, so Apply must not modify the op.
+//
+// Replay stops at the first error, from any shard. Returning ErrStopReplay
+// from Apply is not supported, and fails the replay like any other error.
+// After a successful ReplaySharded the log is positioned at its end.
+func (l *Log[State]) ReplaySharded(dests []State, shardOf func(op Op[State]) int) error {
+	defer l.startReplaying()()
+	if len(dests) == 0 {
+		return fmt.Errorf("ReplaySharded requires at least one shard")
+	}
+	if l.resetBeforeReplay {
+		for _, dest := range dests {
+			if err := reset(dest); err != nil {
+				return err
+			}
+		}
+	}
+	r, err := l.startReplay(dests[0])
+	if err != nil {
+		return err
+	}
+	defer r.close()
+
+	type shardOp struct {
+		logEntry   Frame
+		op, parent Op[State]
+	}
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		shardErr error
+		failed   = make(chan struct{})
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			shardErr = err
+			close(failed)
+		})
+	}
+	shards := make([]chan shardOp, len(dests))
+	for i, dest := range dests {
+		shards[i] = make(chan shardOp, shardBuffer)
+		wg.Add(1)
+		go func(i int, dest State, ch chan shardOp) {
+			defer wg.Done()
+			for sop := range ch {
+				if err := l.apply(sop.logEntry, sop.op, sop.parent, dest); err != nil {
+					fail(fmt.Errorf("shard %d: could not apply event of type %T: %w", i, sop.op, err))
+					return
+				}
+			}
+		}(i, dest, shards[i])
+	}
+	send := func(shard int, sop shardOp) error {
+		select {
+		case shards[shard] <- sop:
+			return nil
+		case <-failed:
+			return errShardFailed
+		}
+	}
+	_, err = l.replayUntil(r, dests[0], replayControl[State]{
+		dispatch: func(logEntry Frame, op, parent Op[State]) error {
+			sop := shardOp{logEntry, op, parent}
+			shard := shardOf(op)
+			if shard == -1 {
+				for i := range shards {
+					if err := send(i, sop); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			if shard < 0 || shard >= len(shards) {
+				return fmt.Errorf("shard %d is out of range for %d shards", shard, len(shards))
+			}
+			return send(shard, sop)
+		},
+	})
+	for _, ch := range shards {
+		close(ch)
+	}
+	wg.Wait()
+	if shardErr != nil {
+		return shardErr
+	}
+	return err
+}
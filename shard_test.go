@@ -0,0 +1,60 @@
+package replaylog
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// clearAll is broadcast to every shard.
+type clearAll struct{}
+
+func (clearAll) Apply(state KV) error {
+	for k := range state {
+		delete(state, k)
+	}
+	return nil
+}
+
+func TestReplaySharded(t *testing.T) {
+	f := &MemoryFile{}
+	log, err := New[KV](f, []Op[KV]{&Set{}, &Delete{}, clearAll{}})
+	assert.NoError(t, err)
+	appendAll(t, log,
+		&Set{Key: "a1", Value: "x"},
+		&Set{Key: "b1", Value: "x"},
+		clearAll{},
+		&Set{Key: "a2", Value: "y"},
+		&Set{Key: "b2", Value: "y"},
+		&Set{Key: "a2", Value: "z"},
+		&Delete{Key: "b2"},
+		&Set{Key: "b3", Value: "z"},
+	)
+	shardOf := func(op Op[KV]) int {
+		switch op := op.(type) {
+		case *Set:
+			return int(op.Key[0] - 'a')
+		case *Delete:
+			return int(op.Key[0] - 'a')
+		default:
+			return -1
+		}
+	}
+	assert.NoError(t, log.Rewind())
+	dests := []KV{{}, {}}
+	assert.NoError(t, log.ReplaySharded(dests, shardOf))
+	assert.Equal(t, []KV{{"a2": "z"}, {"b3": "z"}}, dests)
+
+	// Positioned at the end.
+	assert.NoError(t, log.Append(&Set{Key: "a3", Value: "w"}))
+	assert.NoError(t, log.Rewind())
+	dests = []KV{{}, {}}
+	assert.NoError(t, log.ReplaySharded(dests, shardOf))
+	assert.Equal(t, []KV{{"a2": "z", "a3": "w"}, {"b3": "z"}}, dests)
+
+	t.Run("OutOfRange", func(t *testing.T) {
+		assert.NoError(t, log.Rewind())
+		err := log.ReplaySharded([]KV{{}}, shardOf)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,77 @@
+package replaylog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Snapshotter is an optional interface that State can implement to support
+// SaveSnapshot and LoadSnapshot. It is also used by SnapshotOp and Checkpoint.
+type Snapshotter interface {
+	// Snapshot serialises the State.
+	Snapshot() ([]byte, error)
+	// Restore replaces the State with a serialised snapshot.
+	Restore(data []byte) error
+}
+
+// SaveSnapshot replays the whole log into a new State and writes a snapshot of
+// it to w, along with the position of the end of the log.
+//
+// State must implement Snapshotter.
+func (l *Log[State]) SaveSnapshot(w io.Writer) error {
+	state := newState[State]()
+	snapshotter, ok := any(state).(Snapshotter)
+	if !ok {
+		return fmt.Errorf("can't snapshot state of type %T, it must implement Snapshotter", state)
+	}
+	var offset int64
+	err := l.fromStart(func(r *reader) error {
+		if err := l.replayShadow(r, state); err != nil {
+			return err
+		}
+		offset = r.offset
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	data, err := snapshotter.Snapshot()
+	if err != nil {
+		return fmt.Errorf("failed to snapshot state: %w", err)
+	}
+	if err := json.NewEncoder(w).Encode(snapshotFile{Offset: offset, State: data}); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshot restores dest from a snapshot written by SaveSnapshot, then
+// replays the entries appended to the log after the snapshot was taken.
+//
+// State must implement Snapshotter.
+func (l *Log[State]) LoadSnapshot(r io.Reader, dest State) error {
+	defer l.startReplaying()()
+	snapshotter, ok := any(dest).(Snapshotter)
+	if !ok {
+		return fmt.Errorf("can't restore state of type %T, it must implement Snapshotter", dest)
+	}
+	snapshot := snapshotFile{}
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return fmt.Errorf("corrupt snapshot: %w", err)
+	}
+	size, err := l.fileSize()
+	if err != nil {
+		return err
+	}
+	if snapshot.Offset < 0 || snapshot.Offset > size {
+		return fmt.Errorf("snapshot is at offset %d, beyond the end of the log at %d", snapshot.Offset, size)
+	}
+	if err := snapshotter.Restore(snapshot.State); err != nil {
+		return fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+	if _, err := l.f.Seek(snapshot.Offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek to snapshot offset: %w", err)
+	}
+	return l.replay(l.newReader(l.f, snapshot.Offset), dest)
+}
@@ -0,0 +1,47 @@
+package replaylog
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+type snapshotKVState map[string]string
+
+func (s snapshotKVState) Snapshot() ([]byte, error) { return json.Marshal(map[string]string(s)) }
+
+func (s snapshotKVState) Restore(data []byte) error {
+	for key := range s {
+		delete(s, key)
+	}
+	return json.Unmarshal(data, (*map[string]string)(&s))
+}
+
+type setSnapshotKV struct {
+	Key   string `json:"k"`
+	Value string `json:"v"`
+}
+
+func (s *setSnapshotKV) Apply(state snapshotKVState) error {
+	state[s.Key] = s.Value
+	return nil
+}
+
+func TestSnapshotter(t *testing.T) {
+	log, err := New[snapshotKVState](&MemoryFile{}, []Op[snapshotKVState]{&setSnapshotKV{}})
+	assert.NoError(t, err)
+	assert.NoError(t, log.Append(&setSnapshotKV{Key: "a", Value: "1"}))
+	assert.NoError(t, log.Append(&setSnapshotKV{Key: "b", Value: "2"}))
+	w := &bytes.Buffer{}
+	assert.NoError(t, log.SaveSnapshot(w))
+	assert.NoError(t, log.Append(&setSnapshotKV{Key: "a", Value: "3"}))
+
+	state := snapshotKVState{"stale": "x"}
+	assert.NoError(t, log.LoadSnapshot(w, state))
+	assert.Equal(t, snapshotKVState{"a": "3", "b": "2"}, state)
+
+	kv := newTestLog(t)
+	assert.Error(t, kv.SaveSnapshot(&bytes.Buffer{}))
+}
@@ -0,0 +1,57 @@
+package replaylog
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// SnapshotOp is an Op that replaces the entire State with a serialised
+// snapshot of it, allowing full checkpoints to be recorded inline in the log.
+//
+// The snapshot must be JSON. If State implements Snapshotter the snapshot is
+// passed to Restore, otherwise it is decoded into the State after clearing it, which requires State to
+// be a non-nil map or pointer.
+//
+// Register it with New as &SnapshotOp[State]{}, and append it with
+// AppendSnapshot.
+type SnapshotOp[State any] struct {
+	Snapshot json.RawMessage `json:"s"`
+}
+
+func (s *SnapshotOp[State]) Apply(state State) error {
+	if snapshotter, ok := any(state).(Snapshotter); ok {
+		if err := snapshotter.Restore(s.Snapshot); err != nil {
+			return fmt.Errorf("failed to restore snapshot: %w", err)
+		}
+		return nil
+	}
+	v := reflect.ValueOf(state)
+	switch {
+	case v.Kind() == reflect.Ptr && !v.IsNil():
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	case v.Kind() == reflect.Map && !v.IsNil():
+		if err := reset(state); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("can't replace state of type %T, it must be a non-nil map or pointer, or implement Snapshotter", state)
+	}
+	if err := json.Unmarshal(s.Snapshot, &state); err != nil {
+		return fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+	return nil
+}
+
+// AppendSnapshot appends a SnapshotOp containing state serialised as JSON by
+// "marshal", such as json.Marshal.
+//
+// Replaying the log discards the State accumulated before the snapshot and
+// applies later ops on top of it. SnapshotOp must be registered with the log.
+func (l *Log[State]) AppendSnapshot(state State, marshal func(State) ([]byte, error)) error {
+	data, err := marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot state: %w", err)
+	}
+	return l.Append(&SnapshotOp[State]{Snapshot: data})
+}
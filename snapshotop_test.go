@@ -0,0 +1,36 @@
+package replaylog
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestAppendSnapshot(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "")
+	assert.NoError(t, err)
+	log, err := New[KV](f, []Op[KV]{&Set{}, &Delete{}, &SnapshotOp[KV]{}})
+	assert.NoError(t, err)
+	defer log.Close()
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"})
+	err = log.AppendSnapshot(KV{"snap": "shot", "bar": "foo"}, func(state KV) ([]byte, error) { return json.Marshal(state) })
+	assert.NoError(t, err)
+	appendAll(t, log, &Delete{Key: "snap"})
+	assert.Equal(t, KV{"bar": "foo"}, replay(t, log))
+}
+
+func TestSnapshotOpPointerState(t *testing.T) {
+	type doc struct {
+		A string
+		B string
+	}
+	state := &doc{A: "a", B: "b"}
+	err := (&SnapshotOp[*doc]{Snapshot: json.RawMessage(`{"A":"x"}`)}).Apply(state)
+	assert.NoError(t, err)
+	assert.Equal(t, &doc{A: "x"}, state)
+
+	err = (&SnapshotOp[[]string]{Snapshot: json.RawMessage(`[]`)}).Apply(nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,153 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Splice rewrites dst to contain its first "at" entries, followed by every
+// entry of src, followed by the remaining entries of dst.
+//
+// dst must be an *os.File, and src must have the same SchemaFingerprint as
+// dst, otherwise an error wrapping ErrSchemaMismatch is returned. Ops are
+// re-encoded using the options of dst as for Transcode, preserving their
+// application versions, timestamps and metadata, and renumbering them if dst uses
+// WithSequenceNumbers. The result is written to a temporary file in the same
+// directory, then atomically renamed over dst, leaving dst positioned at its
+// end. Appends to dst are blocked for the duration.
+//
+// src is read from the start, and its position restored afterwards.
+func Splice[State any](dst *Log[State], at int, src *Log[State]) error {
+	if dst == src {
+		return errors.New("can't splice a log into itself")
+	}
+	if src.SchemaFingerprint() != dst.SchemaFingerprint() {
+		return fmt.Errorf("%w: can't splice logs with different ops", ErrSchemaMismatch)
+	}
+	dst.lock.Lock()
+	defer dst.lock.Unlock()
+	if dst.readOnly {
+		return ErrReadOnly
+	}
+	path, ok := dst.f.(*os.File)
+	if !ok {
+		return fmt.Errorf("can't splice into log of type %T, it must be an *os.File", dst.f)
+	}
+	entries, err := dst.count()
+	if err != nil {
+		return err
+	}
+	if at < 0 || at > entries {
+		return fmt.Errorf("can't splice at entry %d of log with %d entries", at, entries)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path.Name()), filepath.Base(path.Name())+".*.splice")
+	if err != nil {
+		return fmt.Errorf("failed to create spliced log: %w", err)
+	}
+	spliced, err := spliceInto(tmp, dst, at, src)
+	if err == nil {
+		err = os.Rename(tmp.Name(), path.Name())
+	}
+	if err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	_ = dst.f.Close()
+	dst.f = reopenRenamed(tmp, path.Name())
+	dst.buf = nil
+	dst.size = spliced.size
+	dst.entries = spliced.entries
+	dst.pending = 0
+	dst.ids.reset()
+	dst.lamportLoaded = false
+	if dst.snapshotEvery > 0 {
+		// Offsets in the previous snapshot refer to the original log.
+		dst.snapshots = periodicSnapshots[State]{}
+	}
+	return nil
+}
+
+// spliceInto writes the entries of dst with those of src spliced in at "at" to
+// f, then syncs it. Must be called with the lock of dst held.
+func spliceInto[State any](f *os.File, dst *Log[State], at int, src *Log[State]) (*Log[State], error) {
+	spliced := dst.withFile(f)
+	if dst.header {
+		if err := spliced.initHeader(); err != nil {
+			return nil, err
+		}
+	}
+	entries := 0
+	err := dst.rewound(func(r *reader) error {
+		n, err := spliced.copyEntries(dst, r, at)
+		entries += n
+		if err != nil {
+			return err
+		}
+		err = src.fromStart(func(sr *reader) error {
+			n, err := spliced.copyEntries(src, sr, -1)
+			entries += n
+			if err != nil {
+				return fmt.Errorf("source: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		n, err = spliced.copyEntries(dst, r, -1)
+		entries += n
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := spliced.sync(); err != nil {
+		return nil, err
+	}
+	spliced.entries = entries
+	if spliced.size, err = spliced.f.Seek(0, io.SeekCurrent); err != nil {
+		return nil, fmt.Errorf("failed to determine spliced log size: %w", err)
+	}
+	return spliced, nil
+}
+
+// copyEntries re-encodes up to "limit" entries of "from" read from r, or all of
+// them if "limit" is negative, and writes them to l without syncing, returning
+// the number written.
+func (l *Log[State]) copyEntries(from *Log[State], r *reader, limit int) (int, error) {
+	n := 0
+	for ; limit < 0 || n < limit; n++ {
+		logEntry, err := from.nextEntry(r)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return n, fmt.Errorf("entry %d: %w", r.index-1, err)
+		}
+		op, err := from.decodeOp(logEntry)
+		if err != nil {
+			return n, fmt.Errorf("entry %d: %w", r.index-1, err)
+		}
+		e, err := l.newEntry(op)
+		if err != nil {
+			return n, fmt.Errorf("entry %d: %w", r.index-1, err)
+		}
+		e.Version = logEntry.Version
+		if l.timestamps {
+			e.Time = logEntry.Time
+		}
+		e.Meta = logEntry.Meta
+		e.Group, e.GroupContext = logEntry.Group, logEntry.GroupContext
+		frame, err := l.encodeFrame(e)
+		if err != nil {
+			return n, fmt.Errorf("entry %d: %w", r.index-1, err)
+		}
+		if err := l.write(frame); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
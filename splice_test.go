@@ -0,0 +1,36 @@
+package replaylog
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestSplice(t *testing.T) {
+	dst := newTestLog(t, WithSequenceNumbers())
+	path := dst.f.(*os.File).Name()
+	appendAll(t, dst, &Set{Key: "a", Value: "1"}, &Set{Key: "b", Value: "2"}, &Delete{Key: "a"})
+	src := newTestLog(t)
+	appendAll(t, src, &Set{Key: "a", Value: "3"}, &Set{Key: "c", Value: "4"})
+
+	assert.NoError(t, Splice(dst, 1, src))
+	appendAll(t, dst, &Set{Key: "d", Value: "5"})
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"k":0,"e":{"k":"a","v":"1"},"s":1}
+{"k":0,"e":{"k":"a","v":"3"},"s":2}
+{"k":0,"e":{"k":"c","v":"4"},"s":3}
+{"k":0,"e":{"k":"b","v":"2"},"s":4}
+{"k":1,"e":{"k":"a"},"s":5}
+{"k":0,"e":{"k":"d","v":"5"},"s":6}
+`, string(data))
+	assert.Equal(t, KV{"b": "2", "c": "4", "d": "5"}, replay(t, dst))
+	assert.Equal(t, KV{"a": "3", "c": "4"}, replay(t, src))
+
+	assert.EqualError(t, Splice(dst, 7, src), "can't splice at entry 7 of log with 6 entries")
+	other, err := New[KV](&MemoryFile{}, []Op[KV]{&Set{}})
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(Splice(dst, 0, other), ErrSchemaMismatch))
+}
@@ -0,0 +1,131 @@
+package replaylog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"os"
+)
+
+// stagedHeader precedes the entries written to the staging file by
+// WithStagedWrites.
+type stagedHeader struct {
+	Offset int64  `json:"offset"`
+	Length int    `json:"length"`
+	CRC64  string `json:"crc64"`
+}
+
+// openStaging opens the staging file for WithStagedWrites and recovers any
+// staged append.
+func (l *Log[State]) openStaging() error {
+	f, ok := l.f.(*os.File)
+	if !ok {
+		return fmt.Errorf("WithStagedWrites: log must be an *os.File but is %T", l.f)
+	}
+	staging, err := os.OpenFile(f.Name()+".staged", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open staging file: %w", err)
+	}
+	l.staging = staging
+	if err := l.recoverStaged(f); err != nil {
+		_ = staging.Close()
+		return err
+	}
+	return nil
+}
+
+// recoverStaged ensures that the log contains any complete staged append.
+func (l *Log[State]) recoverStaged(f *os.File) error {
+	data, err := io.ReadAll(io.NewSectionReader(l.staging, 0, 1<<62))
+	if err != nil {
+		return fmt.Errorf("failed to read staging file: %w", err)
+	}
+	header, frames, ok := parseStaged(data)
+	if !ok {
+		// Nothing, or only part of an append, was staged, so the log was
+		// not written to.
+		return l.unstage()
+	}
+	pos, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to determine log position: %w", err)
+	}
+	existing := make([]byte, len(frames))
+	n, err := f.ReadAt(existing, header.Offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read staged entries from log: %w", err)
+	}
+	if n < len(frames) || !bytes.Equal(existing, frames) {
+		if err := f.Truncate(header.Offset); err != nil {
+			return fmt.Errorf("failed to truncate log to staged offset: %w", err)
+		}
+		if _, err := f.WriteAt(frames, header.Offset); err != nil {
+			return fmt.Errorf("failed to write staged entries to log: %w", err)
+		}
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("failed to sync log: %w", err)
+		}
+		if pos > header.Offset+int64(len(frames)) {
+			pos = header.Offset + int64(len(frames))
+		}
+		if _, err := f.Seek(pos, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to restore log position: %w", err)
+		}
+	}
+	return l.unstage()
+}
+
+// parseStaged parses the contents of a staging file, returning false if it
+// does not contain a complete staged append.
+func parseStaged(data []byte) (stagedHeader, []byte, bool) {
+	header := stagedHeader{}
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 || json.Unmarshal(data[:i], &header) != nil {
+		return header, nil, false
+	}
+	frames := data[i+1:]
+	if len(frames) != header.Length || header.Offset < 0 || fmt.Sprintf("%016x", crc64.Checksum(frames, crc64Table)) != header.CRC64 {
+		return header, nil, false
+	}
+	return header, frames, true
+}
+
+// stage frames that are about to be written at the current position of the
+// log. Must be called with the lock held.
+func (l *Log[State]) stage(frames []byte) error {
+	offset, err := l.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to determine log position: %w", err)
+	}
+	header, err := json.Marshal(stagedHeader{
+		Offset: offset,
+		Length: len(frames),
+		CRC64:  fmt.Sprintf("%016x", crc64.Checksum(frames, crc64Table)),
+	})
+	if err != nil {
+		return err
+	}
+	if err := l.staging.Truncate(0); err != nil {
+		return fmt.Errorf("failed to clear staging file: %w", err)
+	}
+	data := append(append(header, '\n'), frames...)
+	if _, err := l.staging.WriteAt(data, 0); err != nil {
+		return fmt.Errorf("failed to write staging file: %w", err)
+	}
+	if err := l.staging.Sync(); err != nil {
+		return fmt.Errorf("failed to sync staging file: %w", err)
+	}
+	return nil
+}
+
+// unstage clears the staging file once the staged entries are durable in the
+// log.
+func (l *Log[State]) unstage() error {
+	if err := l.staging.Truncate(0); err != nil {
+		return fmt.Errorf("failed to clear staging file: %w", err)
+	}
+	return nil
+}
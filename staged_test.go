@@ -0,0 +1,58 @@
+package replaylog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestWithStagedWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	open := func() *Log[KV] {
+		t.Helper()
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+		assert.NoError(t, err)
+		log, err := New[KV](f, ops, WithStagedWrites())
+		assert.NoError(t, err)
+		return log
+	}
+	staged := func() string {
+		t.Helper()
+		data, err := os.ReadFile(path + ".staged")
+		assert.NoError(t, err)
+		return string(data)
+	}
+
+	log := open()
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"})
+	assert.Equal(t, "", staged())
+	assert.Equal(t, KV{"foo": "bar"}, replay(t, log))
+
+	t.Run("RecoverTornWrite", func(t *testing.T) {
+		// Simulate a crash part way through writing a staged append.
+		frame, err := log.encode(&Set{Key: "bar", Value: "waz"})
+		assert.NoError(t, err)
+		assert.NoError(t, log.stage(frame))
+		_, err = log.f.Write(frame[:10])
+		assert.NoError(t, err)
+		assert.NoError(t, log.f.Close())
+		assert.NoError(t, log.staging.Close())
+
+		log = open()
+		assert.Equal(t, "", staged())
+		assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, replay(t, log))
+		appendAll(t, log, &Delete{Key: "foo"})
+		assert.Equal(t, KV{"bar": "waz"}, replay(t, log))
+	})
+
+	t.Run("DiscardIncompleteStaging", func(t *testing.T) {
+		assert.NoError(t, log.Close())
+		assert.NoError(t, os.WriteFile(path+".staged", []byte(`{"offset":0,"length":100,"crc64":"0000000000000000"}`+"\n"+`{"k":0`), 0600))
+		log = open()
+		defer log.Close()
+		assert.Equal(t, "", staged())
+		assert.Equal(t, KV{"bar": "waz"}, replay(t, log))
+	})
+}
@@ -0,0 +1,59 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Step decodes the next op in the log without applying it, for driving replay
+// manually.
+//
+// If an op is decoded, the log is positioned after it and Step returns the op
+// along with a function that applies it to dest, as Replay would. The op is
+// skipped if the function is not called, and calling it more than once returns
+// an error. Ops are returned regardless of WithReplayFilter, and the parents of
+// ops implementing ParentedOp are not resolved.
+//
+// At the end of the log Step returns true, and the position is unchanged. If
+// the next entry is corrupt, Step returns an error and the position is
+// likewise unchanged.
+func (l *Log[State]) Step(dest State) (op Op[State], apply func() error, eof bool, err error) {
+	r, err := l.currentReader()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	logEntry, err := l.nextEntry(r)
+	if errors.Is(err, io.EOF) {
+		return nil, nil, true, l.reposition(r)
+	}
+	if err != nil {
+		return nil, nil, false, l.repositionAfter(err, r.start)
+	}
+	if op, err = l.decodeOp(logEntry); err != nil {
+		return nil, nil, false, l.repositionAfter(err, r.start)
+	}
+	if err := l.reposition(r); err != nil {
+		return nil, nil, false, err
+	}
+	applied := false
+	apply = func() error {
+		if applied {
+			return fmt.Errorf("op %T has already been applied", op)
+		}
+		applied = true
+		if err := l.apply(logEntry, op, nil, dest); err != nil {
+			return fmt.Errorf("could not apply event of type %T: %w", op, err)
+		}
+		return nil
+	}
+	return op, apply, false, nil
+}
+
+// repositionAfter seeks the log to "offset" after err occurred, returning err.
+func (l *Log[State]) repositionAfter(err error, offset int64) error {
+	if _, serr := l.f.Seek(offset, io.SeekStart); serr != nil {
+		return fmt.Errorf("%w (and failed to reposition log: %s)", err, serr)
+	}
+	return err
+}
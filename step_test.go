@@ -0,0 +1,52 @@
+package replaylog
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestStep(t *testing.T) {
+	log := newTestLog(t)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"}, &Delete{Key: "foo"})
+	assert.NoError(t, log.Rewind())
+
+	state := KV{}
+	op, apply, eof, err := log.Step(state)
+	assert.NoError(t, err)
+	assert.False(t, eof)
+	assert.Equal(t, Op[KV](&Set{Key: "foo", Value: "bar"}), op)
+	assert.NoError(t, apply())
+	assert.Error(t, apply())
+
+	// Skip the next op by not applying it.
+	op, _, _, err = log.Step(state)
+	assert.NoError(t, err)
+	assert.Equal(t, Op[KV](&Set{Key: "bar", Value: "waz"}), op)
+
+	op, apply, _, err = log.Step(state)
+	assert.NoError(t, err)
+	assert.Equal(t, Op[KV](&Delete{Key: "foo"}), op)
+	assert.NoError(t, apply())
+	assert.Equal(t, KV{}, state)
+
+	_, _, eof, err = log.Step(state)
+	assert.NoError(t, err)
+	assert.True(t, eof)
+
+	appendAll(t, log, &Set{Key: "waz", Value: "foo"})
+	assert.Equal(t, KV{"bar": "waz", "waz": "foo"}, replay(t, log))
+}
+
+func TestStepCorrupt(t *testing.T) {
+	f := writeTestFile(t, `{"k":0,"e":{"k":"foo","v":"bar"}}`+"\n"+`{"k":9,"e":{}}`+"\n")
+	log, err := New[KV](f, ops)
+	assert.NoError(t, err)
+	_, apply, _, err := log.Step(KV{})
+	assert.NoError(t, err)
+	assert.NoError(t, apply())
+	for i := 0; i < 2; i++ {
+		_, _, _, err = log.Step(KV{})
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,71 @@
+package replaylog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// SnapshotStore persists the latest snapshot of a State, with the offset in
+// the log it was taken at, for WithSnapshotStore.
+//
+// Implementations may be backed by a file, as FileSnapshotStore is, or by any
+// other storage such as an object store.
+type SnapshotStore interface {
+	// Load returns the latest snapshot, or an error wrapping os.ErrNotExist if
+	// none has been saved.
+	Load() (state []byte, offset int64, err error)
+	// Save replaces the latest snapshot.
+	Save(state []byte, offset int64) error
+}
+
+// FileSnapshotStore returns a SnapshotStore that keeps the latest snapshot in
+// the file at "path", which is replaced atomically on each save.
+//
+// The format is that written by WithPeriodicSnapshot.
+func FileSnapshotStore(path string) SnapshotStore {
+	return fileSnapshotStore(path)
+}
+
+type fileSnapshotStore string
+
+func (f fileSnapshotStore) Load() ([]byte, int64, error) {
+	data, err := os.ReadFile(string(f))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	snapshot := snapshotFile{}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, 0, fmt.Errorf("corrupt snapshot %s: %w", string(f), err)
+	}
+	return snapshot.State, snapshot.Offset, nil
+}
+
+func (f fileSnapshotStore) Save(state []byte, offset int64) error {
+	data, err := json.Marshal(snapshotFile{Offset: offset, State: state})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(string(f), data)
+}
+
+// snapshotterMarshal returns a marshal function for WithSnapshotStore, which
+// requires State to implement Snapshotter.
+func snapshotterMarshal[State any]() (func(State) ([]byte, error), error) {
+	if _, ok := any(newState[State]()).(Snapshotter); !ok {
+		var state State
+		return nil, fmt.Errorf("WithSnapshotStore: state of type %T must implement Snapshotter", state)
+	}
+	return func(state State) ([]byte, error) {
+		return any(state).(Snapshotter).Snapshot() // nolint: forcetypeassert
+	}, nil
+}
+
+// restoreSnapshotter restores a State implementing Snapshotter.
+func restoreSnapshotter[State any](data []byte, dest State) error {
+	snapshotter, ok := any(dest).(Snapshotter)
+	if !ok {
+		return fmt.Errorf("can't restore state of type %T, it must implement Snapshotter", dest)
+	}
+	return snapshotter.Restore(data)
+}
@@ -0,0 +1,63 @@
+package replaylog
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+type memSnapshotStore struct {
+	state  []byte
+	offset int64
+	saves  int
+}
+
+func (m *memSnapshotStore) Load() ([]byte, int64, error) {
+	if m.state == nil {
+		return nil, 0, fmt.Errorf("no snapshot: %w", os.ErrNotExist)
+	}
+	return m.state, m.offset, nil
+}
+
+func (m *memSnapshotStore) Save(state []byte, offset int64) error {
+	m.state, m.offset = state, offset
+	m.saves++
+	return nil
+}
+
+func TestWithSnapshotStore(t *testing.T) {
+	store := &memSnapshotStore{}
+	f := &MemoryFile{}
+	ops := []Op[snapshotKVState]{&setSnapshotKV{}}
+	log, err := New(f, ops, WithSnapshotStore(store, 2))
+	assert.NoError(t, err)
+	state := snapshotKVState{}
+	assert.NoError(t, log.Replay(state))
+	assert.NoError(t, log.Append(&setSnapshotKV{Key: "a", Value: "1"}))
+	assert.NoError(t, log.Append(&setSnapshotKV{Key: "b", Value: "2"}))
+	assert.Equal(t, 1, store.saves)
+	assert.Equal(t, `{"a":"1","b":"2"}`, string(store.state))
+	assert.NoError(t, log.Append(&setSnapshotKV{Key: "a", Value: "3"}))
+
+	// Only the tail after the snapshot is read from the log.
+	for i := range f.data[:store.offset] {
+		f.data[i] = ' '
+	}
+	f.pos = 0
+	log, err = New(f, ops, WithSnapshotStore(store, 2))
+	assert.NoError(t, err)
+	state = snapshotKVState{}
+	assert.NoError(t, log.Replay(state))
+	assert.Equal(t, snapshotKVState{"a": "3", "b": "2"}, state)
+
+	// The next snapshot builds on the restored one.
+	assert.NoError(t, log.Append(&setSnapshotKV{Key: "c", Value: "4"}))
+	assert.NoError(t, log.Append(&setSnapshotKV{Key: "d", Value: "5"}))
+	assert.Equal(t, 2, store.saves)
+	assert.Equal(t, `{"a":"3","b":"2","c":"4","d":"5"}`, string(store.state))
+
+	_, err = New[KV](&MemoryFile{}, []Op[KV]{&Set{}}, WithSnapshotStore(store, 2))
+	assert.EqualError(t, err, "WithSnapshotStore: state of type replaylog.KV must implement Snapshotter")
+}
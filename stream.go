@@ -0,0 +1,173 @@
+package replaylog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrSchemaMismatch is returned by StreamImport when the stream was exported
+// from a log whose ops have a different SchemaFingerprint, and by ReplayChunk
+// for a ResumeToken created by such a log.
+var ErrSchemaMismatch = errors.New("schema fingerprint mismatch")
+
+// streamMagic starts every stream written by StreamExport.
+const streamMagic = "RLS1"
+
+// maxStreamEntry bounds the length prefix of a stream entry, so that a corrupt
+// prefix doesn't cause an enormous allocation.
+const maxStreamEntry = 1 << 30
+
+// streamHeader follows streamMagic at the start of a stream.
+type streamHeader struct {
+	Fingerprint string `json:"fingerprint"`
+	Entries     int    `json:"entries"`
+}
+
+// StreamExport writes every entry in the log to w in a compact binary format
+// for shipping to another process with StreamImport, eg. as the body of an
+// HTTP request.
+//
+// The stream starts with a header holding the SchemaFingerprint of the log and
+// its number of entries, followed by each raw entry prefixed by its length as a
+// big-endian uint32. The position of the log is preserved.
+func (l *Log[State]) StreamExport(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	err := l.fromStart(func(r *reader) error {
+		count := 0
+		for {
+			if _, err := r.next(); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return fmt.Errorf("entry %d: %w", r.index, err)
+			}
+			count++
+		}
+		header, err := json.Marshal(streamHeader{Fingerprint: l.SchemaFingerprint(), Entries: count})
+		if err != nil {
+			return err
+		}
+		if _, err := bw.WriteString(streamMagic); err != nil {
+			return err
+		}
+		if err := writeStreamEntry(bw, header); err != nil {
+			return err
+		}
+		if _, err := l.f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to rewind log: %w", err)
+		}
+		r = l.newReader(l.f, 0)
+		for {
+			data, err := r.next()
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return fmt.Errorf("entry %d: %w", r.index, err)
+			}
+			if err := writeStreamEntry(bw, data); err != nil {
+				return err
+			}
+		}
+		if r.index != count {
+			return fmt.Errorf("log changed during export: expected %d entries but read %d", count, r.index)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// StreamImport appends the entries of a stream written by StreamExport.
+//
+// An error wrapping ErrSchemaMismatch is returned, and nothing is appended, if
+// the fingerprint of the exporting log doesn't match that of this log. Each
+// entry is decoded and appended as an op, in batches, so if an error occurs
+// ops up to the failing batch have already been appended.
+func (l *Log[State]) StreamImport(r io.Reader) error {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(streamMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return fmt.Errorf("failed to read stream header: %w", err)
+	}
+	if string(magic) != streamMagic {
+		return fmt.Errorf("not a log stream: unexpected magic %q", magic)
+	}
+	data, err := readStreamEntry(br)
+	if err != nil {
+		return fmt.Errorf("failed to read stream header: %w", err)
+	}
+	header := streamHeader{}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return fmt.Errorf("corrupt stream header: %w", err)
+	}
+	if fingerprint := l.SchemaFingerprint(); header.Fingerprint != fingerprint {
+		return fmt.Errorf("%w: stream has %s but log has %s", ErrSchemaMismatch, header.Fingerprint, fingerprint)
+	}
+	batch := l.Batch()
+	defer batch.Discard()
+	for index := 0; index < header.Entries; index++ {
+		data, err := readStreamEntry(br)
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("stream truncated after %d of %d entries", index, header.Entries)
+		} else if err != nil {
+			return fmt.Errorf("entry %d: %w", index, err)
+		}
+		logEntry, err := l.decodeEntry(data)
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", index, err)
+		}
+		op, err := l.decodeOp(logEntry)
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", index, err)
+		}
+		if err := batch.Add(op); err != nil {
+			return fmt.Errorf("entry %d: %w", index, err)
+		}
+		if batch.Len() >= appendBatchSize {
+			if _, err := batch.Commit(); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := br.ReadByte(); !errors.Is(err, io.EOF) {
+		return fmt.Errorf("stream has data after its %d entries", header.Entries)
+	}
+	_, err = batch.Commit()
+	return err
+}
+
+// writeStreamEntry writes data prefixed by its length.
+func writeStreamEntry(w *bufio.Writer, data []byte) error {
+	var prefix [4]byte
+	binary.BigEndian.PutUint32(prefix[:], uint32(len(data)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// readStreamEntry reads a length-prefixed entry, returning io.EOF only if the
+// stream ends before the prefix.
+func readStreamEntry(r *bufio.Reader) ([]byte, error) {
+	var prefix [4]byte
+	if _, err := io.ReadFull(r, prefix[:]); errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("truncated length prefix: %w", err)
+	} else if err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(prefix[:])
+	if size > maxStreamEntry {
+		return nil, fmt.Errorf("entry of %d bytes exceeds the maximum of %d", size, maxStreamEntry)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("truncated entry: %w", io.ErrUnexpectedEOF)
+	}
+	return data, nil
+}
@@ -0,0 +1,31 @@
+package replaylog
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestStreamExportImport(t *testing.T) {
+	src := newTestLog(t)
+	appendAll(t, src, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"}, &Delete{Key: "foo"})
+	w := &bytes.Buffer{}
+	assert.NoError(t, src.StreamExport(w))
+	stream := w.Bytes()
+	assert.Equal(t, "RLS1", string(stream[:4]))
+
+	dst := newTestLog(t)
+	assert.NoError(t, dst.StreamImport(bytes.NewReader(stream)))
+	assert.Equal(t, KV{"bar": "waz"}, replay(t, dst))
+
+	err := dst.StreamImport(bytes.NewReader(stream[:len(stream)-3]))
+	assert.EqualError(t, err, "entry 2: truncated entry: unexpected EOF")
+
+	other, err := New[KV](&MemoryFile{}, []Op[KV]{&Set{}})
+	assert.NoError(t, err)
+	err = other.StreamImport(bytes.NewReader(stream))
+	assert.True(t, errors.Is(err, ErrSchemaMismatch))
+	assert.Equal(t, KV{}, replay(t, other))
+}
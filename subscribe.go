@@ -0,0 +1,70 @@
+package replaylog
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// subscriberBuffer is the number of ops buffered for each subscriber before
+// further ops are dropped.
+const subscriberBuffer = 64
+
+type subscribers[State any] struct {
+	next    int
+	chans   map[int]chan Op[State]
+	dropped atomic.Uint64
+}
+
+// Subscribe to ops appended to the log.
+//
+// Each op is delivered after it has been durably appended. Delivery never
+// blocks Append: if a subscriber falls more than a small number of ops
+// behind, further ops are dropped for that subscriber and counted by Dropped.
+//
+// The returned function unsubscribes and closes the channel.
+func (l *Log[State]) Subscribe() (<-chan Op[State], func()) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.subscribers.chans == nil {
+		l.subscribers.chans = map[int]chan Op[State]{}
+	}
+	id := l.subscribers.next
+	l.subscribers.next++
+	ch := make(chan Op[State], subscriberBuffer)
+	l.subscribers.chans[id] = ch
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			l.lock.Lock()
+			defer l.lock.Unlock()
+			delete(l.subscribers.chans, id)
+			close(ch)
+		})
+	}
+}
+
+// Dropped returns the total number of ops dropped across all subscribers.
+func (l *Log[State]) Dropped() uint64 {
+	return l.subscribers.dropped.Load()
+}
+
+// publish op to all subscribers, the text mirror, the recent cache and the set
+// of IDs for AppendOnce. Must be called with the lock held.
+func (l *Log[State]) publish(op Op[State]) {
+	if l.commits.deferPublish(op) {
+		if id, ok := l.ids.reserve(op); ok {
+			l.commits.joined.ids = append(l.commits.joined.ids, id)
+		}
+		return
+	}
+	l.mirrorText(op)
+	l.ids.add(op)
+	l.recent.push(l.recentCache, op)
+	for _, ch := range l.subscribers.chans {
+		select {
+		case ch <- op:
+		default:
+			l.subscribers.dropped.Add(1)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package replaylog
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestSubscribe(t *testing.T) {
+	log := newTestLog(t)
+	ch, unsubscribe := log.Subscribe()
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Delete{Key: "foo"})
+	assert.Equal(t, Op[KV](&Set{Key: "foo", Value: "bar"}), <-ch)
+	assert.Equal(t, Op[KV](&Delete{Key: "foo"}), <-ch)
+
+	for i := 0; i < subscriberBuffer+2; i++ {
+		appendAll(t, log, &Delete{Key: "foo"})
+	}
+	assert.Equal(t, uint64(2), log.Dropped())
+
+	unsubscribe()
+	unsubscribe()
+	n := 0
+	for range ch {
+		n++
+	}
+	assert.Equal(t, subscriberBuffer, n)
+	appendAll(t, log, &Delete{Key: "foo"})
+}
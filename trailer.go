@@ -0,0 +1,133 @@
+package replaylog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+)
+
+var (
+	trailerPrefix = []byte(`{"crc64":`)
+	crc64Table    = crc64.MakeTable(crc64.ECMA)
+)
+
+type trailer struct {
+	CRC64 string `json:"crc64"`
+}
+
+// isTrailer returns true if frame is a trailer written by WithTrailer.
+func isTrailer(frame []byte) bool {
+	return bytes.HasPrefix(frame, trailerPrefix)
+}
+
+// trailerLength returns the length of the trailer line at the end of tail, or
+// 0 if tail does not end with a trailer.
+func trailerLength(tail []byte, delim byte) int {
+	if len(tail) == 0 || tail[len(tail)-1] != delim {
+		return 0
+	}
+	line := tail[bytes.LastIndexByte(tail[:len(tail)-1], delim)+1:]
+	if !isTrailer(line) {
+		return 0
+	}
+	return len(line)
+}
+
+// VerifyTrailer recomputes the checksum of the log and compares it to the
+// trailer written by WithTrailer, returning an error if they differ or the log
+// has no trailer.
+//
+// The position of the log is preserved.
+func (l *Log[State]) VerifyTrailer() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	tail, size, err := l.tail(64)
+	if err != nil {
+		return err
+	}
+	n := trailerLength(tail, l.delimiter)
+	if n == 0 {
+		return errors.New("log has no trailer")
+	}
+	t := trailer{}
+	if err := json.Unmarshal(tail[len(tail)-n:len(tail)-1], &t); err != nil {
+		return fmt.Errorf("corrupt trailer: %w", err)
+	}
+	sum, err := l.checksum(size - int64(n))
+	if err != nil {
+		return err
+	}
+	if actual := fmt.Sprintf("%016x", sum); actual != t.CRC64 {
+		return fmt.Errorf("log checksum %s does not match trailer checksum %s", actual, t.CRC64)
+	}
+	return nil
+}
+
+// checksum computes the CRC64 of the first "size" bytes of the log, preserving
+// its position. Must be called with the lock held.
+func (l *Log[State]) checksum(size int64) (uint64, error) {
+	h := crc64.New(crc64Table)
+	err := l.rewound(func(*reader) error {
+		if _, err := io.CopyN(h, l.f, size); err != nil {
+			return fmt.Errorf("failed to read log: %w", err)
+		}
+		return nil
+	})
+	return h.Sum64(), err
+}
+
+// removeTrailer truncates any trailer from the end of the log. Must be called
+// with the lock held.
+func (l *Log[State]) removeTrailer() error {
+	tail, size, err := l.tail(64)
+	if err != nil {
+		return err
+	}
+	n := int64(trailerLength(tail, l.delimiter))
+	if n == 0 {
+		return nil
+	}
+	t, ok := l.f.(Truncater)
+	if !ok {
+		return fmt.Errorf("can't remove trailer: File of type %T does not implement Truncater", l.f)
+	}
+	pos, err := l.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to determine log position: %w", err)
+	}
+	if err := t.Truncate(size - n); err != nil {
+		return fmt.Errorf("failed to remove trailer: %w", err)
+	}
+	if pos > size-n {
+		if _, err := l.f.Seek(size-n, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to reposition log: %w", err)
+		}
+	}
+	if l.tracksSize() {
+		l.size -= n
+	}
+	return nil
+}
+
+// writeTrailer appends a trailer to the log. Must be called with the lock held.
+func (l *Log[State]) writeTrailer() error {
+	size, err := l.f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to determine log size: %w", err)
+	}
+	sum, err := l.checksum(size)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(trailer{CRC64: fmt.Sprintf("%016x", sum)})
+	if err != nil {
+		return err
+	}
+	if err := l.write(l.terminate(data)); err != nil {
+		return err
+	}
+	return l.sync()
+}
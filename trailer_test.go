@@ -0,0 +1,59 @@
+package replaylog
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestTrailer(t *testing.T) {
+	path := t.TempDir() + "/log"
+	open := func() *Log[KV] {
+		t.Helper()
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+		assert.NoError(t, err)
+		log, err := New[KV](f, ops, WithTrailer(), WithCommitMarker(0))
+		assert.NoError(t, err)
+		return log
+	}
+
+	log := open()
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"})
+	assert.Error(t, log.VerifyTrailer())
+	assert.NoError(t, log.Close())
+
+	log = open()
+	assert.NoError(t, log.VerifyTrailer())
+	clean, err := log.ReplayClean(KV{})
+	assert.NoError(t, err)
+	assert.True(t, clean)
+	appendAll(t, log, &Set{Key: "bar", Value: "waz"})
+	assert.Error(t, log.VerifyTrailer())
+	assert.NoError(t, log.Close())
+
+	// Closing without appending replaces the trailer.
+	assert.NoError(t, open().Close())
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Equal(t, []string{
+		`{"k":0,"e":{"k":"foo","v":"bar"}}`,
+		`{"commit":true}`,
+		`{"k":0,"e":{"k":"bar","v":"waz"}}`,
+		`{"commit":true}`,
+	}, lines[:4])
+	assert.Equal(t, 5, len(lines))
+
+	log = open()
+	defer log.Close()
+	assert.NoError(t, log.VerifyTrailer())
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz"}, replay(t, log))
+
+	// Corrupt a byte.
+	data[10] = 'X'
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+	assert.Error(t, log.VerifyTrailer())
+}
@@ -0,0 +1,37 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Transcode appends every entry in src to dst, re-encoding each using the
+// options of dst.
+//
+// This can be used to migrate a log between encodings, such as enabling
+// compression. The op types registered with dst must match those of src for
+// every kind present in src. Application versions recorded with
+// WithAppVersion are preserved.
+//
+// src is read from the start, and its position restored afterwards.
+func Transcode[State any](dst, src *Log[State]) error {
+	if dst == src {
+		return errors.New("can't transcode a log into itself")
+	}
+	return src.eachOp(func(index int, logEntry Frame, op Op[State]) error {
+		e, err := dst.newEntry(op)
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", index, err)
+		}
+		if e.Kind != logEntry.Kind {
+			return fmt.Errorf("entry %d: op %s has kind %d in source but %d in destination", index, reflect.TypeOf(op), logEntry.Kind, e.Kind)
+		}
+		e.Version = logEntry.Version
+		frame, err := dst.encodeFrame(e)
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", index, err)
+		}
+		return dst.appendFrames(frame, 1)
+	})
+}
@@ -0,0 +1,32 @@
+package replaylog
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestTranscode(t *testing.T) {
+	src := newTestLog(t, WithAppVersion(3))
+	dst := newTestLog(t, WithCompression(CompressZstd))
+	appendAll(t, src, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"}, &Delete{Key: "foo"})
+
+	err := Transcode(dst, src)
+	assert.NoError(t, err)
+	assert.Equal(t, replay(t, src), replay(t, dst))
+
+	reports, err := dst.Scan()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(reports))
+
+	t.Run("KindMismatch", func(t *testing.T) {
+		f, err := ioutil.TempFile(t.TempDir(), "")
+		assert.NoError(t, err)
+		swapped, err := New[KV](f, []Op[KV]{&Delete{}, &Set{}})
+		assert.NoError(t, err)
+		defer swapped.Close()
+		err = Transcode(swapped, src)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,76 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Truncater is an optional interface that a File can implement to support
+// truncating the log. *os.File implements it.
+type Truncater interface {
+	Truncate(size int64) error
+}
+
+// TruncateAt truncates the log immediately before the entry at "index",
+// discarding it and every later entry. The log is left positioned at its new
+// end. Truncating at the number of entries in the log leaves it unchanged.
+//
+// The File must implement Truncater.
+func (l *Log[State]) TruncateAt(index int) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.readOnly {
+		return ErrReadOnly
+	}
+	t, ok := l.f.(Truncater)
+	if !ok {
+		return fmt.Errorf("can't truncate log: File of type %T does not implement Truncater", l.f)
+	}
+	if index < 0 {
+		return fmt.Errorf("can't truncate at negative index %d", index)
+	}
+	offset := int64(-1)
+	err := l.rewound(func(r *reader) error {
+		for r.index <= index {
+			if _, err := r.next(); errors.Is(err, io.EOF) {
+				l.entries = r.index
+				if r.index == index {
+					offset = r.offset
+				}
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("entry %d: %w", r.index, err)
+			}
+		}
+		offset = r.start
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if offset < 0 {
+		return fmt.Errorf("can't truncate at entry %d of log with %d entries", index, l.entries)
+	}
+	if err := t.Truncate(offset); err != nil {
+		return fmt.Errorf("failed to truncate log: %w", err)
+	}
+	if _, err := l.f.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to reposition log: %w", err)
+	}
+	l.size = offset
+	l.entries = index
+	l.forgetEntries()
+	if l.snapshots.offset > offset {
+		l.snapshots.valid = false
+	}
+	return l.sync()
+}
+
+// forgetEntries discards what the log remembers about the ops in its entries,
+// after some of them have been removed. Must be called with the lock held.
+func (l *Log[State]) forgetEntries() {
+	l.ids.reset()
+	l.recent.reset()
+	l.lastOp = nil
+}
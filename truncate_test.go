@@ -0,0 +1,30 @@
+package replaylog
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestTruncateAt(t *testing.T) {
+	log := newTestLog(t)
+	appendAll(t, log, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"}, &Delete{Key: "foo"})
+
+	err := log.TruncateAt(2)
+	assert.NoError(t, err)
+	appendAll(t, log, &Set{Key: "waz", Value: "foo"})
+	assert.Equal(t, KV{"foo": "bar", "bar": "waz", "waz": "foo"}, replay(t, log))
+
+	err = log.TruncateAt(3)
+	assert.NoError(t, err)
+	err = log.TruncateAt(4)
+	assert.EqualError(t, err, "can't truncate at entry 4 of log with 3 entries")
+
+	err = log.TruncateAt(0)
+	assert.NoError(t, err)
+	assert.Equal(t, KV{}, replay(t, log))
+
+	stream, err := New[KV](&streamFile{}, ops)
+	assert.NoError(t, err)
+	assert.Error(t, stream.TruncateAt(0))
+}
@@ -0,0 +1,29 @@
+package replaylog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestExportImportTyped(t *testing.T) {
+	src := newTestLog(t)
+	appendAll(t, src, &Set{Key: "foo", Value: "bar"}, &Set{Key: "bar", Value: "waz"}, &Delete{Key: "foo"})
+	w := &bytes.Buffer{}
+	assert.NoError(t, src.ExportTyped(w))
+	assert.Equal(t, `{"type":"Set","data":{"k":"foo","v":"bar"}}
+{"type":"Set","data":{"k":"bar","v":"waz"}}
+{"type":"Delete","data":{"k":"foo"}}
+`, w.String())
+
+	// Import into a log with different kinds.
+	dst, err := New[KV](&MemoryFile{}, []Op[KV]{&Delete{}, clearAll{}, &Set{}})
+	assert.NoError(t, err)
+	assert.NoError(t, dst.ImportTyped(w))
+	assert.Equal(t, replay(t, src), replay(t, dst))
+
+	err = dst.ImportTyped(strings.NewReader(`{"type":"Rename","data":{}}`))
+	assert.EqualError(t, err, `entry 0: unknown op type "Rename"`)
+}
@@ -0,0 +1,126 @@
+package replaylog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ReversibleOp is an optional interface that an Op can implement to support
+// Undo.
+type ReversibleOp[State any] interface {
+	Op[State]
+	// Invert returns an Op that reverses the effect of this op, given the
+	// State immediately before it was applied.
+	Invert(state State) (Op[State], error)
+}
+
+// Undo appends the inverses of the ops of the last "n" entries of the log, most
+// recent first, atomically as for AppendAtomic, and returns them so that they
+// can be applied to a live State.
+//
+// The log is replayed from the start into a fresh State to obtain the State
+// before each of those ops, all of which must implement ReversibleOp. Nothing
+// is undone; the inverses are ordinary entries, so a subsequent Undo(n)
+// reverses this one.
+func (l *Log[State]) Undo(n int) ([]Op[State], error) {
+	var inverses []Op[State]
+	err := l.grouped(func() error {
+		var err error
+		if inverses, err = l.inverses(n); err != nil {
+			return err
+		}
+		inverses, err = l.appendAtomicLocked(inverses)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inverses, nil
+}
+
+// inverses returns the inverses of the ops of the last "n" entries, most recent
+// first. Must be called with the lock held.
+func (l *Log[State]) inverses(n int) ([]Op[State], error) {
+	count, err := l.count()
+	if err != nil {
+		return nil, err
+	}
+	if n < 1 || n > count {
+		return nil, fmt.Errorf("can't undo %d entries of log with %d entries", n, count)
+	}
+	start := count - n
+	state := newState[State]()
+	var inverses []Op[State]
+	err = l.rewound(func(r *reader) error {
+		_, err := l.replayUntil(r, state, replayControl[State]{
+			shadow: true,
+			accept: func(Frame) (apply, more bool) {
+				more = r.index <= start
+				return more, more
+			},
+		})
+		if err != nil {
+			return err
+		}
+		r = l.newReader(l.f, r.offset)
+		r.index = start
+		for {
+			logEntry, err := l.nextEntry(r)
+			if errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("entry %d: %w", r.index-1, err)
+			}
+			op, err := l.decodeOp(logEntry)
+			if err != nil {
+				return fmt.Errorf("entry %d: %w", r.index-1, err)
+			}
+			reversible, ok := op.(ReversibleOp[State])
+			if !ok {
+				return fmt.Errorf("can't undo entry %d: op of type %T does not implement ReversibleOp", r.index-1, op)
+			}
+			inverse, err := reversible.Invert(state)
+			if err != nil {
+				return fmt.Errorf("can't undo entry %d: %w", r.index-1, err)
+			}
+			inverses = append([]Op[State]{inverse}, inverses...)
+			if err := l.apply(logEntry, op, nil, state); err != nil {
+				return fmt.Errorf("could not apply event %d of type %T: %w", r.index-1, op, err)
+			}
+		}
+	})
+	return inverses, err
+}
+
+// ReplayTo replays the first "n" entries of the log into dest, reconstructing
+// the State as of entry n-1. The position of the log is preserved.
+func (l *Log[State]) ReplayTo(dest State, n int) error {
+	if n < 0 {
+		return fmt.Errorf("can't replay to negative entry %d", n)
+	}
+	defer l.startReplaying()()
+	if l.resetBeforeReplay {
+		if err := reset(dest); err != nil {
+			return err
+		}
+	}
+	return l.fromStart(func(r *reader) error {
+		_, err := l.replayUntil(r, dest, replayControl[State]{
+			accept: func(Frame) (apply, more bool) {
+				more = r.index <= n
+				return more, more
+			},
+		})
+		return err
+	})
+}
+
+// ReplayAsOf replays the entries of the log appended no later than "t", as
+// recorded by WithTimestamps, into dest, reconstructing the State as of that
+// time. It is ReplayRange from the start of the log, so entries without a
+// timestamp are not applied. The position of the log is preserved.
+func (l *Log[State]) ReplayAsOf(dest State, t time.Time) error {
+	return l.ReplayRange(dest, time.Unix(0, 0), t)
+}
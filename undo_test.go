@@ -0,0 +1,96 @@
+package replaylog
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// editKV sets or deletes a key, and can be inverted.
+type editKV struct {
+	Key     string `json:"k"`
+	Value   string `json:"v,omitempty"`
+	Deleted bool   `json:"d,omitempty"`
+}
+
+func (e *editKV) Apply(kv KV) error {
+	if e.Deleted {
+		delete(kv, e.Key)
+	} else {
+		kv[e.Key] = e.Value
+	}
+	return nil
+}
+
+func (e *editKV) Invert(kv KV) (Op[KV], error) {
+	prev, ok := kv[e.Key]
+	if !ok {
+		return &editKV{Key: e.Key, Deleted: true}, nil
+	}
+	return &editKV{Key: e.Key, Value: prev}, nil
+}
+
+func TestUndo(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "")
+	assert.NoError(t, err)
+	log, err := New[KV](f, []Op[KV]{&editKV{}})
+	assert.NoError(t, err)
+	defer log.Close()
+	for _, op := range []*editKV{{Key: "a", Value: "1"}, {Key: "a", Value: "2"}, {Key: "b", Value: "3"}} {
+		assert.NoError(t, log.Append(op))
+	}
+	inverses, err := log.Undo(2)
+	assert.NoError(t, err)
+	assert.Equal(t, []Op[KV]{&editKV{Key: "b", Deleted: true}, &editKV{Key: "a", Value: "1"}}, inverses)
+
+	state := KV{}
+	assert.NoError(t, log.Rewind())
+	assert.NoError(t, log.Replay(state))
+	assert.Equal(t, KV{"a": "1"}, state)
+
+	// Undoing the undo restores the original State.
+	_, err = log.Undo(2)
+	assert.NoError(t, err)
+	state = KV{}
+	assert.NoError(t, log.Rewind())
+	assert.NoError(t, log.Replay(state))
+	assert.Equal(t, KV{"a": "2", "b": "3"}, state)
+
+	_, err = log.Undo(8)
+	assert.EqualError(t, err, "can't undo 8 entries of log with 7 entries")
+
+	plain := newTestLog(t)
+	appendAll(t, plain, &Set{Key: "a", Value: "1"})
+	_, err = plain.Undo(1)
+	assert.EqualError(t, err, "can't undo entry 0: op of type *replaylog.Set does not implement ReversibleOp")
+}
+
+func TestReplayTo(t *testing.T) {
+	now := time.Unix(1000, 0)
+	log := newTestLog(t, WithTimestamps())
+	log.now = func() time.Time { return now }
+	for i, op := range []Op[KV]{&Set{Key: "a", Value: "1"}, &Set{Key: "b", Value: "2"}, &Delete{Key: "a"}} {
+		now = time.Unix(int64(1000*(i+1)), 0)
+		appendAll(t, log, op)
+	}
+
+	state := KV{}
+	assert.NoError(t, log.ReplayTo(state, 2))
+	assert.Equal(t, KV{"a": "1", "b": "2"}, state)
+	state = KV{}
+	assert.NoError(t, log.ReplayTo(state, 0))
+	assert.Equal(t, KV{}, state)
+
+	state = KV{}
+	assert.NoError(t, log.ReplayAsOf(state, time.Unix(1500, 0)))
+	assert.Equal(t, KV{"a": "1"}, state)
+	state = KV{}
+	assert.NoError(t, log.ReplayAsOf(state, time.Unix(3000, 0)))
+	assert.Equal(t, KV{"b": "2"}, state)
+
+	// The position of the log is preserved.
+	assert.NoError(t, log.Append(&Set{Key: "c", Value: "4"}))
+	assert.Equal(t, KV{"b": "2", "c": "4"}, replay(t, log))
+}
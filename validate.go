@@ -0,0 +1,168 @@
+package replaylog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Validate checks that every entry in the log can be decoded, including
+// validation against any schemas set by WithSchemas, without applying them.
+//
+// The position of the log is preserved.
+func (l *Log[State]) Validate() error {
+	return l.eachOp(func(int, Frame, Op[State]) error { return nil })
+}
+
+// CheckLogCompatible checks that every entry in the log is of a kind, or for a
+// NamedLog has a name, registered with the log, returning an error listing
+// those that aren't in the order they first appear.
+//
+// This is intended as a cheap check at startup that a binary can replay an
+// existing log. Events are not decoded, and the check is not relaxed by
+// WithUnknownKindPolicy or WithFallbackOp. The position of the log is
+// preserved.
+func (l *Log[State]) CheckLogCompatible() error {
+	unknownKinds := map[int]bool{}
+	unknownNames := map[string]bool{}
+	var kinds, names []string
+	err := l.fromStart(func(r *reader) error {
+		for {
+			data, err := r.next()
+			if errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			frame, err := l.decodeFrame(data)
+			if err != nil {
+				return fmt.Errorf("entry %d: %w", r.index-1, err)
+			}
+			switch {
+			case l.kinds == nil:
+				if !l.knownKind(frame.Kind) && !unknownKinds[frame.Kind] {
+					unknownKinds[frame.Kind] = true
+					kinds = append(kinds, strconv.Itoa(frame.Kind))
+				}
+			case frame.Name == "":
+				return fmt.Errorf("entry %d of kind %d has no name, use MigrateToNamed to convert positional logs", r.index-1, frame.Kind)
+			default:
+				if _, ok := l.kinds[frame.Name]; !ok && !unknownNames[frame.Name] {
+					unknownNames[frame.Name] = true
+					names = append(names, strconv.Quote(frame.Name))
+				}
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if len(kinds) > 0 {
+		return fmt.Errorf("log contains entries of unregistered kinds %s, but only kinds 0-%d are registered", strings.Join(kinds, ", "), len(l.ops)-1)
+	}
+	if len(names) > 0 {
+		return fmt.Errorf("log contains entries of unregistered names %s", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// CheckMonotonicTimestamps returns the indices of entries whose timestamp, as
+// recorded by WithTimestamps, is earlier than that of the entry before them,
+// indicating clock skew or entries appended out of order.
+//
+// This can be used to check that timestamps are monotonic, as ReplayRange
+// assumes, for logs assembled from multiple sources. Entries without a
+// timestamp are ignored. Events are not decoded, and the position of the log
+// is preserved.
+func (l *Log[State]) CheckMonotonicTimestamps() ([]int, error) {
+	var indices []int
+	err := l.fromStart(func(r *reader) error {
+		var prev int64
+		for {
+			data, err := r.next()
+			if errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			frame, err := l.decodeFrame(data)
+			if err != nil {
+				return fmt.Errorf("entry %d: %w", r.index-1, err)
+			}
+			if frame.Time == 0 {
+				continue
+			}
+			if frame.Time < prev {
+				indices = append(indices, r.index-1)
+			}
+			prev = frame.Time
+		}
+	})
+	return indices, err
+}
+
+// validateSchema validates the event of logEntry against the schema for its
+// kind, if any.
+func (l *Log[State]) validateSchema(logEntry Frame) error {
+	schema, ok := l.schemas[logEntry.Kind]
+	if !ok {
+		return nil
+	}
+	var event any
+	dec := json.NewDecoder(bytes.NewReader(logEntry.Event))
+	dec.UseNumber()
+	if err := dec.Decode(&event); err != nil {
+		return fmt.Errorf("could not decode event of kind %d: %w", logEntry.Kind, err)
+	}
+	if err := schema.Validate(event); err != nil {
+		return fmt.Errorf("event of kind %d does not match its schema: %w", logEntry.Kind, err)
+	}
+	return nil
+}
+
+// verifyAppended reads back the entries of the last write, which must have been
+// synced, and checks that they decode to "events", as set by
+// WithVerifyOnAppend. The log is left positioned at its end. Must be called
+// with the lock held.
+func (l *Log[State]) verifyAppended(events []Op[State]) error {
+	if !l.verifyOnAppend {
+		return nil
+	}
+	end, err := l.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to determine log position: %w", err)
+	}
+	start := end - l.lastWrite
+	if _, err := l.f.Seek(start, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek to appended entry: %w", err)
+	}
+	err = l.compareAppended(l.newReader(l.f, start), events)
+	if _, serr := l.f.Seek(end, io.SeekStart); serr != nil && err == nil {
+		err = fmt.Errorf("failed to restore log position: %w", serr)
+	}
+	return err
+}
+
+func (l *Log[State]) compareAppended(r *reader, events []Op[State]) error {
+	for _, event := range events {
+		logEntry, err := l.nextEntry(r)
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("appended %T is missing from the log", event)
+		} else if err != nil {
+			return fmt.Errorf("failed to read back appended %T: %w", event, err)
+		}
+		op, err := l.decodeOp(logEntry)
+		if err != nil {
+			return fmt.Errorf("failed to read back appended %T: %w", event, err)
+		}
+		if !reflect.DeepEqual(op, event) {
+			return fmt.Errorf("appended %T read back as %s", event, logEntry.Event)
+		}
+	}
+	return nil
+}
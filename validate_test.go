@@ -0,0 +1,82 @@
+package replaylog
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestSchemas(t *testing.T) {
+	f := writeTestFile(t, `{"k":0,"e":{"k":"foo","v":"bar"}}`+"\n"+`{"k":0,"e":{"k":"foo","v":1}}`+"\n"+`{"k":1,"e":{"k":"foo"}}`+"\n")
+	log, err := New[KV](f, ops, WithSchemas(map[int]string{
+		0: `{"type":"object","properties":{"k":{"type":"string"},"v":{"type":"string"}},"required":["k","v"]}`,
+	}))
+	assert.NoError(t, err)
+	err = log.Validate()
+	assert.EqualError(t, err, "entry 1: event of kind 0 does not match its schema: jsonschema: '/v' does not validate with replaylog:///kind/0#/properties/v/type: expected string, but got number")
+	err = log.Replay(KV{})
+	assert.Error(t, err)
+
+	_, err = New[KV](f, ops, WithSchemas(map[int]string{2: `{}`}))
+	assert.Error(t, err)
+	_, err = New[KV](f, ops, WithSchemas(map[int]string{0: `{"type":1}`}))
+	assert.Error(t, err)
+}
+
+func TestCheckLogCompatible(t *testing.T) {
+	f := writeTestFile(t, `{"k":0,"e":{"k":"foo","v":"bar"}}`+"\n"+`{"k":3,"e":{}}`+"\n"+`{"k":1,"e":{"k":"foo"}}`+"\n"+`{"k":2,"e":{}}`+"\n"+`{"k":3,"e":{}}`+"\n")
+	log, err := New[KV](f, ops)
+	assert.NoError(t, err)
+	err = log.CheckLogCompatible()
+	assert.EqualError(t, err, "log contains entries of unregistered kinds 3, 2, but only kinds 0-1 are registered")
+
+	log, err = New[KV](f, []Op[KV]{&Set{}, &Delete{}, &swap{}, stopOp{}})
+	assert.NoError(t, err)
+	assert.NoError(t, log.CheckLogCompatible())
+
+	f = writeTestFile(t, `{"k":0,"e":{"k":"foo","v":"bar"},"n":"set"}`+"\n"+`{"k":1,"e":{},"n":"rename"}`+"\n")
+	named, err := NewNamed[KV](f, map[string]Op[KV]{"set": &Set{}, "delete": &Delete{}})
+	assert.NoError(t, err)
+	err = named.CheckLogCompatible()
+	assert.EqualError(t, err, `log contains entries of unregistered names "rename"`)
+}
+
+// corruptingFile replaces "bar" with "baz" in everything written to it.
+type corruptingFile struct{ MemoryFile }
+
+func (c *corruptingFile) Write(p []byte) (int, error) {
+	return c.MemoryFile.Write(bytes.ReplaceAll(p, []byte("bar"), []byte("baz")))
+}
+
+func TestWithVerifyOnAppend(t *testing.T) {
+	log, err := New[KV](&MemoryFile{}, ops, WithVerifyOnAppend())
+	assert.NoError(t, err)
+	assert.NoError(t, log.Append(&Set{Key: "foo", Value: "bar"}))
+	assert.NoError(t, log.AppendAtomic(&Set{Key: "bar", Value: "waz"}, &Delete{Key: "foo"}))
+	assert.NoError(t, log.Append(&Set{Key: "waz", Value: "bar"}))
+	assert.NoError(t, log.Rewind())
+	assert.Equal(t, KV{"bar": "waz", "waz": "bar"}, replay(t, log))
+
+	log, err = New[KV](&corruptingFile{}, ops, WithVerifyOnAppend())
+	assert.NoError(t, err)
+	assert.NoError(t, log.Append(&Set{Key: "foo", Value: "waz"}))
+	err = log.AppendAtomic(&Delete{Key: "foo"}, &Set{Key: "foo", Value: "bar"})
+	assert.EqualError(t, err, `appended *replaylog.Set read back as {"k":"foo","v":"baz"}`)
+}
+
+func TestCheckMonotonicTimestamps(t *testing.T) {
+	f := writeTestFile(t, `{"k":0,"e":{"k":"a","v":"1"},"t":10}
+{"k":0,"e":{"k":"b","v":"2"},"t":20}
+{"k":0,"e":{"k":"c","v":"3"},"t":15}
+{"k":0,"e":{"k":"d","v":"4"}}
+{"k":0,"e":{"k":"e","v":"5"},"t":16}
+{"k":0,"e":{"k":"f","v":"6"},"t":5}
+`)
+	log, err := New[KV](f, ops, WithTimestamps())
+	assert.NoError(t, err)
+	indices, err := log.CheckMonotonicTimestamps()
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 5}, indices)
+	assert.Equal(t, 6, len(replay(t, log)))
+}